@@ -3,6 +3,7 @@ package cmd
 import (
 	"log"
 	"path/filepath"
+	"time"
 )
 
 // Input contains the input for the root command
@@ -14,21 +15,60 @@ type Input struct {
 	eventPath             string
 	reuseContainers       bool
 	bindWorkdir           bool
+	bindHostPath          bool
+	containerWorkspace    string
 	secrets               []string
 	envs                  []string
+	actionEnvs            []string
 	platforms             []string
 	dryrun                bool
 	forcePull             bool
+	forcePullImages       []string
+	pullRetries           int
+	pullRetryBackoff      time.Duration
 	noOutput              bool
-	envfile               string
-	secretfile            string
+	envfiles              []string
+	secretfiles           []string
+	secretPatterns        []string
+	token                 string
+	insecureSkipTLS       bool
+	githubInstance        string
+	caBundle              string
+	vars                  []string
+	varfiles              []string
 	insecureSecrets       bool
 	defaultBranch         string
 	privileged            bool
 	usernsMode            string
 	containerArchitecture string
+	containerDaemonSocket string
+	bindDaemonSocket      bool
 	noWorkflowRecurse     bool
 	useGitIgnore          bool
+	watchIgnore           []string
+	inputs                []string
+	inputfile             string
+	containerOptions      string
+	containerMemory       string
+	containerCPUs         string
+	containerInit         bool
+	containerStopTimeout  time.Duration
+	actionCacheDir        string
+	actionCacheMaxSize    string
+	actionConstraints     bool
+	actionRewrites        []string
+	toolCacheDir          string
+	defaultImage          string
+	noGitContext          bool
+	envExpressions        bool
+	containerShell        string
+	neutralExitCode       int
+	stepOutputEnv         bool
+	beforeStep            string
+	afterStep             string
+	postRun               string
+	noDeps                bool
+	failFastPlan          bool
 }
 
 func (i *Input) resolve(path string) string {
@@ -45,14 +85,32 @@ func (i *Input) resolve(path string) string {
 	return path
 }
 
-// Envfile returns path to .env
-func (i *Input) Envfile() string {
-	return i.resolve(i.envfile)
+func (i *Input) resolveAll(paths []string) []string {
+	resolved := make([]string, 0, len(paths))
+	for _, path := range paths {
+		resolved = append(resolved, i.resolve(path))
+	}
+	return resolved
+}
+
+// Envfiles returns paths to .env files
+func (i *Input) Envfiles() []string {
+	return i.resolveAll(i.envfiles)
+}
+
+// Secretfiles returns paths to secrets files
+func (i *Input) Secretfiles() []string {
+	return i.resolveAll(i.secretfiles)
 }
 
-// Secretfile returns path to secrets
-func (i *Input) Secretfile() string {
-	return i.resolve(i.secretfile)
+// Varfiles returns paths to vars files
+func (i *Input) Varfiles() []string {
+	return i.resolveAll(i.varfiles)
+}
+
+// Inputfile returns path to the workflow_dispatch inputs
+func (i *Input) Inputfile() string {
+	return i.resolve(i.inputfile)
 }
 
 // Workdir returns path to workdir
@@ -65,6 +123,11 @@ func (i *Input) WorkflowsPath() string {
 	return i.resolve(i.workflowsPath)
 }
 
+// CABundle returns the path to the CA bundle
+func (i *Input) CABundle() string {
+	return i.resolve(i.caBundle)
+}
+
 // EventPath returns the path to events file
 func (i *Input) EventPath() string {
 	return i.resolve(i.eventPath)
@@ -2,18 +2,16 @@ package cmd
 
 import (
 	"strings"
+
+	"github.com/nektos/act/pkg/runner"
 )
 
 func (i *Input) newPlatforms() map[string]string {
 	platforms := map[string]string{
-		"ubuntu-latest":  "node:12.20.1-buster-slim",
-		"ubuntu-20.04":   "node:12.20.1-buster-slim",
-		"ubuntu-18.04":   "node:12.20.1-buster-slim",
-		"ubuntu-16.04":   "node:12.20.1-stretch-slim",
-		"windows-latest": "",
-		"windows-2019":   "",
-		"macos-latest":   "",
-		"macos-10.15":    "",
+		"ubuntu-latest": "node:12.20.1-buster-slim",
+		"ubuntu-20.04":  "node:12.20.1-buster-slim",
+		"ubuntu-18.04":  "node:12.20.1-buster-slim",
+		"ubuntu-16.04":  "node:12.20.1-stretch-slim",
 	}
 
 	for _, p := range i.platforms {
@@ -24,3 +22,8 @@ func (i *Input) newPlatforms() map[string]string {
 	}
 	return platforms
 }
+
+// DefaultImage returns the image for jobs whose labels match no platform, a preset (micro, medium or large) or an image
+func (i *Input) DefaultImage() string {
+	return runner.ResolveDefaultImage(i.defaultImage)
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+
+	"github.com/nektos/act/pkg/runner"
+)
+
+// newPostRunHook returns a hook that runs command with sh on the host, with the result of the plan in
+// ACT_RESULT and the results of its jobs as a JSON array in ACT_JOB_RESULTS
+func newPostRunHook(command string) runner.PostRunHook {
+	if command == "" {
+		return nil
+	}
+	return func(ctx context.Context, event runner.PostRunEvent) error {
+		jobs := make([]map[string]string, 0, len(event.Jobs))
+		for _, job := range event.Jobs {
+			jobs = append(jobs, map[string]string{"workflow": job.Workflow, "job": job.JobID, "result": job.Result})
+		}
+		jobResults, err := json.Marshal(jobs)
+		if err != nil {
+			return err
+		}
+
+		cmd := exec.CommandContext(ctx, "sh", "-c", command) // #nosec G204
+		cmd.Env = append(os.Environ(),
+			"ACT_RESULT="+event.Result,
+			"ACT_JOB_RESULTS="+string(jobResults),
+		)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		return cmd.Run()
+	}
+}
@@ -1,23 +1,24 @@
 package cmd
 
 import (
-	"bufio"
 	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strings"
 
 	"github.com/nektos/act/pkg/common"
 
 	"github.com/AlecAivazis/survey/v2"
-	"github.com/andreaskoch/go-fswatch"
+	"github.com/docker/go-units"
 	"github.com/joho/godotenv"
 	"github.com/mitchellh/go-homedir"
-	gitignore "github.com/sabhiram/go-gitignore"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
+	"github.com/nektos/act/pkg/container"
 	"github.com/nektos/act/pkg/model"
 	"github.com/nektos/act/pkg/runner"
 )
@@ -35,18 +36,36 @@ func Execute(ctx context.Context, version string) {
 		SilenceUsage:     true,
 	}
 	rootCmd.Flags().BoolP("watch", "w", false, "watch the contents of the local repo and run when files change")
+	rootCmd.Flags().StringArrayVarP(&input.watchIgnore, "watch-ignore", "", []string{}, "paths whose changes don't trigger a run with --watch, like in a .gitignore, besides .git and those of the .gitignore (e.g. --watch-ignore 'dist/')")
 	rootCmd.Flags().BoolP("list", "l", false, "list workflows")
 	rootCmd.Flags().BoolP("graph", "g", false, "draw workflows")
-	rootCmd.Flags().StringP("job", "j", "", "run job")
+	rootCmd.Flags().StringP("job", "j", "", "run job and the jobs it needs")
+	rootCmd.Flags().BoolVar(&input.failFastPlan, "fail-fast", false, "abort all the jobs once one of them fails, the running jobs are canceled and the others are skipped")
+	rootCmd.Flags().BoolVar(&input.noDeps, "no-deps", false, "run the job of --job without the jobs it needs, it must not use their outputs")
 	rootCmd.Flags().StringArrayVarP(&input.secrets, "secret", "s", []string{}, "secret to make available to actions with optional value (e.g. -s mysecret=foo or -s mysecret)")
+	rootCmd.Flags().StringArrayVarP(&input.vars, "var", "", []string{}, "variable to make available in the vars context (e.g. --var myvar=foo)")
 	rootCmd.Flags().StringArrayVarP(&input.envs, "env", "", []string{}, "env to make available to actions with optional value (e.g. --e myenv=foo or -s myenv)")
+	rootCmd.Flags().StringArrayVarP(&input.actionEnvs, "action-env", "", []string{}, "env to make available to the steps that use an action (not run steps) unless the workflow sets it (e.g. --action-env FORCE_COLOR=1)")
+	rootCmd.Flags().StringArrayVarP(&input.inputs, "input", "", []string{}, "input to the workflow_dispatch event (e.g. --input myinput=foo)")
 	rootCmd.Flags().StringArrayVarP(&input.platforms, "platform", "P", []string{}, "custom image to use per platform (e.g. -P ubuntu-18.04=nektos/act-environments-ubuntu:18.04)")
+	rootCmd.Flags().StringVar(&input.defaultImage, "default-image", "", "image for jobs whose runs-on labels match no platform, micro, medium, large or an image (e.g. --default-image medium)")
 	rootCmd.Flags().BoolVarP(&input.reuseContainers, "reuse", "r", false, "reuse action containers to maintain state")
 	rootCmd.Flags().BoolVarP(&input.bindWorkdir, "bind", "b", false, "bind working directory to container, rather than copy")
+	rootCmd.Flags().BoolVarP(&input.bindHostPath, "bind-host-path", "", false, "with --bind, bind the working directory at its own path in the containers, the WSL path of a windows path, instead of --container-workspace")
+	rootCmd.Flags().StringVar(&input.containerWorkspace, "container-workspace", "", "path of the workspace in the job containers the working directory is copied or bound to, the path of the working directory if not set (e.g. --container-workspace /github/workspace)")
 	rootCmd.Flags().BoolVarP(&input.forcePull, "pull", "p", false, "pull docker image(s) even if already present")
-	rootCmd.Flags().BoolVarP(&input.autodetectEvent, "detect-event", "", false, "Use first event type from workflow as event that triggered the workflow")
+	rootCmd.Flags().IntVar(&input.pullRetries, "pull-retries", 0, "times to retry pulling an image that failed with a network error or an overloaded registry")
+	rootCmd.Flags().DurationVar(&input.pullRetryBackoff, "pull-retry-backoff", container.DefaultPullBackoff, "time to wait before the first retry of a pull, doubled for every further one")
+	rootCmd.Flags().StringArrayVarP(&input.forcePullImages, "pull-image", "", []string{}, "pull docker images matching the glob pattern even if already present (e.g. --pull-image 'node:*')")
+	rootCmd.Flags().BoolVarP(&input.autodetectEvent, "detect-event", "", false, "detect the event from the payload of --eventpath, otherwise use the first event type from workflow as event that triggered the workflow")
 	rootCmd.Flags().StringVarP(&input.eventPath, "eventpath", "e", "", "path to event JSON file")
 	rootCmd.Flags().StringVar(&input.defaultBranch, "defaultbranch", "", "the name of the main branch")
+	rootCmd.Flags().StringVar(&input.beforeStep, "before-step", "", "command to run on the host before every step, with the step in $ACT_WORKFLOW, $ACT_JOB, $ACT_STEP_ID and $ACT_STEP")
+	rootCmd.Flags().StringVar(&input.postRun, "post-run", "", "command to run on the host once all the jobs are done, with success, failure or cancelled in $ACT_RESULT and the results of the jobs in $ACT_JOB_RESULTS")
+	rootCmd.Flags().StringVar(&input.afterStep, "after-step", "", "command to run on the host after every step, like --before-step with the result in $ACT_STEP_OUTCOME and $ACT_STEP_CONCLUSION")
+	rootCmd.Flags().IntVar(&input.neutralExitCode, "neutral-exit-code", 0, "exit code of a step that skips it instead of failing the job, like the neutral result (78) of legacy actions")
+	rootCmd.Flags().BoolVar(&input.stepOutputEnv, "step-output-env", false, "expose the outputs of the previous steps to the later steps as $STEPS_<ID>_<OUTPUT> env vars")
+	rootCmd.Flags().BoolVar(&input.noGitContext, "no-git-context", false, "don't read the ref, sha and repository of the github context and the event payload from the git repository")
 	rootCmd.Flags().BoolVar(&input.privileged, "privileged", false, "use privileged mode")
 	rootCmd.Flags().StringVar(&input.usernsMode, "userns", "", "user namespace to use")
 	rootCmd.Flags().BoolVar(&input.useGitIgnore, "use-gitignore", true, "Controls whether paths specified in .gitignore should be copied into container")
@@ -56,11 +75,32 @@ func Execute(ctx context.Context, version string) {
 	rootCmd.PersistentFlags().StringVarP(&input.workdir, "directory", "C", ".", "working directory")
 	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "verbose output")
 	rootCmd.PersistentFlags().BoolVarP(&input.noOutput, "quiet", "q", false, "disable logging of output from steps")
-	rootCmd.PersistentFlags().BoolVarP(&input.dryrun, "dryrun", "n", false, "dryrun mode")
-	rootCmd.PersistentFlags().StringVarP(&input.secretfile, "secret-file", "", ".secrets", "file with list of secrets to read from (e.g. --secret-file .secrets)")
-	rootCmd.PersistentFlags().BoolVarP(&input.insecureSecrets, "insecure-secrets", "", false, "NOT RECOMMENDED! Doesn't hide secrets while printing logs.")
-	rootCmd.PersistentFlags().StringVarP(&input.envfile, "env-file", "", ".env", "environment file to read and use as env in the containers")
+	rootCmd.PersistentFlags().BoolVarP(&input.dryrun, "dryrun", "n", false, "evaluate the conditions and env of the steps and log what would run, without creating containers or executing commands")
+	rootCmd.PersistentFlags().StringArrayVarP(&input.secretPatterns, "secret-pattern", "", []string{}, "regular expression of values to mask in the output like secrets, can be repeated (e.g. --secret-pattern 'AKIA[0-9A-Z]{16}')")
+	rootCmd.PersistentFlags().StringVarP(&input.token, "token", "", "", "token for github.token and $GITHUB_TOKEN of the steps and to clone private remote actions with, also the default of secrets.GITHUB_TOKEN")
+	rootCmd.PersistentFlags().StringVarP(&input.githubInstance, "github-instance", "", "github.com", "host of the GitHub instance for the github context and to clone remote actions from, e.g. of a GitHub Enterprise Server (e.g. --github-instance github.mycompany.com)")
+	rootCmd.PersistentFlags().BoolVarP(&input.insecureSkipTLS, "insecure-skip-tls", "", false, "NOT RECOMMENDED! Doesn't verify the TLS certificates of the servers remote actions are cloned from.")
+	rootCmd.PersistentFlags().StringVarP(&input.caBundle, "ca-bundle", "", "", "PEM file with the certificates of private CAs to verify the servers remote actions are cloned from with, besides those of the system")
+	rootCmd.PersistentFlags().StringArrayVarP(&input.secretfiles, "secret-file", "", []string{".secrets"}, "file with list of secrets to read from, can be repeated with later files overriding earlier ones (e.g. --secret-file .secrets)")
+	rootCmd.PersistentFlags().BoolVarP(&input.insecureSecrets, "insecure-secrets", "", false, "NOT RECOMMENDED! Doesn't hide secrets and the values of ::add-mask:: while printing logs, e.g. to debug a secret")
+	rootCmd.PersistentFlags().StringArrayVarP(&input.varfiles, "var-file", "", []string{".vars"}, "file with list of variables for the vars context, can be repeated with later files overriding earlier ones (e.g. --var-file .vars)")
+	rootCmd.PersistentFlags().BoolVar(&input.envExpressions, "env-expressions", false, "evaluate expressions like ${{ github.ref_name }} in the values of --env and --env-file")
+	rootCmd.PersistentFlags().StringArrayVarP(&input.envfiles, "env-file", "", []string{".env"}, "environment file to read and use as env in the containers, can be repeated with later files overriding earlier ones")
+	rootCmd.PersistentFlags().StringVarP(&input.inputfile, "input-file", "", ".input", "input file to read and use as workflow_dispatch inputs, either in .env format or as a JSON object")
+	rootCmd.PersistentFlags().StringVarP(&input.containerShell, "container-shell", "", "", "shell to keep the job container alive and to run steps without a shell with, bash or else sh is used if not set (e.g. --container-shell /bin/bash)")
+	rootCmd.PersistentFlags().StringVarP(&input.containerOptions, "container-options", "", "", "extra docker create options for every container, applied before the options of the workflow (e.g. --container-options \"--add-host=registry:10.0.0.1 --dns 10.0.0.53\")")
+	rootCmd.PersistentFlags().StringVarP(&input.containerMemory, "container-memory", "", "", "default memory limit of every container, overridden by --memory in the options of the workflow (e.g. --container-memory 512m)")
+	rootCmd.PersistentFlags().StringVarP(&input.containerCPUs, "container-cpus", "", "", "default number of CPUs of every container, overridden by --cpus in the options of the workflow (e.g. --container-cpus 2)")
+	rootCmd.PersistentFlags().BoolVar(&input.containerInit, "container-init", false, "run an init process in every container that reaps zombie processes and forwards signals, overridden by --init in the options of the workflow")
+	rootCmd.PersistentFlags().DurationVar(&input.containerStopTimeout, "container-stop-timeout", runner.DefaultContainerStopTimeout, "time the processes of the containers have to exit after SIGTERM when they are removed, before they are killed, a negative timeout kills them at once")
+	rootCmd.PersistentFlags().StringVarP(&input.actionCacheDir, "action-cache-dir", "", "", "directory to store remote actions in (default $XDG_CACHE_HOME/act)")
+	rootCmd.PersistentFlags().StringVarP(&input.actionCacheMaxSize, "action-cache-max-size", "", "", "evict the least recently used remote actions when the action cache grows beyond this size (e.g. --action-cache-max-size 1g)")
+	rootCmd.PersistentFlags().StringArrayVarP(&input.actionRewrites, "action-rewrite", "", []string{}, "clone the remote actions of an owner or owner/repo from another one, can be repeated (e.g. --action-rewrite actions=my-mirror)")
+	rootCmd.PersistentFlags().BoolVar(&input.actionConstraints, "action-version-constraints", false, "resolve semver constraints in the refs of remote actions to the highest matching tag (e.g. uses: org/action@^1.2.0)")
+	rootCmd.PersistentFlags().StringVarP(&input.toolCacheDir, "tool-cache-dir", "", "", "directory on the host to mount as $RUNNER_TOOL_CACHE, so the tools setup actions download are kept across runs (default the tool cache of the image)")
 	rootCmd.PersistentFlags().StringVarP(&input.containerArchitecture, "container-architecture", "", "", "Architecture which should be used to run containers, e.g.: linux/amd64. If not specified, will use host default architecture. Requires Docker server API Version 1.41+. Ignored on earlier Docker server platforms.")
+	rootCmd.PersistentFlags().StringVarP(&input.containerDaemonSocket, "container-daemon-socket", "", "", "socket of the daemon to create the containers with (e.g. tcp://host:2376 or unix:///run/user/1000/podman/podman.sock), $DOCKER_HOST or the docker socket, else the one of Podman, if not set")
+	rootCmd.PersistentFlags().BoolVarP(&input.bindDaemonSocket, "bind-socket", "", false, "INSECURE: bind the socket of the container daemon into the containers and set $DOCKER_HOST to it, e.g. for docker build steps, the steps can control the daemon")
 	rootCmd.SetArgs(args())
 
 	if err := rootCmd.Execute(); err != nil {
@@ -69,24 +109,16 @@ func Execute(ctx context.Context, version string) {
 }
 
 func configLocations() []string {
+	return runner.ConfigFiles(".")
+}
+
+// userConfigLocation is the .actrc in the home directory the default image survey saves the platforms to
+func userConfigLocation() string {
 	home, err := homedir.Dir()
 	if err != nil {
 		log.Fatal(err)
 	}
-
-	// reference: https://specifications.freedesktop.org/basedir-spec/latest/ar01s03.html
-	var actrcXdg string
-	if xdg, ok := os.LookupEnv("XDG_CONFIG_HOME"); ok && xdg != "" {
-		actrcXdg = filepath.Join(xdg, ".actrc")
-	} else {
-		actrcXdg = filepath.Join(home, ".config", ".actrc")
-	}
-
-	return []string{
-		filepath.Join(home, ".actrc"),
-		actrcXdg,
-		filepath.Join(".", ".actrc"),
-	}
+	return filepath.Join(home, ".actrc")
 }
 
 func args() []string {
@@ -102,23 +134,10 @@ func args() []string {
 }
 
 func readArgsFile(file string) []string {
-	args := make([]string, 0)
-	f, err := os.Open(file)
+	args, err := runner.ReadConfigFile(file)
 	if err != nil {
-		return args
-	}
-	defer func() {
-		err := f.Close()
-		if err != nil {
-			log.Errorf("Failed to close args file: %v", err)
-		}
-	}()
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		arg := scanner.Text()
-		if strings.HasPrefix(arg, "-") {
-			args = append(args, regexp.MustCompile(`\s`).Split(arg, 2)...)
-		}
+		log.Errorf("Failed to read args file: %v", err)
+		return []string{}
 	}
 	return args
 }
@@ -144,9 +163,61 @@ func readEnvs(path string, envs map[string]string) bool {
 	return false
 }
 
+func newEnvFiles(paths []string, optional bool) []runner.EnvFile {
+	files := make([]runner.EnvFile, 0, len(paths))
+	for _, path := range paths {
+		files = append(files, runner.EnvFile{Path: path, Optional: optional})
+	}
+	return files
+}
+
+func readInputs(path string, inputs map[string]string) bool {
+	if filepath.Ext(path) != ".json" {
+		return readEnvs(path, inputs)
+	}
+	if _, err := os.Stat(path); err == nil {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Fatalf("Error loading from %s: %v", path, err)
+		}
+		values := make(map[string]interface{})
+		if err := json.Unmarshal(content, &values); err != nil {
+			log.Fatalf("Error loading from %s: %v", path, err)
+		}
+		for k, v := range values {
+			inputs[k] = fmt.Sprintf("%v", v)
+		}
+		return true
+	}
+	return false
+}
+
+// readEventPayload reads the payload the workflow filters are evaluated against from the event file,
+// nil without an event file. The current git ref is used if the payload of a push has none.
+func readEventPayload(input *Input, eventName string) (*model.EventPayload, error) {
+	if input.EventPath() == "" {
+		return nil, nil
+	}
+	content, err := ioutil.ReadFile(input.EventPath())
+	if err != nil {
+		return nil, err
+	}
+	payload, err := model.ParseEventPayload(eventName, content)
+	if err != nil {
+		return nil, err
+	}
+	if payload.Ref == "" && eventName == "push" {
+		if ref, err := common.FindGitRef(input.Workdir()); err == nil {
+			payload.Ref = ref
+		} else {
+			log.Debugf("Unable to find the git ref of %s: %v", input.Workdir(), err)
+		}
+	}
+	return payload, nil
+}
+
 func newRunCommand(ctx context.Context, input *Input) func(*cobra.Command, []string) error {
 	return func(cmd *cobra.Command, args []string) error {
-		log.Debugf("Loading environment from %s", input.Envfile())
 		envs := make(map[string]string)
 		if input.envs != nil {
 			for _, envVar := range input.envs {
@@ -158,11 +229,51 @@ func newRunCommand(ctx context.Context, input *Input) func(*cobra.Command, []str
 				}
 			}
 		}
-		_ = readEnvs(input.Envfile(), envs)
+		actionEnvs := make(map[string]string)
+		for _, envVar := range input.actionEnvs {
+			e := strings.SplitN(envVar, `=`, 2)
+			if len(e) == 2 {
+				actionEnvs[e[0]] = e[1]
+			} else {
+				actionEnvs[e[0]] = ""
+			}
+		}
+		actionRewrites := make(map[string]string)
+		for _, rewrite := range input.actionRewrites {
+			r := strings.SplitN(rewrite, `=`, 2)
+			if len(r) != 2 || r[0] == "" || r[1] == "" {
+				return fmt.Errorf("invalid --action-rewrite '%s', it must be from=to", rewrite)
+			}
+			actionRewrites[r[0]] = r[1]
+		}
+		// the default files are optional, files given explicitly must exist
+		envfiles := newEnvFiles(input.Envfiles(), !cmd.Flag("env-file").Changed)
 
-		log.Debugf("Loading secrets from %s", input.Secretfile())
 		secrets := newSecrets(input.secrets)
-		_ = readEnvs(input.Secretfile(), secrets)
+		secretfiles := newEnvFiles(input.Secretfiles(), !cmd.Flag("secret-file").Changed)
+
+		vars := make(map[string]string)
+		for _, varVar := range input.vars {
+			e := strings.SplitN(varVar, `=`, 2)
+			if len(e) == 2 {
+				vars[e[0]] = e[1]
+			} else {
+				vars[e[0]] = ""
+			}
+		}
+		varfiles := newEnvFiles(input.Varfiles(), !cmd.Flag("var-file").Changed)
+
+		log.Debugf("Loading inputs from %s", input.Inputfile())
+		inputs := make(map[string]string)
+		for _, inputVar := range input.inputs {
+			e := strings.SplitN(inputVar, `=`, 2)
+			if len(e) == 2 {
+				inputs[e[0]] = e[1]
+			} else {
+				inputs[e[0]] = ""
+			}
+		}
+		_ = readInputs(input.Inputfile(), inputs)
 
 		planner, err := model.NewWorkflowPlanner(input.WorkflowsPath(), input.noWorkflowRecurse)
 		if err != nil {
@@ -172,29 +283,50 @@ func newRunCommand(ctx context.Context, input *Input) func(*cobra.Command, []str
 		// Determine the event name
 		var eventName string
 		events := planner.GetEvents()
-		if input.autodetectEvent && len(events) > 0 {
+		if len(args) > 0 {
+			eventName = args[0]
+		}
+		if input.autodetectEvent && input.EventPath() != "" {
+			// the event is resolved before planning, the plan is the one of the detected event
+			if detected, err := runner.ResolveEventName(input.EventPath(), eventName, log.StandardLogger()); err != nil {
+				log.Infof("Using the first event of the workflows, %v", err)
+			} else {
+				eventName = detected
+			}
+		}
+		if eventName == "" && input.autodetectEvent && len(events) > 0 {
 			// set default event type to first event
 			// this way user dont have to specify the event.
 			log.Debugf("Using detected workflow event: %s", events[0])
 			eventName = events[0]
-		} else {
-			if len(args) > 0 {
-				eventName = args[0]
-			} else if plan := planner.PlanEvent("push"); plan != nil {
+		} else if eventName == "" {
+			if plan := planner.PlanEvent("push"); plan != nil {
 				eventName = "push"
 			}
 		}
 
+		if eventName != "" {
+			if err := model.ValidateEventName(eventName); err != nil {
+				return err
+			}
+		}
+
 		// build the plan for this run
 		var plan *model.Plan
 		if jobID, err := cmd.Flags().GetString("job"); err != nil {
 			return err
 		} else if jobID != "" {
 			log.Debugf("Planning job: %s", jobID)
-			plan = planner.PlanJob(jobID)
+			if plan, err = planner.PlanAll().FilterJob(jobID, input.noDeps); err != nil {
+				return err
+			}
 		} else {
 			log.Debugf("Planning event: %s", eventName)
-			plan = planner.PlanEvent(eventName)
+			payload, err := readEventPayload(input, eventName)
+			if err != nil {
+				return err
+			}
+			plan = planner.PlanEventWithPayload(eventName, payload)
 		}
 
 		// check if we should just list the workflows
@@ -217,8 +349,8 @@ func newRunCommand(ctx context.Context, input *Input) func(*cobra.Command, []str
 			return err
 		}
 
-		// Check if platforms flag is set, if not, run default image survey
-		if len(input.platforms) == 0 {
+		// Check if platforms or default image flag is set, if not, run default image survey
+		if len(input.platforms) == 0 && input.defaultImage == "" {
 			cfgFound := false
 			cfgLocations := configLocations()
 			for _, v := range cfgLocations {
@@ -228,10 +360,17 @@ func newRunCommand(ctx context.Context, input *Input) func(*cobra.Command, []str
 				}
 			}
 			if !cfgFound && len(cfgLocations) > 0 {
-				if err := defaultImageSurvey(cfgLocations[0]); err != nil {
+				if err := defaultImageSurvey(userConfigLocation()); err != nil {
 					log.Fatal(err)
 				}
-				input.platforms = readArgsFile(cfgLocations[0])
+				input.platforms = readArgsFile(userConfigLocation())
+			}
+		}
+
+		var actionCacheMaxSize int64
+		if input.actionCacheMaxSize != "" {
+			if actionCacheMaxSize, err = units.RAMInBytes(input.actionCacheMaxSize); err != nil {
+				return fmt.Errorf("invalid --action-cache-max-size '%s': %w", input.actionCacheMaxSize, err)
 			}
 		}
 
@@ -242,18 +381,57 @@ func newRunCommand(ctx context.Context, input *Input) func(*cobra.Command, []str
 			EventPath:             input.EventPath(),
 			DefaultBranch:         defaultbranch,
 			ForcePull:             input.forcePull,
+			ForcePullImages:       input.forcePullImages,
+			PullRetries:           input.pullRetries,
+			PullRetryBackoff:      input.pullRetryBackoff,
 			ReuseContainers:       input.reuseContainers,
 			Workdir:               input.Workdir(),
 			BindWorkdir:           input.bindWorkdir,
+			BindHostPath:          input.bindHostPath,
+			ContainerWorkspace:    input.containerWorkspace,
 			LogOutput:             !input.noOutput,
 			Env:                   envs,
+			StepEnvOverride:       actionEnvs,
 			Secrets:               secrets,
+			EnvFiles:              envfiles,
+			SecretFiles:           secretfiles,
+			Vars:                  vars,
+			VarFiles:              varfiles,
 			InsecureSecrets:       input.insecureSecrets,
+			SecretPatterns:        input.secretPatterns,
+			Token:                 input.token,
+			InsecureSkipTLS:       input.insecureSkipTLS,
+			GitHubInstance:        input.githubInstance,
+			CABundle:              input.CABundle(),
 			Platforms:             input.newPlatforms(),
+			DefaultImage:          input.DefaultImage(),
 			Privileged:            input.privileged,
 			UsernsMode:            input.usernsMode,
 			ContainerArchitecture: input.containerArchitecture,
+			ContainerDaemonSocket: input.containerDaemonSocket,
+			BindDaemonSocket:      input.bindDaemonSocket,
 			UseGitIgnore:          input.useGitIgnore,
+			Inputs:                inputs,
+			ContainerOptions:      input.containerOptions,
+			ContainerMemory:       input.containerMemory,
+			ContainerCPUs:         input.containerCPUs,
+			ContainerInit:         input.containerInit,
+			ContainerStopTimeout:  input.containerStopTimeout,
+			ActionCacheDir:        input.actionCacheDir,
+			ToolCacheDir:          input.toolCacheDir,
+			ActionCacheMaxSize:    actionCacheMaxSize,
+			ActionRefConstraints:  input.actionConstraints,
+			ActionRewrites:        actionRewrites,
+			NoGitContext:          input.noGitContext,
+			EnvExpressions:        input.envExpressions,
+			ContainerDefaultShell: input.containerShell,
+			NeutralExitCode:       input.neutralExitCode,
+			StepOutputEnv:         input.stepOutputEnv,
+			BeforeStep:            newStepHook(input.beforeStep),
+			AfterStep:             newStepHook(input.afterStep),
+			PostRun:               newPostRunHook(input.postRun),
+			DryRun:                input.dryrun,
+			FailFastPlan:          input.failFastPlan,
 		}
 		r, err := runner.New(config)
 		if err != nil {
@@ -264,7 +442,10 @@ func newRunCommand(ctx context.Context, input *Input) func(*cobra.Command, []str
 		if watch, err := cmd.Flags().GetBool("watch"); err != nil {
 			return err
 		} else if watch {
-			return watchAndRun(ctx, r.NewPlanExecutor(plan))
+			return runner.NewWatchExecutor(runner.WatchOptions{
+				Dir:    input.Workdir(),
+				Ignore: input.watchIgnore,
+			}, r.NewPlanExecutor(plan))(ctx)
 		}
 
 		return r.NewPlanExecutor(plan)(ctx)
@@ -313,47 +494,3 @@ func defaultImageSurvey(actrc string) error {
 
 	return nil
 }
-
-func watchAndRun(ctx context.Context, fn common.Executor) error {
-	recurse := true
-	checkIntervalInSeconds := 2
-	dir, err := os.Getwd()
-	if err != nil {
-		return err
-	}
-
-	var ignore *gitignore.GitIgnore
-	if _, err := os.Stat(filepath.Join(dir, ".gitignore")); !os.IsNotExist(err) {
-		ignore, _ = gitignore.CompileIgnoreFile(filepath.Join(dir, ".gitignore"))
-	} else {
-		ignore = &gitignore.GitIgnore{}
-	}
-
-	folderWatcher := fswatch.NewFolderWatcher(
-		dir,
-		recurse,
-		ignore.MatchesPath,
-		checkIntervalInSeconds,
-	)
-
-	folderWatcher.Start()
-
-	go func() {
-		for folderWatcher.IsRunning() {
-			if err = fn(ctx); err != nil {
-				break
-			}
-			log.Debugf("Watching %s for changes", dir)
-			for changes := range folderWatcher.ChangeDetails() {
-				log.Debugf("%s", changes.String())
-				if err = fn(ctx); err != nil {
-					break
-				}
-				log.Debugf("Watching %s for changes", dir)
-			}
-		}
-	}()
-	<-ctx.Done()
-	folderWatcher.Stop()
-	return err
-}
@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/exec"
+
+	"github.com/nektos/act/pkg/runner"
+)
+
+// newStepHook returns a hook that runs command with sh on the host, with the step in ACT_* variables
+func newStepHook(command string) runner.StepHook {
+	if command == "" {
+		return nil
+	}
+	return func(ctx context.Context, event runner.StepHookEvent) error {
+		cmd := exec.CommandContext(ctx, "sh", "-c", command) // #nosec G204
+		cmd.Env = append(os.Environ(),
+			"ACT_WORKFLOW="+event.Workflow,
+			"ACT_JOB_ID="+event.JobID,
+			"ACT_JOB="+event.Job,
+			"ACT_STEP_ID="+event.StepID,
+			"ACT_STEP="+event.Step,
+			"ACT_STEP_OUTCOME="+event.Outcome,
+			"ACT_STEP_CONCLUSION="+event.Conclusion,
+		)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		return cmd.Run()
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"os"
 	"os/signal"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
 
 	"github.com/nektos/act/cmd"
 )
@@ -14,9 +17,10 @@ func main() {
 	ctx := context.Background()
 	ctx, cancel := context.WithCancel(ctx)
 
-	// trap Ctrl+C and call cancel on the context
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
+	// trap Ctrl+C and SIGTERM and call cancel on the context, so the containers are cleaned up
+	// before act exits. A second signal exits right away.
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	defer func() {
 		signal.Stop(c)
 		cancel()
@@ -24,9 +28,13 @@ func main() {
 	go func() {
 		select {
 		case <-c:
+			log.Warn("Interrupted, cleaning up. Interrupt again to exit without cleaning up")
 			cancel()
 		case <-ctx.Done():
+			return
 		}
+		<-c
+		os.Exit(1)
 	}()
 
 	// run the command
@@ -0,0 +1,33 @@
+package common
+
+import (
+	"context"
+	"time"
+)
+
+// uncanceledContext has the values of its parent, but not its deadline and cancellation
+type uncanceledContext struct {
+	parent context.Context
+}
+
+func (uncanceledContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (uncanceledContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (uncanceledContext) Err() error {
+	return nil
+}
+
+func (c uncanceledContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
+// WithoutCancel returns a context with the values of ctx, like the logger and dryrun, that is not
+// canceled when ctx is, for the cleanups that have to run after a run is interrupted
+func WithoutCancel(ctx context.Context) context.Context {
+	return uncanceledContext{parent: ctx}
+}
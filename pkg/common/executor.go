@@ -92,19 +92,32 @@ func NewErrorExecutor(err error) Executor {
 
 // NewParallelExecutor creates a new executor from a parallel of other executors
 func NewParallelExecutor(executors ...Executor) Executor {
+	return NewLimitedParallelExecutor(len(executors), executors...)
+}
+
+// NewLimitedParallelExecutor creates a new executor from a parallel of other executors, running no more than
+// parallel of them at once. Executors are dispatched in the order they are given.
+func NewLimitedParallelExecutor(parallel int, executors ...Executor) Executor {
+	if parallel < 1 {
+		parallel = 1
+	}
 	return func(ctx context.Context) error {
-		errChan := make(chan error)
+		work := make(chan Executor, len(executors))
+		errChan := make(chan error, len(executors))
 
-		for _, executor := range executors {
-			e := executor
+		for i := 0; i < parallel; i++ {
 			go func() {
-				err := e.ChannelError(errChan)(ctx)
-				if err != nil {
-					log.Fatal(err)
+				for e := range work {
+					errChan <- e(ctx)
 				}
 			}()
 		}
 
+		for _, executor := range executors {
+			work <- executor
+		}
+		close(work)
+
 		// Executor waits all executors to cleanup these resources.
 		var firstErr error
 		for i := 0; i < len(executors); i++ {
@@ -186,6 +199,21 @@ func (e Executor) Finally(finally Executor) Executor {
 	}
 }
 
+// OnCancel adds an executor to run after this executor if ctx was canceled. It runs with a context
+// that is not canceled, so it can remove what this executor created before it was interrupted.
+func (e Executor) OnCancel(cleanup Executor) Executor {
+	return func(ctx context.Context) error {
+		err := e(ctx)
+		if ctx.Err() == nil {
+			return err
+		}
+		if err2 := cleanup(WithoutCancel(ctx)); err2 != nil {
+			return fmt.Errorf("Error occurred running cleanup: %v (original error: %v)", err2, err)
+		}
+		return err
+	}
+}
+
 // Not return an inverted conditional
 func (c Conditional) Not() Conditional {
 	return func(ctx context.Context) bool {
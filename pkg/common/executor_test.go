@@ -3,7 +3,9 @@ package common
 import (
 	"context"
 	"fmt"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -127,3 +129,91 @@ func TestNewParallelExecutorCanceled(t *testing.T) {
 	assert.Equal(3, count)
 	assert.Error(errExpected, err)
 }
+
+func TestNewLimitedParallelExecutor(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	workflow := func(ctx context.Context) error {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	}
+
+	executors := make([]Executor, 0)
+	for i := 0; i < 9; i++ {
+		executors = append(executors, workflow)
+	}
+
+	err := NewLimitedParallelExecutor(3, executors...)(ctx)
+	assert.Nil(err)
+	assert.Equal(3, maxRunning)
+
+	maxRunning = 0
+	err = NewLimitedParallelExecutor(1, executors...)(ctx)
+	assert.Nil(err)
+	assert.Equal(1, maxRunning)
+}
+
+func TestNewLimitedParallelExecutorOrder(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx := context.Background()
+
+	order := make([]int, 0)
+	executors := make([]Executor, 0)
+	for i := 0; i < 5; i++ {
+		i := i
+		executors = append(executors, func(ctx context.Context) error {
+			order = append(order, i)
+			return nil
+		})
+	}
+
+	err := NewLimitedParallelExecutor(1, executors...)(ctx)
+	assert.Nil(err)
+	assert.Equal([]int{0, 1, 2, 3, 4}, order)
+}
+
+func TestExecutorOnCancel(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx, cancel := context.WithCancel(WithDryrun(context.Background(), true))
+	defer cancel()
+
+	cleanups := 0
+	cleanup := func(ctx context.Context) error {
+		cleanups++
+		assert.Nil(ctx.Err())
+		assert.True(Dryrun(ctx))
+		return nil
+	}
+
+	err := NewPipelineExecutor(func(ctx context.Context) error {
+		return nil
+	}).OnCancel(cleanup)(ctx)
+	assert.Nil(err)
+	assert.Equal(0, cleanups)
+
+	err = NewPipelineExecutor(func(ctx context.Context) error {
+		cancel()
+		return nil
+	}, func(ctx context.Context) error {
+		return fmt.Errorf("not canceled")
+	}).OnCancel(cleanup)(ctx)
+	assert.ErrorIs(err, context.Canceled)
+	assert.Equal(1, cleanups)
+}
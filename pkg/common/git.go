@@ -2,19 +2,27 @@ package common
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	nethttp "net/http"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 
+	"github.com/Masterminds/semver"
 	git "github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
 	"github.com/go-ini/ini"
 	log "github.com/sirupsen/logrus"
 )
@@ -24,7 +32,10 @@ var (
 	codeCommitSSHRegex  = regexp.MustCompile(`ssh://git-codecommit\.(.+)\.amazonaws.com/v1/repos/(.+)$`)
 	githubHTTPRegex     = regexp.MustCompile(`^https?://.*github.com.*/(.+)/(.+?)(?:.git)?$`)
 	githubSSHRegex      = regexp.MustCompile(`github.com[:/](.+)/(.+).git$`)
+	majorVersionRegex   = regexp.MustCompile(`^v(\d+)$`)
 
+	// cloneLock serializes the clones, which are the go-git https operations of act, so the https
+	// protocol of go-git a clone installs isn't used by another one
 	cloneLock sync.Mutex
 )
 
@@ -141,13 +152,14 @@ func findGitPrettyRef(head, root, sub string) (string, error) {
 	return name, err
 }
 
-// FindGithubRepo get the repo
-func FindGithubRepo(file string) (string, error) {
+// FindGithubRepo get the repo, githubInstance is the host of a GitHub Enterprise Server the origin may be on
+// besides github.com (e.g. github.mycompany.com)
+func FindGithubRepo(file string, githubInstance string) (string, error) {
 	url, err := findGitRemoteURL(file)
 	if err != nil {
 		return "", err
 	}
-	_, slug, err := findGitSlug(url)
+	_, slug, err := findGitSlug(url, githubInstance)
 	return slug, err
 }
 
@@ -174,7 +186,7 @@ func findGitRemoteURL(file string) (string, error) {
 	return url, nil
 }
 
-func findGitSlug(url string) (string, string, error) {
+func findGitSlug(url string, githubInstance string) (string, string, error) {
 	if matches := codeCommitHTTPRegex.FindStringSubmatch(url); matches != nil {
 		return "CodeCommit", matches[2], nil
 	} else if matches := codeCommitSSHRegex.FindStringSubmatch(url); matches != nil {
@@ -183,6 +195,15 @@ func findGitSlug(url string) (string, string, error) {
 		return "GitHub", fmt.Sprintf("%s/%s", matches[1], matches[2]), nil
 	} else if matches := githubSSHRegex.FindStringSubmatch(url); matches != nil {
 		return "GitHub", fmt.Sprintf("%s/%s", matches[1], matches[2]), nil
+	} else if githubInstance != "" && githubInstance != "github.com" {
+		instance := regexp.QuoteMeta(githubInstance)
+		gheHTTPRegex := regexp.MustCompile(fmt.Sprintf(`^https?://%s/(.+)/(.+?)(?:.git)?$`, instance))
+		gheSSHRegex := regexp.MustCompile(fmt.Sprintf(`%s[:/](.+)/(.+?)(?:.git)?$`, instance))
+		if matches := gheHTTPRegex.FindStringSubmatch(url); matches != nil {
+			return "GitHub", fmt.Sprintf("%s/%s", matches[1], matches[2]), nil
+		} else if matches := gheSSHRegex.FindStringSubmatch(url); matches != nil {
+			return "GitHub", fmt.Sprintf("%s/%s", matches[1], matches[2]), nil
+		}
 	}
 	return "", url, nil
 }
@@ -221,6 +242,49 @@ type NewGitCloneExecutorInput struct {
 	URL string
 	Ref string
 	Dir string
+
+	VersionConstraint bool               // Ref may be a semver constraint like ^1.2.0, which is resolved to the highest tag satisfying it
+	Token             string             // token to authenticate to URL with over https, e.g. for private repositories
+	InsecureSkipTLS   bool               // INSECURE: don't verify the TLS certificate of URL, anyone in between can read the token and change the action
+	CABundle          string             // path to a PEM file with the certificates of CAs to verify the TLS certificate of URL with besides those of the system
+	MajorVersions     *MajorVersionCache // shas the major version refs like v2 were resolved to before, they are resolved each time if nil
+}
+
+// httpClient returns the client to clone input.URL with over https, nil for the default one if the TLS
+// certificate of the server is verified with the CAs of the system
+func (input NewGitCloneExecutorInput) httpClient() (*nethttp.Client, error) {
+	if !input.InsecureSkipTLS && input.CABundle == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: input.InsecureSkipTLS} // #nosec G402
+	if input.CABundle != "" {
+		pem, err := ioutil.ReadFile(input.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in the CA bundle %s", input.CABundle)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	transport := nethttp.DefaultTransport.(*nethttp.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &nethttp.Client{Transport: transport}, nil
+}
+
+// auth returns the credentials to clone and fetch input.URL with, nil without a token
+func (input NewGitCloneExecutorInput) auth() transport.AuthMethod {
+	if input.Token == "" || !strings.HasPrefix(input.URL, "https://") {
+		return nil
+	}
+	// GitHub accepts a token as the password with any username
+	return &http.BasicAuth{Username: "x-access-token", Password: input.Token}
 }
 
 // CloneIfRequired ...
@@ -239,6 +303,7 @@ func CloneIfRequired(ctx context.Context, refName plumbing.ReferenceName, input
 
 		r, err = git.PlainCloneContext(ctx, input.Dir, false, &git.CloneOptions{
 			URL:      input.URL,
+			Auth:     input.auth(),
 			Progress: progressWriter,
 		})
 		if err != nil {
@@ -251,6 +316,207 @@ func CloneIfRequired(ctx context.Context, refName plumbing.ReferenceName, input
 	return r, nil
 }
 
+// resolveGitRef determines whether ref is a tag, a branch or a sha. A ref can name both
+// a tag and a branch, in which case the tag is used like GitHub and git itself do
+func resolveGitRef(logger log.FieldLogger, r *git.Repository, ref string) (string, plumbing.Revision, error) {
+	tagName := plumbing.NewTagReferenceName(ref)
+	_, err := r.Reference(tagName, false)
+	isTag := err == nil
+	if err != nil && !errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return "", "", err
+	}
+
+	branchName := plumbing.NewRemoteReferenceName("origin", ref)
+	_, err = r.Reference(branchName, false)
+	isBranch := err == nil
+	if err != nil && !errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return "", "", err
+	}
+
+	switch {
+	case isTag && isBranch:
+		logger.Infof("  \u2601  ref '%s' is both a tag and a branch, using the tag", ref)
+		return "tag", plumbing.Revision(tagName), nil
+	case isTag:
+		logger.Debugf("ref '%s' is a tag", ref)
+		return "tag", plumbing.Revision(tagName), nil
+	case isBranch:
+		logger.Debugf("ref '%s' is a branch", ref)
+		return "branch", plumbing.Revision(branchName), nil
+	}
+	logger.Debugf("ref '%s' is neither a tag nor a branch, using it as a sha", ref)
+	return "sha", plumbing.Revision(ref), nil
+}
+
+// IsVersionConstraint returns true if ref is a semver constraint like ^1.2.0, ~1.2 or >= 1.0.0, < 2
+// rather than the name of a tag, a branch or a sha
+func IsVersionConstraint(ref string) bool {
+	if !strings.ContainsAny(ref, "^~<>=*| ") {
+		return false
+	}
+	_, err := semver.NewConstraint(ref)
+	return err == nil
+}
+
+// ResolveVersionConstraint returns the highest of tags that is a semver version satisfying constraint.
+// The tags that aren't semver versions are ignored.
+func ResolveVersionConstraint(constraint string, tags []string) (string, error) {
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return "", fmt.Errorf("invalid version constraint '%s': %w", constraint, err)
+	}
+
+	var highest *semver.Version
+	highestTag := ""
+	for _, tag := range tags {
+		v, err := semver.NewVersion(tag)
+		if err != nil || !c.Check(v) {
+			continue
+		}
+		if highest == nil || v.GreaterThan(highest) {
+			highest, highestTag = v, tag
+		}
+	}
+	if highest == nil {
+		return "", fmt.Errorf("no tag satisfies the version constraint '%s'", constraint)
+	}
+	return highestTag, nil
+}
+
+// tagResolver lists the tags of a repository and resolves them to the sha of their commit
+type tagResolver interface {
+	Tags() ([]string, error)
+	ResolveTag(tag string) (string, error)
+}
+
+// repositoryTagResolver is the tagResolver of a cloned repository, it fetches the tags of the origin first
+type repositoryTagResolver struct {
+	logger log.FieldLogger
+	repo   *git.Repository
+	auth   transport.AuthMethod
+}
+
+func (tr *repositoryTagResolver) Tags() ([]string, error) {
+	err := tr.repo.Fetch(&git.FetchOptions{Tags: git.AllTags, Auth: tr.auth})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		tr.logger.Debugf("Unable to fetch tags: %v", err)
+	}
+
+	iter, err := tr.repo.Tags()
+	if err != nil {
+		return nil, err
+	}
+	tags := make([]string, 0)
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		tags = append(tags, ref.Name().Short())
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+func (tr *repositoryTagResolver) ResolveTag(tag string) (string, error) {
+	hash, err := tr.repo.ResolveRevision(plumbing.Revision(plumbing.NewTagReferenceName(tag)))
+	if err != nil {
+		return "", err
+	}
+	return hash.String(), nil
+}
+
+// resolveVersionConstraintTag fetches the tags of r and resolves constraint against them
+func resolveVersionConstraintTag(logger log.FieldLogger, r *git.Repository, constraint string, auth transport.AuthMethod) (string, error) {
+	tags, err := (&repositoryTagResolver{logger: logger, repo: r, auth: auth}).Tags()
+	if err != nil {
+		return "", err
+	}
+
+	tag, err := ResolveVersionConstraint(constraint, tags)
+	if err != nil {
+		return "", err
+	}
+	logger.Infof("  \u2601  version constraint '%s' resolved to tag '%s'", constraint, tag)
+	return tag, nil
+}
+
+// IsMajorVersion returns true if ref is a major version like v2, which by the convention of GitHub
+// actions is a tag that is moved to their latest v2.x.y release
+func IsMajorVersion(ref string) bool {
+	return majorVersionRegex.MatchString(ref)
+}
+
+// MajorVersionCache caches the shas the major version refs are resolved to, by the URL of the repository
+// and the ref. The zero value is an empty cache.
+type MajorVersionCache struct {
+	mu   sync.Mutex
+	shas map[string]string
+}
+
+func (c *MajorVersionCache) get(key string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sha, ok := c.shas[key]
+	return sha, ok
+}
+
+func (c *MajorVersionCache) set(key string, sha string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.shas == nil {
+		c.shas = make(map[string]string)
+	}
+	c.shas[key] = sha
+}
+
+// resolveMajorVersion resolves the major version ref of the repository at url to the sha of its tag if
+// it has one, otherwise to the sha of the highest release of the major like v2.3.1 for v2. The shas are
+// cached in cache, so the tags of the repository are only listed the first time a major version is resolved.
+// The tags are listed without holding the cache, the resolutions of other repositories don't wait for them.
+func resolveMajorVersion(logger log.FieldLogger, resolver tagResolver, cache *MajorVersionCache, url string, ref string) (string, error) {
+	key := fmt.Sprintf("%s@%s", url, ref)
+	if sha, ok := cache.get(key); ok {
+		logger.Debugf("major version '%s' was resolved to %s before", ref, sha)
+		return sha, nil
+	}
+
+	tags, err := resolver.Tags()
+	if err != nil {
+		return "", err
+	}
+	tag := ""
+	for _, t := range tags {
+		if t == ref {
+			tag = t
+			break
+		}
+	}
+	if tag == "" {
+		major, err := strconv.Atoi(majorVersionRegex.FindStringSubmatch(ref)[1])
+		if err != nil {
+			return "", err
+		}
+		tag, err = ResolveVersionConstraint(fmt.Sprintf(">= %d.0.0, < %d.0.0", major, major+1), tags)
+		if err != nil {
+			return "", fmt.Errorf("unable to resolve the major version '%s': %w", ref, err)
+		}
+	}
+
+	sha, err := resolver.ResolveTag(tag)
+	if err != nil {
+		return "", err
+	}
+	logger.Infof("  \u2601  major version '%s' resolved to tag '%s' (%s)", ref, tag, sha)
+	cache.set(key, sha)
+	return sha, nil
+}
+
 // NewGitCloneExecutor creates an executor to clone git repos
 func NewGitCloneExecutor(input NewGitCloneExecutorInput) Executor {
 	return func(ctx context.Context) error {
@@ -261,6 +527,21 @@ func NewGitCloneExecutor(input NewGitCloneExecutorInput) Executor {
 		cloneLock.Lock()
 		defer cloneLock.Unlock()
 
+		httpClient, err := input.httpClient()
+		if err != nil {
+			return err
+		}
+		if httpClient != nil {
+			if input.InsecureSkipTLS {
+				logger.Warnf("  \u26a0  Not verifying the TLS certificate of %s", input.URL)
+			}
+			// go-git has one client for all the https clones, which are serialized by cloneLock,
+			// so it is only replaced while this one clones and the one installed before is restored
+			previous := client.Protocols["https"]
+			client.InstallProtocol("https", http.NewClient(httpClient))
+			defer client.InstallProtocol("https", previous)
+		}
+
 		refName := plumbing.ReferenceName(fmt.Sprintf("refs/heads/%s", input.Ref))
 		r, err := CloneIfRequired(ctx, refName, input, logger)
 		if err != nil {
@@ -272,26 +553,29 @@ func NewGitCloneExecutor(input NewGitCloneExecutorInput) Executor {
 			return err
 		}
 
-		// At this point we need to know if it's a tag or a branch
-		// And the easiest way to do it is duck typing
-		//
-		// If err is nil, it's a tag so let's proceed with that hash like we would if
-		// it was a sha
-		refType := "tag"
-		rev := plumbing.Revision(path.Join("refs", "tags", input.Ref))
-		if _, err := r.Tag(input.Ref); errors.Is(err, git.ErrTagNotFound) {
-			rName := plumbing.ReferenceName(path.Join("refs", "remotes", "origin", input.Ref))
-			if _, err := r.Reference(rName, false); errors.Is(err, plumbing.ErrReferenceNotFound) {
-				refType = "sha"
-				rev = plumbing.Revision(input.Ref)
-			} else {
-				refType = "branch"
-				rev = plumbing.Revision(rName)
+		ref := input.Ref
+		if input.VersionConstraint && IsVersionConstraint(ref) {
+			ref, err = resolveVersionConstraintTag(logger, r, ref, input.auth())
+			if err != nil {
+				return err
+			}
+		}
+
+		refType, rev, err := resolveGitRef(logger, r, ref)
+		if err != nil {
+			return err
+		}
+		if refType == "sha" && IsMajorVersion(ref) {
+			// a major version that is neither a tag nor a branch of the clone is the latest release of the major
+			ref, err = resolveMajorVersion(logger, &repositoryTagResolver{logger: logger, repo: r, auth: input.auth()}, input.MajorVersions, input.URL, ref)
+			if err != nil {
+				return err
 			}
+			rev = plumbing.Revision(ref)
 		}
 		hash, err := r.ResolveRevision(rev)
 		if err != nil {
-			logger.Errorf("Unable to resolve %s: %v", input.Ref, err)
+			logger.Errorf("Unable to resolve %s: %v", ref, err)
 			return err
 		}
 
@@ -300,16 +584,16 @@ func NewGitCloneExecutor(input NewGitCloneExecutorInput) Executor {
 		//
 		// Repos on disk point to commit hashes, and need to checkout input.Ref before
 		// we try and pull down any changes
-		if hash.String() != input.Ref {
+		if hash.String() != ref {
 			// Run git fetch to make sure we have the latest sha
-			err := r.Fetch(&git.FetchOptions{})
+			err := r.Fetch(&git.FetchOptions{Auth: input.auth()})
 			if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
 				logger.Debugf("Unable to fetch: %v", err)
 			}
 
 			if refType == "branch" {
 				logger.Debugf("Provided ref is not a sha. Checking out branch before pulling changes")
-				sourceRef := plumbing.ReferenceName(path.Join("refs", "remotes", "origin", input.Ref))
+				sourceRef := plumbing.ReferenceName(path.Join("refs", "remotes", "origin", ref))
 				err := w.Checkout(&git.CheckoutOptions{
 					Branch: sourceRef,
 					Force:  true,
@@ -323,6 +607,7 @@ func NewGitCloneExecutor(input NewGitCloneExecutorInput) Executor {
 
 		err = w.Pull(&git.PullOptions{
 			Force: true,
+			Auth:  input.auth(),
 		})
 		if err != nil && err.Error() != "already up-to-date" {
 			logger.Debugf("Unable to pull %s: %v", refName, err)
@@ -347,7 +632,7 @@ func NewGitCloneExecutor(input NewGitCloneExecutorInput) Executor {
 			return err
 		}
 
-		logger.Debugf("Checked out %s", input.Ref)
+		logger.Debugf("Checked out %s", ref)
 		return nil
 	}
 }
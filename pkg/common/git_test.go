@@ -2,14 +2,21 @@ package common
 
 import (
 	"context"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"syscall"
 	"testing"
 
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -19,22 +26,26 @@ func TestFindGitSlug(t *testing.T) {
 
 	var slugTests = []struct {
 		url      string // input
+		instance string // input
 		provider string // expected result
 		slug     string // expected result
 	}{
-		{"https://git-codecommit.us-east-1.amazonaws.com/v1/repos/my-repo-name", "CodeCommit", "my-repo-name"},
-		{"ssh://git-codecommit.us-west-2.amazonaws.com/v1/repos/my-repo", "CodeCommit", "my-repo"},
-		{"git@github.com:nektos/act.git", "GitHub", "nektos/act"},
-		{"https://github.com/nektos/act.git", "GitHub", "nektos/act"},
-		{"http://github.com/nektos/act.git", "GitHub", "nektos/act"},
-		{"https://github.com/nektos/act", "GitHub", "nektos/act"},
-		{"http://github.com/nektos/act", "GitHub", "nektos/act"},
-		{"git+ssh://git@github.com/owner/repo.git", "GitHub", "owner/repo"},
-		{"http://myotherrepo.com/act.git", "", "http://myotherrepo.com/act.git"},
+		{"https://git-codecommit.us-east-1.amazonaws.com/v1/repos/my-repo-name", "github.com", "CodeCommit", "my-repo-name"},
+		{"ssh://git-codecommit.us-west-2.amazonaws.com/v1/repos/my-repo", "github.com", "CodeCommit", "my-repo"},
+		{"git@github.com:nektos/act.git", "github.com", "GitHub", "nektos/act"},
+		{"https://github.com/nektos/act.git", "github.com", "GitHub", "nektos/act"},
+		{"http://github.com/nektos/act.git", "github.com", "GitHub", "nektos/act"},
+		{"https://github.com/nektos/act", "github.com", "GitHub", "nektos/act"},
+		{"http://github.com/nektos/act", "github.com", "GitHub", "nektos/act"},
+		{"git+ssh://git@github.com/owner/repo.git", "github.com", "GitHub", "owner/repo"},
+		{"http://myotherrepo.com/act.git", "github.com", "", "http://myotherrepo.com/act.git"},
+		{"https://github.mycompany.com/owner/repo.git", "github.mycompany.com", "GitHub", "owner/repo"},
+		{"git@github.mycompany.com:owner/repo.git", "github.mycompany.com", "GitHub", "owner/repo"},
+		{"https://github.mycompany.com/owner/repo.git", "github.com", "", "https://github.mycompany.com/owner/repo.git"},
 	}
 
 	for _, tt := range slugTests {
-		provider, slug, err := findGitSlug(tt.url)
+		provider, slug, err := findGitSlug(tt.url, tt.instance)
 
 		assert.NoError(err)
 		assert.Equal(tt.provider, provider)
@@ -205,6 +216,280 @@ func TestGitCloneExecutor(t *testing.T) {
 	}
 }
 
+func TestGitCloneExecutorAmbiguousRef(t *testing.T) {
+	basedir := testDir(t)
+	gitConfig()
+
+	origin := filepath.Join(basedir, "origin")
+	require.NoError(t, os.MkdirAll(origin, 0755))
+	require.NoError(t, gitCmd("-C", origin, "init", "--initial-branch=master"))
+	require.NoError(t, cleanGitHooks(origin))
+	require.NoError(t, gitCmd("-C", origin, "-c", "user.name=act", "-c", "user.email=act@example.com", "commit", "--allow-empty", "-m", "tagged"))
+	require.NoError(t, gitCmd("-C", origin, "tag", "v1"))
+	require.NoError(t, gitCmd("-C", origin, "checkout", "-b", "v1"))
+	require.NoError(t, gitCmd("-C", origin, "-c", "user.name=act", "-c", "user.email=act@example.com", "commit", "--allow-empty", "-m", "branched"))
+	require.NoError(t, gitCmd("-C", origin, "checkout", "-b", "feature"))
+	require.NoError(t, gitCmd("-C", origin, "checkout", "master"))
+
+	originRepo, err := git.PlainOpen(origin)
+	require.NoError(t, err)
+	tagHash, err := originRepo.ResolveRevision("refs/tags/v1")
+	require.NoError(t, err)
+
+	dir := filepath.Join(basedir, "clone")
+	clone := NewGitCloneExecutor(NewGitCloneExecutorInput{
+		URL: origin,
+		Ref: "v1",
+		Dir: dir,
+	})
+	require.NoError(t, clone(context.Background()))
+
+	r, err := git.PlainOpen(dir)
+	require.NoError(t, err)
+	head, err := r.Head()
+	require.NoError(t, err)
+	assert.Equal(t, tagHash.String(), head.Hash().String())
+
+	logger, hook := test.NewNullLogger()
+	for _, tt := range []struct {
+		ref     string
+		refType string
+	}{
+		{"v1", "tag"},
+		{"feature", "branch"},
+		{tagHash.String(), "sha"},
+	} {
+		refType, _, err := resolveGitRef(logger, r, tt.ref)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.refType, refType, tt.ref)
+	}
+	if assert.NotNil(t, hook.LastEntry()) {
+		assert.Contains(t, hook.AllEntries()[0].Message, "ref 'v1' is both a tag and a branch, using the tag")
+	}
+}
+
+func TestResolveVersionConstraint(t *testing.T) {
+	tags := []string{"v0.9.0", "v1", "v1.0.0", "v1.2.0", "v1.10.1", "v1.11.0-beta.1", "v2.0.0", "latest"}
+	for _, tt := range []struct {
+		constraint string
+		tag        string
+	}{
+		{"^1.0.0", "v1.10.1"},
+		{"~1.2", "v1.2.0"},
+		{">= 1.0.0, < 1.5", "v1.2.0"},
+		{"*", "v2.0.0"},
+	} {
+		tag, err := ResolveVersionConstraint(tt.constraint, tags)
+		assert.NoError(t, err, tt.constraint)
+		assert.Equal(t, tt.tag, tag, tt.constraint)
+	}
+
+	_, err := ResolveVersionConstraint("^3.0.0", tags)
+	assert.EqualError(t, err, "no tag satisfies the version constraint '^3.0.0'")
+
+	assert.True(t, IsVersionConstraint("^1.2.0"))
+	assert.True(t, IsVersionConstraint(">= 1.0.0, < 2"))
+	assert.False(t, IsVersionConstraint("v1"))
+	assert.False(t, IsVersionConstraint("main"))
+	assert.False(t, IsVersionConstraint("5a4ac9002d0be2fb38bd78e4b4dbde5606d7042f"))
+}
+
+func TestGitCloneExecutorVersionConstraint(t *testing.T) {
+	basedir := testDir(t)
+	gitConfig()
+
+	origin := filepath.Join(basedir, "origin")
+	require.NoError(t, os.MkdirAll(origin, 0755))
+	require.NoError(t, gitCmd("-C", origin, "init", "--initial-branch=master"))
+	require.NoError(t, cleanGitHooks(origin))
+	for _, tag := range []string{"v1.0.0", "v1.3.0", "v2.0.0"} {
+		require.NoError(t, gitCmd("-C", origin, "-c", "user.name=act", "-c", "user.email=act@example.com", "commit", "--allow-empty", "-m", tag))
+		require.NoError(t, gitCmd("-C", origin, "tag", tag))
+	}
+
+	originRepo, err := git.PlainOpen(origin)
+	require.NoError(t, err)
+	tagHash, err := originRepo.ResolveRevision("refs/tags/v1.3.0")
+	require.NoError(t, err)
+
+	dir := filepath.Join(basedir, "clone")
+	clone := NewGitCloneExecutor(NewGitCloneExecutorInput{
+		URL:               origin,
+		Ref:               "^1.0.0",
+		Dir:               dir,
+		VersionConstraint: true,
+	})
+	require.NoError(t, clone(context.Background()))
+
+	r, err := git.PlainOpen(dir)
+	require.NoError(t, err)
+	head, err := r.Head()
+	require.NoError(t, err)
+	assert.Equal(t, tagHash.String(), head.Hash().String())
+}
+
+type fakeTagResolver struct {
+	shas  map[string]string
+	calls int
+}
+
+func (tr *fakeTagResolver) Tags() ([]string, error) {
+	tr.calls++
+	tags := make([]string, 0, len(tr.shas))
+	for tag := range tr.shas {
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+func (tr *fakeTagResolver) ResolveTag(tag string) (string, error) {
+	return tr.shas[tag], nil
+}
+
+func TestResolveMajorVersion(t *testing.T) {
+	resolver := &fakeTagResolver{shas: map[string]string{
+		"v1":             "sha-v1",
+		"v1.0.0":         "sha-v1.0.0",
+		"v1.4.0":         "sha-v1.4.0",
+		"v2.0.0":         "sha-v2.0.0",
+		"v2.3.1":         "sha-v2.3.1",
+		"v2.10.0":        "sha-v2.10.0",
+		"v2.11.0-beta.1": "sha-v2.11.0-beta.1",
+		"v3.0.0":         "sha-v3.0.0",
+		"latest":         "sha-latest",
+	}}
+	logger, _ := test.NewNullLogger()
+	url := "https://github.com/nektos/resolve-major-version"
+	cache := &MajorVersionCache{}
+
+	for _, tt := range []struct {
+		ref string
+		sha string
+	}{
+		{"v1", "sha-v1"},
+		{"v2", "sha-v2.10.0"},
+		{"v3", "sha-v3.0.0"},
+	} {
+		sha, err := resolveMajorVersion(logger, resolver, cache, url, tt.ref)
+		assert.NoError(t, err, tt.ref)
+		assert.Equal(t, tt.sha, sha, tt.ref)
+	}
+	assert.Equal(t, 3, resolver.calls)
+
+	// the resolved shas are cached
+	resolver.shas["v2.12.0"] = "sha-v2.12.0"
+	sha, err := resolveMajorVersion(logger, resolver, cache, url, "v2")
+	assert.NoError(t, err)
+	assert.Equal(t, "sha-v2.10.0", sha)
+	assert.Equal(t, 3, resolver.calls)
+
+	// without a cache, e.g. in another run, the moved releases are seen
+	sha, err = resolveMajorVersion(logger, resolver, nil, url, "v2")
+	assert.NoError(t, err)
+	assert.Equal(t, "sha-v2.12.0", sha)
+	assert.Equal(t, 4, resolver.calls)
+
+	_, err = resolveMajorVersion(logger, resolver, cache, url, "v4")
+	assert.EqualError(t, err, "unable to resolve the major version 'v4': no tag satisfies the version constraint '>= 4.0.0, < 5.0.0'")
+
+	assert.True(t, IsMajorVersion("v2"))
+	assert.False(t, IsMajorVersion("v2.1"))
+	assert.False(t, IsMajorVersion("main"))
+}
+
+func TestGitCloneExecutorMajorVersion(t *testing.T) {
+	basedir := testDir(t)
+	gitConfig()
+
+	origin := filepath.Join(basedir, "origin")
+	require.NoError(t, os.MkdirAll(origin, 0755))
+	require.NoError(t, gitCmd("-C", origin, "init", "--initial-branch=master"))
+	require.NoError(t, cleanGitHooks(origin))
+	for _, tag := range []string{"v1.0.0", "v1.3.0", "v2.0.0"} {
+		require.NoError(t, gitCmd("-C", origin, "-c", "user.name=act", "-c", "user.email=act@example.com", "commit", "--allow-empty", "-m", tag))
+		require.NoError(t, gitCmd("-C", origin, "tag", tag))
+	}
+
+	originRepo, err := git.PlainOpen(origin)
+	require.NoError(t, err)
+	tagHash, err := originRepo.ResolveRevision("refs/tags/v1.3.0")
+	require.NoError(t, err)
+
+	dir := filepath.Join(basedir, "clone")
+	clone := NewGitCloneExecutor(NewGitCloneExecutorInput{
+		URL: origin,
+		Ref: "v1",
+		Dir: dir,
+	})
+	require.NoError(t, clone(context.Background()))
+
+	r, err := git.PlainOpen(dir)
+	require.NoError(t, err)
+	head, err := r.Head()
+	require.NoError(t, err)
+	assert.Equal(t, tagHash.String(), head.Hash().String())
+}
+
+func TestGitCloneExecutorInputHTTPClient(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	httpClient, err := NewGitCloneExecutorInput{URL: server.URL}.httpClient()
+	require.NoError(t, err)
+	assert.Nil(t, httpClient)
+
+	httpClient, err = NewGitCloneExecutorInput{URL: server.URL, InsecureSkipTLS: true}.httpClient()
+	require.NoError(t, err)
+	assert.True(t, httpClient.Transport.(*http.Transport).TLSClientConfig.InsecureSkipVerify)
+	_, err = httpClient.Get(server.URL)
+	assert.NoError(t, err)
+
+	dir := testDir(t)
+	bundle := filepath.Join(dir, "ca.pem")
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, ioutil.WriteFile(bundle, certificate, 0600))
+	httpClient, err = NewGitCloneExecutorInput{URL: server.URL, CABundle: bundle}.httpClient()
+	require.NoError(t, err)
+	tlsConfig := httpClient.Transport.(*http.Transport).TLSClientConfig
+	assert.False(t, tlsConfig.InsecureSkipVerify)
+	assert.NotNil(t, tlsConfig.RootCAs)
+	_, err = httpClient.Get(server.URL)
+	assert.NoError(t, err)
+
+	// without the CA bundle the certificate of the server isn't trusted
+	_, err = http.Get(server.URL)
+	assert.Error(t, err)
+
+	empty := filepath.Join(dir, "empty.pem")
+	require.NoError(t, ioutil.WriteFile(empty, []byte{}, 0600))
+	_, err = NewGitCloneExecutorInput{URL: server.URL, CABundle: empty}.httpClient()
+	assert.EqualError(t, err, fmt.Sprintf("no certificates in the CA bundle %s", empty))
+}
+
+func TestGitCloneExecutorRestoresHTTPSProtocol(t *testing.T) {
+	basedir := testDir(t)
+	origin := filepath.Join(basedir, "origin")
+	require.NoError(t, os.MkdirAll(origin, 0755))
+	require.NoError(t, gitCmd("-C", origin, "init", "--initial-branch=master"))
+	require.NoError(t, cleanGitHooks(origin))
+	require.NoError(t, gitCmd("-C", origin, "-c", "user.name=act", "-c", "user.email=act@example.com", "commit", "--allow-empty", "-m", "initial"))
+
+	// the client an embedder installed is restored after a clone that skips the TLS verification
+	installed := githttp.NewClient(&http.Client{})
+	previous := client.Protocols["https"]
+	client.InstallProtocol("https", installed)
+	defer client.InstallProtocol("https", previous)
+
+	clone := NewGitCloneExecutor(NewGitCloneExecutorInput{
+		URL:             origin,
+		Ref:             "master",
+		Dir:             filepath.Join(basedir, "clone"),
+		InsecureSkipTLS: true,
+	})
+	require.NoError(t, clone(context.Background()))
+	assert.Same(t, installed, client.Protocols["https"])
+}
+
 func gitConfig() {
 	if os.Getenv("GITHUB_ACTIONS") == "true" {
 		_ = gitCmd("config", "--global", "user.email", "test@test.com")
@@ -0,0 +1,108 @@
+package container
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+)
+
+// ImageRegistry returns the host of the registry that image is pulled from
+func ImageRegistry(image string) string {
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return parts[0]
+	}
+	return "docker.io"
+}
+
+// dockerConfigFile is the part of the docker CLI's config.json with the credentials of registries
+type dockerConfigFile struct {
+	Auths map[string]dockerConfigAuth `json:"auths"`
+}
+
+type dockerConfigAuth struct {
+	Auth     string `json:"auth"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// registryAuth returns the encoded credentials to pull image with. The username and password are used
+// if set, otherwise the credentials of the registry are looked up in the docker CLI's config.json.
+// Credential helpers (credsStore) are not supported. An empty string means an anonymous pull.
+func registryAuth(image string, username string, password string) (string, error) {
+	registry := ImageRegistry(image)
+	if username == "" && password == "" {
+		var err error
+		username, password, err = dockerConfigCredentials(registry)
+		if err != nil {
+			return "", err
+		}
+		if username == "" && password == "" {
+			return "", nil
+		}
+	}
+
+	buf, err := json.Marshal(types.AuthConfig{
+		Username:      username,
+		Password:      password,
+		ServerAddress: registry,
+	})
+	if err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(buf), nil
+}
+
+func dockerConfigCredentials(registry string) (string, string, error) {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := homedir.Dir()
+		if err != nil {
+			return "", "", nil
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "config.json"))
+	if os.IsNotExist(err) {
+		return "", "", nil
+	} else if err != nil {
+		return "", "", err
+	}
+
+	var config dockerConfigFile
+	if err := json.Unmarshal(content, &config); err != nil {
+		return "", "", errors.Wrapf(err, "unable to read docker config %s", filepath.Join(dir, "config.json"))
+	}
+
+	keys := []string{registry, "https://" + registry, "http://" + registry}
+	if registry == "docker.io" {
+		keys = append(keys, "https://index.docker.io/v1/", "index.docker.io")
+	}
+	for _, key := range keys {
+		auth, ok := config.Auths[key]
+		if !ok {
+			continue
+		}
+		if auth.Auth == "" {
+			return auth.Username, auth.Password, nil
+		}
+		decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+		if err != nil {
+			return "", "", errors.Wrapf(err, "invalid auth of registry %s in docker config", key)
+		}
+		parts := strings.SplitN(string(decoded), ":", 2)
+		if len(parts) != 2 {
+			return "", "", errors.Errorf("invalid auth of registry %s in docker config", key)
+		}
+		return parts[0], parts[1], nil
+	}
+	return "", "", nil
+}
@@ -0,0 +1,77 @@
+package container
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImageRegistry(t *testing.T) {
+	tables := []struct {
+		image    string
+		registry string
+	}{
+		{"ubuntu", "docker.io"},
+		{"cibuilds/hugo:0.53", "docker.io"},
+		{"ghcr.io/myorg/builder:1", "ghcr.io"},
+		{"localhost/builder", "localhost"},
+		{"registry.corp:5000/builder", "registry.corp:5000"},
+	}
+
+	for _, table := range tables {
+		assert.Equal(t, table.registry, ImageRegistry(table.image), table.image)
+	}
+}
+
+func decodeRegistryAuth(t *testing.T, auth string) types.AuthConfig {
+	buf, err := base64.URLEncoding.DecodeString(auth)
+	assert.Nil(t, err)
+	var authConfig types.AuthConfig
+	assert.Nil(t, json.Unmarshal(buf, &authConfig))
+	return authConfig
+}
+
+func TestImagePullOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "act-docker-config")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer os.Setenv("DOCKER_CONFIG", os.Getenv("DOCKER_CONFIG"))
+	os.Setenv("DOCKER_CONFIG", dir)
+
+	// without a config.json and credentials the image is pulled anonymously
+	options, err := imagePullOptions(NewDockerPullExecutorInput{Image: "ghcr.io/myorg/builder:1"})
+	assert.Nil(t, err)
+	assert.Equal(t, "", options.RegistryAuth)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(`{
+  "auths": {
+    "ghcr.io": {"auth": "`+base64.StdEncoding.EncodeToString([]byte("octocat:from-config"))+`"},
+    "https://index.docker.io/v1/": {"username": "hubber", "password": "hub-token"}
+  }
+}`), 0600)
+	assert.Nil(t, err)
+
+	options, err = imagePullOptions(NewDockerPullExecutorInput{Image: "ghcr.io/myorg/builder:1", Platform: "linux/amd64"})
+	assert.Nil(t, err)
+	assert.Equal(t, "linux/amd64", options.Platform)
+	assert.Equal(t, types.AuthConfig{Username: "octocat", Password: "from-config", ServerAddress: "ghcr.io"}, decodeRegistryAuth(t, options.RegistryAuth))
+
+	options, err = imagePullOptions(NewDockerPullExecutorInput{Image: "node:12"})
+	assert.Nil(t, err)
+	assert.Equal(t, types.AuthConfig{Username: "hubber", Password: "hub-token", ServerAddress: "docker.io"}, decodeRegistryAuth(t, options.RegistryAuth))
+
+	// explicit credentials win over the config.json
+	options, err = imagePullOptions(NewDockerPullExecutorInput{Image: "ghcr.io/myorg/builder:1", Username: "bot", Password: "secret"})
+	assert.Nil(t, err)
+	assert.Equal(t, types.AuthConfig{Username: "bot", Password: "secret", ServerAddress: "ghcr.io"}, decodeRegistryAuth(t, options.RegistryAuth))
+
+	options, err = imagePullOptions(NewDockerPullExecutorInput{Image: "quay.io/other/image"})
+	assert.Nil(t, err)
+	assert.Equal(t, "", options.RegistryAuth)
+}
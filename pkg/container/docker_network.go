@@ -0,0 +1,63 @@
+package container
+
+import (
+	"context"
+	"runtime"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/pkg/errors"
+)
+
+// dockerDesktopHost is the name Docker Desktop resolves to the host in its containers
+const dockerDesktopHost = "host.docker.internal"
+
+// ServerAddress is where a server for the containers on the host listens and the host the containers reach it at
+type ServerAddress struct {
+	ListenAddr string // address to bind the server to
+	Host       string // host to use in the urls passed to the containers
+}
+
+// DetectServerAddress returns the address for servers on the host that containers have to reach. On Docker
+// Desktop the containers reach the host's loopback address at host.docker.internal, otherwise the server
+// listens on the gateway of the default bridge network.
+func DetectServerAddress(ctx context.Context) (ServerAddress, error) {
+	cli, err := GetDockerClient(ctx)
+	if err != nil {
+		return ServerAddress{}, err
+	}
+
+	info, err := cli.Info(ctx)
+	if err != nil {
+		return ServerAddress{}, errors.WithStack(err)
+	}
+
+	var gateway string
+	if !isDockerDesktop(runtime.GOOS, info.OperatingSystem) {
+		network, err := cli.NetworkInspect(ctx, "bridge", types.NetworkInspectOptions{})
+		if err != nil {
+			return ServerAddress{}, errors.WithStack(err)
+		}
+		for _, config := range network.IPAM.Config {
+			if config.Gateway != "" {
+				gateway = config.Gateway
+				break
+			}
+		}
+	}
+	return serverAddress(runtime.GOOS, info.OperatingSystem, gateway)
+}
+
+func isDockerDesktop(goos string, operatingSystem string) bool {
+	return strings.Contains(operatingSystem, "Docker Desktop") || goos == "darwin" || goos == "windows"
+}
+
+func serverAddress(goos string, operatingSystem string, gateway string) (ServerAddress, error) {
+	if isDockerDesktop(goos, operatingSystem) {
+		return ServerAddress{ListenAddr: "127.0.0.1", Host: dockerDesktopHost}, nil
+	}
+	if gateway == "" {
+		return ServerAddress{}, errors.New("unable to find the gateway of the docker bridge network")
+	}
+	return ServerAddress{ListenAddr: gateway, Host: gateway}, nil
+}
@@ -0,0 +1,31 @@
+package container
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerAddress(t *testing.T) {
+	tables := []struct {
+		goos            string
+		operatingSystem string
+		gateway         string
+		address         ServerAddress
+	}{
+		{"linux", "Ubuntu 20.04.2 LTS", "172.17.0.1", ServerAddress{ListenAddr: "172.17.0.1", Host: "172.17.0.1"}},
+		{"linux", "Docker Desktop", "", ServerAddress{ListenAddr: "127.0.0.1", Host: "host.docker.internal"}},
+		{"darwin", "Docker Desktop", "", ServerAddress{ListenAddr: "127.0.0.1", Host: "host.docker.internal"}},
+		{"windows", "Docker Desktop", "", ServerAddress{ListenAddr: "127.0.0.1", Host: "host.docker.internal"}},
+		{"darwin", "Ubuntu 20.04.2 LTS", "", ServerAddress{ListenAddr: "127.0.0.1", Host: "host.docker.internal"}},
+	}
+
+	for _, table := range tables {
+		address, err := serverAddress(table.goos, table.operatingSystem, table.gateway)
+		assert.Nil(t, err, table.goos)
+		assert.Equal(t, table.address, address, table.goos)
+	}
+
+	_, err := serverAddress("linux", "Ubuntu 20.04.2 LTS", "")
+	assert.Error(t, err)
+}
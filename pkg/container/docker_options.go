@@ -0,0 +1,252 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-units"
+	"github.com/kballard/go-shellquote"
+	"github.com/pkg/errors"
+
+	"github.com/nektos/act/pkg/common"
+)
+
+type containerOption struct {
+	isBool bool
+	apply  func(value string, config *container.Config, hostConfig *container.HostConfig) error
+}
+
+// short flags accepted by `docker create` for the supported options
+var containerOptionAliases = map[string]string{
+	"c": "cpu-shares",
+	"e": "env",
+	"h": "hostname",
+	"l": "label",
+	"m": "memory",
+	"u": "user",
+}
+
+var containerOptions = map[string]containerOption{
+	"cpus": {apply: func(value string, config *container.Config, hostConfig *container.HostConfig) error {
+		cpus, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		hostConfig.NanoCPUs = int64(cpus * 1e9)
+		return nil
+	}},
+	"cpu-shares": {apply: func(value string, config *container.Config, hostConfig *container.HostConfig) error {
+		shares, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		hostConfig.CPUShares = shares
+		return nil
+	}},
+	"memory": {apply: func(value string, config *container.Config, hostConfig *container.HostConfig) error {
+		memory, err := units.RAMInBytes(value)
+		if err != nil {
+			return err
+		}
+		hostConfig.Memory = memory
+		return nil
+	}},
+	"memory-reservation": {apply: func(value string, config *container.Config, hostConfig *container.HostConfig) error {
+		memory, err := units.RAMInBytes(value)
+		if err != nil {
+			return err
+		}
+		hostConfig.MemoryReservation = memory
+		return nil
+	}},
+	"memory-swap": {apply: func(value string, config *container.Config, hostConfig *container.HostConfig) error {
+		if value == "-1" {
+			hostConfig.MemorySwap = -1
+			return nil
+		}
+		memory, err := units.RAMInBytes(value)
+		if err != nil {
+			return err
+		}
+		hostConfig.MemorySwap = memory
+		return nil
+	}},
+	"shm-size": {apply: func(value string, config *container.Config, hostConfig *container.HostConfig) error {
+		size, err := units.RAMInBytes(value)
+		if err != nil {
+			return err
+		}
+		hostConfig.ShmSize = size
+		return nil
+	}},
+	"pids-limit": {apply: func(value string, config *container.Config, hostConfig *container.HostConfig) error {
+		limit, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		hostConfig.PidsLimit = &limit
+		return nil
+	}},
+	"cap-add": {apply: func(value string, config *container.Config, hostConfig *container.HostConfig) error {
+		hostConfig.CapAdd = append(hostConfig.CapAdd, value)
+		return nil
+	}},
+	"cap-drop": {apply: func(value string, config *container.Config, hostConfig *container.HostConfig) error {
+		hostConfig.CapDrop = append(hostConfig.CapDrop, value)
+		return nil
+	}},
+	"security-opt": {apply: func(value string, config *container.Config, hostConfig *container.HostConfig) error {
+		hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, value)
+		return nil
+	}},
+	"add-host": {apply: func(value string, config *container.Config, hostConfig *container.HostConfig) error {
+		hostConfig.ExtraHosts = append(hostConfig.ExtraHosts, value)
+		return nil
+	}},
+	"dns": {apply: func(value string, config *container.Config, hostConfig *container.HostConfig) error {
+		hostConfig.DNS = append(hostConfig.DNS, value)
+		return nil
+	}},
+	"dns-search": {apply: func(value string, config *container.Config, hostConfig *container.HostConfig) error {
+		hostConfig.DNSSearch = append(hostConfig.DNSSearch, value)
+		return nil
+	}},
+	"tmpfs": {apply: func(value string, config *container.Config, hostConfig *container.HostConfig) error {
+		path, options := value, ""
+		if idx := strings.Index(value, ":"); idx >= 0 {
+			path, options = value[:idx], value[idx+1:]
+		}
+		if hostConfig.Tmpfs == nil {
+			hostConfig.Tmpfs = make(map[string]string)
+		}
+		hostConfig.Tmpfs[path] = options
+		return nil
+	}},
+	"privileged": {isBool: true, apply: func(value string, config *container.Config, hostConfig *container.HostConfig) error {
+		privileged, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		hostConfig.Privileged = hostConfig.Privileged || privileged
+		return nil
+	}},
+	"init": {isBool: true, apply: func(value string, config *container.Config, hostConfig *container.HostConfig) error {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		hostConfig.Init = &enabled
+		return nil
+	}},
+	"read-only": {isBool: true, apply: func(value string, config *container.Config, hostConfig *container.HostConfig) error {
+		readOnly, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		hostConfig.ReadonlyRootfs = readOnly
+		return nil
+	}},
+	"env": {apply: func(value string, config *container.Config, hostConfig *container.HostConfig) error {
+		config.Env = append(config.Env, value)
+		return nil
+	}},
+	"hostname": {apply: func(value string, config *container.Config, hostConfig *container.HostConfig) error {
+		config.Hostname = value
+		return nil
+	}},
+	"label": {apply: func(value string, config *container.Config, hostConfig *container.HostConfig) error {
+		key, val := value, ""
+		if idx := strings.Index(value, "="); idx >= 0 {
+			key, val = value[:idx], value[idx+1:]
+		}
+		if config.Labels == nil {
+			config.Labels = make(map[string]string)
+		}
+		config.Labels[key] = val
+		return nil
+	}},
+	"user": {apply: func(value string, config *container.Config, hostConfig *container.HostConfig) error {
+		config.User = value
+		return nil
+	}},
+}
+
+// applyResourceLimits sets the memory and cpu limits of a container, empty values are left unlimited
+func applyResourceLimits(memory string, cpus string, config *container.Config, hostConfig *container.HostConfig) error {
+	if memory != "" {
+		if err := containerOptions["memory"].apply(memory, config, hostConfig); err != nil {
+			return errors.Wrapf(err, "invalid container memory limit '%s'", memory)
+		}
+	}
+	if cpus != "" {
+		if err := containerOptions["cpus"].apply(cpus, config, hostConfig); err != nil {
+			return errors.Wrapf(err, "invalid container cpus limit '%s'", cpus)
+		}
+		if hostConfig.NanoCPUs <= 0 {
+			return fmt.Errorf("invalid container cpus limit '%s', it has to be positive", cpus)
+		}
+	}
+	return nil
+}
+
+// ValidateResourceLimits returns an error if memory or cpus can't be used as the limits of a container
+func ValidateResourceLimits(memory string, cpus string) error {
+	return applyResourceLimits(memory, cpus, &container.Config{}, &container.HostConfig{})
+}
+
+// parseContainerOptions applies the `docker create` style options string of a
+// job or service container to the container config. Options that are not
+// supported are logged and ignored.
+func parseContainerOptions(ctx context.Context, options string, config *container.Config, hostConfig *container.HostConfig) error {
+	logger := common.Logger(ctx)
+
+	args, err := shellquote.Split(options)
+	if err != nil {
+		return errors.Wrapf(err, "unable to parse container options '%s'", options)
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			logger.Warnf("Ignoring unexpected container option argument '%s'", arg)
+			continue
+		}
+
+		name, value := strings.TrimLeft(arg, "-"), ""
+		hasValue := false
+		if idx := strings.Index(name, "="); idx >= 0 {
+			name, value, hasValue = name[:idx], name[idx+1:], true
+		}
+		if alias, ok := containerOptionAliases[name]; ok && !strings.HasPrefix(arg, "--") {
+			name = alias
+		}
+
+		option, ok := containerOptions[name]
+		if !ok {
+			logger.Warnf("Ignoring unsupported container option '%s'", arg)
+			if !hasValue && i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				i++
+			}
+			continue
+		}
+
+		if !hasValue {
+			if option.isBool {
+				value = "true"
+			} else if i+1 < len(args) {
+				i++
+				value = args[i]
+			} else {
+				return fmt.Errorf("container option '%s' requires a value", arg)
+			}
+		}
+
+		if err := option.apply(value, config, hostConfig); err != nil {
+			return errors.Wrapf(err, "invalid value '%s' for container option '%s'", value, arg)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package container
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nektos/act/pkg/common"
+)
+
+func TestParseContainerOptions(t *testing.T) {
+	config := &container.Config{Env: []string{"FOO=bar"}}
+	hostConfig := &container.HostConfig{}
+
+	logger, hook := test.NewNullLogger()
+	ctx := common.WithLogger(context.Background(), logger)
+
+	err := parseContainerOptions(ctx, `--cpus 1.5 -m=512m --cap-add SYS_PTRACE --cap-add=NET_ADMIN --security-opt "seccomp=unconfined" --privileged --label a=b -e BAZ=qux --hostname builder --ulimit nofile=1024 --tmpfs /run:rw`, config, hostConfig)
+	assert.Nil(t, err)
+
+	assert.Equal(t, int64(1500000000), hostConfig.NanoCPUs)
+	assert.Equal(t, int64(512*1024*1024), hostConfig.Memory)
+	assert.Equal(t, []string{"SYS_PTRACE", "NET_ADMIN"}, []string(hostConfig.CapAdd))
+	assert.Equal(t, []string{"seccomp=unconfined"}, hostConfig.SecurityOpt)
+	assert.True(t, hostConfig.Privileged)
+	assert.Equal(t, map[string]string{"/run": "rw"}, hostConfig.Tmpfs)
+	assert.Equal(t, map[string]string{"a": "b"}, config.Labels)
+	assert.Equal(t, []string{"FOO=bar", "BAZ=qux"}, config.Env)
+	assert.Equal(t, "builder", config.Hostname)
+
+	if assert.Len(t, hook.AllEntries(), 1) {
+		assert.Contains(t, hook.LastEntry().Message, "--ulimit")
+	}
+}
+
+func TestParseContainerOptionsPrecedence(t *testing.T) {
+	config := &container.Config{}
+	hostConfig := &container.HostConfig{}
+
+	// global options come first, the options of the workflow follow
+	err := parseContainerOptions(context.Background(), "--memory 1g --dns 10.0.0.53 --memory 2g --dns 8.8.8.8", config, hostConfig)
+	assert.Nil(t, err)
+
+	assert.Equal(t, int64(2*1024*1024*1024), hostConfig.Memory)
+	assert.Equal(t, []string{"10.0.0.53", "8.8.8.8"}, hostConfig.DNS)
+}
+
+func TestParseContainerOptionsErrors(t *testing.T) {
+	tables := []struct {
+		options string
+		errMsg  string
+	}{
+		{"--cpus", "container option '--cpus' requires a value"},
+		{"--memory lots", "invalid value 'lots' for container option '--memory'"},
+		{"--privileged=maybe", "invalid value 'maybe' for container option '--privileged=maybe'"},
+		{`--label "a=b`, "unable to parse container options"},
+	}
+
+	for _, table := range tables {
+		err := parseContainerOptions(context.Background(), table.options, &container.Config{}, &container.HostConfig{})
+		assert.Error(t, err, table.options)
+		assert.Contains(t, err.Error(), table.errMsg, table.options)
+	}
+}
+
+func TestApplyResourceLimits(t *testing.T) {
+	config := &container.Config{}
+	hostConfig := &container.HostConfig{}
+
+	err := applyResourceLimits("512m", "2", config, hostConfig)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(512*1024*1024), hostConfig.Memory)
+	assert.Equal(t, int64(2000000000), hostConfig.NanoCPUs)
+
+	// the options of the container override the limits
+	err = parseContainerOptions(context.Background(), "--cpus 0.5", config, hostConfig)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(512*1024*1024), hostConfig.Memory)
+	assert.Equal(t, int64(500000000), hostConfig.NanoCPUs)
+
+	hostConfig = &container.HostConfig{}
+	err = applyResourceLimits("", "", config, hostConfig)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), hostConfig.Memory)
+	assert.Equal(t, int64(0), hostConfig.NanoCPUs)
+}
+
+func TestValidateResourceLimits(t *testing.T) {
+	assert.Nil(t, ValidateResourceLimits("1g", "1.5"))
+	assert.Contains(t, ValidateResourceLimits("lots", "").Error(), "invalid container memory limit 'lots'")
+	assert.Contains(t, ValidateResourceLimits("", "two").Error(), "invalid container cpus limit 'two'")
+	assert.Contains(t, ValidateResourceLimits("", "0").Error(), "invalid container cpus limit '0'")
+}
@@ -3,9 +3,13 @@ package container
 import (
 	"context"
 	"fmt"
+	"io"
+	"net"
 	"strings"
+	"time"
 
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/errdefs"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 
@@ -17,8 +21,15 @@ type NewDockerPullExecutorInput struct {
 	Image     string
 	ForcePull bool
 	Platform  string
+	Username  string
+	Password  string
+	Retries   int           // times to retry a pull that failed with a transient error, like a timeout or a reset connection
+	Backoff   time.Duration // time to wait before the first retry, doubled for every further one, DefaultPullBackoff if 0
 }
 
+// DefaultPullBackoff is the time to wait before the first retry of a pull if NewDockerPullExecutorInput.Backoff is 0
+const DefaultPullBackoff = 2 * time.Second
+
 // NewDockerPullExecutor function to create a run executor for the container
 func NewDockerPullExecutor(input NewDockerPullExecutorInput) common.Executor {
 	return func(ctx context.Context) error {
@@ -54,15 +65,118 @@ func NewDockerPullExecutor(input NewDockerPullExecutorInput) common.Executor {
 			return err
 		}
 
-		reader, err := cli.ImagePull(ctx, imageRef, types.ImagePullOptions{
-			Platform: input.Platform,
-		})
-		_ = logDockerResponse(logger, reader, err != nil)
+		pullOptions, err := imagePullOptions(input)
+		if err != nil {
+			return err
+		}
+
+		return pullImage(ctx, cli, imageRef, pullOptions, input.Retries, input.Backoff)
+	}
+}
+
+// imagePuller is the part of the docker client that pulls images
+type imagePuller interface {
+	ImagePull(ctx context.Context, refStr string, options types.ImagePullOptions) (io.ReadCloser, error)
+}
+
+// pullImage pulls imageRef and retries up to retries times if the pull fails with a transient error,
+// waiting backoff before the first retry and twice as long before every further one
+func pullImage(ctx context.Context, cli imagePuller, imageRef string, options types.ImagePullOptions, retries int, backoff time.Duration) error {
+	logger := common.Logger(ctx)
+	if backoff <= 0 {
+		backoff = DefaultPullBackoff
+	}
+	for attempt := 0; ; attempt++ {
+		reader, err := cli.ImagePull(ctx, imageRef, options)
 		if err != nil {
+			_ = logDockerResponse(logger, reader, true)
+		} else {
+			// errors while downloading the layers, like a reset connection, are in the response
+			err = logDockerResponse(logger, reader, false)
+		}
+		if err == nil || attempt >= retries || !isTransientPullError(err) {
 			return err
 		}
-		return nil
+
+		logger.Warnf("  \u26A0  Pulling image '%s' failed: %v, retrying in %s (%d/%d)", imageRef, err, backoff, attempt+1, retries)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// transientPullErrors are parts of the messages of pull errors that may not happen again, the daemon
+// reports most errors of the registry as plain messages without a type
+var transientPullErrors = []string{
+	"timeout",
+	"timed out",
+	"connection reset",
+	"connection refused",
+	"broken pipe",
+	"unexpected eof",
+	"i/o timeout",
+	"tls handshake",
+	"temporary failure",
+	"toomanyrequests",
+	"too many requests",
+	"service unavailable",
+	"bad gateway",
+	"gateway timeout",
+	"internal server error",
+}
+
+// permanentPullErrors are parts of the messages of pull errors that happen again on a retry
+var permanentPullErrors = []string{
+	"not found",
+	"manifest unknown",
+	"unauthorized",
+	"denied",
+	"authentication required",
+	"invalid reference format",
+}
+
+// isTransientPullError returns true if err is worth retrying the pull, like a network error or an
+// overloaded registry, but not if the image doesn't exist or the credentials are wrong
+func isTransientPullError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errdefs.IsNotFound(err) || errdefs.IsUnauthorized(err) || errdefs.IsForbidden(err) || errdefs.IsInvalidParameter(err) {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	for _, permanent := range permanentPullErrors {
+		if strings.Contains(msg, permanent) {
+			return false
+		}
+	}
+	if errdefs.IsUnavailable(err) || errdefs.IsDeadline(err) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	for _, transient := range transientPullErrors {
+		if strings.Contains(msg, transient) {
+			return true
+		}
+	}
+	return false
+}
+
+func imagePullOptions(input NewDockerPullExecutorInput) (types.ImagePullOptions, error) {
+	auth, err := registryAuth(input.Image, input.Username, input.Password)
+	if err != nil {
+		return types.ImagePullOptions{}, err
 	}
+	return types.ImagePullOptions{
+		Platform:     input.Platform,
+		RegistryAuth: auth,
+	}, nil
 }
 
 func cleanImage(image string) string {
@@ -1,8 +1,16 @@
 package container
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/errdefs"
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
@@ -27,3 +35,54 @@ func TestCleanImage(t *testing.T) {
 		assert.Equal(t, table.imageOut, imageOut)
 	}
 }
+
+// pullRecorder fails the pulls with errs in order, a nil error is a pull that succeeds
+type pullRecorder struct {
+	errs  []error
+	pulls int
+}
+
+func (pr *pullRecorder) ImagePull(ctx context.Context, refStr string, options types.ImagePullOptions) (io.ReadCloser, error) {
+	err := pr.errs[pr.pulls]
+	pr.pulls++
+	if err != nil && strings.HasPrefix(err.Error(), "stream: ") {
+		// an error while downloading the layers is only in the response
+		body := fmt.Sprintf(`{"status":"Downloading"}`+"\n"+`{"errorDetail":{"message":%q},"error":%q}`+"\n", err.Error(), err.Error())
+		return ioutil.NopCloser(strings.NewReader(body)), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(strings.NewReader(`{"status":"Pull complete"}` + "\n")), nil
+}
+
+func TestPullImageRetries(t *testing.T) {
+	timeout := errdefs.Unavailable(fmt.Errorf("Get https://registry-1.docker.io/v2/: net/http: TLS handshake timeout"))
+	reset := fmt.Errorf("stream: read tcp 10.0.0.2:443: read: connection reset by peer")
+	notFound := errdefs.NotFound(fmt.Errorf("manifest for node:404 not found"))
+
+	tables := []struct {
+		retries int
+		errs    []error
+		pulls   int
+		err     string
+	}{
+		{2, []error{nil}, 1, ""},
+		{2, []error{timeout, reset, nil}, 3, ""},
+		{1, []error{timeout, reset}, 2, reset.Error()},
+		{0, []error{timeout}, 1, timeout.Error()},
+		{2, []error{notFound}, 1, notFound.Error()},
+		{2, []error{fmt.Errorf("unauthorized: incorrect username or password")}, 1, "unauthorized: incorrect username or password"},
+	}
+
+	for _, table := range tables {
+		recorder := &pullRecorder{errs: table.errs}
+		err := pullImage(context.Background(), recorder, "docker.io/library/node:16", types.ImagePullOptions{}, table.retries, time.Millisecond)
+		assert.Equal(t, table.pulls, recorder.pulls, table.errs)
+		if table.err == "" {
+			assert.Nil(t, err)
+		} else {
+			assert.EqualError(t, err, table.err)
+		}
+	}
+}
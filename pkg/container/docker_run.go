@@ -13,6 +13,7 @@ import (
 	"regexp"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/go-git/go-billy/v5/helper/polyfill"
 	"github.com/go-git/go-billy/v5/osfs"
@@ -24,6 +25,7 @@ import (
 	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-connections/nat"
 	specs "github.com/opencontainers/image-spec/specs-go/v1"
 
 	"github.com/Masterminds/semver"
@@ -50,6 +52,17 @@ type NewContainerInput struct {
 	Privileged  bool
 	UsernsMode  string
 	Platform    string
+	Options     string
+	Ports       []string
+	Memory      string        // default memory limit (e.g. 512m), overridden by Options
+	CPUs        string        // default number of CPUs (e.g. 1.5), overridden by Options
+	Init        bool          // run an init process as PID 1 that reaps zombie processes and forwards signals, like `docker create --init`
+	OpenStdin   bool          // keep the stdin of the container open even if nothing is attached to it, like `docker create --interactive`
+	StopTimeout time.Duration // time the processes of the container have to exit after SIGTERM when it is removed, before they are killed, 0 kills them at once
+	Username    string        // username to pull the image with
+	Password    string        // password to pull the image with
+	PullRetries int           // times to retry a pull that failed with a transient error
+	PullBackoff time.Duration // time to wait before the first retry of a pull, doubled for every further one
 }
 
 // FileEntry is a file to copy to a container
@@ -67,10 +80,20 @@ type Container interface {
 	Pull(forcePull bool) common.Executor
 	Start(attach bool) common.Executor
 	Exec(command []string, env map[string]string) common.Executor
-	UpdateFromGithubEnv(env *map[string]string) common.Executor
+	UpdateFromEnvFile(srcPath string, env *map[string]string) common.Executor
+	UpdateFromPath(env *map[string]string) common.Executor
 	Remove() common.Executor
 }
 
+// ExitCodeError is returned when a command in a container exits with a non-zero code
+type ExitCodeError struct {
+	ExitCode int
+}
+
+func (e ExitCodeError) Error() string {
+	return fmt.Sprintf("exit with `FAILURE`: %v", e.ExitCode)
+}
+
 // NewContainer creates a reference to a container
 func NewContainer(input *NewContainerInput) Container {
 	cr := new(containerReference)
@@ -126,6 +149,10 @@ func (cr *containerReference) Pull(forcePull bool) common.Executor {
 		Image:     cr.input.Image,
 		ForcePull: forcePull,
 		Platform:  cr.input.Platform,
+		Username:  cr.input.Username,
+		Password:  cr.input.Password,
+		Retries:   cr.input.PullRetries,
+		Backoff:   cr.input.PullBackoff,
 	})
 }
 func (cr *containerReference) Copy(destPath string, files ...*FileEntry) common.Executor {
@@ -146,8 +173,12 @@ func (cr *containerReference) CopyDir(destPath string, srcPath string, useGitIgn
 	).IfNot(common.Dryrun)
 }
 
-func (cr *containerReference) UpdateFromGithubEnv(env *map[string]string) common.Executor {
-	return cr.extractGithubEnv(env).IfNot(common.Dryrun)
+func (cr *containerReference) UpdateFromEnvFile(srcPath string, env *map[string]string) common.Executor {
+	return cr.extractEnv(srcPath, env).IfNot(common.Dryrun)
+}
+
+func (cr *containerReference) UpdateFromPath(env *map[string]string) common.Executor {
+	return cr.extractPath(env).IfNot(common.Dryrun)
 }
 
 func (cr *containerReference) Exec(command []string, env map[string]string) common.Executor {
@@ -172,14 +203,13 @@ type containerReference struct {
 	input *NewContainerInput
 }
 
+// GetDockerClient returns a client of the daemon at the socket of WithDaemonSocket, DOCKER_HOST or the
+// detected socket, which can also be the Docker compatible API of Podman
 func GetDockerClient(ctx context.Context) (*client.Client, error) {
 	var err error
 	var cli *client.Client
 
-	// TODO: this should maybe need to be a global option, not hidden in here?
-	//       though i'm not sure how that works out when there's another Executor :D
-	//		 I really would like something that works on OSX native for eg
-	dockerHost := os.Getenv("DOCKER_HOST")
+	dockerHost := daemonSocket(ctx)
 
 	if strings.HasPrefix(dockerHost, "ssh://") {
 		var helper *connhelper.ConnectionHelper
@@ -192,6 +222,8 @@ func GetDockerClient(ctx context.Context) (*client.Client, error) {
 			client.WithHost(helper.Host),
 			client.WithDialContext(helper.Dialer),
 		)
+	} else if dockerHost != "" {
+		cli, err = client.NewClientWithOpts(client.FromEnv, client.WithHost(dockerHost))
 	} else {
 		cli, err = client.NewClientWithOpts(client.FromEnv)
 	}
@@ -245,23 +277,40 @@ func (cr *containerReference) find() common.Executor {
 
 func (cr *containerReference) remove() common.Executor {
 	return func(ctx context.Context) error {
-		if cr.id == "" {
-			return nil
-		}
+		return cr.removeWith(ctx, cr.cli)
+	}
+}
 
-		logger := common.Logger(ctx)
-		err := cr.cli.ContainerRemove(context.Background(), cr.id, types.ContainerRemoveOptions{
-			RemoveVolumes: true,
-			Force:         true,
-		})
-		if err != nil {
-			logger.Error(errors.WithStack(err))
-		}
+// containerRemover is the part of the docker client that stops and removes containers
+type containerRemover interface {
+	ContainerStop(ctx context.Context, containerID string, timeout *time.Duration) error
+	ContainerRemove(ctx context.Context, containerID string, options types.ContainerRemoveOptions) error
+}
 
-		logger.Debugf("Removed container: %v", cr.id)
-		cr.id = ""
+// removeWith removes the container and its volumes with cli. With a StopTimeout its processes get SIGTERM
+// first and are killed if they haven't exited after it, otherwise they are killed at once.
+func (cr *containerReference) removeWith(ctx context.Context, cli containerRemover) error {
+	if cr.id == "" {
 		return nil
 	}
+
+	logger := common.Logger(ctx)
+	if timeout := cr.input.StopTimeout; timeout > 0 {
+		if err := cli.ContainerStop(context.Background(), cr.id, &timeout); err != nil {
+			logger.Debugf("Unable to stop container %v, it is killed: %v", cr.id, err)
+		}
+	}
+	err := cli.ContainerRemove(context.Background(), cr.id, types.ContainerRemoveOptions{
+		RemoveVolumes: true,
+		Force:         true,
+	})
+	if err != nil {
+		logger.Error(errors.WithStack(err))
+	}
+
+	logger.Debugf("Removed container: %v", cr.id)
+	cr.id = ""
+	return nil
 }
 
 func (cr *containerReference) create() common.Executor {
@@ -280,15 +329,7 @@ func (cr *containerReference) create() common.Executor {
 			WorkingDir: input.WorkingDir,
 			Env:        input.Env,
 			Tty:        isTerminal,
-		}
-
-		mounts := make([]mount.Mount, 0)
-		for mountSource, mountTarget := range input.Mounts {
-			mounts = append(mounts, mount.Mount{
-				Type:   mount.TypeVolume,
-				Source: mountSource,
-				Target: mountTarget,
-			})
+			OpenStdin:  input.OpenStdin,
 		}
 
 		var platSpecs *specs.Platform
@@ -304,13 +345,22 @@ func (cr *containerReference) create() common.Executor {
 				OS:           desiredPlatform[0],
 			}
 		}
-		resp, err := cr.cli.ContainerCreate(ctx, config, &container.HostConfig{
-			Binds:       input.Binds,
-			Mounts:      mounts,
-			NetworkMode: container.NetworkMode(input.NetworkMode),
-			Privileged:  input.Privileged,
-			UsernsMode:  container.UsernsMode(input.UsernsMode),
-		}, nil, platSpecs, input.Name)
+		hostConfig := newHostConfig(input)
+		if err := applyResourceLimits(input.Memory, input.CPUs, config, hostConfig); err != nil {
+			return err
+		}
+		if err := parseContainerOptions(ctx, input.Options, config, hostConfig); err != nil {
+			return err
+		}
+
+		exposedPorts, portBindings, err := nat.ParsePortSpecs(input.Ports)
+		if err != nil {
+			return errors.Wrapf(err, "invalid container ports %v", input.Ports)
+		}
+		config.ExposedPorts = exposedPorts
+		hostConfig.PortBindings = portBindings
+
+		resp, err := cr.cli.ContainerCreate(ctx, config, hostConfig, nil, platSpecs, input.Name)
 		if err != nil {
 			return errors.WithStack(err)
 		}
@@ -322,51 +372,129 @@ func (cr *containerReference) create() common.Executor {
 	}
 }
 
-var singleLineEnvPattern, mulitiLineEnvPattern *regexp.Regexp
+// newHostConfig returns the host config of a container for input, before the resource limits and options are applied
+func newHostConfig(input *NewContainerInput) *container.HostConfig {
+	mounts := make([]mount.Mount, 0)
+	for mountSource, mountTarget := range input.Mounts {
+		mounts = append(mounts, mount.Mount{
+			Type:   mount.TypeVolume,
+			Source: mountSource,
+			Target: mountTarget,
+		})
+	}
 
-func (cr *containerReference) extractGithubEnv(env *map[string]string) common.Executor {
-	if singleLineEnvPattern == nil {
-		singleLineEnvPattern = regexp.MustCompile("^([^=]+)=([^=]+)$")
-		mulitiLineEnvPattern = regexp.MustCompile(`^([^<]+)<<(\w+)$`)
+	hostConfig := &container.HostConfig{
+		Binds:       input.Binds,
+		Mounts:      mounts,
+		NetworkMode: container.NetworkMode(input.NetworkMode),
+		Privileged:  input.Privileged,
+		UsernsMode:  container.UsernsMode(input.UsernsMode),
+	}
+	// left unset if disabled, so the default-init of the docker daemon still applies
+	if input.Init {
+		enabled := true
+		hostConfig.Init = &enabled
 	}
+	return hostConfig
+}
+
+var singleLineEnvPattern, mulitiLineEnvPattern *regexp.Regexp
 
+func (cr *containerReference) extractEnv(srcPath string, env *map[string]string) common.Executor {
 	localEnv := *env
 	return func(ctx context.Context) error {
-		githubEnvTar, _, err := cr.cli.CopyFromContainer(ctx, cr.id, localEnv["GITHUB_ENV"])
+		envTar, _, err := cr.cli.CopyFromContainer(ctx, cr.id, srcPath)
 		if err != nil {
 			return nil
 		}
-		reader := tar.NewReader(githubEnvTar)
+		reader := tar.NewReader(envTar)
 		_, err = reader.Next()
 		if err != nil && err != io.EOF {
 			return errors.WithStack(err)
 		}
-		s := bufio.NewScanner(reader)
-		multiLineEnvKey := ""
-		multiLineEnvDelimiter := ""
-		multiLineEnvContent := ""
-		for s.Scan() {
-			line := s.Text()
-			if singleLineEnv := singleLineEnvPattern.FindStringSubmatch(line); singleLineEnv != nil {
-				localEnv[singleLineEnv[1]] = singleLineEnv[2]
-			}
+		parseEnvFile(reader, localEnv)
+		env = &localEnv
+		return nil
+	}
+}
+
+func (cr *containerReference) extractPath(env *map[string]string) common.Executor {
+	localEnv := *env
+	return func(ctx context.Context) error {
+		srcPath := localEnv["GITHUB_PATH"]
+		if strings.TrimSpace(srcPath) == "" {
+			return nil
+		}
+		pathTar, _, err := cr.cli.CopyFromContainer(ctx, cr.id, srcPath)
+		if client.IsErrNotFound(err) {
+			return nil
+		} else if err != nil {
+			return errors.WithStack(err)
+		}
+		defer pathTar.Close()
+		reader := tar.NewReader(pathTar)
+		_, err = reader.Next()
+		if err != nil && err != io.EOF {
+			return errors.WithStack(err)
+		}
+		prependPathFile(reader, localEnv, DefaultPathEnv)
+		return nil
+	}
+}
+
+// DefaultPathEnv is the PATH of a container whose image doesn't set one
+const DefaultPathEnv = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// prependPathFile prepends the directories in r, one per line like the ones written to GITHUB_PATH,
+// to the PATH in env, or to defaultPath if env has none. Directories added later come first, so they
+// take precedence.
+func prependPathFile(r io.Reader, env map[string]string, defaultPath string) {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		dir := strings.TrimSpace(s.Text())
+		if dir == "" {
+			continue
+		}
+		if env["PATH"] == "" {
+			env["PATH"] = defaultPath
+		}
+		env["PATH"] = dir + ":" + env["PATH"]
+	}
+}
+
+// parseEnvFile reads `key=value` and `key<<delimiter` heredoc entries, like the ones
+// written to GITHUB_ENV, into env, the value of a `key=value` entry is all after the first =
+func parseEnvFile(r io.Reader, env map[string]string) {
+	if singleLineEnvPattern == nil {
+		singleLineEnvPattern = regexp.MustCompile("^([^=]+)=(.*)$")
+		mulitiLineEnvPattern = regexp.MustCompile(`^([^<]+)<<(\w+)$`)
+	}
+
+	s := bufio.NewScanner(r)
+	multiLineEnvKey := ""
+	multiLineEnvDelimiter := ""
+	multiLineEnvContent := ""
+	for s.Scan() {
+		line := s.Text()
+		if multiLineEnvDelimiter != "" {
+			// the lines of a heredoc are its content, even if they look like an entry
 			if line == multiLineEnvDelimiter {
-				localEnv[multiLineEnvKey] = multiLineEnvContent
+				env[multiLineEnvKey] = multiLineEnvContent
 				multiLineEnvKey, multiLineEnvDelimiter, multiLineEnvContent = "", "", ""
+				continue
 			}
-			if multiLineEnvKey != "" && multiLineEnvDelimiter != "" {
-				if multiLineEnvContent != "" {
-					multiLineEnvContent += "\n"
-				}
-				multiLineEnvContent += line
-			}
-			if mulitiLineEnvStart := mulitiLineEnvPattern.FindStringSubmatch(line); mulitiLineEnvStart != nil {
-				multiLineEnvKey = mulitiLineEnvStart[1]
-				multiLineEnvDelimiter = mulitiLineEnvStart[2]
+			if multiLineEnvContent != "" {
+				multiLineEnvContent += "\n"
 			}
+			multiLineEnvContent += line
+			continue
+		}
+		if singleLineEnv := singleLineEnvPattern.FindStringSubmatch(line); singleLineEnv != nil {
+			env[singleLineEnv[1]] = singleLineEnv[2]
+		} else if mulitiLineEnvStart := mulitiLineEnvPattern.FindStringSubmatch(line); mulitiLineEnvStart != nil {
+			multiLineEnvKey = mulitiLineEnvStart[1]
+			multiLineEnvDelimiter = mulitiLineEnvStart[2]
 		}
-		env = &localEnv
-		return nil
 	}
 }
 
@@ -442,7 +570,7 @@ func (cr *containerReference) exec(cmd []string, env map[string]string) common.E
 			return nil
 		}
 
-		return fmt.Errorf("exit with `FAILURE`: %v", inspectResp.ExitCode)
+		return ExitCodeError{ExitCode: inspectResp.ExitCode}
 	}
 }
 
@@ -658,6 +786,6 @@ func (cr *containerReference) wait() common.Executor {
 			return nil
 		}
 
-		return fmt.Errorf("exit with `FAILURE`: %v", statusCode)
+		return ExitCodeError{ExitCode: int(statusCode)}
 	}
 }
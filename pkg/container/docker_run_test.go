@@ -0,0 +1,71 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEnvFile(t *testing.T) {
+	env := map[string]string{"EXISTING": "value"}
+	parseEnvFile(strings.NewReader("KEY=value\nMULTI<<EOF\nfirst\nsecond=2\nEOF\nOTHER=other\nURL=https://x?a=b\nB64=YQ==\nEMPTY=\n"), env)
+
+	assert.Equal(t, map[string]string{
+		"EXISTING": "value",
+		"KEY":      "value",
+		"MULTI":    "first\nsecond=2",
+		"OTHER":    "other",
+		"URL":      "https://x?a=b",
+		"B64":      "YQ==",
+		"EMPTY":    "",
+	}, env)
+}
+
+func TestNewHostConfigInit(t *testing.T) {
+	hostConfig := newHostConfig(&NewContainerInput{})
+	assert.Nil(t, hostConfig.Init)
+
+	hostConfig = newHostConfig(&NewContainerInput{Init: true})
+	if assert.NotNil(t, hostConfig.Init) {
+		assert.True(t, *hostConfig.Init)
+	}
+
+	err := parseContainerOptions(context.Background(), "--init=false", &container.Config{}, hostConfig)
+	assert.Nil(t, err)
+	assert.False(t, *hostConfig.Init)
+}
+
+type removeRecorder struct {
+	calls []string
+}
+
+func (rr *removeRecorder) ContainerStop(ctx context.Context, containerID string, timeout *time.Duration) error {
+	rr.calls = append(rr.calls, fmt.Sprintf("stop %s %v", containerID, *timeout))
+	return nil
+}
+
+func (rr *removeRecorder) ContainerRemove(ctx context.Context, containerID string, options types.ContainerRemoveOptions) error {
+	rr.calls = append(rr.calls, fmt.Sprintf("remove %s", containerID))
+	return nil
+}
+
+func TestContainerRemove(t *testing.T) {
+	// the processes get SIGTERM and the StopTimeout of the input to exit before the container is removed
+	recorder := &removeRecorder{}
+	cr := &containerReference{id: "abc123", input: &NewContainerInput{StopTimeout: 7 * time.Second}}
+	assert.Nil(t, cr.removeWith(context.Background(), recorder))
+	assert.Equal(t, []string{"stop abc123 7s", "remove abc123"}, recorder.calls)
+	assert.Equal(t, "", cr.id)
+
+	// without one they are killed at once
+	recorder = &removeRecorder{}
+	cr = &containerReference{id: "abc123", input: &NewContainerInput{}}
+	assert.Nil(t, cr.removeWith(context.Background(), recorder))
+	assert.Equal(t, []string{"remove abc123"}, recorder.calls)
+}
@@ -0,0 +1,108 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/client"
+)
+
+type daemonSocketContextKey string
+
+const daemonSocketContextKeyVal = daemonSocketContextKey("container.daemonSocket")
+
+// DefaultDockerSocket is where the docker daemon listens if DOCKER_HOST isn't set
+const DefaultDockerSocket = "/var/run/docker.sock"
+
+// WithDaemonSocket adds the socket (e.g. unix:///run/user/1000/podman/podman.sock or tcp://host:2376) of the
+// daemon the containers are created with to the context. The daemon is detected if socket is empty.
+func WithDaemonSocket(ctx context.Context, socket string) context.Context {
+	return context.WithValue(ctx, daemonSocketContextKeyVal, socket)
+}
+
+// daemonSocket returns the socket of the context, DOCKER_HOST or else the detected socket. It is empty
+// when the docker client should use its defaults.
+func daemonSocket(ctx context.Context) string {
+	if socket, ok := ctx.Value(daemonSocketContextKeyVal).(string); ok && socket != "" {
+		return socket
+	}
+	if dockerHost := os.Getenv("DOCKER_HOST"); dockerHost != "" {
+		return dockerHost
+	}
+	return DetectDaemonSocket()
+}
+
+// podmanSockets are where the Docker compatible API of Podman listens, rootless and rootful
+func podmanSockets() []string {
+	sockets := make([]string, 0, 2)
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		sockets = append(sockets, filepath.Join(runtimeDir, "podman", "podman.sock"))
+	}
+	return append(sockets, "/run/podman/podman.sock")
+}
+
+// PodmanSocket returns the socket of the Docker compatible API of Podman, empty if it isn't listening.
+// Rootless Podman listens once the podman.socket unit of the user is enabled (or `podman system service` runs).
+func PodmanSocket() string {
+	for _, socket := range podmanSockets() {
+		if info, err := os.Stat(socket); err == nil && info.Mode()&os.ModeSocket != 0 {
+			return "unix://" + socket
+		}
+	}
+	return ""
+}
+
+// DetectDaemonSocket returns the socket of Podman if there is no docker daemon at DefaultDockerSocket, so
+// act can use Podman instead of docker without any configuration. It is empty if the default is used.
+// Podman is supported through its Docker compatible API: the docker client of GetDockerClient is connected
+// to its socket, so there is a single implementation of Container for both daemons.
+func DetectDaemonSocket() string {
+	if runtime.GOOS == "windows" {
+		return ""
+	}
+	if _, err := os.Stat(DefaultDockerSocket); err == nil {
+		return ""
+	}
+	return PodmanSocket()
+}
+
+// daemonCheckTimeout is how long CheckDaemon waits for the daemon to answer
+var daemonCheckTimeout = 10 * time.Second
+
+// ValidateDaemonSocket returns an error if socket isn't the URL of a daemon, e.g. unix:///var/run/docker.sock,
+// tcp://host:2376 or ssh://user@host. An empty socket is valid, the daemon is detected then.
+func ValidateDaemonSocket(socket string) error {
+	if socket == "" || strings.HasPrefix(socket, "ssh://") {
+		return nil
+	}
+	if _, err := client.ParseHostURL(socket); err != nil {
+		return fmt.Errorf("invalid container daemon socket '%s': %w", socket, err)
+	}
+	return nil
+}
+
+// CheckDaemon returns an error if the daemon at the socket of the context doesn't answer, so a wrong
+// socket fails before the first job instead of when it creates its container
+func CheckDaemon(ctx context.Context) error {
+	socket := daemonSocket(ctx)
+	if socket == "" {
+		socket = client.DefaultDockerHost
+	}
+	cli, err := GetDockerClient(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to connect to the container daemon at %s: %w", socket, err)
+	}
+	defer cli.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, daemonCheckTimeout)
+	defer cancel()
+	if _, err := cli.Ping(ctx); err != nil {
+		return fmt.Errorf("unable to reach the container daemon at %s: %w", socket, err)
+	}
+	return nil
+}
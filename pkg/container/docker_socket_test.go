@@ -0,0 +1,89 @@
+package container
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setEnv(t *testing.T, key string, value string) func() {
+	old, ok := os.LookupEnv(key)
+	assert.NoError(t, os.Setenv(key, value))
+	return func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+func TestDaemonSocket(t *testing.T) {
+	defer setEnv(t, "DOCKER_HOST", "tcp://docker.example.com:2376")()
+
+	assert.Equal(t, "tcp://docker.example.com:2376", daemonSocket(context.Background()))
+	assert.Equal(t, "tcp://docker.example.com:2376", daemonSocket(WithDaemonSocket(context.Background(), "")))
+	ctx := WithDaemonSocket(context.Background(), "unix:///run/podman/podman.sock")
+	assert.Equal(t, "unix:///run/podman/podman.sock", daemonSocket(ctx))
+
+	cli, err := GetDockerClient(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "unix:///run/podman/podman.sock", cli.DaemonHost())
+}
+
+func TestPodmanSocket(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("podman listens on a unix socket")
+	}
+
+	dir, err := ioutil.TempDir("", "act-podman-socket")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer setEnv(t, "XDG_RUNTIME_DIR", dir)()
+
+	socket := filepath.Join(dir, "podman", "podman.sock")
+	assert.NotEqual(t, "unix://"+socket, PodmanSocket())
+
+	assert.NoError(t, os.MkdirAll(filepath.Dir(socket), 0700))
+	listener, err := net.Listen("unix", socket)
+	assert.NoError(t, err)
+	defer listener.Close()
+	assert.Equal(t, "unix://"+socket, PodmanSocket())
+}
+
+func TestValidateDaemonSocket(t *testing.T) {
+	assert.NoError(t, ValidateDaemonSocket(""))
+	assert.NoError(t, ValidateDaemonSocket("unix:///var/run/docker.sock"))
+	assert.NoError(t, ValidateDaemonSocket("tcp://docker.example.com:2376"))
+	assert.NoError(t, ValidateDaemonSocket("ssh://user@docker.example.com"))
+	assert.Error(t, ValidateDaemonSocket("docker.example.com"))
+}
+
+func TestCheckDaemon(t *testing.T) {
+	pings := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/_ping") {
+			pings++
+		}
+		w.Header().Set("API-Version", "1.41")
+		w.WriteHeader(http.StatusOK)
+	}))
+	socket := "tcp://" + server.Listener.Addr().String()
+
+	assert.NoError(t, CheckDaemon(WithDaemonSocket(context.Background(), socket)))
+	assert.NotZero(t, pings)
+
+	server.Close()
+	err := CheckDaemon(WithDaemonSocket(context.Background(), socket))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unable to reach the container daemon at "+socket)
+}
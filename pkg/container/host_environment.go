@@ -0,0 +1,203 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/nektos/act/pkg/common"
+)
+
+// HostImage is the image of a platform whose jobs run directly on the host instead of in a container
+const HostImage = "-self-hosted"
+
+// hostEnvironment runs the commands of a job on the host. The paths in the container are the same
+// paths on the host, so there is nothing to create, start or remove.
+type hostEnvironment struct {
+	input *NewContainerInput
+}
+
+// NewHostEnvironment returns a Container that runs its commands on the host in input.WorkingDir with
+// the environment of act and input.Env. The image, mounts, binds and options of input are ignored.
+func NewHostEnvironment(input *NewContainerInput) Container {
+	return &hostEnvironment{input: input}
+}
+
+func (he *hostEnvironment) Create() common.Executor {
+	return func(ctx context.Context) error {
+		common.Logger(ctx).Warnf("⚠  Running the job on the host in %s, not in a container", he.input.WorkingDir)
+		return nil
+	}
+}
+
+func (he *hostEnvironment) Pull(forcePull bool) common.Executor {
+	return func(ctx context.Context) error {
+		return nil
+	}
+}
+
+func (he *hostEnvironment) Start(attach bool) common.Executor {
+	return func(ctx context.Context) error {
+		return nil
+	}
+}
+
+func (he *hostEnvironment) Remove() common.Executor {
+	return func(ctx context.Context) error {
+		return nil
+	}
+}
+
+func (he *hostEnvironment) Copy(destPath string, files ...*FileEntry) common.Executor {
+	return he.copy(destPath, files...).IfNot(common.Dryrun)
+}
+
+func (he *hostEnvironment) copy(destPath string, files ...*FileEntry) common.Executor {
+	return func(ctx context.Context) error {
+		for _, file := range files {
+			path := filepath.Join(destPath, file.Name)
+			common.Logger(ctx).Debugf("Writing %s", path)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(path, []byte(file.Body), os.FileMode(file.Mode)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func (he *hostEnvironment) CopyDir(destPath string, srcPath string, useGitIgnore bool) common.Executor {
+	return he.copyDir(destPath, srcPath, useGitIgnore).IfNot(common.Dryrun)
+}
+
+func (he *hostEnvironment) copyDir(destPath string, srcPath string, useGitIgnore bool) common.Executor {
+	return func(ctx context.Context) error {
+		srcPath, destPath = filepath.Clean(srcPath), filepath.Clean(destPath)
+		if srcPath == destPath {
+			return nil
+		}
+		common.Logger(ctx).Debugf("Copying %s to %s", srcPath, destPath)
+		return filepath.Walk(srcPath, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(srcPath, path)
+			if err != nil {
+				return err
+			}
+			target := filepath.Join(destPath, rel)
+			if info.IsDir() {
+				return os.MkdirAll(target, info.Mode()|0700)
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			return copyFile(path, target, info.Mode())
+		})
+	}
+}
+
+func copyFile(src string, dest string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func (he *hostEnvironment) Exec(command []string, env map[string]string) common.Executor {
+	return he.exec(command, env).IfNot(common.Dryrun)
+}
+
+func (he *hostEnvironment) exec(command []string, env map[string]string) common.Executor {
+	return func(ctx context.Context) error {
+		common.Logger(ctx).Debugf("Exec command '%s' on the host", command)
+		if len(command) == 0 {
+			return errors.New("no command to execute")
+		}
+
+		cmd := exec.CommandContext(ctx, command[0], command[1:]...) // #nosec G204
+		cmd.Dir = he.input.WorkingDir
+		cmd.Env = append(os.Environ(), he.input.Env...)
+		for k, v := range env {
+			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
+		}
+		cmd.Stdout = he.input.Stdout
+		if cmd.Stdout == nil {
+			cmd.Stdout = os.Stdout
+		}
+		cmd.Stderr = he.input.Stderr
+		if cmd.Stderr == nil {
+			cmd.Stderr = os.Stderr
+		}
+
+		err := cmd.Run()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return ExitCodeError{ExitCode: exitErr.ExitCode()}
+		}
+		return err
+	}
+}
+
+func (he *hostEnvironment) UpdateFromEnvFile(srcPath string, env *map[string]string) common.Executor {
+	return he.updateFromEnvFile(srcPath, env).IfNot(common.Dryrun)
+}
+
+func (he *hostEnvironment) UpdateFromPath(env *map[string]string) common.Executor {
+	return he.updateFromPath(env).IfNot(common.Dryrun)
+}
+
+func (he *hostEnvironment) updateFromPath(env *map[string]string) common.Executor {
+	return func(ctx context.Context) error {
+		srcPath := (*env)["GITHUB_PATH"]
+		if strings.TrimSpace(srcPath) == "" {
+			return nil
+		}
+		f, err := os.Open(srcPath)
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		defer f.Close()
+		prependPathFile(f, *env, os.Getenv("PATH"))
+		return nil
+	}
+}
+
+func (he *hostEnvironment) updateFromEnvFile(srcPath string, env *map[string]string) common.Executor {
+	return func(ctx context.Context) error {
+		if strings.TrimSpace(srcPath) == "" {
+			return nil
+		}
+		f, err := os.Open(srcPath)
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		defer f.Close()
+		parseEnvFile(f, *env)
+		return nil
+	}
+}
@@ -0,0 +1,79 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostEnvironmentExec(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the host environment is not supported on windows")
+	}
+
+	dir, err := ioutil.TempDir("", "act-host-environment")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	output := &bytes.Buffer{}
+	he := NewHostEnvironment(&NewContainerInput{
+		WorkingDir: dir,
+		Env:        []string{"FROM_INPUT=input"},
+		Stdout:     output,
+		Stderr:     output,
+	})
+	ctx := context.Background()
+
+	err = he.Copy(dir, &FileEntry{
+		Name: "workflow/script.sh",
+		Mode: 0755,
+		Body: "echo \"$PWD $FROM_INPUT $FROM_STEP\"\necho \"NAME=value\" >> \"$GITHUB_ENV\"\n",
+	})(ctx)
+	assert.Nil(t, err)
+
+	env := map[string]string{
+		"FROM_STEP":  "step",
+		"GITHUB_ENV": filepath.Join(dir, "workflow", "envs.txt"),
+	}
+	err = he.Exec([]string{"sh", "-e", "workflow/script.sh"}, env)(ctx)
+	assert.Nil(t, err)
+	realDir, err := filepath.EvalSymlinks(dir)
+	assert.Nil(t, err)
+	assert.Contains(t, output.String(), realDir+" input step")
+
+	err = he.UpdateFromEnvFile(env["GITHUB_ENV"], &env)(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "value", env["NAME"])
+
+	err = he.Exec([]string{"sh", "-c", "exit 3"}, nil)(ctx)
+	assert.EqualError(t, err, "exit with `FAILURE`: 3")
+}
+
+func TestHostEnvironmentCopyDir(t *testing.T) {
+	src, err := ioutil.TempDir("", "act-host-environment-src")
+	assert.Nil(t, err)
+	defer os.RemoveAll(src)
+	dest, err := ioutil.TempDir("", "act-host-environment-dest")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dest)
+
+	assert.Nil(t, os.MkdirAll(filepath.Join(src, "dir"), 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(src, "dir", "file.txt"), []byte("content"), 0644))
+
+	he := NewHostEnvironment(&NewContainerInput{WorkingDir: dest})
+	err = he.CopyDir(filepath.Join(dest, "_actions", "action"), src+"/", false)(context.Background())
+	assert.Nil(t, err)
+
+	content, err := ioutil.ReadFile(filepath.Join(dest, "_actions", "action", "dir", "file.txt"))
+	assert.Nil(t, err)
+	assert.Equal(t, "content", string(content))
+
+	err = he.CopyDir(src, src+"/.", false)(context.Background())
+	assert.Nil(t, err)
+}
@@ -46,8 +46,12 @@ type ActionRuns struct {
 	Using      ActionRunsUsing   `yaml:"using"`
 	Env        map[string]string `yaml:"env"`
 	Main       string            `yaml:"main"`
+	Pre        string            `yaml:"pre"`
+	PreIf      string            `yaml:"pre-if"`
+	Post       string            `yaml:"post"`
+	PostIf     string            `yaml:"post-if"`
 	Image      string            `yaml:"image"`
-	Entrypoint []string          `yaml:"entrypoint"`
+	Entrypoint string            `yaml:"entrypoint"`
 	Args       []string          `yaml:"args"`
 	Steps      []Step            `yaml:"steps"`
 }
@@ -79,9 +83,69 @@ type Output struct {
 	Value       string `yaml:"value"`
 }
 
-// ReadAction reads an action from a reader
+// ReadAction reads an action from a reader. Every step of a composite action must be a `run` step with a
+// `shell` or a `uses` step of an action
 func ReadAction(in io.Reader) (*Action, error) {
 	a := new(Action)
 	err := yaml.NewDecoder(in).Decode(a)
-	return a, err
+	if err != nil {
+		return a, err
+	}
+	if a.Runs.Using == ActionRunsUsingComposite {
+		for i := range a.Runs.Steps {
+			if err := a.Runs.Steps[i].Validate(); err != nil {
+				return a, fmt.Errorf("invalid composite action '%s': %w", a.Name, err)
+			}
+		}
+	}
+	return a, nil
+}
+
+// ActionJobID is the id of the job of a workflow created with NewActionWorkflow
+const ActionJobID = "action"
+
+// NewActionWorkflow returns a workflow that runs the steps of a composite action in a single job, so the
+// action can be run without a workflow using it. The inputs of the action become the inputs of the
+// `workflow_dispatch` event and the outputs of the action the outputs of the job.
+func NewActionWorkflow(action *Action) (*Workflow, error) {
+	if action.Runs.Using != ActionRunsUsingComposite {
+		return nil, fmt.Errorf("action '%s' runs using '%s', only composite actions can be run without a workflow", action.Name, action.Runs.Using)
+	}
+
+	dispatch := WorkflowDispatch{Inputs: make(map[string]WorkflowDispatchInput)}
+	for name, input := range action.Inputs {
+		dispatch.Inputs[name] = WorkflowDispatchInput{
+			Description: input.Description,
+			Required:    input.Required,
+			Default:     input.Default,
+		}
+	}
+
+	job := &Job{
+		Name:    action.Name,
+		Env:     action.Runs.Env,
+		Outputs: make(map[string]string),
+	}
+	for name, output := range action.Outputs {
+		job.Outputs[name] = output.Value
+	}
+	for i := range action.Runs.Steps {
+		step := action.Runs.Steps[i]
+		// the action is run from the workspace
+		step.Run = strings.ReplaceAll(step.Run, "${{ github.action_path }}", "${{ github.workspace }}")
+		job.Steps = append(job.Steps, &step)
+	}
+	if err := job.RawRunsOn.Encode("ubuntu-latest"); err != nil {
+		return nil, err
+	}
+
+	workflow := &Workflow{
+		Name:   action.Name,
+		Jobs:   map[string]*Job{ActionJobID: job},
+		Action: action,
+	}
+	if err := workflow.RawOn.Encode(map[string]WorkflowDispatch{"workflow_dispatch": dispatch}); err != nil {
+		return nil, err
+	}
+	return workflow, nil
 }
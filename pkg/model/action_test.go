@@ -0,0 +1,77 @@
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadAction_CompositeShell(t *testing.T) {
+	yaml := `
+name: composite
+runs:
+  using: composite
+  steps:
+    - run: echo bash
+      shell: bash
+    - run: echo sh
+      shell: sh
+`
+
+	action, err := ReadAction(strings.NewReader(yaml))
+	assert.NoError(t, err, "read action should succeed")
+	assert.Equal(t, "bash", action.Runs.Steps[0].Shell)
+	assert.Equal(t, "sh", action.Runs.Steps[1].Shell)
+}
+
+func TestReadAction_CompositeMissingShell(t *testing.T) {
+	yaml := `
+name: composite
+runs:
+  using: composite
+  steps:
+    - run: echo bash
+      shell: bash
+    - run: echo missing
+`
+
+	_, err := ReadAction(strings.NewReader(yaml))
+	assert.EqualError(t, err, "invalid composite action 'composite': (StepID: echo missing): Required property is missing: 'shell'")
+}
+
+func TestReadAction_CompositeUses(t *testing.T) {
+	yaml := `
+name: composite
+runs:
+  using: composite
+  steps:
+    - uses: ./nested
+    - run: echo invalid
+      uses: ./nested
+`
+
+	_, err := ReadAction(strings.NewReader(yaml))
+	assert.EqualError(t, err, "invalid composite action 'composite': (StepID: ./nested): Unexpected value 'uses'")
+}
+
+func TestReadAction_DockerArgs(t *testing.T) {
+	yaml := `
+name: docker
+runs:
+  using: docker
+  image: Dockerfile
+  entrypoint: /entrypoint.sh
+  args:
+    - ${{ inputs.greeting }}
+    - world
+  env:
+    GREETING: ${{ inputs.greeting }}
+`
+
+	action, err := ReadAction(strings.NewReader(yaml))
+	assert.NoError(t, err, "read action should succeed")
+	assert.Equal(t, "/entrypoint.sh", action.Runs.Entrypoint)
+	assert.Equal(t, []string{"${{ inputs.greeting }}", "world"}, action.Runs.Args)
+	assert.Equal(t, map[string]string{"GREETING": "${{ inputs.greeting }}"}, action.Runs.Env)
+}
@@ -0,0 +1,220 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// KnownEvents are the names of the events that can trigger a workflow
+var KnownEvents = []string{
+	"branch_protection_rule",
+	"check_run",
+	"check_suite",
+	"create",
+	"delete",
+	"deployment",
+	"deployment_status",
+	"discussion",
+	"discussion_comment",
+	"fork",
+	"gollum",
+	"issue_comment",
+	"issues",
+	"label",
+	"merge_group",
+	"milestone",
+	"page_build",
+	"project",
+	"project_card",
+	"project_column",
+	"public",
+	"pull_request",
+	"pull_request_review",
+	"pull_request_review_comment",
+	"pull_request_target",
+	"push",
+	"registry_package",
+	"release",
+	"repository_dispatch",
+	"schedule",
+	"status",
+	"watch",
+	"workflow_call",
+	"workflow_dispatch",
+	"workflow_run",
+}
+
+// ValidateEventName returns an error if eventName is not one of the KnownEvents, suggesting the closest match
+func ValidateEventName(eventName string) error {
+	suggestion := ""
+	bestDistance := len(eventName)/2 + 1
+	for _, known := range KnownEvents {
+		if known == eventName {
+			return nil
+		}
+		if distance := levenshteinDistance(eventName, known); distance < bestDistance {
+			suggestion, bestDistance = known, distance
+		}
+	}
+
+	if suggestion != "" {
+		return fmt.Errorf("unknown event '%s', did you mean '%s'? Valid events are: %s", eventName, suggestion, strings.Join(KnownEvents, ", "))
+	}
+	return fmt.Errorf("unknown event '%s'. Valid events are: %s", eventName, strings.Join(KnownEvents, ", "))
+}
+
+func levenshteinDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func minInt(values ...int) int {
+	min := values[0]
+	for _, v := range values[1:] {
+		if v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+// EventPayload is what the filters of a workflow are evaluated against, taken from an event payload
+type EventPayload struct {
+	// Ref is the ref the branch filters match, the base branch for pull requests, empty if unknown
+	Ref string
+	// DefaultBranch replaces `$default-branch` in the branch filters
+	DefaultBranch string
+	// ChangedFiles are the files the paths filters match, nil if unknown
+	ChangedFiles []string
+}
+
+type eventPayloadJSON struct {
+	Ref     string `json:"ref"`
+	Commits []struct {
+		Added    []string `json:"added"`
+		Removed  []string `json:"removed"`
+		Modified []string `json:"modified"`
+	} `json:"commits"`
+	PullRequest struct {
+		Base struct {
+			Ref string `json:"ref"`
+		} `json:"base"`
+	} `json:"pull_request"`
+	Repository struct {
+		DefaultBranch string `json:"default_branch"`
+	} `json:"repository"`
+}
+
+// ParseEventPayload reads the ref and the changed files of an event from its JSON payload
+func ParseEventPayload(eventName string, content []byte) (*EventPayload, error) {
+	var raw eventPayloadJSON
+	if err := json.Unmarshal(content, &raw); err != nil {
+		return nil, errors.Wrapf(err, "unable to read the payload of event '%s'", eventName)
+	}
+
+	payload := &EventPayload{
+		Ref:           raw.Ref,
+		DefaultBranch: raw.Repository.DefaultBranch,
+	}
+	if payload.DefaultBranch == "" {
+		payload.DefaultBranch = "master"
+	}
+	if strings.HasPrefix(eventName, "pull_request") {
+		payload.Ref = raw.PullRequest.Base.Ref
+	}
+
+	if len(raw.Commits) > 0 {
+		payload.ChangedFiles = make([]string, 0)
+		seen := make(map[string]bool)
+		for _, commit := range raw.Commits {
+			for _, files := range [][]string{commit.Added, commit.Removed, commit.Modified} {
+				for _, file := range files {
+					if !seen[file] {
+						seen[file] = true
+						payload.ChangedFiles = append(payload.ChangedFiles, file)
+					}
+				}
+			}
+		}
+	}
+	return payload, nil
+}
+
+// eventPayloadRule matches the payloads of events by their top-level keys, a rule with more
+// than one event can't tell them apart
+type eventPayloadRule struct {
+	events []string
+	keys   []string
+}
+
+// eventPayloadRules are checked in order, the rules of events whose payloads contain the keys
+// of more general events (e.g. a pull_request_review has a pull_request) come first
+var eventPayloadRules = []eventPayloadRule{
+	{[]string{"pull_request_review"}, []string{"review", "pull_request"}},
+	{[]string{"pull_request_review_comment"}, []string{"comment", "pull_request"}},
+	{[]string{"pull_request"}, []string{"pull_request"}},
+	{[]string{"issue_comment"}, []string{"comment", "issue"}},
+	{[]string{"issues"}, []string{"issue"}},
+	{[]string{"discussion_comment"}, []string{"comment", "discussion"}},
+	{[]string{"discussion"}, []string{"discussion"}},
+	{[]string{"release"}, []string{"release"}},
+	{[]string{"deployment_status"}, []string{"deployment_status"}},
+	{[]string{"deployment"}, []string{"deployment"}},
+	{[]string{"workflow_run"}, []string{"workflow_run"}},
+	{[]string{"check_run"}, []string{"check_run"}},
+	{[]string{"check_suite"}, []string{"check_suite"}},
+	{[]string{"schedule"}, []string{"schedule"}},
+	{[]string{"workflow_dispatch"}, []string{"inputs", "workflow"}},
+	{[]string{"repository_dispatch"}, []string{"client_payload"}},
+	{[]string{"create", "delete"}, []string{"ref", "ref_type"}},
+	{[]string{"fork"}, []string{"forkee"}},
+	{[]string{"gollum"}, []string{"pages"}},
+	{[]string{"push"}, []string{"pusher"}},
+	{[]string{"push"}, []string{"ref", "commits"}},
+}
+
+// DetectEventName guesses the name of the event from the top-level keys of its JSON payload. It
+// returns the event and why it was chosen, or an error if the payload matches no event or several.
+func DetectEventName(content []byte) (string, string, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(content, &raw); err != nil {
+		return "", "", errors.Wrap(err, "unable to read the event payload")
+	}
+
+	for _, rule := range eventPayloadRules {
+		matches := true
+		for _, key := range rule.keys {
+			if _, ok := raw[key]; !ok {
+				matches = false
+				break
+			}
+		}
+		if !matches {
+			continue
+		}
+		reason := fmt.Sprintf("the payload has '%s'", strings.Join(rule.keys, "' and '"))
+		if len(rule.events) > 1 {
+			return "", "", fmt.Errorf("unable to detect the event, %s which could be any of %s", reason, strings.Join(rule.events, ", "))
+		}
+		return rule.events[0], reason, nil
+	}
+	return "", "", errors.New("unable to detect the event, the payload has none of the keys of a known event")
+}
@@ -0,0 +1,65 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateEventName(t *testing.T) {
+	tables := []struct {
+		eventName string
+		errMsg    string
+	}{
+		{"push", ""},
+		{"workflow_dispatch", ""},
+		{"puhs", "unknown event 'puhs', did you mean 'push'?"},
+		{"pull_requst", "unknown event 'pull_requst', did you mean 'pull_request'?"},
+		{"workflow-dispatch", "unknown event 'workflow-dispatch', did you mean 'workflow_dispatch'?"},
+		{"something_else_entirely", "unknown event 'something_else_entirely'. Valid events are: branch_protection_rule, check_run"},
+	}
+
+	for _, table := range tables {
+		err := ValidateEventName(table.eventName)
+		if table.errMsg == "" {
+			assert.NoError(t, err, table.eventName)
+		} else {
+			assert.Error(t, err, table.eventName)
+			assert.Contains(t, err.Error(), table.errMsg, table.eventName)
+		}
+	}
+}
+
+func TestDetectEventName(t *testing.T) {
+	tables := []struct {
+		payload   string
+		eventName string
+		errMsg    string
+	}{
+		{`{"ref": "refs/heads/main", "before": "a", "after": "b", "commits": [], "pusher": {"name": "mona"}}`, "push", ""},
+		{`{"ref": "refs/heads/main", "commits": []}`, "push", ""},
+		{`{"action": "opened", "number": 1, "pull_request": {"base": {"ref": "main"}}}`, "pull_request", ""},
+		{`{"action": "submitted", "review": {}, "pull_request": {}}`, "pull_request_review", ""},
+		{`{"action": "created", "comment": {}, "pull_request": {}}`, "pull_request_review_comment", ""},
+		{`{"action": "created", "comment": {}, "issue": {}}`, "issue_comment", ""},
+		{`{"action": "opened", "issue": {}}`, "issues", ""},
+		{`{"action": "published", "release": {"tag_name": "v1.0.0"}}`, "release", ""},
+		{`{"inputs": {"name": "mona"}, "ref": "refs/heads/main", "workflow": ".github/workflows/dispatch.yml"}`, "workflow_dispatch", ""},
+		{`{"schedule": "0 0 * * *"}`, "schedule", ""},
+		{`{"ref": "v1.0.0", "ref_type": "tag", "pusher_type": "user"}`, "", "could be any of create, delete"},
+		{`{"repository": {"name": "act"}}`, "", "none of the keys of a known event"},
+		{`[]`, "", "unable to read the event payload"},
+	}
+
+	for _, table := range tables {
+		eventName, reason, err := DetectEventName([]byte(table.payload))
+		if table.errMsg == "" {
+			assert.NoError(t, err, table.payload)
+			assert.Equal(t, table.eventName, eventName, table.payload)
+			assert.NotEmpty(t, reason, table.payload)
+		} else {
+			assert.Error(t, err, table.payload)
+			assert.Contains(t, err.Error(), table.errMsg, table.payload)
+		}
+	}
+}
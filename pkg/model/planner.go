@@ -9,15 +9,21 @@ import (
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strings"
 
 	"github.com/pkg/errors"
+	"github.com/robertkrimen/otto/ast"
+	"github.com/robertkrimen/otto/parser"
 	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
 )
 
 // WorkflowPlanner contains methods for creating plans
 type WorkflowPlanner interface {
 	PlanEvent(eventName string) *Plan
+	PlanEventWithPayload(eventName string, payload *EventPayload) *Plan
 	PlanJob(jobName string) *Plan
+	PlanAll() *Plan
 	GetEvents() []string
 }
 
@@ -50,6 +56,15 @@ func (r *Run) Job() *Job {
 	return r.Workflow.GetJob(r.JobID)
 }
 
+// Permissions of the GITHUB_TOKEN for this Run, those of the job override those of the workflow.
+// It's nil if neither declares them.
+func (r *Run) Permissions() Permissions {
+	if permissions := r.Job().Permissions(); permissions != nil {
+		return permissions
+	}
+	return r.Workflow.Permissions()
+}
+
 // Helper function for FixIfstatement
 func FixIfStatement1(val string, lines [][][]byte, l int) (string, error) {
 	if val != "" {
@@ -154,7 +169,18 @@ func NewWorkflowPlanner(path string, noWorkflowRecurse bool) (WorkflowPlanner, e
 	wp := new(workflowPlanner)
 	for _, wf := range workflows {
 		ext := filepath.Ext(wf.workflowFileInfo.Name())
-		if ext == ".yml" || ext == ".yaml" {
+		if isActionFile(wf.workflowFileInfo.Name()) {
+			// only the action file given as the path is run, the actions next to the workflows are used by them
+			if fi.IsDir() {
+				log.Debugf("Skipping action '%s'", filepath.Join(wf.dirPath, wf.workflowFileInfo.Name()))
+				continue
+			}
+			workflow, err := readActionWorkflow(filepath.Join(wf.dirPath, wf.workflowFileInfo.Name()))
+			if err != nil {
+				return nil, err
+			}
+			wp.workflows = append(wp.workflows, workflow)
+		} else if ext == ".yml" || ext == ".yaml" {
 			f, err := os.Open(filepath.Join(wf.dirPath, wf.workflowFileInfo.Name()))
 			if err != nil {
 				return nil, err
@@ -167,7 +193,7 @@ func NewWorkflowPlanner(path string, noWorkflowRecurse bool) (WorkflowPlanner, e
 				if err == io.EOF {
 					return nil, errors.WithMessagef(err, "unable to read workflow, %s file is empty", wf.workflowFileInfo.Name())
 				}
-				return nil, err
+				return nil, errors.WithMessagef(err, "unable to read workflow %s", wf.workflowFileInfo.Name())
 			}
 			_, err = f.Seek(0, 0)
 			if err != nil {
@@ -185,6 +211,7 @@ func NewWorkflowPlanner(path string, noWorkflowRecurse bool) (WorkflowPlanner, e
 				return nil, err
 			}
 
+			workflow.File = f.Name()
 			if workflow.Name == "" {
 				workflow.Name = wf.workflowFileInfo.Name()
 			}
@@ -204,12 +231,51 @@ func NewWorkflowPlanner(path string, noWorkflowRecurse bool) (WorkflowPlanner, e
 	return wp, nil
 }
 
+// isActionFile returns true for the file names of action metadata files
+func isActionFile(name string) bool {
+	return name == "action.yml" || name == "action.yaml"
+}
+
+// readActionWorkflow reads a composite action file as a workflow, see NewActionWorkflow
+func readActionWorkflow(path string) (*Workflow, error) {
+	log.Debugf("Reading action '%s'", path)
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	action, err := ReadAction(f)
+	if err != nil {
+		if err == io.EOF {
+			return nil, errors.WithMessagef(err, "unable to read action, %s file is empty", filepath.Base(path))
+		}
+		return nil, err
+	}
+	if action.Name == "" {
+		action.Name = filepath.Base(path)
+	}
+
+	workflow, err := NewActionWorkflow(action)
+	if err != nil {
+		return nil, err
+	}
+	workflow.File = path
+	return workflow, nil
+}
+
 type workflowPlanner struct {
 	workflows []*Workflow
 }
 
 // PlanEvent builds a new list of runs to execute in parallel for an event name
 func (wp *workflowPlanner) PlanEvent(eventName string) *Plan {
+	return wp.PlanEventWithPayload(eventName, nil)
+}
+
+// PlanEventWithPayload builds a new list of runs to execute in parallel for an event name, leaving out
+// the workflows whose branch and paths filters don't match the payload
+func (wp *workflowPlanner) PlanEventWithPayload(eventName string, payload *EventPayload) *Plan {
 	plan := new(Plan)
 	if len(wp.workflows) == 0 {
 		log.Debugf("no events found for workflow: %s", eventName)
@@ -217,9 +283,14 @@ func (wp *workflowPlanner) PlanEvent(eventName string) *Plan {
 
 	for _, w := range wp.workflows {
 		for _, e := range w.On() {
-			if e == eventName {
-				plan.mergeStages(createStages(w, w.GetJobIDs()...))
+			if e != eventName {
+				continue
+			}
+			if !w.OnEvent(eventName).MatchesPayload(payload) {
+				log.Debugf("Skipping workflow '%s', the filters of event '%s' don't match", w.Name, eventName)
+				continue
 			}
+			plan.mergeStages(createStages(w, w.GetJobIDs()...))
 		}
 	}
 	return plan
@@ -238,6 +309,15 @@ func (wp *workflowPlanner) PlanJob(jobName string) *Plan {
 	return plan
 }
 
+// PlanAll builds a new plan with all the jobs of all the workflows, whatever events trigger them
+func (wp *workflowPlanner) PlanAll() *Plan {
+	plan := new(Plan)
+	for _, w := range wp.workflows {
+		plan.mergeStages(createStages(w, w.GetJobIDs()...))
+	}
+	return plan
+}
+
 // GetEvents gets all the events in the workflows file
 func (wp *workflowPlanner) GetEvents() []string {
 	events := make([]string, 0)
@@ -282,6 +362,108 @@ func (p *Plan) MaxRunNameLen() int {
 	return maxRunNameLen
 }
 
+var expressionPattern = regexp.MustCompile(`\${{\s*(.+?)\s*}}`)
+
+// usesNeedsContext returns true if an expression of the job uses the `needs` context. The expressions are
+// the ${{ }} in its values and the conditions of `if`, parsed like when they're evaluated, so `needs` in the
+// text of a script or in a string doesn't count, while e.g. needs['build'] and toJSON(needs) do.
+func (j *Job) usesNeedsContext() bool {
+	var node yaml.Node
+	if err := node.Encode(j); err != nil {
+		return true
+	}
+	return nodeUsesNeedsContext(&node, false)
+}
+
+// nodeUsesNeedsContext returns true if an expression in node uses the `needs` context, isCondition is true
+// if node is the value of an `if`, which is an expression without ${{ }} too
+func nodeUsesNeedsContext(node *yaml.Node, isCondition bool) bool {
+	if node.Kind == yaml.ScalarNode {
+		expressions := make([]string, 0)
+		for _, match := range expressionPattern.FindAllStringSubmatch(node.Value, -1) {
+			expressions = append(expressions, match[1])
+		}
+		if isCondition && len(expressions) == 0 {
+			expressions = append(expressions, node.Value)
+		}
+		for _, expression := range expressions {
+			if program, err := parser.ParseFile(nil, "", expression, 0); err == nil {
+				visitor := &needsVisitor{}
+				ast.Walk(visitor, program)
+				if visitor.found {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	for i, child := range node.Content {
+		if node.Kind != yaml.MappingNode {
+			if nodeUsesNeedsContext(child, false) {
+				return true
+			}
+		} else if i%2 == 1 && nodeUsesNeedsContext(child, node.Content[i-1].Value == "if") {
+			// the keys of a mapping are skipped, its values are checked
+			return true
+		}
+	}
+	return false
+}
+
+// needsVisitor finds the `needs` context in an expression
+type needsVisitor struct {
+	found bool
+}
+
+func (v *needsVisitor) Enter(n ast.Node) ast.Visitor {
+	if identifier, ok := n.(*ast.Identifier); ok && identifier.Name == "needs" {
+		v.found = true
+	}
+	return v
+}
+
+func (v *needsVisitor) Exit(n ast.Node) {}
+
+// FilterJob returns a plan with the runs of the job jobID and the jobs it needs, transitively, so the
+// outputs it uses are there. With noDeps only jobID runs, which fails if it uses the `needs` context.
+// A job that isn't in the plan is an error listing the jobs that are.
+func (p *Plan) FilterJob(jobID string, noDeps bool) (*Plan, error) {
+	filtered := new(Plan)
+	workflows := make([]*Workflow, 0)
+	jobIDs := make(map[string]bool)
+	for _, stage := range p.Stages {
+		for _, run := range stage.Runs {
+			jobIDs[run.JobID] = true
+			if run.JobID != jobID {
+				continue
+			}
+			workflows = append(workflows, run.Workflow)
+		}
+	}
+
+	if len(workflows) == 0 {
+		available := make([]string, 0, len(jobIDs))
+		for id := range jobIDs {
+			available = append(available, id)
+		}
+		sort.Strings(available)
+		return nil, fmt.Errorf("job '%s' is not in the plan, the jobs are: %s", jobID, strings.Join(available, ", "))
+	}
+
+	for _, w := range workflows {
+		if !noDeps {
+			filtered.mergeStages(createStages(w, jobID))
+			continue
+		}
+		job := w.GetJob(jobID)
+		if needs := job.Needs(); len(needs) > 0 && job.usesNeedsContext() {
+			return nil, fmt.Errorf("job '%s' uses the outputs of the jobs it needs (%s), which don't run without their dependencies", jobID, strings.Join(needs, ", "))
+		}
+		filtered.mergeStages([]*Stage{{Runs: []*Run{{Workflow: w, JobID: jobID}}}})
+	}
+	return filtered, nil
+}
+
 // GetJobIDs will get all the job names in the stage
 func (s *Stage) GetJobIDs() []string {
 	names := make([]string, 0)
@@ -342,6 +524,10 @@ func createStages(w *Workflow, jobIDs ...string) []*Stage {
 		if len(stage.Runs) == 0 {
 			log.Fatalf("Unable to build dependency graph!")
 		}
+		// keep the dispatch order of the jobs in a stage reproducible
+		sort.Slice(stage.Runs, func(i, j int) bool {
+			return stage.Runs[i].JobID < stage.Runs[j].JobID
+		})
 		stages = append(stages, stage)
 	}
 
@@ -365,3 +551,61 @@ func listInStages(srcList []string, stages ...*Stage) bool {
 	}
 	return true
 }
+
+// PlanEstimate is what running a plan takes, to show before the plan runs
+type PlanEstimate struct {
+	Jobs           int      // runs of the jobs once their matrixes are expanded
+	Images         []string // distinct images of the job containers, services and docker:// steps, sorted
+	Platforms      []string // distinct runs-on labels, sorted, the images they run on depend on the runner
+	TimeoutMinutes int64    // sum of the timeout-minutes of the runs, the runs of jobs without one aren't counted
+	DynamicMatrix  []string // jobs whose matrix is only known once the plan runs, each counted as a single run
+}
+
+// Estimate returns the number of runs, the images and the timeouts of the plan without running it
+func (p *Plan) Estimate() PlanEstimate {
+	estimate := PlanEstimate{}
+	images := make(map[string]bool)
+	platforms := make(map[string]bool)
+	for _, stage := range p.Stages {
+		for _, run := range stage.Runs {
+			job := run.Job()
+			runs := 1
+			if matrixes, err := job.GetMatrixes(nil); err != nil {
+				estimate.DynamicMatrix = append(estimate.DynamicMatrix, run.String())
+			} else {
+				runs = len(matrixes)
+			}
+			estimate.Jobs += runs
+			estimate.TimeoutMinutes += job.TimeoutMinutes * int64(runs)
+
+			for _, label := range job.RunsOn() {
+				platforms[label] = true
+			}
+			if c := job.Container(); c != nil && c.Image != "" {
+				images[c.Image] = true
+			}
+			for _, service := range job.Services {
+				if service != nil && service.Image != "" {
+					images[service.Image] = true
+				}
+			}
+			for _, step := range job.Steps {
+				if strings.HasPrefix(step.Uses, "docker://") {
+					images[strings.TrimPrefix(step.Uses, "docker://")] = true
+				}
+			}
+		}
+	}
+	estimate.Images = sortedKeys(images)
+	estimate.Platforms = sortedKeys(platforms)
+	return estimate
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
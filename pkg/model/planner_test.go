@@ -1,7 +1,10 @@
 package model
 
 import (
+	"fmt"
+	"io/ioutil"
 	"path/filepath"
+	"sort"
 	"testing"
 
 	log "github.com/sirupsen/logrus"
@@ -25,6 +28,7 @@ func TestPlanner(t *testing.T) {
 		{"empty-workflow", "unable to read workflow, push.yml file is empty: EOF", false},
 		{"nested", "unable to read workflow, fail.yml file is empty: EOF", false},
 		{"nested", "", true},
+		{"invalid-permissions", "unable to read workflow push.yml: job 'test': invalid permission 'admin' of the scope 'contents', expected read, write or none", false},
 	}
 
 	workdir, err := filepath.Abs("testdata")
@@ -39,3 +43,136 @@ func TestPlanner(t *testing.T) {
 		}
 	}
 }
+
+func TestPlannerEventPayload(t *testing.T) {
+	workdir, err := filepath.Abs("testdata/event-filters")
+	assert.NoError(t, err, workdir)
+
+	planner, err := NewWorkflowPlanner(filepath.Join(workdir, "workflows"), false)
+	assert.NoError(t, err)
+
+	tables := []struct {
+		eventFile string
+		workflows []string
+	}{
+		{"", []string{"branches", "paths", "paths-ignore", "unfiltered"}},
+		{"push-src.json", []string{"branches", "paths", "paths-ignore", "unfiltered"}},
+		{"push-docs.json", []string{"unfiltered"}},
+	}
+
+	for _, table := range tables {
+		var payload *EventPayload
+		if table.eventFile != "" {
+			content, err := ioutil.ReadFile(filepath.Join(workdir, table.eventFile))
+			assert.NoError(t, err, table.eventFile)
+			payload, err = ParseEventPayload("push", content)
+			assert.NoError(t, err, table.eventFile)
+		}
+
+		workflows := make([]string, 0)
+		for _, stage := range planner.PlanEventWithPayload("push", payload).Stages {
+			for _, run := range stage.Runs {
+				workflows = append(workflows, run.Workflow.Name)
+			}
+		}
+		sort.Strings(workflows)
+		assert.Equal(t, table.workflows, workflows, table.eventFile)
+	}
+}
+
+func TestPlannerActionFile(t *testing.T) {
+	workdir, err := filepath.Abs("testdata/composite-action")
+	assert.NoError(t, err, workdir)
+
+	planner, err := NewWorkflowPlanner(filepath.Join(workdir, "action.yml"), false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"workflow_dispatch"}, planner.GetEvents())
+
+	plan := planner.PlanEvent("workflow_dispatch")
+	if assert.Len(t, plan.Stages, 1) && assert.Len(t, plan.Stages[0].Runs, 1) {
+		run := plan.Stages[0].Runs[0]
+		assert.Equal(t, ActionJobID, run.JobID)
+		assert.Equal(t, "greet", run.String())
+		assert.Equal(t, []string{"ubuntu-latest"}, run.Job().RunsOn())
+		assert.Len(t, run.Job().Steps, 2)
+		assert.Equal(t, map[string]string{"message": "${{ steps.greet.outputs.message }}"}, run.Job().Outputs)
+		assert.NotNil(t, run.Workflow.Action)
+
+		dispatch := run.Workflow.WorkflowDispatchConfig()
+		if assert.NotNil(t, dispatch) {
+			assert.True(t, dispatch.Inputs["who"].Required)
+			assert.Equal(t, "Hello", dispatch.Inputs["greeting"].Default)
+		}
+	}
+
+	// an action in a directory of workflows isn't one of them
+	planner, err = NewWorkflowPlanner(workdir, false)
+	assert.NoError(t, err)
+	assert.Empty(t, planner.GetEvents())
+}
+
+func TestPlannerSchedule(t *testing.T) {
+	planner, err := NewWorkflowPlanner("testdata/schedule", false)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"schedule"}, planner.GetEvents())
+	assert.Empty(t, planner.PlanEvent("push").Stages)
+
+	plan := planner.PlanEvent("schedule")
+	if assert.Len(t, plan.Stages, 2) {
+		assert.Equal(t, "build", plan.Stages[0].Runs[0].JobID)
+		assert.Equal(t, "test", plan.Stages[1].Runs[0].JobID)
+		assert.Equal(t, []string{"0 3 * * *", "30 12 * * 1-5"}, plan.Stages[0].Runs[0].Workflow.Schedules())
+	}
+}
+
+func TestPlanFilterJob(t *testing.T) {
+	planner, err := NewWorkflowPlanner("testdata/job-filter/push.yml", true)
+	assert.NoError(t, err)
+
+	stageJobIDs := func(plan *Plan) [][]string {
+		stages := make([][]string, 0)
+		for _, stage := range plan.Stages {
+			stages = append(stages, stage.GetJobIDs())
+		}
+		return stages
+	}
+
+	plan, err := planner.PlanEvent("push").FilterJob("test", false)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"setup"}, {"build"}, {"test"}}, stageJobIDs(plan))
+
+	plan, err = planner.PlanEvent("push").FilterJob("build", true)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"build"}}, stageJobIDs(plan))
+
+	_, err = planner.PlanEvent("push").FilterJob("test", true)
+	assert.EqualError(t, err, "job 'test' uses the outputs of the jobs it needs (build), which don't run without their dependencies")
+
+	// only the expressions count, not the text of a script
+	plan, err = planner.PlanEvent("push").FilterJob("report", true)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"report"}}, stageJobIDs(plan))
+
+	for _, jobID := range []string{"publish", "summary"} {
+		_, err = planner.PlanEvent("push").FilterJob(jobID, true)
+		assert.EqualError(t, err, fmt.Sprintf("job '%s' uses the outputs of the jobs it needs (build), which don't run without their dependencies", jobID))
+	}
+
+	_, err = planner.PlanAll().FilterJob("deploy", false)
+	assert.EqualError(t, err, "job 'deploy' is not in the plan, the jobs are: build, lint, publish, report, setup, summary, test")
+}
+
+func TestPlanEstimate(t *testing.T) {
+	planner, err := NewWorkflowPlanner("testdata/estimate/push.yml", true)
+	assert.NoError(t, err)
+
+	estimate := planner.PlanEvent("push").Estimate()
+	assert.Equal(t, PlanEstimate{
+		Jobs:           5 + 1 + 1,
+		Images:         []string{"alpine:3.14", "node:16-buster-slim", "redis:6"},
+		Platforms:      []string{"linux", "self-hosted", "ubuntu-latest"},
+		TimeoutMinutes: 5*10 + 5,
+		DynamicMatrix:  []string{"release"},
+	}, estimate)
+}
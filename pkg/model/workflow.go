@@ -19,6 +19,16 @@ type Workflow struct {
 	Env      map[string]string `yaml:"env"`
 	Jobs     map[string]*Job   `yaml:"jobs"`
 	Defaults Defaults          `yaml:"defaults"`
+
+	RawPermissions yaml.Node `yaml:"permissions"`
+	RawConcurrency yaml.Node `yaml:"concurrency"`
+
+	permissions Permissions // parsed from RawPermissions by ReadWorkflow
+
+	// File is the path of the file the workflow was read from
+	File string `yaml:"-"`
+	// Action is the composite action the workflow runs, nil if it was read from a workflow file
+	Action *Action `yaml:"-"`
 }
 
 // On events for the workflow
@@ -53,6 +63,265 @@ func (w *Workflow) On() []string {
 	return nil
 }
 
+// EventFilters are the filters that can be set for an event in `on`
+type EventFilters struct {
+	Branches       []string `yaml:"branches"`
+	BranchesIgnore []string `yaml:"branches-ignore"`
+	Paths          []string `yaml:"paths"`
+	PathsIgnore    []string `yaml:"paths-ignore"`
+}
+
+// WorkflowDispatchInput is an input declared for the `workflow_dispatch` event
+type WorkflowDispatchInput struct {
+	Description string   `yaml:"description"`
+	Required    bool     `yaml:"required"`
+	Default     string   `yaml:"default"`
+	Type        string   `yaml:"type"`
+	Options     []string `yaml:"options"`
+}
+
+// WorkflowDispatch is the configuration of the `workflow_dispatch` event
+type WorkflowDispatch struct {
+	Inputs map[string]WorkflowDispatchInput `yaml:"inputs"`
+}
+
+// WorkflowCallInput is an input declared for the `workflow_call` event of a reusable workflow
+type WorkflowCallInput struct {
+	Description string `yaml:"description"`
+	Required    bool   `yaml:"required"`
+	Default     string `yaml:"default"`
+	Type        string `yaml:"type"`
+}
+
+// WorkflowCallOutput is an output of a reusable workflow, its value is usually an expression
+// with the outputs of its jobs (e.g. `${{ jobs.build.outputs.version }}`)
+type WorkflowCallOutput struct {
+	Description string `yaml:"description"`
+	Value       string `yaml:"value"`
+}
+
+// WorkflowCall is the configuration of the `workflow_call` event of a reusable workflow
+type WorkflowCall struct {
+	Inputs  map[string]WorkflowCallInput  `yaml:"inputs"`
+	Outputs map[string]WorkflowCallOutput `yaml:"outputs"`
+	Secrets map[string]struct {
+		Description string `yaml:"description"`
+		Required    bool   `yaml:"required"`
+	} `yaml:"secrets"`
+}
+
+// onEventNode returns the yaml node of an event in `on`, nil if the event isn't configured as a mapping
+func (w *Workflow) onEventNode(event string) *yaml.Node {
+	if w.RawOn.Kind != yaml.MappingNode {
+		return nil
+	}
+	var val map[string]yaml.Node
+	err := w.RawOn.Decode(&val)
+	if err != nil {
+		log.Fatal(err)
+	}
+	node, ok := val[event]
+	if !ok || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	return &node
+}
+
+// OnEvent returns the filters for an event, nil if the event has none or isn't part of the workflow
+func (w *Workflow) OnEvent(event string) *EventFilters {
+	node := w.onEventNode(event)
+	if node == nil {
+		return nil
+	}
+	filters := new(EventFilters)
+	err := node.Decode(filters)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return filters
+}
+
+// WorkflowDispatchConfig returns the configuration of the `workflow_dispatch` event, nil if it has none
+func (w *Workflow) WorkflowDispatchConfig() *WorkflowDispatch {
+	node := w.onEventNode("workflow_dispatch")
+	if node == nil {
+		return nil
+	}
+	config := new(WorkflowDispatch)
+	err := node.Decode(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return config
+}
+
+// WorkflowCallConfig returns the configuration of the `workflow_call` event, nil if it has none
+func (w *Workflow) WorkflowCallConfig() *WorkflowCall {
+	node := w.onEventNode("workflow_call")
+	if node == nil {
+		return nil
+	}
+	config := new(WorkflowCall)
+	err := node.Decode(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return config
+}
+
+// Schedules returns the cron expressions of the `schedule` event, nil if the workflow has none
+func (w *Workflow) Schedules() []string {
+	if w.RawOn.Kind != yaml.MappingNode {
+		return nil
+	}
+	var val map[string]yaml.Node
+	err := w.RawOn.Decode(&val)
+	if err != nil {
+		log.Fatal(err)
+	}
+	node, ok := val["schedule"]
+	if !ok || node.Kind != yaml.SequenceNode {
+		return nil
+	}
+	var schedules []struct {
+		Cron string `yaml:"cron"`
+	}
+	if err := node.Decode(&schedules); err != nil {
+		log.Fatal(err)
+	}
+	crons := make([]string, 0, len(schedules))
+	for _, schedule := range schedules {
+		crons = append(crons, schedule.Cron)
+	}
+	return crons
+}
+
+// MatchesBranch returns true if the branch passes the `branches` and `branches-ignore` filters.
+// No filter at all matches every branch, and `$default-branch` is replaced by the given default branch.
+func (f *EventFilters) MatchesBranch(branch string, defaultBranch string) bool {
+	if f == nil {
+		return true
+	}
+	branch = strings.TrimPrefix(branch, "refs/heads/")
+	if len(f.Branches) > 0 && !matchesFilters(f.Branches, branch, defaultBranch) {
+		return false
+	}
+	if len(f.BranchesIgnore) > 0 && matchesFilters(f.BranchesIgnore, branch, defaultBranch) {
+		return false
+	}
+	return true
+}
+
+// MatchesPaths returns true if the changed files pass the `paths` and `paths-ignore` filters, that is
+// at least one file matches `paths` and not every file matches `paths-ignore`. Unknown changes (nil) match.
+func (f *EventFilters) MatchesPaths(changedFiles []string) bool {
+	if f == nil || changedFiles == nil {
+		return true
+	}
+	if len(f.Paths) > 0 {
+		matched := false
+		for _, file := range changedFiles {
+			if matchesFilters(f.Paths, file, "") {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(f.PathsIgnore) > 0 {
+		for _, file := range changedFiles {
+			if !matchesFilters(f.PathsIgnore, file, "") {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// MatchesPayload returns true if the event in payload passes the filters. A nil payload matches,
+// so do the filters the payload has no information for.
+func (f *EventFilters) MatchesPayload(payload *EventPayload) bool {
+	if f == nil || payload == nil {
+		return true
+	}
+	if payload.Ref != "" {
+		if strings.HasPrefix(payload.Ref, "refs/tags/") {
+			// a tag doesn't pass branch filters
+			if len(f.Branches) > 0 || len(f.BranchesIgnore) > 0 {
+				return false
+			}
+		} else if !f.MatchesBranch(payload.Ref, payload.DefaultBranch) {
+			return false
+		}
+	}
+	return f.MatchesPaths(payload.ChangedFiles)
+}
+
+// matchesFilters evaluates the patterns in order, a later matching pattern overrides an earlier one.
+// A list with only negated patterns matches everything the negations don't exclude.
+func matchesFilters(patterns []string, value string, defaultBranch string) bool {
+	matched := true
+	for _, pattern := range patterns {
+		if !strings.HasPrefix(pattern, "!") {
+			matched = false
+			break
+		}
+	}
+	for _, pattern := range patterns {
+		negated := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+		if pattern == "$default-branch" {
+			pattern = defaultBranch
+		}
+		if matchesFilterPattern(pattern, value) {
+			matched = !negated
+		}
+	}
+	return matched
+}
+
+// matchesFilterPattern matches a value against a filter pattern, see
+// https://docs.github.com/en/actions/reference/workflow-syntax-for-github-actions#filter-pattern-cheat-sheet
+func matchesFilterPattern(pattern string, value string) bool {
+	var re strings.Builder
+	re.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				re.WriteString(".*")
+				i++
+			} else {
+				re.WriteString("[^/]*")
+			}
+		case '?', '+':
+			re.WriteByte(c)
+		case '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end < 0 {
+				re.WriteString(regexp.QuoteMeta(pattern[i:]))
+				i = len(pattern)
+			} else {
+				re.WriteString(pattern[i : i+end+1])
+				i += end
+			}
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+	matcher, err := regexp.Compile(re.String())
+	if err != nil {
+		log.Warnf("Invalid filter pattern '%s': %v", pattern, err)
+		return false
+	}
+	return matcher.MatchString(value)
+}
+
 // Job is the structure of one job in a workflow
 type Job struct {
 	Name           string                    `yaml:"name"`
@@ -66,13 +335,220 @@ type Job struct {
 	Strategy       *Strategy                 `yaml:"strategy"`
 	RawContainer   yaml.Node                 `yaml:"container"`
 	Defaults       Defaults                  `yaml:"defaults"`
+	RawEnvironment yaml.Node                 `yaml:"environment"`
+	Outputs        map[string]string         `yaml:"outputs"`
+	Uses           string                    `yaml:"uses"`
+	With           map[string]string         `yaml:"with"`
+	RawSecrets     yaml.Node                 `yaml:"secrets"`
+	RawPermissions yaml.Node                 `yaml:"permissions"`
+	RawConcurrency yaml.Node                 `yaml:"concurrency"`
+
+	permissions Permissions // parsed from RawPermissions by ReadWorkflow
+}
+
+// Environment is the deployment environment a job targets
+type Environment struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+}
+
+// PermissionScopes are the scopes a workflow or job can set the permissions of the GITHUB_TOKEN for
+var PermissionScopes = []string{
+	"actions",
+	"checks",
+	"contents",
+	"deployments",
+	"discussions",
+	"id-token",
+	"issues",
+	"packages",
+	"pages",
+	"pull-requests",
+	"repository-projects",
+	"security-events",
+	"statuses",
+}
+
+// Permissions of the GITHUB_TOKEN by scope, each read, write or none
+type Permissions map[string]string
+
+// parsePermissions parses read-all, write-all or a map of scopes to permissions, the scopes
+// missing in the map get none like on GitHub. It returns nil if node is empty.
+func parsePermissions(node yaml.Node) (Permissions, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		var val string
+		if err := node.Decode(&val); err != nil {
+			return nil, err
+		}
+		var access string
+		switch val {
+		case "read-all":
+			access = "read"
+		case "write-all":
+			access = "write"
+		default:
+			return nil, fmt.Errorf("invalid permissions '%s', expected read-all, write-all or a map of scopes", val)
+		}
+		permissions := make(Permissions)
+		for _, scope := range PermissionScopes {
+			permissions[scope] = access
+		}
+		return permissions, nil
+	case yaml.MappingNode:
+		var val map[string]string
+		if err := node.Decode(&val); err != nil {
+			return nil, err
+		}
+		permissions := make(Permissions)
+		for _, scope := range PermissionScopes {
+			permissions[scope] = "none"
+		}
+		for scope, access := range val {
+			if _, ok := permissions[scope]; !ok {
+				return nil, fmt.Errorf("invalid permissions scope '%s', expected one of %s", scope, strings.Join(PermissionScopes, ", "))
+			}
+			if access != "read" && access != "write" && access != "none" {
+				return nil, fmt.Errorf("invalid permission '%s' of the scope '%s', expected read, write or none", access, scope)
+			}
+			permissions[scope] = access
+		}
+		return permissions, nil
+	case 0:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("invalid permissions, expected read-all, write-all or a map of scopes")
+}
+
+// Permissions of the GITHUB_TOKEN for all jobs of the workflow, nil if the workflow doesn't declare them
+func (w *Workflow) Permissions() Permissions {
+	return w.permissions
+}
+
+// Permissions of the GITHUB_TOKEN for the job, nil if the job doesn't declare them
+func (j *Job) Permissions() Permissions {
+	return j.permissions
+}
+
+// Secrets returns the secrets a job passes to the reusable workflow it calls, true for `secrets: inherit`
+func (j *Job) Secrets() (map[string]string, bool, error) {
+	switch j.RawSecrets.Kind {
+	case 0:
+		return nil, false, nil
+	case yaml.ScalarNode:
+		if j.RawSecrets.Value == "inherit" {
+			return nil, true, nil
+		}
+	case yaml.MappingNode:
+		var secrets map[string]string
+		if err := j.RawSecrets.Decode(&secrets); err == nil {
+			return secrets, false, nil
+		}
+	}
+	return nil, false, fmt.Errorf("the secrets of job '%s' must be inherit or a map of names to values", j.Name)
+}
+
+// Concurrency is the group of which only one run of a workflow or job can be in progress at a time,
+// both values can be expressions
+type Concurrency struct {
+	Group            string `yaml:"group"`
+	CancelInProgress string `yaml:"cancel-in-progress"`
+}
+
+// parseConcurrency parses the name of a group or a map with the group and cancel-in-progress.
+// It returns nil if node is empty.
+func parseConcurrency(node yaml.Node) *Concurrency {
+	var val *Concurrency
+	switch node.Kind {
+	case yaml.ScalarNode:
+		val = new(Concurrency)
+		err := node.Decode(&val.Group)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case yaml.MappingNode:
+		val = new(Concurrency)
+		err := node.Decode(val)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	return val
+}
+
+// Concurrency group of the runs of the workflow, nil if the workflow doesn't declare one
+func (w *Workflow) Concurrency() *Concurrency {
+	return parseConcurrency(w.RawConcurrency)
+}
+
+// Concurrency group of the runs of the job, nil if the job doesn't declare one
+func (j *Job) Concurrency() *Concurrency {
+	return parseConcurrency(j.RawConcurrency)
 }
 
 // Strategy for the job
 type Strategy struct {
-	FailFast    bool                     `yaml:"fail-fast"`
-	MaxParallel int                      `yaml:"max-parallel"`
-	Matrix      map[string][]interface{} `yaml:"matrix"`
+	FailFast    bool      `yaml:"fail-fast"`
+	MaxParallel int       `yaml:"max-parallel"`
+	RawMatrix   yaml.Node `yaml:"matrix"`
+}
+
+// MatrixEvaluator returns the value of an expression in a matrix, like `${{ fromJSON(needs.setup.outputs.matrix) }}`
+type MatrixEvaluator func(expression string) (interface{}, error)
+
+// isExpression returns true if the whole value is an expression
+func isExpression(value interface{}) bool {
+	s, ok := value.(string)
+	s = strings.TrimSpace(s)
+	return ok && strings.HasPrefix(s, "${{") && strings.HasSuffix(s, "}}")
+}
+
+// Matrix returns the matrix of the strategy, nil if it has none. The whole matrix or the value of a key
+// can be an expression, which is evaluated with evaluate. Without an evaluator expressions are an error.
+func (s *Strategy) Matrix(evaluate MatrixEvaluator) (map[string][]interface{}, error) {
+	if s.RawMatrix.Kind == 0 {
+		return nil, nil
+	}
+	var raw interface{}
+	if err := s.RawMatrix.Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	evaluateExpression := func(value interface{}) (interface{}, error) {
+		if !isExpression(value) {
+			return value, nil
+		}
+		if evaluate == nil {
+			return nil, fmt.Errorf("the matrix expression '%s' can't be evaluated here", value)
+		}
+		return evaluate(value.(string))
+	}
+
+	raw, err := evaluateExpression(raw)
+	if err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return nil, nil
+	}
+	rawMatrix, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("the matrix must be a mapping, got '%v'", raw)
+	}
+
+	matrix := make(map[string][]interface{}, len(rawMatrix))
+	for key, value := range rawMatrix {
+		value, err := evaluateExpression(value)
+		if err != nil {
+			return nil, err
+		}
+		values, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("the matrix key '%s' must be a list, got '%v'", key, value)
+		}
+		matrix[key] = values
+	}
+	return matrix, nil
 }
 
 // Default settings that will apply to all steps in the job or workflow
@@ -106,6 +582,26 @@ func (j *Job) Container() *ContainerSpec {
 	return val
 }
 
+// Environment the job targets, nil if the job doesn't declare one
+func (j *Job) Environment() *Environment {
+	var val *Environment
+	switch j.RawEnvironment.Kind {
+	case yaml.ScalarNode:
+		val = new(Environment)
+		err := j.RawEnvironment.Decode(&val.Name)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case yaml.MappingNode:
+		val = new(Environment)
+		err := j.RawEnvironment.Decode(val)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	return val
+}
+
 // Needs list for Job
 func (j *Job) Needs() []string {
 	switch j.RawNeeds.Kind {
@@ -127,9 +623,15 @@ func (j *Job) Needs() []string {
 	return nil
 }
 
-// RunsOn list for Job
+// RunsOn list for Job, the labels of the `runs-on: { group, labels }` form
 func (j *Job) RunsOn() []string {
 	switch j.RawRunsOn.Kind {
+	case yaml.MappingNode:
+		runsOn, err := j.runsOnMapping()
+		if err != nil {
+			log.Fatal(err)
+		}
+		return runsOn.Labels
 	case yaml.ScalarNode:
 		var val string
 		err := j.RawRunsOn.Decode(&val)
@@ -148,23 +650,92 @@ func (j *Job) RunsOn() []string {
 	return nil
 }
 
-// GetMatrixes returns the matrix cross product
-func (j *Job) GetMatrixes() []map[string]interface{} {
-	matrixes := make([]map[string]interface{}, 0)
+// RunsOnGroup is the runner group of the `runs-on: { group, labels }` form, empty for the other forms
+func (j *Job) RunsOnGroup() string {
+	if j.RawRunsOn.Kind != yaml.MappingNode {
+		return ""
+	}
+	runsOn, err := j.runsOnMapping()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return runsOn.Group
+}
+
+type runsOnMapping struct {
+	Group  string
+	Labels []string
+}
+
+func (j *Job) runsOnMapping() (*runsOnMapping, error) {
+	var raw struct {
+		Group  string    `yaml:"group"`
+		Labels yaml.Node `yaml:"labels"`
+	}
+	if err := j.RawRunsOn.Decode(&raw); err != nil {
+		return nil, err
+	}
+	runsOn := &runsOnMapping{Group: raw.Group, Labels: make([]string, 0)}
+	switch raw.Labels.Kind {
+	case yaml.ScalarNode:
+		var label string
+		if err := raw.Labels.Decode(&label); err != nil {
+			return nil, err
+		}
+		runsOn.Labels = append(runsOn.Labels, label)
+	case yaml.SequenceNode:
+		if err := raw.Labels.Decode(&runsOn.Labels); err != nil {
+			return nil, err
+		}
+	}
+	return runsOn, nil
+}
+
+// GetMatrixes returns the matrix cross product, the expressions of the matrix are evaluated with evaluate
+func (j *Job) GetMatrixes(evaluate MatrixEvaluator) ([]map[string]interface{}, error) {
+	var matrix map[string][]interface{}
 	if j.Strategy != nil {
+		var err error
+		if matrix, err = j.Strategy.Matrix(evaluate); err != nil {
+			return nil, err
+		}
+	}
+	return ExpandMatrix(matrix)
+}
+
+// ExpandMatrix returns the cross product of matrix without the combinations of `exclude` and with the ones
+// of `include`. Like on GitHub the combinations are excluded first, so an include can't be excluded. An
+// include is added to every combination of the cross product it doesn't change an original value of, it
+// can change the values earlier includes added. An include that can't be added to any combination is
+// a combination of its own. A nil matrix has a single empty combination.
+func ExpandMatrix(matrix map[string][]interface{}) ([]map[string]interface{}, error) {
+	matrixes := make([]map[string]interface{}, 0)
+	if matrix != nil {
 		includes := make([]map[string]interface{}, 0)
-		for _, v := range j.Strategy.Matrix["include"] {
-			includes = append(includes, v.(map[string]interface{}))
+		for _, v := range matrix["include"] {
+			include, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("the matrix include '%v' must be a mapping", v)
+			}
+			includes = append(includes, include)
 		}
-		delete(j.Strategy.Matrix, "include")
 
 		excludes := make([]map[string]interface{}, 0)
-		for _, v := range j.Strategy.Matrix["exclude"] {
-			excludes = append(excludes, v.(map[string]interface{}))
+		for _, v := range matrix["exclude"] {
+			exclude, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("the matrix exclude '%v' must be a mapping", v)
+			}
+			excludes = append(excludes, exclude)
 		}
-		delete(j.Strategy.Matrix, "exclude")
 
-		matrixProduct := common.CartesianProduct(j.Strategy.Matrix)
+		dimensions := make(map[string][]interface{}, len(matrix))
+		for key, values := range matrix {
+			if key != "include" && key != "exclude" {
+				dimensions[key] = values
+			}
+		}
+		matrixProduct := common.CartesianProduct(dimensions)
 
 	MATRIX:
 		for _, matrix := range matrixProduct {
@@ -176,14 +747,46 @@ func (j *Job) GetMatrixes() []map[string]interface{} {
 			}
 			matrixes = append(matrixes, matrix)
 		}
+		product := len(matrixes)
+
 		for _, include := range includes {
-			log.Debugf("Adding include '%v'", include)
-			matrixes = append(matrixes, include)
+			extended := false
+			for _, matrix := range matrixes[:product] {
+				if includeMatches(matrix, include, dimensions) {
+					log.Debugf("Adding include '%v' to matrix '%v'", include, matrix)
+					for k, v := range include {
+						matrix[k] = v
+					}
+					extended = true
+				}
+			}
+			if !extended {
+				log.Debugf("Adding include '%v'", include)
+				combination := make(map[string]interface{}, len(include))
+				for k, v := range include {
+					combination[k] = v
+				}
+				matrixes = append(matrixes, combination)
+			}
 		}
 	} else {
 		matrixes = append(matrixes, make(map[string]interface{}))
 	}
-	return matrixes
+	return matrixes, nil
+}
+
+// includeMatches returns true if include doesn't change any of the original values of the combination
+// matrix of the dimensions, only the values of the keys that aren't dimensions
+func includeMatches(matrix map[string]interface{}, include map[string]interface{}, dimensions map[string][]interface{}) bool {
+	for k, v := range include {
+		if _, ok := dimensions[k]; !ok {
+			continue
+		}
+		if original, ok := matrix[k]; ok && !reflect.DeepEqual(original, v) {
+			return false
+		}
+	}
+	return true
 }
 
 func commonKeysMatch(a map[string]interface{}, b map[string]interface{}) bool {
@@ -197,15 +800,16 @@ func commonKeysMatch(a map[string]interface{}, b map[string]interface{}) bool {
 
 // ContainerSpec is the specification of the container to use for the job
 type ContainerSpec struct {
-	Image      string            `yaml:"image"`
-	Env        map[string]string `yaml:"env"`
-	Ports      []string          `yaml:"ports"`
-	Volumes    []string          `yaml:"volumes"`
-	Options    string            `yaml:"options"`
-	Entrypoint string
-	Args       string
-	Name       string
-	Reuse      bool
+	Image       string            `yaml:"image"`
+	Env         map[string]string `yaml:"env"`
+	Ports       []string          `yaml:"ports"`
+	Volumes     []string          `yaml:"volumes"`
+	Options     string            `yaml:"options"`
+	Credentials map[string]string `yaml:"credentials"`
+	Entrypoint  string
+	Args        string
+	Name        string
+	Reuse       bool
 }
 
 // Step is the structure of one step in a job
@@ -219,7 +823,7 @@ type Step struct {
 	Shell            string            `yaml:"shell"`
 	Env              map[string]string `yaml:"env"`
 	With             map[string]string `yaml:"with"`
-	ContinueOnError  bool              `yaml:"continue-on-error"`
+	ContinueOnError  string            `yaml:"continue-on-error"`
 	TimeoutMinutes   int64             `yaml:"timeout-minutes"`
 }
 
@@ -249,20 +853,23 @@ func (s *Step) GetEnv() map[string]string {
 	return rtnEnv
 }
 
-// ShellCommand returns the command for the shell
+// ShellCommand returns the command for the shell, `{0}` is replaced with the path of the script.
+// Shells that are not built in are used as the command as is.
 func (s *Step) ShellCommand() string {
 	shellCommand := ""
 
 	//Reference: https://github.com/actions/runner/blob/8109c962f09d9acc473d92c595ff43afceddb347/src/Runner.Worker/Handlers/ScriptHandlerHelpers.cs#L9-L17
 	switch s.Shell {
-	case "", "bash":
-		shellCommand = "bash --login --noprofile --norc -e -o pipefail {0}"
+	case "":
+		shellCommand = "bash -e {0}"
+	case "bash":
+		shellCommand = "bash --noprofile --norc -eo pipefail {0}"
 	case "pwsh":
 		shellCommand = "pwsh -command . '{0}'"
 	case "python":
 		shellCommand = "python {0}"
 	case "sh":
-		shellCommand = "sh -l -e -c {0}"
+		shellCommand = "sh -e {0}"
 	case "cmd":
 		shellCommand = "%ComSpec% /D /E:ON /V:OFF /S /C \"CALL \"{0}\"\""
 	case "powershell":
@@ -308,11 +915,15 @@ func (s *Step) Type() StepType {
 	return StepTypeUsesActionRemote
 }
 
+// Validate checks that a step of a composite action can be run
 func (s *Step) Validate() error {
-	if s.Type() != StepTypeRun {
+	switch s.Type() {
+	case StepTypeInvalid:
 		return fmt.Errorf("(StepID: %s): Unexpected value 'uses'", s.String())
-	} else if s.Shell == "" {
-		return fmt.Errorf("(StepID: %s): Required property is missing: 'shell'", s.String())
+	case StepTypeRun:
+		if s.Shell == "" {
+			return fmt.Errorf("(StepID: %s): Required property is missing: 'shell'", s.String())
+		}
 	}
 	return nil
 }
@@ -321,7 +932,23 @@ func (s *Step) Validate() error {
 func ReadWorkflow(in io.Reader) (*Workflow, error) {
 	w := new(Workflow)
 	err := yaml.NewDecoder(in).Decode(w)
-	return w, err
+	if err != nil {
+		return w, err
+	}
+
+	// the permissions are parsed once, so an invalid one fails the workflow instead of the job using it
+	if w.permissions, err = parsePermissions(w.RawPermissions); err != nil {
+		return w, fmt.Errorf("workflow: %w", err)
+	}
+	for id, job := range w.Jobs {
+		if job == nil {
+			continue
+		}
+		if job.permissions, err = parsePermissions(job.RawPermissions); err != nil {
+			return w, fmt.Errorf("job '%s': %w", id, err)
+		}
+	}
+	return w, nil
 }
 
 // GetJob will get a job by name in the workflow
@@ -0,0 +1,72 @@
+package model
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// workflowCall is a reusable workflow in the call chain of a job, repository local workflows have no ref
+type workflowCall struct {
+	file string
+	ref  string
+}
+
+func (wc workflowCall) String() string {
+	if wc.ref == "" {
+		return wc.file
+	}
+	return fmt.Sprintf("%s@%s", wc.file, wc.ref)
+}
+
+// CheckWorkflowCalls follows the reusable workflows called by the jobs of workflow and returns an error
+// with the call chain if they call each other in a cycle. Only reusable workflows of the repository in
+// workdir (`uses: ./.github/workflows/...`) can be followed, calls to other repositories end the chain.
+func CheckWorkflowCalls(workdir string, workflow *Workflow) error {
+	file := workflow.File
+	if rel, err := filepath.Rel(workdir, file); err == nil && !strings.HasPrefix(rel, "..") {
+		file = rel
+	}
+	return checkWorkflowCalls(workdir, workflow, []workflowCall{{file: filepath.ToSlash(file)}})
+}
+
+func checkWorkflowCalls(workdir string, workflow *Workflow, stack []workflowCall) error {
+	jobIDs := workflow.GetJobIDs()
+	sort.Strings(jobIDs)
+	for _, jobID := range jobIDs {
+		uses := workflow.GetJob(jobID).Uses
+		if !strings.HasPrefix(uses, "./") {
+			continue
+		}
+
+		call := workflowCall{file: filepath.ToSlash(filepath.Clean(strings.SplitN(uses, "@", 2)[0]))}
+		chain := append(append([]workflowCall{}, stack...), call)
+		for _, visited := range stack {
+			if visited == call {
+				names := make([]string, 0, len(chain))
+				for _, c := range chain {
+					names = append(names, c.String())
+				}
+				return fmt.Errorf("reusable workflows call each other in a cycle: %s", strings.Join(names, " -> "))
+			}
+		}
+
+		f, err := os.Open(filepath.Join(workdir, call.file))
+		if err != nil {
+			return errors.WithMessagef(err, "unable to read reusable workflow called by job '%s'", jobID)
+		}
+		called, err := ReadWorkflow(f)
+		f.Close()
+		if err != nil {
+			return errors.WithMessagef(err, "unable to read reusable workflow '%s'", call.file)
+		}
+		if err := checkWorkflowCalls(workdir, called, chain); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package model
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readTestWorkflow(t *testing.T, workdir string, file string) *Workflow {
+	f, err := os.Open(filepath.Join(workdir, file))
+	assert.Nil(t, err)
+	defer f.Close()
+
+	workflow, err := ReadWorkflow(f)
+	assert.Nil(t, err)
+	workflow.File = f.Name()
+	return workflow
+}
+
+func TestCheckWorkflowCalls(t *testing.T) {
+	workdir := "testdata/workflow-call-cycle"
+
+	err := CheckWorkflowCalls(workdir, readTestWorkflow(t, workdir, ".github/workflows/caller.yml"))
+	assert.EqualError(t, err, "reusable workflows call each other in a cycle: .github/workflows/caller.yml -> .github/workflows/a.yml -> .github/workflows/b.yml -> .github/workflows/a.yml")
+
+	err = CheckWorkflowCalls(workdir, readTestWorkflow(t, workdir, ".github/workflows/b.yml"))
+	assert.EqualError(t, err, "reusable workflows call each other in a cycle: .github/workflows/b.yml -> .github/workflows/a.yml -> .github/workflows/b.yml")
+
+	// calling the same workflow twice or a workflow of another repository is no cycle
+	err = CheckWorkflowCalls(workdir, readTestWorkflow(t, workdir, ".github/workflows/no-cycle.yml"))
+	assert.Nil(t, err)
+}
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"fmt"
 	"strings"
 	"testing"
 
@@ -99,6 +100,217 @@ jobs:
 	assert.Contains(t, workflow.Jobs["test2"].Container().Env["foo"], "bar")
 }
 
+func TestReadWorkflow_Environment(t *testing.T) {
+	yaml := `
+name: deploy
+
+jobs:
+  staging:
+    environment: staging
+    runs-on: ubuntu-latest
+    steps:
+    - run: ./deploy.sh
+  production:
+    environment:
+      name: production
+      url: https://example.com
+    runs-on: ubuntu-latest
+    steps:
+    - run: ./deploy.sh
+  test:
+    runs-on: ubuntu-latest
+    steps:
+    - run: ./test.sh
+`
+
+	workflow, err := ReadWorkflow(strings.NewReader(yaml))
+	assert.NoError(t, err, "read workflow should succeed")
+	assert.Equal(t, &Environment{Name: "staging"}, workflow.Jobs["staging"].Environment())
+	assert.Equal(t, &Environment{Name: "production", URL: "https://example.com"}, workflow.Jobs["production"].Environment())
+	assert.Nil(t, workflow.Jobs["test"].Environment())
+}
+
+func TestReadWorkflow_Concurrency(t *testing.T) {
+	yaml := `
+name: deploy
+concurrency: deploy-${{ github.ref }}
+
+jobs:
+  group:
+    concurrency:
+      group: production
+      cancel-in-progress: true
+    runs-on: ubuntu-latest
+    steps:
+    - run: ./deploy.sh
+  test:
+    runs-on: ubuntu-latest
+    steps:
+    - run: ./test.sh
+`
+
+	workflow, err := ReadWorkflow(strings.NewReader(yaml))
+	assert.NoError(t, err, "read workflow should succeed")
+	assert.Equal(t, &Concurrency{Group: "deploy-${{ github.ref }}"}, workflow.Concurrency())
+	assert.Equal(t, &Concurrency{Group: "production", CancelInProgress: "true"}, workflow.Jobs["group"].Concurrency())
+	assert.Nil(t, workflow.Jobs["test"].Concurrency())
+}
+
+func TestReadWorkflow_Permissions(t *testing.T) {
+	yaml := `
+name: permissions
+permissions: read-all
+
+jobs:
+  inherit:
+    runs-on: ubuntu-latest
+    steps:
+    - run: ./test.sh
+  write:
+    permissions: write-all
+    runs-on: ubuntu-latest
+    steps:
+    - run: ./test.sh
+  scopes:
+    permissions:
+      contents: read
+      pull-requests: write
+    runs-on: ubuntu-latest
+    steps:
+    - run: ./test.sh
+  none:
+    permissions: {}
+    runs-on: ubuntu-latest
+    steps:
+    - run: ./test.sh
+`
+
+	workflow, err := ReadWorkflow(strings.NewReader(yaml))
+	assert.NoError(t, err, "read workflow should succeed")
+
+	permissions := func(fn func(scope string) string) Permissions {
+		val := make(Permissions)
+		for _, scope := range PermissionScopes {
+			val[scope] = fn(scope)
+		}
+		return val
+	}
+	readAll := permissions(func(string) string { return "read" })
+	assert.Equal(t, readAll, workflow.Permissions())
+	assert.Nil(t, workflow.Jobs["inherit"].Permissions())
+	assert.Equal(t, readAll, (&Run{Workflow: workflow, JobID: "inherit"}).Permissions())
+	assert.Equal(t, permissions(func(string) string { return "write" }), (&Run{Workflow: workflow, JobID: "write"}).Permissions())
+	assert.Equal(t, permissions(func(scope string) string {
+		switch scope {
+		case "contents":
+			return "read"
+		case "pull-requests":
+			return "write"
+		}
+		return "none"
+	}), (&Run{Workflow: workflow, JobID: "scopes"}).Permissions())
+	assert.Equal(t, permissions(func(string) string { return "none" }), (&Run{Workflow: workflow, JobID: "none"}).Permissions())
+
+	workflow, err = ReadWorkflow(strings.NewReader("name: default\njobs:\n  test:\n    runs-on: ubuntu-latest\n"))
+	assert.NoError(t, err, "read workflow should succeed")
+	assert.Nil(t, (&Run{Workflow: workflow, JobID: "test"}).Permissions())
+
+	for yaml, err := range map[string]string{
+		"permissions: admin\n":                      "workflow: invalid permissions 'admin', expected read-all, write-all or a map of scopes",
+		"permissions:\n  code: read\n":              "workflow: invalid permissions scope 'code', expected one of " + strings.Join(PermissionScopes, ", "),
+		"jobs:\n  test:\n    permissions: [read]\n": "job 'test': invalid permissions, expected read-all, write-all or a map of scopes",
+	} {
+		_, readErr := ReadWorkflow(strings.NewReader(yaml))
+		assert.EqualError(t, readErr, err, yaml)
+	}
+}
+
+func TestReadWorkflow_WorkflowCall(t *testing.T) {
+	yaml := `
+name: reusable
+on:
+  workflow_call:
+    inputs:
+      target:
+        type: string
+        required: true
+    outputs:
+      version:
+        description: version that was built
+        value: ${{ jobs.build.outputs.version }}
+    secrets:
+      token:
+        required: true
+
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    outputs:
+      version: ${{ steps.version.outputs.version }}
+    steps:
+    - id: version
+      run: echo "::set-output name=version::1.2.3"
+`
+
+	workflow, err := ReadWorkflow(strings.NewReader(yaml))
+	assert.NoError(t, err, "read workflow should succeed")
+
+	call := workflow.WorkflowCallConfig()
+	if assert.NotNil(t, call) {
+		assert.Equal(t, WorkflowCallInput{Type: "string", Required: true}, call.Inputs["target"])
+		assert.Equal(t, WorkflowCallOutput{Description: "version that was built", Value: "${{ jobs.build.outputs.version }}"}, call.Outputs["version"])
+		assert.True(t, call.Secrets["token"].Required)
+	}
+
+	workflow, err = ReadWorkflow(strings.NewReader("name: push\non: push\njobs: {}\n"))
+	assert.NoError(t, err, "read workflow should succeed")
+	assert.Nil(t, workflow.WorkflowCallConfig())
+}
+
+func TestReadWorkflow_JobSecrets(t *testing.T) {
+	yaml := `
+name: caller
+on: push
+
+jobs:
+  passed:
+    uses: ./.github/workflows/reusable.yml
+    with:
+      target: linux
+    secrets:
+      token: ${{ secrets.TOKEN }}
+  inherited:
+    uses: ./.github/workflows/reusable.yml
+    secrets: inherit
+  none:
+    uses: ./.github/workflows/reusable.yml
+  invalid:
+    uses: ./.github/workflows/reusable.yml
+    secrets: all
+`
+
+	workflow, err := ReadWorkflow(strings.NewReader(yaml))
+	assert.NoError(t, err, "read workflow should succeed")
+	assert.Equal(t, map[string]string{"target": "linux"}, workflow.GetJob("passed").With)
+
+	for jobID, want := range map[string]struct {
+		secrets map[string]string
+		inherit bool
+	}{
+		"passed":    {map[string]string{"token": "${{ secrets.TOKEN }}"}, false},
+		"inherited": {nil, true},
+		"none":      {nil, false},
+	} {
+		secrets, inherit, err := workflow.GetJob(jobID).Secrets()
+		assert.NoError(t, err, jobID)
+		assert.Equal(t, want.secrets, secrets, jobID)
+		assert.Equal(t, want.inherit, inherit, jobID)
+	}
+
+	_, _, err = workflow.GetJob("invalid").Secrets()
+	assert.Error(t, err)
+}
+
 func TestReadWorkflow_StepsTypes(t *testing.T) {
 	yaml := `
 name: invalid step definition
@@ -146,3 +358,338 @@ func TestStep_ShellCommand(t *testing.T) {
 		})
 	}
 }
+
+func TestReadWorkflow_BranchFilters(t *testing.T) {
+	yaml := `
+name: branch-filters
+on:
+  push:
+    branches:
+    - main
+    - 'releases/**'
+    - '!releases/**-alpha'
+  pull_request:
+    branches:
+    - '!feature/*'
+    - '!wip'
+  pull_request_target:
+    branches:
+    - $default-branch
+  release:
+    branches-ignore:
+    - 'docs/*'
+  workflow_dispatch:
+
+jobs:
+  test:
+    runs-on: ubuntu-latest
+    steps:
+    - uses: ./actions/docker-url
+`
+
+	workflow, err := ReadWorkflow(strings.NewReader(yaml))
+	assert.NoError(t, err, "read workflow should succeed")
+
+	tables := []struct {
+		event   string
+		branch  string
+		matches bool
+	}{
+		// mixed filters, a later negation excludes again
+		{"push", "main", true},
+		{"push", "refs/heads/main", true},
+		{"push", "releases/v1", true},
+		{"push", "releases/v1/beta", true},
+		{"push", "releases/v1-alpha", false},
+		{"push", "feature/main", false},
+		// only negations means all except
+		{"pull_request", "main", true},
+		{"pull_request", "feature/foo", false},
+		{"pull_request", "feature/foo/bar", true},
+		{"pull_request", "wip", false},
+		// default branch shorthand
+		{"pull_request_target", "master", true},
+		{"pull_request_target", "main", false},
+		{"release", "docs/readme", false},
+		{"release", "main", true},
+		// no filters means all branches
+		{"workflow_dispatch", "anything/at/all", true},
+		{"schedule", "anything", true},
+	}
+
+	for _, table := range tables {
+		assert.Equal(t, table.matches, workflow.OnEvent(table.event).MatchesBranch(table.branch, "master"), "%s %s", table.event, table.branch)
+	}
+}
+
+func TestReadWorkflow_PathFilters(t *testing.T) {
+	yaml := `
+name: path filters
+
+on:
+  push:
+    branches:
+    - main
+    paths:
+    - 'src/**'
+    - '!src/**.md'
+  pull_request:
+    paths-ignore:
+    - 'docs/**'
+
+jobs:
+  test:
+    runs-on: ubuntu-latest
+    steps:
+    - run: echo
+`
+
+	workflow, err := ReadWorkflow(strings.NewReader(yaml))
+	assert.NoError(t, err, "read workflow should succeed")
+
+	tables := []struct {
+		event   string
+		payload *EventPayload
+		matches bool
+	}{
+		{"push", nil, true},
+		{"push", &EventPayload{Ref: "refs/heads/main", ChangedFiles: []string{"src/main.go"}}, true},
+		{"push", &EventPayload{Ref: "refs/heads/main", ChangedFiles: []string{"src/README.md", "docs/index.md"}}, false},
+		{"push", &EventPayload{Ref: "refs/heads/main", ChangedFiles: []string{"src/README.md", "src/pkg/file.go"}}, true},
+		{"push", &EventPayload{Ref: "refs/heads/feature", ChangedFiles: []string{"src/main.go"}}, false},
+		{"push", &EventPayload{Ref: "refs/tags/v1.0.0", ChangedFiles: []string{"src/main.go"}}, false},
+		{"push", &EventPayload{Ref: "refs/heads/main"}, true},
+		{"pull_request", &EventPayload{Ref: "main", ChangedFiles: []string{"docs/index.md"}}, false},
+		{"pull_request", &EventPayload{Ref: "main", ChangedFiles: []string{"docs/index.md", "README.md"}}, true},
+		{"pull_request", &EventPayload{Ref: "refs/tags/v1.0.0", ChangedFiles: []string{"README.md"}}, true},
+	}
+
+	for _, table := range tables {
+		assert.Equal(t, table.matches, workflow.OnEvent(table.event).MatchesPayload(table.payload), "%s %+v", table.event, table.payload)
+	}
+}
+
+func TestReadWorkflow_MatrixExpressions(t *testing.T) {
+	yaml := `
+name: matrix expressions
+
+on: push
+
+jobs:
+  whole:
+    runs-on: ubuntu-latest
+    strategy:
+      matrix: ${{ fromJSON(needs.setup.outputs.matrix) }}
+    steps:
+    - run: echo
+  key:
+    runs-on: ubuntu-latest
+    strategy:
+      matrix:
+        os: ${{ fromJSON(needs.setup.outputs.os) }}
+        node: [12, 14]
+    steps:
+    - run: echo
+  static:
+    runs-on: ubuntu-latest
+    strategy:
+      matrix:
+        os: [linux]
+        include:
+        - os: windows
+    steps:
+    - run: echo
+`
+
+	workflow, err := ReadWorkflow(strings.NewReader(yaml))
+	assert.NoError(t, err, "read workflow should succeed")
+
+	evaluate := func(expression string) (interface{}, error) {
+		switch expression {
+		case "${{ fromJSON(needs.setup.outputs.matrix) }}":
+			return map[string]interface{}{"os": []interface{}{"linux", "windows"}}, nil
+		case "${{ fromJSON(needs.setup.outputs.os) }}":
+			return []interface{}{"linux"}, nil
+		}
+		return nil, fmt.Errorf("unexpected expression %s", expression)
+	}
+
+	matrixes, err := workflow.GetJob("whole").GetMatrixes(evaluate)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []map[string]interface{}{{"os": "linux"}, {"os": "windows"}}, matrixes)
+
+	matrixes, err = workflow.GetJob("key").GetMatrixes(evaluate)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []map[string]interface{}{{"os": "linux", "node": 12}, {"os": "linux", "node": 14}}, matrixes)
+
+	_, err = workflow.GetJob("whole").GetMatrixes(nil)
+	assert.Error(t, err)
+
+	// evaluating the matrix again gives the same result
+	for i := 0; i < 2; i++ {
+		matrixes, err = workflow.GetJob("static").GetMatrixes(nil)
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []map[string]interface{}{{"os": "linux"}, {"os": "windows"}}, matrixes)
+	}
+}
+
+// the examples of https://docs.github.com/en/actions/using-jobs/using-a-matrix-for-your-jobs
+func TestExpandMatrix(t *testing.T) {
+	for _, table := range []struct {
+		name     string
+		matrix   map[string][]interface{}
+		expected []map[string]interface{}
+	}{
+		{
+			name: "expanding",
+			matrix: map[string][]interface{}{
+				"fruit":  {"apple", "pear"},
+				"animal": {"cat", "dog"},
+				"include": {
+					map[string]interface{}{"color": "green"},
+					map[string]interface{}{"color": "pink", "animal": "cat"},
+					map[string]interface{}{"fruit": "apple", "shape": "circle"},
+					map[string]interface{}{"fruit": "banana"},
+					map[string]interface{}{"fruit": "banana", "animal": "cat"},
+				},
+			},
+			expected: []map[string]interface{}{
+				{"fruit": "apple", "animal": "cat", "color": "pink", "shape": "circle"},
+				{"fruit": "apple", "animal": "dog", "color": "green", "shape": "circle"},
+				{"fruit": "pear", "animal": "cat", "color": "pink"},
+				{"fruit": "pear", "animal": "dog", "color": "green"},
+				{"fruit": "banana"},
+				{"fruit": "banana", "animal": "cat"},
+			},
+		},
+		{
+			name: "extending",
+			matrix: map[string][]interface{}{
+				"os":   {"windows-latest", "ubuntu-latest"},
+				"node": {14, 16},
+				"include": {
+					map[string]interface{}{"os": "windows-latest", "node": 16, "npm": 6},
+				},
+			},
+			expected: []map[string]interface{}{
+				{"os": "windows-latest", "node": 14},
+				{"os": "windows-latest", "node": 16, "npm": 6},
+				{"os": "ubuntu-latest", "node": 14},
+				{"os": "ubuntu-latest", "node": 16},
+			},
+		},
+		{
+			name: "only include",
+			matrix: map[string][]interface{}{
+				"include": {
+					map[string]interface{}{"site": "production", "datacenter": "site-a"},
+					map[string]interface{}{"site": "staging", "datacenter": "site-b"},
+				},
+			},
+			expected: []map[string]interface{}{
+				{"site": "production", "datacenter": "site-a"},
+				{"site": "staging", "datacenter": "site-b"},
+			},
+		},
+		{
+			name: "excluding",
+			matrix: map[string][]interface{}{
+				"os":          {"macos-latest", "windows-latest"},
+				"version":     {12, 14, 16},
+				"environment": {"staging", "production"},
+				"exclude": {
+					map[string]interface{}{"os": "macos-latest", "version": 12, "environment": "production"},
+					map[string]interface{}{"os": "windows-latest", "version": 16},
+				},
+			},
+			expected: []map[string]interface{}{
+				{"os": "macos-latest", "version": 12, "environment": "staging"},
+				{"os": "macos-latest", "version": 14, "environment": "staging"},
+				{"os": "macos-latest", "version": 14, "environment": "production"},
+				{"os": "macos-latest", "version": 16, "environment": "staging"},
+				{"os": "macos-latest", "version": 16, "environment": "production"},
+				{"os": "windows-latest", "version": 12, "environment": "staging"},
+				{"os": "windows-latest", "version": 12, "environment": "production"},
+				{"os": "windows-latest", "version": 14, "environment": "staging"},
+				{"os": "windows-latest", "version": 14, "environment": "production"},
+			},
+		},
+		{
+			name: "include after exclude",
+			matrix: map[string][]interface{}{
+				"os":   {"linux", "windows"},
+				"node": {14},
+				"exclude": {
+					map[string]interface{}{"os": "windows"},
+				},
+				"include": {
+					map[string]interface{}{"os": "windows", "node": 16},
+				},
+			},
+			expected: []map[string]interface{}{
+				{"os": "linux", "node": 14},
+				{"os": "windows", "node": 16},
+			},
+		},
+	} {
+		t.Run(table.name, func(t *testing.T) {
+			matrixes, err := ExpandMatrix(table.matrix)
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, table.expected, matrixes)
+		})
+	}
+}
+
+func TestReadWorkflow_RunsOn(t *testing.T) {
+	yaml := `
+name: runs-on
+on: push
+
+jobs:
+  string:
+    runs-on: ubuntu-latest
+    steps:
+    - run: echo
+  list:
+    runs-on: [self-hosted, linux]
+    steps:
+    - run: echo
+  group:
+    runs-on:
+      group: gpu-runners
+    steps:
+    - run: echo
+  group-label:
+    runs-on:
+      group: gpu-runners
+      labels: linux
+    steps:
+    - run: echo
+  group-labels:
+    runs-on:
+      group: gpu-runners
+      labels: [self-hosted, linux]
+    steps:
+    - run: echo
+`
+
+	workflow, err := ReadWorkflow(strings.NewReader(yaml))
+	assert.NoError(t, err, "read workflow should succeed")
+
+	tables := []struct {
+		jobID  string
+		group  string
+		labels []string
+	}{
+		{"string", "", []string{"ubuntu-latest"}},
+		{"list", "", []string{"self-hosted", "linux"}},
+		{"group", "gpu-runners", []string{}},
+		{"group-label", "gpu-runners", []string{"linux"}},
+		{"group-labels", "gpu-runners", []string{"self-hosted", "linux"}},
+	}
+	for _, table := range tables {
+		job := workflow.GetJob(table.jobID)
+		assert.Equal(t, table.group, job.RunsOnGroup(), table.jobID)
+		assert.Equal(t, table.labels, job.RunsOn(), table.jobID)
+	}
+}
@@ -0,0 +1,149 @@
+package runner
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nektos/act/pkg/common"
+)
+
+var actionCacheLock sync.Mutex
+
+// actionCacheInUse counts the jobs that use each action directory of the cache, they are never evicted.
+// It is guarded by actionCacheLock.
+var actionCacheInUse = make(map[string]int)
+
+// actions pinned to a commit sha never change, so they are the last to be evicted
+var pinnedActionPattern = regexp.MustCompile(`@[0-9a-f]{40}$`)
+
+type actionCacheEntry struct {
+	path     string
+	size     int64
+	lastUsed time.Time
+	pinned   bool
+}
+
+// acquireCachedAction marks the action in actionDir as in use by the job of rc until releaseCachedActions,
+// so the jobs running in parallel don't evict it while it is cloned or its steps run
+func (rc *RunContext) acquireCachedAction(actionDir string) common.Executor {
+	return func(ctx context.Context) error {
+		actionCacheLock.Lock()
+		defer actionCacheLock.Unlock()
+
+		actionDir = filepath.Clean(actionDir)
+		if rc.cachedActions == nil {
+			rc.cachedActions = make(map[string]bool)
+		}
+		if !rc.cachedActions[actionDir] {
+			rc.cachedActions[actionDir] = true
+			actionCacheInUse[actionDir]++
+		}
+		return nil
+	}
+}
+
+// releaseCachedActions releases the actions the job of rc acquired, once its post steps ran too
+func (rc *RunContext) releaseCachedActions() common.Executor {
+	return func(ctx context.Context) error {
+		actionCacheLock.Lock()
+		defer actionCacheLock.Unlock()
+
+		for actionDir := range rc.cachedActions {
+			if actionCacheInUse[actionDir]--; actionCacheInUse[actionDir] <= 0 {
+				delete(actionCacheInUse, actionDir)
+			}
+		}
+		rc.cachedActions = nil
+		return nil
+	}
+}
+
+// useCachedAction marks the action in actionDir as used and evicts the least recently used
+// actions no job uses from the cache until it fits in Config.ActionCacheMaxSize
+func (rc *RunContext) useCachedAction(actionDir string) common.Executor {
+	return func(ctx context.Context) error {
+		actionCacheLock.Lock()
+		defer actionCacheLock.Unlock()
+
+		now := time.Now()
+		if err := os.Chtimes(actionDir, now, now); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		if rc.Config.ActionCacheMaxSize <= 0 {
+			return nil
+		}
+		return pruneActionCache(ctx, rc.ActionCacheDir(), rc.Config.ActionCacheMaxSize, actionCacheInUse)
+	}
+}
+
+func pruneActionCache(ctx context.Context, cacheDir string, maxSize int64, inUse map[string]int) error {
+	logger := common.Logger(ctx)
+
+	infos, err := ioutil.ReadDir(cacheDir)
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	entries := make([]actionCacheEntry, 0, len(infos))
+	for _, info := range infos {
+		if !info.IsDir() {
+			continue
+		}
+		path := filepath.Join(cacheDir, info.Name())
+		size, err := dirSize(path)
+		if err != nil {
+			return err
+		}
+		total += size
+		entries = append(entries, actionCacheEntry{
+			path:     path,
+			size:     size,
+			lastUsed: info.ModTime(),
+			pinned:   pinnedActionPattern.MatchString(info.Name()),
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].pinned != entries[j].pinned {
+			return !entries[i].pinned
+		}
+		return entries[i].lastUsed.Before(entries[j].lastUsed)
+	})
+
+	for _, entry := range entries {
+		if total <= maxSize {
+			break
+		}
+		if inUse[entry.path] > 0 {
+			continue
+		}
+		logger.Debugf("Evicting %s (%d bytes) from the action cache", entry.path, entry.size)
+		if err := os.RemoveAll(entry.path); err != nil {
+			return err
+		}
+		total -= entry.size
+	}
+	return nil
+}
+
+func dirSize(path string) (int64, error) {
+	var size int64
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,114 @@
+package runner
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPruneActionCache(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "act-action-cache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	now := time.Now()
+	newEntry := func(name string, size int, lastUsed time.Duration) string {
+		dir := filepath.Join(cacheDir, name)
+		assert.NoError(t, os.MkdirAll(dir, 0755))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "action.yml"), make([]byte, size), 0644))
+		assert.NoError(t, os.Chtimes(dir, now.Add(-lastUsed), now.Add(-lastUsed)))
+		return dir
+	}
+
+	pinned := newEntry("actions-checkout@5a4ac9002d0be2fb38bd78e4b4dbde5606d7042f", 100, 5*time.Hour)
+	oldest := newEntry("actions-setup-node@v2", 100, 4*time.Hour)
+	older := newEntry("actions-cache@v2", 100, 3*time.Hour)
+	recent := newEntry("actions-upload-artifact@v2", 100, time.Hour)
+	current := newEntry("actions-download-artifact@v2", 100, 24*time.Hour)
+
+	err = pruneActionCache(context.Background(), cacheDir, 300, map[string]int{current: 1})
+	assert.NoError(t, err)
+
+	for dir, exists := range map[string]bool{
+		pinned:  true,
+		oldest:  false,
+		older:   false,
+		recent:  true,
+		current: true,
+	} {
+		_, err := os.Stat(dir)
+		assert.Equal(t, exists, err == nil, dir)
+	}
+
+	// once only pinned entries are left to evict, they go too
+	err = pruneActionCache(context.Background(), cacheDir, 100, map[string]int{current: 1})
+	assert.NoError(t, err)
+	_, err = os.Stat(pinned)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(recent)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(current)
+	assert.NoError(t, err)
+}
+
+func TestUseCachedAction(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "act-action-cache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	actionDir := filepath.Join(cacheDir, "actions-checkout@v2")
+	assert.NoError(t, os.MkdirAll(actionDir, 0755))
+	past := time.Now().Add(-time.Hour)
+	assert.NoError(t, os.Chtimes(actionDir, past, past))
+
+	rc := &RunContext{Config: &Config{ActionCacheDir: cacheDir}}
+	assert.NoError(t, rc.useCachedAction(actionDir)(context.Background()))
+
+	info, err := os.Stat(actionDir)
+	assert.NoError(t, err)
+	assert.True(t, info.ModTime().After(past))
+}
+
+func TestAcquireCachedAction(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "act-action-cache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	past := time.Now().Add(-time.Hour)
+	newEntry := func(name string) string {
+		dir := filepath.Join(cacheDir, name)
+		assert.NoError(t, os.MkdirAll(dir, 0755))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "action.yml"), make([]byte, 100), 0644))
+		assert.NoError(t, os.Chtimes(dir, past, past))
+		return dir
+	}
+	used := newEntry("actions-checkout@v2")
+	current := newEntry("actions-cache@v2")
+
+	// both jobs use the older action, the first one is done with it before the second one
+	first := &RunContext{Config: &Config{ActionCacheDir: cacheDir, ActionCacheMaxSize: 100}}
+	second := &RunContext{Config: &Config{ActionCacheDir: cacheDir, ActionCacheMaxSize: 100}}
+	ctx := context.Background()
+	assert.NoError(t, first.acquireCachedAction(used)(ctx))
+	assert.NoError(t, first.acquireCachedAction(used)(ctx))
+	assert.NoError(t, second.acquireCachedAction(used)(ctx))
+	assert.NoError(t, first.releaseCachedActions()(ctx))
+
+	assert.NoError(t, second.acquireCachedAction(current)(ctx))
+	assert.NoError(t, second.useCachedAction(current)(ctx))
+	_, err = os.Stat(used)
+	assert.NoError(t, err, "an action a job still uses is not evicted")
+
+	assert.NoError(t, second.releaseCachedActions()(ctx))
+	assert.NoError(t, first.acquireCachedAction(current)(ctx))
+	assert.NoError(t, first.useCachedAction(current)(ctx))
+	_, err = os.Stat(used)
+	assert.True(t, os.IsNotExist(err), "an action no job uses is evicted")
+	assert.NoError(t, first.releaseCachedActions()(ctx))
+	assert.Empty(t, actionCacheInUse)
+}
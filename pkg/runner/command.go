@@ -2,6 +2,7 @@ package runner
 
 import (
 	"context"
+	"fmt"
 	"regexp"
 	"strings"
 
@@ -12,10 +13,24 @@ var commandPatternGA *regexp.Regexp
 var commandPatternADO *regexp.Regexp
 
 func init() {
-	commandPatternGA = regexp.MustCompile("^::([^ ]+)( (.+))?::([^\r\n]*)[\r\n]+$")
-	commandPatternADO = regexp.MustCompile("^##\\[([^ ]+)( (.+))?]([^\r\n]*)[\r\n]+$")
+	// a command has to start a line, only whitespace can come before it, so output like
+	// `echo "see ::set-output name=x::y"` isn't one
+	commandPatternGA = regexp.MustCompile("^[ \t]*::([^ ]+)( (.+))?::([^\r\n]*)[\r\n]+$")
+	commandPatternADO = regexp.MustCompile("^[ \t]*##\\[([^ ]+)( (.+))?]([^\r\n]*)[\r\n]+$")
 }
 
+// WorkflowCommand is a command like `::set-output name=x::value` emitted by a step
+type WorkflowCommand struct {
+	Command    string            // name of the command, e.g. set-output
+	Parameters map[string]string // parameters of the command, e.g. name=x
+	Value      string            // data of the command after the parameters
+	JobID      string            // id of the job that emitted the command
+	StepID     string            // id of the step that emitted the command
+}
+
+// WorkflowCommandHandler is called with every workflow command emitted by a step
+type WorkflowCommandHandler func(ctx context.Context, command WorkflowCommand)
+
 func (rc *RunContext) commandHandler(ctx context.Context) common.LineHandler {
 	logger := common.Logger(ctx)
 	resumeCommand := ""
@@ -40,6 +55,9 @@ func (rc *RunContext) commandHandler(ctx context.Context) common.LineHandler {
 		}
 		arg = unescapeCommandData(arg)
 		kvPairs = unescapeKvPairs(kvPairs)
+		if rc.Config != nil && rc.Config.OnWorkflowCommand != nil {
+			rc.Config.OnWorkflowCommand(ctx, rc.newWorkflowCommand(command, kvPairs, arg))
+		}
 		switch command {
 		case "set-env":
 			rc.setEnv(ctx, kvPairs, arg)
@@ -47,13 +65,22 @@ func (rc *RunContext) commandHandler(ctx context.Context) common.LineHandler {
 			rc.setOutput(ctx, kvPairs, arg)
 		case "add-path":
 			rc.addPath(ctx, arg)
+		case "save-state":
+			rc.saveState(ctx, kvPairs, arg)
 		case "debug":
-			logger.Infof("  \U0001F4AC  %s", line)
+			if rc.isStepDebug() {
+				logger.Infof("  \U0001F4AC  %s", line)
+			} else {
+				logger.Debugf("  \U0001F4AC  %s", line)
+			}
 		case "warning":
 			logger.Infof("  \U0001F6A7  %s", line)
 		case "error":
 			logger.Infof("  \U00002757  %s", line)
 		case "add-mask":
+			if rc.Config == nil || !rc.Config.InsecureSecrets {
+				rc.masks.add(arg)
+			}
 			logger.Infof("  \U00002699  %s", line)
 		case "stop-commands":
 			resumeCommand = arg
@@ -69,6 +96,36 @@ func (rc *RunContext) commandHandler(ctx context.Context) common.LineHandler {
 	}
 }
 
+func (rc *RunContext) newWorkflowCommand(command string, kvPairs map[string]string, arg string) WorkflowCommand {
+	workflowCommand := WorkflowCommand{
+		Command:    command,
+		Parameters: kvPairs,
+		Value:      arg,
+		StepID:     rc.CurrentStep,
+	}
+	if rc.Run != nil {
+		workflowCommand.JobID = rc.Run.JobID
+	}
+	return workflowCommand
+}
+
+// isStepDebug returns true if debug output should be shown for the current step.
+// Without any Config.StepDebug entries debug output is shown for every step.
+func (rc *RunContext) isStepDebug() bool {
+	if rc.Config == nil || len(rc.Config.StepDebug) == 0 {
+		return true
+	}
+	return rc.isStepDebugTarget()
+}
+
+// isStepDebugTarget returns true if Config.StepDebug explicitly enables the current step
+func (rc *RunContext) isStepDebugTarget() bool {
+	if rc.Config == nil || rc.Run == nil {
+		return false
+	}
+	return rc.Config.StepDebug[fmt.Sprintf("%s.%s", rc.Run.JobID, rc.CurrentStep)]
+}
+
 func (rc *RunContext) setEnv(ctx context.Context, kvPairs map[string]string, arg string) {
 	common.Logger(ctx).Infof("  \U00002699  ::set-env:: %s=%s", kvPairs["name"], arg)
 	if rc.Env == nil {
@@ -79,10 +136,6 @@ func (rc *RunContext) setEnv(ctx context.Context, kvPairs map[string]string, arg
 func (rc *RunContext) setOutput(ctx context.Context, kvPairs map[string]string, arg string) {
 	stepID := rc.CurrentStep
 	outputName := kvPairs["name"]
-	if outputMapping, ok := rc.OutputMappings[MappableOutput{StepID: stepID, OutputName: outputName}]; ok {
-		stepID = outputMapping.StepID
-		outputName = outputMapping.OutputName
-	}
 
 	result, ok := rc.StepResults[stepID]
 	if !ok {
@@ -91,8 +144,37 @@ func (rc *RunContext) setOutput(ctx context.Context, kvPairs map[string]string,
 	}
 
 	common.Logger(ctx).Infof("  \U00002699  ::set-output:: %s=%s", outputName, arg)
+	rc.warnDeprecated(ctx, result, "set-output", "GITHUB_OUTPUT")
 	result.Outputs[outputName] = arg
 }
+func (rc *RunContext) saveState(ctx context.Context, kvPairs map[string]string, arg string) {
+	stepID := rc.CurrentStep
+	result, ok := rc.StepResults[stepID]
+	if !ok {
+		common.Logger(ctx).Infof("  \U00002757  no state saved for step '%s'", stepID)
+		return
+	}
+
+	common.Logger(ctx).Infof("  \U00002699  ::save-state:: %s=%s", kvPairs["name"], arg)
+	rc.warnDeprecated(ctx, result, "save-state", "GITHUB_STATE")
+	if result.State == nil {
+		result.State = make(map[string]string)
+	}
+	result.State[kvPairs["name"]] = arg
+}
+
+// warnDeprecated warns once per step that it used command, which GitHub deprecated in favor of writing to the
+// file in the env var file. The command still works.
+func (rc *RunContext) warnDeprecated(ctx context.Context, result *stepResult, command string, file string) {
+	if result.deprecated[command] {
+		return
+	}
+	if result.deprecated == nil {
+		result.deprecated = make(map[string]bool)
+	}
+	result.deprecated[command] = true
+	common.Logger(ctx).Warnf("  ⚠  The step '%s' uses the deprecated ::%s:: command, write to the file in $%s instead", rc.CurrentStep, command, file)
+}
 func (rc *RunContext) addPath(ctx context.Context, arg string) {
 	common.Logger(ctx).Infof("  \U00002699  ::add-path:: %s", arg)
 	rc.ExtraPath = append(rc.ExtraPath, arg)
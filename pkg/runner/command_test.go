@@ -4,7 +4,12 @@ import (
 	"context"
 	"testing"
 
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/nektos/act/pkg/common"
+	"github.com/nektos/act/pkg/model"
 )
 
 func TestSetEnv(t *testing.T) {
@@ -47,6 +52,84 @@ func TestSetOutput(t *testing.T) {
 	a.Equal("percent2%\ntest", rc.StepResults["my-step"].Outputs["x:,\n%\r:"])
 }
 
+func TestCommandsInChunks(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	rc := new(RunContext)
+	rc.StepResults = make(map[string]*stepResult)
+	rc.CurrentStep = "my-step"
+	rc.StepResults[rc.CurrentStep] = &stepResult{
+		Outputs: make(map[string]string),
+	}
+	writer := common.NewLineWriter(rc.commandHandler(ctx))
+
+	for _, chunk := range []string{
+		"::set-out",
+		"put name=split::val",
+		"ue\nline with ::set-output name=mid::line\n",
+		"  ::set-output name=indented::value\r",
+		"\n\t##[set-output name=ado]value\n",
+		// a line is only parsed once it is complete
+		"::set-output name=unterminated::value",
+	} {
+		_, err := writer.Write([]byte(chunk))
+		a.NoError(err)
+	}
+
+	a.Equal(map[string]string{
+		"split":    "value",
+		"indented": "value",
+		"ado":      "value",
+	}, rc.StepResults["my-step"].Outputs)
+}
+
+func TestSaveState(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	rc := new(RunContext)
+	rc.StepResults = make(map[string]*stepResult)
+	handler := rc.commandHandler(ctx)
+
+	rc.CurrentStep = "my-step"
+	rc.StepResults[rc.CurrentStep] = &stepResult{
+		Outputs: make(map[string]string),
+	}
+	handler("::save-state name=x::valz\n")
+	a.Equal("valz", rc.StepResults["my-step"].State["x"])
+	a.Empty(rc.StepResults["my-step"].Outputs)
+}
+
+func TestDeprecatedCommands(t *testing.T) {
+	a := assert.New(t)
+	logger, hook := test.NewNullLogger()
+	ctx := common.WithLogger(context.Background(), logger)
+	rc := new(RunContext)
+	rc.StepResults = make(map[string]*stepResult)
+	handler := rc.commandHandler(ctx)
+
+	rc.CurrentStep = "my-step"
+	rc.StepResults[rc.CurrentStep] = &stepResult{
+		Outputs: make(map[string]string),
+	}
+	handler("::set-output name=x::one\n")
+	handler("::set-output name=y::two\n")
+	handler("::save-state name=z::three\n")
+
+	// the commands still work, each is warned about once per step
+	a.Equal(map[string]string{"x": "one", "y": "two"}, rc.StepResults["my-step"].Outputs)
+	a.Equal("three", rc.StepResults["my-step"].State["z"])
+	warnings := make([]string, 0)
+	for _, entry := range hook.AllEntries() {
+		if entry.Level == logrus.WarnLevel {
+			warnings = append(warnings, entry.Message)
+		}
+	}
+	a.Equal([]string{
+		"  ⚠  The step 'my-step' uses the deprecated ::set-output:: command, write to the file in $GITHUB_OUTPUT instead",
+		"  ⚠  The step 'my-step' uses the deprecated ::save-state:: command, write to the file in $GITHUB_STATE instead",
+	}, warnings)
+}
+
 func TestAddpath(t *testing.T) {
 	a := assert.New(t)
 	ctx := context.Background()
@@ -88,3 +171,77 @@ func TestAddpathADO(t *testing.T) {
 	handler("##[add-path]/boo\n")
 	a.Equal("/boo", rc.ExtraPath[1])
 }
+
+func TestStepDebug(t *testing.T) {
+	a := assert.New(t)
+	logger, hook := test.NewNullLogger()
+	ctx := common.WithLogger(context.Background(), logger)
+	rc := &RunContext{
+		Config: &Config{
+			StepDebug: map[string]bool{
+				"job1.step1": true,
+			},
+		},
+		Run: &model.Run{
+			JobID: "job1",
+		},
+	}
+	handler := rc.commandHandler(ctx)
+
+	rc.CurrentStep = "step1"
+	handler("::debug::visible\n")
+	a.Len(hook.AllEntries(), 1)
+	a.Contains(hook.LastEntry().Message, "visible")
+
+	hook.Reset()
+	rc.CurrentStep = "step2"
+	handler("::debug::hidden\n")
+	a.Empty(hook.AllEntries())
+
+	rc.Config.StepDebug = nil
+	handler("::debug::visible\n")
+	a.Len(hook.AllEntries(), 1)
+}
+
+func TestOnWorkflowCommand(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	var commands []WorkflowCommand
+	rc := &RunContext{
+		Config: &Config{
+			OnWorkflowCommand: func(ctx context.Context, command WorkflowCommand) {
+				commands = append(commands, command)
+			},
+		},
+		Run: &model.Run{
+			JobID: "job1",
+		},
+		CurrentStep: "step1",
+		StepResults: map[string]*stepResult{
+			"step1": {Outputs: make(map[string]string)},
+		},
+	}
+	handler := rc.commandHandler(ctx)
+
+	handler("::set-output name=x::valz\n")
+	handler("::add-mask::secret%25\n")
+	handler("::warning file=app.js,line=1::careful\n")
+	handler("##[error]broken\n")
+	handler("not a command\n")
+	handler("::stop-commands::my-end-token\n")
+	handler("::notice::ignored\n")
+	handler("::my-end-token::\n")
+
+	a.Equal([]WorkflowCommand{
+		{Command: "set-output", Parameters: map[string]string{"name": "x"}, Value: "valz", JobID: "job1", StepID: "step1"},
+		{Command: "add-mask", Parameters: map[string]string{}, Value: "secret%", JobID: "job1", StepID: "step1"},
+		{Command: "warning", Parameters: map[string]string{"file": "app.js", "line": "1"}, Value: "careful", JobID: "job1", StepID: "step1"},
+		{Command: "error", Parameters: map[string]string{}, Value: "broken", JobID: "job1", StepID: "step1"},
+		{Command: "stop-commands", Parameters: map[string]string{}, Value: "my-end-token", JobID: "job1", StepID: "step1"},
+		{Command: "my-end-token", Parameters: map[string]string{}, Value: "", JobID: "job1", StepID: "step1"},
+	}, commands)
+
+	// built-in handling still runs
+	a.Equal("valz", rc.StepResults["step1"].Outputs["x"])
+}
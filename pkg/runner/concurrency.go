@@ -0,0 +1,134 @@
+package runner
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/nektos/act/pkg/common"
+	"github.com/nektos/act/pkg/model"
+)
+
+// concurrencyPollInterval is how often a run waiting for its concurrency group tries to take the lock again
+var concurrencyPollInterval = 500 * time.Millisecond
+
+// concurrencyLockDir is the directory of the lock files of the concurrency groups, shared by the act processes of the user.
+// It isn't in the action cache, whose entries are evicted.
+func concurrencyLockDir() string {
+	return filepath.Join(cacheHome(), "act-concurrency")
+}
+
+type concurrencyContextKey string
+
+const concurrencyContextKeyVal = concurrencyContextKey("runner.concurrencyGroups")
+
+// heldConcurrencyGroups returns the groups the executors ctx was passed to by withConcurrency hold
+func heldConcurrencyGroups(ctx context.Context) map[string]bool {
+	if groups, ok := ctx.Value(concurrencyContextKeyVal).(map[string]bool); ok {
+		return groups
+	}
+	return nil
+}
+
+// lockConcurrencyGroup waits until no other run, of this or another act process, holds the lock of group in dir
+// and takes it. The returned func releases the lock. The runs of a group queue like on GitHub with
+// cancel-in-progress false, the lock is released by the OS too if the process exits.
+func lockConcurrencyGroup(ctx context.Context, dir string, group string) (func(), error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(group))
+	f, err := os.OpenFile(filepath.Join(dir, hex.EncodeToString(sum[:])+".lock"), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	waiting := false
+	for {
+		locked, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("unable to lock the concurrency group %s: %w", group, err)
+		}
+		if locked {
+			return func() {
+				if err := unlockFile(f); err != nil {
+					common.Logger(ctx).Debugf("Unable to unlock the concurrency group %s: %v", group, err)
+				}
+				f.Close()
+			}, nil
+		}
+		if !waiting {
+			waiting = true
+			common.Logger(ctx).Infof("⏳  Waiting for the run in progress of the concurrency group %s", group)
+		}
+		select {
+		case <-ctx.Done():
+			f.Close()
+			return nil, ctx.Err()
+		case <-time.After(concurrencyPollInterval):
+		}
+	}
+}
+
+// concurrencyGroup evaluates the group of concurrency with the contexts of rc, it returns an empty group
+// if there is no concurrency. Cancelling the run in progress isn't supported, the runs queue instead.
+func (rc *RunContext) concurrencyGroup(ctx context.Context, concurrency *model.Concurrency) string {
+	if concurrency == nil {
+		return ""
+	}
+	group := rc.ExprEval.Interpolate(concurrency.Group)
+	if group != "" && rc.ExprEval.Interpolate(concurrency.CancelInProgress) == "true" {
+		common.Logger(ctx).Warnf("⚠  cancel-in-progress of the concurrency group %s isn't supported, the runs of the group queue instead", group)
+	}
+	return group
+}
+
+// withConcurrency runs executor holding the locks of groups, which are taken in order so that two
+// plans waiting for the same groups can't deadlock. Dry runs don't wait for the groups. It fails if
+// one of groups is already held by the withConcurrency executor it runs in.
+func withConcurrency(groups []string, executor common.Executor) common.Executor {
+	return func(ctx context.Context) error {
+		if len(groups) == 0 {
+			return executor(ctx)
+		}
+
+		// a job in the group of its workflow would wait for the workflow, which waits for the job
+		held := heldConcurrencyGroups(ctx)
+		for _, group := range groups {
+			if held[group] {
+				return fmt.Errorf("deadlock for the concurrency group %s: the job's workflow holds it until the job is done", group)
+			}
+		}
+		holding := make(map[string]bool, len(held)+len(groups))
+		for group := range held {
+			holding[group] = true
+		}
+		for _, group := range groups {
+			holding[group] = true
+		}
+		ctx = context.WithValue(ctx, concurrencyContextKeyVal, holding)
+		if common.Dryrun(ctx) {
+			return executor(ctx)
+		}
+
+		sorted := append([]string(nil), groups...)
+		sort.Strings(sorted)
+		for i, group := range sorted {
+			if i > 0 && group == sorted[i-1] {
+				continue
+			}
+			unlock, err := lockConcurrencyGroup(ctx, concurrencyLockDir(), group)
+			if err != nil {
+				return err
+			}
+			defer unlock()
+		}
+		return executor(ctx)
+	}
+}
@@ -0,0 +1,57 @@
+package runner
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestLockConcurrencyGroup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "act-concurrency")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	interval := concurrencyPollInterval
+	concurrencyPollInterval = 10 * time.Millisecond
+	defer func() { concurrencyPollInterval = interval }()
+
+	ctx := context.Background()
+	unlockFirst, err := lockConcurrencyGroup(ctx, dir, "deploy-refs/heads/main")
+	assert.NilError(t, err)
+
+	// another group doesn't wait
+	unlockOther, err := lockConcurrencyGroup(ctx, dir, "deploy-refs/heads/feature")
+	assert.NilError(t, err)
+	unlockOther()
+
+	// the second run of the group queues until the first one is done
+	events := make(chan string, 2)
+	done := make(chan error)
+	go func() {
+		unlock, err := lockConcurrencyGroup(ctx, dir, "deploy-refs/heads/main")
+		if err == nil {
+			events <- "second started"
+			unlock()
+		}
+		done <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	events <- "first done"
+	unlockFirst()
+	assert.NilError(t, <-done)
+	assert.Equal(t, "first done", <-events)
+	assert.Equal(t, "second started", <-events)
+
+	// a waiting run is cancelled with its context
+	unlockFirst, err = lockConcurrencyGroup(ctx, dir, "deploy-refs/heads/main")
+	assert.NilError(t, err)
+	defer unlockFirst()
+	cancelCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = lockConcurrencyGroup(cancelCtx, dir, "deploy-refs/heads/main")
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
@@ -0,0 +1,200 @@
+package runner
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+	log "github.com/sirupsen/logrus"
+)
+
+// GlobalConfigFile is the .actrc for all the users of the machine
+const GlobalConfigFile = "/etc/act/actrc"
+
+// ConfigFiles returns the .actrc files in the order they are read, each one overrides the ones before it:
+//
+//  1. the global GlobalConfigFile
+//  2. the user's ~/.actrc
+//  3. the user's $XDG_CONFIG_HOME/.actrc, ~/.config/.actrc if XDG_CONFIG_HOME isn't set
+//  4. the .actrc of the repository in workdir
+func ConfigFiles(workdir string) []string {
+	files := []string{GlobalConfigFile}
+	if home, err := homedir.Dir(); err == nil {
+		files = append(files, filepath.Join(home, ".actrc"))
+		// reference: https://specifications.freedesktop.org/basedir-spec/latest/ar01s03.html
+		if xdg, ok := os.LookupEnv("XDG_CONFIG_HOME"); ok && xdg != "" {
+			files = append(files, filepath.Join(xdg, ".actrc"))
+		} else {
+			files = append(files, filepath.Join(home, ".config", ".actrc"))
+		}
+	} else {
+		log.Debugf("Skipping the .actrc files of the user: %v", err)
+	}
+	return append(files, filepath.Join(workdir, ".actrc"))
+}
+
+// ReadConfigFile returns the flags in an .actrc file, one per line with its value separated by a space
+// (e.g. -P ubuntu-latest=node:16-buster-slim), the lines that aren't flags are skipped. A file that
+// doesn't exist has no flags.
+func ReadConfigFile(file string) ([]string, error) {
+	lines, err := readConfigFileLines(file)
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, 0)
+	for _, line := range lines {
+		args = append(args, line...)
+	}
+	return args, nil
+}
+
+// readConfigFileLines returns the flags in file, each with its value if it has one
+func readConfigFileLines(file string) ([][]string, error) {
+	lines := make([][]string, 0)
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return lines, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "-") {
+			lines = append(lines, configFileSeparator.Split(line, 2))
+		}
+	}
+	return lines, scanner.Err()
+}
+
+var configFileSeparator = regexp.MustCompile(`\s`)
+
+// defaultImagePresets are the images of the sizes the default image survey offers, by the name --default-image accepts
+var defaultImagePresets = map[string]string{
+	"micro":  "node:12.20.1-buster-slim",
+	"medium": "catthehacker/ubuntu:act-latest",
+	"large":  "nektos/act-environments-ubuntu:18.04",
+}
+
+// ResolveDefaultImage returns the image of the value of --default-image, the image of a preset (micro, medium
+// or large) or else the value
+func ResolveDefaultImage(value string) string {
+	if image, ok := defaultImagePresets[strings.ToLower(value)]; ok {
+		return image
+	}
+	return value
+}
+
+// configFileFlags apply the value of a flag of an .actrc file to a Config, by the names of the flag
+var configFileFlags = map[string]func(config *Config, value string) error{
+	"-P":                       setConfigPlatform,
+	"--platform":               setConfigPlatform,
+	"--default-image":          func(config *Config, value string) error { config.DefaultImage = ResolveDefaultImage(value); return nil },
+	"--container-architecture": func(config *Config, value string) error { config.ContainerArchitecture = value; return nil },
+	"--env-file": func(config *Config, value string) error {
+		config.EnvFiles = append(config.EnvFiles, EnvFile{Path: config.resolvePath(value)})
+		return nil
+	},
+	"--secret-file": func(config *Config, value string) error {
+		config.SecretFiles = append(config.SecretFiles, EnvFile{Path: config.resolvePath(value)})
+		return nil
+	},
+	"--var-file": func(config *Config, value string) error {
+		config.VarFiles = append(config.VarFiles, EnvFile{Path: config.resolvePath(value)})
+		return nil
+	},
+	"--env": func(config *Config, value string) error {
+		config.Env = setConfigValue(config.Env, value)
+		return nil
+	},
+	"--var": func(config *Config, value string) error {
+		config.Vars = setConfigValue(config.Vars, value)
+		return nil
+	},
+}
+
+func setConfigPlatform(config *Config, value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid platform '%s', expected label=image", value)
+	}
+	if config.Platforms == nil {
+		config.Platforms = make(map[string]string)
+	}
+	config.Platforms[parts[0]] = parts[1]
+	return nil
+}
+
+// setConfigValue sets NAME=value in values, a NAME without a value gets the value of the env var like with --env
+func setConfigValue(values map[string]string, value string) map[string]string {
+	if values == nil {
+		values = make(map[string]string)
+	}
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) == 2 {
+		values[parts[0]] = parts[1]
+	} else {
+		values[parts[0]] = os.Getenv(parts[0])
+	}
+	return values
+}
+
+// resolvePath returns path relative to Workdir, like the CLI resolves the paths of its flags
+func (c *Config) resolvePath(path string) string {
+	if filepath.IsAbs(path) || c.Workdir == "" {
+		return path
+	}
+	return filepath.Join(c.Workdir, path)
+}
+
+// LoadConfigFiles merges the flags of the .actrc files into config, e.g. of ConfigFiles(config.Workdir).
+// The files are read in order and each one overrides the ones before it, what is set in config overrides
+// them all: the platforms, env and vars are merged by key and the env, secret and var files of config
+// are read after those of the files. The flags supported are -P/--platform, --default-image,
+// --container-architecture, --env-file, --secret-file, --var-file, --env and --var, the others
+// are skipped since they only apply to the CLI. A file that doesn't exist is skipped.
+func LoadConfigFiles(config *Config, files ...string) error {
+	loaded := &Config{Workdir: config.Workdir}
+	for _, file := range files {
+		lines, err := readConfigFileLines(file)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		for _, line := range lines {
+			name, value := line[0], ""
+			if len(line) == 2 {
+				value = strings.TrimSpace(line[1])
+			} else if parts := strings.SplitN(name, "=", 2); len(parts) == 2 {
+				name, value = parts[0], parts[1]
+			}
+			apply, ok := configFileFlags[name]
+			if !ok {
+				config.logger().Debugf("Skipping %s of %s, it only applies to the CLI", name, file)
+				continue
+			}
+			if err := apply(loaded, value); err != nil {
+				return fmt.Errorf("invalid %s in %s: %w", name, file, err)
+			}
+		}
+	}
+
+	config.Platforms = mergeMaps(loaded.Platforms, config.Platforms)
+	config.Env = mergeMaps(loaded.Env, config.Env)
+	config.Vars = mergeMaps(loaded.Vars, config.Vars)
+	config.EnvFiles = append(loaded.EnvFiles, config.EnvFiles...)
+	config.SecretFiles = append(loaded.SecretFiles, config.SecretFiles...)
+	config.VarFiles = append(loaded.VarFiles, config.VarFiles...)
+	if config.DefaultImage == "" {
+		config.DefaultImage = loaded.DefaultImage
+	}
+	if config.ContainerArchitecture == "" {
+		config.ContainerArchitecture = loaded.ContainerArchitecture
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package runner
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestConfigFiles(t *testing.T) {
+	xdg, ok := os.LookupEnv("XDG_CONFIG_HOME")
+	defer func() {
+		if ok {
+			os.Setenv("XDG_CONFIG_HOME", xdg)
+		} else {
+			os.Unsetenv("XDG_CONFIG_HOME")
+		}
+	}()
+	os.Setenv("XDG_CONFIG_HOME", "/xdg")
+
+	files := ConfigFiles("/repo")
+	assert.Equal(t, 4, len(files))
+	assert.Equal(t, GlobalConfigFile, files[0])
+	assert.Equal(t, ".actrc", filepath.Base(files[1]))
+	assert.Equal(t, "/xdg/.actrc", files[2])
+	assert.Equal(t, "/repo/.actrc", files[3])
+}
+
+func TestLoadConfigFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "act-config-files")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	write := func(name string, content string) string {
+		path := filepath.Join(dir, name)
+		assert.NilError(t, ioutil.WriteFile(path, []byte(content), 0600))
+		return path
+	}
+	global := write("global", `# platforms of the machine
+-P ubuntu-latest=node:12-buster-slim
+-P ubuntu-18.04=node:12-buster-slim
+--default-image node:12-buster-slim
+--env FROM=global
+--env GLOBAL=global
+`)
+	user := write("user", `-P ubuntu-latest=catthehacker/ubuntu:act-latest
+--reuse
+--default-image=catthehacker/ubuntu:act-latest
+--secret-file user.secrets
+--env FROM=user
+`)
+	repo := write("repo", `--platform self-hosted=-self-hosted
+--env FROM=repo
+--var-file /vars/repo.vars
+`)
+
+	config := &Config{
+		Workdir:     dir,
+		Platforms:   map[string]string{"ubuntu-18.04": "node:16-buster-slim"},
+		Env:         map[string]string{"CALLER": "caller"},
+		SecretFiles: []EnvFile{{Path: ".secrets", Optional: true}},
+	}
+	err = LoadConfigFiles(config, global, user, filepath.Join(dir, "missing"), repo)
+	assert.NilError(t, err)
+
+	assert.DeepEqual(t, map[string]string{
+		"ubuntu-latest": "catthehacker/ubuntu:act-latest",
+		"ubuntu-18.04":  "node:16-buster-slim",
+		"self-hosted":   "-self-hosted",
+	}, config.Platforms)
+	assert.Equal(t, "catthehacker/ubuntu:act-latest", config.DefaultImage)
+	assert.DeepEqual(t, map[string]string{
+		"FROM":   "repo",
+		"GLOBAL": "global",
+		"CALLER": "caller",
+	}, config.Env)
+	assert.DeepEqual(t, []EnvFile{{Path: filepath.Join(dir, "user.secrets")}, {Path: ".secrets", Optional: true}}, config.SecretFiles)
+	assert.DeepEqual(t, []EnvFile{{Path: "/vars/repo.vars"}}, config.VarFiles)
+
+	config = &Config{DefaultImage: "node:16-buster-slim"}
+	assert.NilError(t, LoadConfigFiles(config, global))
+	assert.Equal(t, "node:16-buster-slim", config.DefaultImage)
+
+	// a preset is resolved like the one of the flag
+	config = &Config{}
+	assert.NilError(t, LoadConfigFiles(config, write("preset", "--default-image Medium\n")))
+	assert.Equal(t, "catthehacker/ubuntu:act-latest", config.DefaultImage)
+
+	assert.ErrorContains(t, LoadConfigFiles(&Config{}, write("invalid", "-P ubuntu-latest\n")), "invalid -P")
+}
@@ -0,0 +1,49 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nektos/act/pkg/common"
+)
+
+// logSkipped logs a job or a step that is skipped by its `if`. In a dry run it is logged as info,
+// so the output shows everything that would run and what wouldn't.
+func logSkipped(ctx context.Context, format string, args ...interface{}) {
+	if common.Dryrun(ctx) {
+		common.Logger(ctx).Infof("\u23ED  "+format, args...)
+		return
+	}
+	common.Logger(ctx).Debugf(format, args...)
+}
+
+// logDryRunCommand logs the command and the env a dry run would have executed
+func logDryRunCommand(ctx context.Context, where string, command []string, env map[string]string) {
+	if !common.Dryrun(ctx) {
+		return
+	}
+	common.Logger(ctx).Infof("  \U0001F50D  Would run %+q %s with env %s", command, where, formatEnv(env))
+}
+
+// formatEnv returns env as KEY=value pairs sorted by key
+func formatEnv(env map[string]string) string {
+	pairs := make([]string, 0, len(env))
+	for k, v := range env {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, " ")
+}
+
+// withDryRun runs planExecutor as a dry run if Config.DryRun is set: the plan is walked and the
+// conditions and env are evaluated, but no container is created and no command is executed
+func (runner *runnerImpl) withDryRun(planExecutor common.Executor) common.Executor {
+	if !runner.config.DryRun {
+		return planExecutor
+	}
+	return func(ctx context.Context) error {
+		return planExecutor(common.WithDryrun(ctx, true))
+	}
+}
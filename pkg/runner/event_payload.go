@@ -0,0 +1,72 @@
+package runner
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/nektos/act/pkg/common"
+)
+
+// gitEventPayload returns an event payload for runs without an event file, with the ref, sha and
+// repository of the git repository in Workdir where GitHub would send them for the event.
+// Whatever can't be read from the repository is left out.
+func gitEventPayload(config *Config) string {
+	event := make(map[string]interface{})
+
+	if repo, err := common.FindGithubRepo(config.Workdir, config.githubInstance()); err == nil {
+		repository := map[string]interface{}{
+			"full_name": repo,
+		}
+		if parts := strings.SplitN(repo, "/", 2); len(parts) == 2 {
+			repository["name"] = parts[1]
+			repository["owner"] = map[string]interface{}{"login": parts[0]}
+		}
+		event["repository"] = repository
+	}
+
+	if config.Actor != "" {
+		event["sender"] = map[string]interface{}{"login": config.Actor}
+	}
+
+	_, sha, err := common.FindGitRevision(config.Workdir)
+	if err != nil {
+		config.logger().Debugf("Unable to find the git revision for the event payload: %v", err)
+		return marshalEventPayload(config, event)
+	}
+	ref, err := common.FindGitRef(config.Workdir)
+	if err != nil {
+		config.logger().Debugf("Unable to find the git ref for the event payload: %v", err)
+	}
+
+	switch config.EventName {
+	case "push":
+		event["ref"] = ref
+		event["after"] = sha
+		event["head_commit"] = map[string]interface{}{"id": sha}
+	case "pull_request", "pull_request_target":
+		base := config.DefaultBranch
+		if base == "" {
+			base = "master"
+		}
+		event["pull_request"] = map[string]interface{}{
+			"head": map[string]interface{}{
+				"ref": strings.TrimPrefix(ref, "refs/heads/"),
+				"sha": sha,
+			},
+			"base": map[string]interface{}{
+				"ref": base,
+			},
+		}
+	}
+
+	return marshalEventPayload(config, event)
+}
+
+func marshalEventPayload(config *Config, event map[string]interface{}) string {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		config.logger().Debugf("Unable to create the event payload: %v", err)
+		return "{}"
+	}
+	return string(payload)
+}
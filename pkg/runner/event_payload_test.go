@@ -0,0 +1,116 @@
+package runner
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	a "github.com/stretchr/testify/assert"
+
+	"github.com/nektos/act/pkg/model"
+)
+
+// initGitRepo creates a git repository with one commit on master and a GitHub remote, returning the sha of the commit
+func initGitRepo(t *testing.T, dir string) string {
+	repo, err := git.PlainInit(dir, false)
+	a.Nil(t, err)
+	_, err = repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{"https://github.com/nektos/act-test.git"}})
+	a.Nil(t, err)
+
+	a.Nil(t, ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("test"), 0600))
+	worktree, err := repo.Worktree()
+	a.Nil(t, err)
+	_, err = worktree.Add("README.md")
+	a.Nil(t, err)
+	hash, err := worktree.Commit("initial commit", &git.CommitOptions{
+		Author: &object.Signature{Name: "act", Email: "act@example.com", When: time.Now()},
+	})
+	a.Nil(t, err)
+	return hash.String()
+}
+
+func TestGitEventPayload(t *testing.T) {
+	assert := a.New(t)
+
+	dir, err := ioutil.TempDir("", "act-git-event")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	sha := initGitRepo(t, dir)
+
+	tables := []struct {
+		eventName string
+		payload   map[string]interface{}
+	}{
+		{"push", map[string]interface{}{
+			"ref":         "refs/heads/master",
+			"after":       sha,
+			"head_commit": map[string]interface{}{"id": sha},
+		}},
+		{"pull_request", map[string]interface{}{
+			"pull_request": map[string]interface{}{
+				"head": map[string]interface{}{"ref": "master", "sha": sha},
+				"base": map[string]interface{}{"ref": "main"},
+			},
+		}},
+		{"workflow_dispatch", map[string]interface{}{}},
+	}
+
+	for _, table := range tables {
+		table.payload["repository"] = map[string]interface{}{
+			"full_name": "nektos/act-test",
+			"name":      "act-test",
+			"owner":     map[string]interface{}{"login": "nektos"},
+		}
+		table.payload["sender"] = map[string]interface{}{"login": "nektos/act"}
+
+		payload := make(map[string]interface{})
+		err := json.Unmarshal([]byte(gitEventPayload(&Config{
+			Workdir:       dir,
+			EventName:     table.eventName,
+			Actor:         "nektos/act",
+			DefaultBranch: "main",
+		})), &payload)
+		assert.Nil(err, table.eventName)
+		assert.Equal(table.payload, payload, table.eventName)
+	}
+}
+
+func TestRunnerNoGitContext(t *testing.T) {
+	assert := a.New(t)
+
+	dir, err := ioutil.TempDir("", "act-git-event")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	sha := initGitRepo(t, dir)
+
+	for _, noGitContext := range []bool{false, true} {
+		r, err := New(&Config{
+			Workdir:      dir,
+			EventName:    "push",
+			NoGitContext: noGitContext,
+		})
+		assert.Nil(err)
+
+		runner := r.(*runnerImpl)
+		rc := newTestRunContext(runner.config, &model.Workflow{Name: "test", Jobs: map[string]*model.Job{"job": {}}}, "job", nil)
+		rc.EventJSON = runner.eventJSON
+		ghc := rc.getGithubContext()
+		if noGitContext {
+			assert.Equal("{}", runner.eventJSON)
+			assert.Equal("", ghc.Sha)
+			assert.Equal("", ghc.Ref)
+			assert.Equal("", ghc.Repository)
+		} else {
+			assert.Equal(sha, ghc.Sha)
+			assert.Equal("refs/heads/master", ghc.Ref)
+			assert.Equal("nektos/act-test", ghc.Repository)
+			assert.Equal(sha, ghc.Event["after"])
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package runner
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nektos/act/pkg/common"
+	"github.com/nektos/act/pkg/model"
+)
+
+// RunEventType is the kind of a RunEvent
+type RunEventType string
+
+const (
+	JobStarted    RunEventType = "job-started"    // a job passed its `if` and starts
+	JobCompleted  RunEventType = "job-completed"  // a job is done, also when it was skipped
+	StepStarted   RunEventType = "step-started"   // a step passed its `if` and starts
+	StepCompleted RunEventType = "step-completed" // a step is done, also when it was skipped
+	PlanCompleted RunEventType = "plan-completed" // the run of the plan is done, the last event of the run
+)
+
+// RunEvent describes the progress of a plan, for embedders that show it live instead of parsing the log
+type RunEvent struct {
+	Type     RunEventType
+	Workflow string        // name of the workflow, empty for plan events
+	JobID    string        // id of the job, empty for plan events
+	Job      string        // name of the job, with the number of the matrix combination, empty for plan events
+	StepID   string        // id of the step, empty for job events
+	Step     string        // name of the step, empty for job events
+	Result   string        // success, failure, cancelled or skipped, the conclusion for steps, empty for started events
+	Outcome  string        // result of the step before continue-on-error is applied, empty for job, plan and started events
+	Time     time.Time     // time the event happened
+	Duration time.Duration // time the job, step or plan took, 0 for started events and for jobs and steps that were skipped
+}
+
+// maxPendingEvents is the number of events that wait for the consumer at most, beyond it the oldest ones are dropped
+const maxPendingEvents = 1000
+
+// eventQueue sends RunEvents to Config.Events in the order they happened without blocking the jobs. The
+// events wait in the queue while the consumer is busy, one goroutine at a time forwards them until the
+// queue is empty, so it's done once the consumer read the PlanCompleted event of the last run.
+type eventQueue struct {
+	mu      sync.Mutex
+	events  chan<- RunEvent
+	pending []RunEvent
+	sending bool
+}
+
+// newEventQueue returns nil if events is nil, no events are collected then
+func newEventQueue(events chan<- RunEvent) *eventQueue {
+	if events == nil {
+		return nil
+	}
+	return &eventQueue{events: events}
+}
+
+func (q *eventQueue) send(event RunEvent) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.pending) == maxPendingEvents {
+		q.pending = q.pending[1:]
+	}
+	q.pending = append(q.pending, event)
+	if !q.sending {
+		q.sending = true
+		go q.forward()
+	}
+}
+
+func (q *eventQueue) forward() {
+	for {
+		q.mu.Lock()
+		if len(q.pending) == 0 {
+			q.sending = false
+			q.mu.Unlock()
+			return
+		}
+		event := q.pending[0]
+		q.pending = q.pending[1:]
+		q.mu.Unlock()
+
+		q.events <- event
+	}
+}
+
+// sendJobEvent sends an event of type for the job of rc, result and duration are only set for completed jobs
+func (rc *RunContext) sendJobEvent(eventType RunEventType, result string, duration time.Duration) {
+	rc.events.send(RunEvent{
+		Type:     eventType,
+		Workflow: rc.Run.Workflow.Name,
+		JobID:    rc.Run.JobID,
+		Job:      rc.Name,
+		Result:   result,
+		Time:     time.Now(),
+		Duration: duration,
+	})
+}
+
+// sendStepEvent sends an event of type for step, with its result once it completed
+func (rc *RunContext) sendStepEvent(eventType RunEventType, step *model.Step) {
+	event := RunEvent{
+		Type:     eventType,
+		Workflow: rc.Run.Workflow.Name,
+		JobID:    rc.Run.JobID,
+		Job:      rc.Name,
+		StepID:   step.ID,
+		Step:     step.String(),
+		Time:     time.Now(),
+	}
+	if result, ok := rc.StepResults[step.ID]; ok && eventType == StepCompleted {
+		event.Result, event.Outcome, event.Duration = result.Conclusion, result.Outcome, result.duration
+	}
+	rc.events.send(event)
+}
+
+// withPlanEvent sends the PlanCompleted event once planExecutor is done, with the result of the plan
+func (runner *runnerImpl) withPlanEvent(planExecutor common.Executor) common.Executor {
+	if runner.events == nil {
+		return planExecutor
+	}
+	return func(ctx context.Context) error {
+		start := time.Now()
+		err := planExecutor(ctx)
+		runner.events.send(RunEvent{
+			Type:     PlanCompleted,
+			Result:   planResult(ctx, err),
+			Time:     time.Now(),
+			Duration: time.Since(start),
+		})
+		return err
+	}
+}
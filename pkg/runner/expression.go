@@ -6,9 +6,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/robertkrimen/otto"
@@ -27,6 +30,7 @@ func (rc *RunContext) NewExpressionEvaluator() ExpressionEvaluator {
 	vm := rc.newVM()
 	return &expressionEvaluator{
 		vm,
+		rc.Config.logger(),
 	}
 }
 
@@ -43,6 +47,55 @@ func (sc *StepContext) NewExpressionEvaluator() ExpressionEvaluator {
 
 	return &expressionEvaluator{
 		vm,
+		sc.RunContext.Config.logger(),
+	}
+}
+
+// newCompositeExpressionEvaluator creates an evaluator for the steps of a composite action,
+// which see the inputs of the action and their own env
+func (sc *StepContext) newCompositeExpressionEvaluator(env map[string]string) ExpressionEvaluator {
+	vm := sc.RunContext.newVM()
+	sc.vmInputs()(vm)
+	_ = vm.Set("env", env)
+
+	return &expressionEvaluator{
+		vm,
+		sc.RunContext.Config.logger(),
+	}
+}
+
+// newEnvironmentEvaluator creates an evaluator for the job's environment, which sees the
+// contexts of the job but not the secrets and vars of the environment it names
+func (rc *RunContext) newEnvironmentEvaluator() ExpressionEvaluator {
+	vars := rc.Config.Vars
+	if vars == nil {
+		vars = make(map[string]string)
+	}
+	configers := []func(*otto.Otto){
+		vmContains,
+		vmStartsWith,
+		vmEndsWith,
+		vmFormat,
+		vmJoin,
+		vmObjectFilter,
+		rc.vmToJSON(),
+		rc.vmFromJSON(),
+
+		rc.vmGithub(),
+		rc.vmNeeds(),
+		rc.vmStrategy(),
+		rc.vmMatrix(),
+		rc.vmInputs(),
+	}
+	vm := otto.New()
+	for _, configer := range configers {
+		configer(vm)
+	}
+	_ = vm.Set("vars", vars)
+
+	return &expressionEvaluator{
+		vm,
+		rc.Config.logger(),
 	}
 }
 
@@ -55,7 +108,8 @@ type ExpressionEvaluator interface {
 }
 
 type expressionEvaluator struct {
-	vm *otto.Otto
+	vm     *otto.Otto
+	logger *log.Logger
 }
 
 func (ee *expressionEvaluator) Evaluate(in string) (string, bool, error) {
@@ -64,7 +118,7 @@ func (ee *expressionEvaluator) Evaluate(in string) (string, bool, error) {
 	}
 	re := ee.Rewrite(in)
 	if re != in {
-		log.Debugf("Evaluating '%s' instead of '%s'", re, in)
+		ee.logger.Debugf("Evaluating '%s' instead of '%s'", re, in)
 	}
 
 	val, err := ee.vm.Run(re)
@@ -90,39 +144,43 @@ func (ee *expressionEvaluator) Interpolate(in string) string {
 func (ee *expressionEvaluator) InterpolateWithStringCheck(in string) (string, bool) {
 	errList := make([]error, 0)
 
-	out := in
+	// the expressions are replaced in a single pass, so the values they evaluate to are never evaluated
 	isString := false
-	for {
-		out = expressionPattern.ReplaceAllStringFunc(in, func(match string) string {
-			// Extract and trim the actual expression inside ${{...}} delimiters
-			expression := expressionPattern.ReplaceAllString(match, "$1")
+	out := expressionPattern.ReplaceAllStringFunc(in, func(match string) string {
+		// Extract and trim the actual expression inside ${{...}} delimiters
+		expression := expressionPattern.ReplaceAllString(match, "$1")
 
-			// Evaluate the expression and retrieve errors if any
-			evaluated, evaluatedIsString, err := ee.Evaluate(expression)
-			if err != nil {
-				errList = append(errList, err)
-			}
-			isString = evaluatedIsString
-			return evaluated
-		})
-		if len(errList) > 0 {
-			log.Errorf("Unable to interpolate string '%s' - %v", in, errList)
-			break
-		}
-		if out == in {
-			// No replacement occurred, we're done!
-			break
+		// Evaluate the expression and retrieve errors if any
+		evaluated, evaluatedIsString, err := ee.Evaluate(expression)
+		if err != nil {
+			errList = append(errList, err)
 		}
-		in = out
+		isString = evaluatedIsString
+		return evaluated
+	})
+	if len(errList) > 0 {
+		ee.logger.Errorf("Unable to interpolate string '%s' - %v", in, errList)
 	}
 	return out, isString
 }
 
 // Rewrite tries to transform any javascript property accessor into its bracket notation.
 // For instance, "object.property" would become "object['property']".
+// An object filter like "object.*.property" becomes "__property(__splat(object), 'property')".
 func (ee *expressionEvaluator) Rewrite(in string) string {
 	var buf strings.Builder
 	r := strings.NewReader(in)
+
+	// chainStart is where the property accessors that are written in buf begin, so they can be
+	// wrapped by an object filter, brackets keeps it for each [ and ( that is open
+	chainStart, inChain, inFilter := 0, false, false
+	brackets := make([]int, 0)
+	wrap := func(prefix string, suffix string) {
+		written := buf.String()
+		buf.Reset()
+		buf.WriteString(written[:chainStart] + prefix + written[chainStart:] + suffix)
+	}
+
 	for {
 		c, _, err := r.ReadRune()
 		if err == io.EOF {
@@ -131,10 +189,37 @@ func (ee *expressionEvaluator) Rewrite(in string) string {
 		//nolint
 		switch {
 		default:
+			switch {
+			case c == '[' || c == '(':
+				if !inChain {
+					chainStart = buf.Len()
+				}
+				brackets = append(brackets, chainStart)
+				inChain, inFilter = false, false
+			case (c == ']' || c == ')') && len(brackets) > 0:
+				chainStart, brackets = brackets[len(brackets)-1], brackets[:len(brackets)-1]
+				inChain = true
+			case isLetter(c):
+				if !inChain {
+					chainStart = buf.Len()
+				}
+				inChain = true
+			default:
+				inChain, inFilter = false, false
+			}
 			buf.WriteRune(c)
 		case c == '\'':
 			buf.WriteRune(c)
 			ee.advString(&buf, r)
+			inChain, inFilter = false, false
+		case c == '.' && inChain && nextRune(r) == '*':
+			_, _, _ = r.ReadRune()
+			wrap("__splat(", ")")
+			inFilter = true
+		case c == '.' && inFilter:
+			var name strings.Builder
+			ee.advPropertyName(&name, r)
+			wrap("__property(", ", '"+name.String()+"')")
 		case c == '.':
 			buf.WriteString("['")
 			ee.advPropertyName(&buf, r)
@@ -144,6 +229,16 @@ func (ee *expressionEvaluator) Rewrite(in string) string {
 	return buf.String()
 }
 
+// nextRune returns the next rune of r without reading it
+func nextRune(r *strings.Reader) rune {
+	c, _, err := r.ReadRune()
+	if err != nil {
+		return 0
+	}
+	_ = r.UnreadRune()
+	return c
+}
+
 func (*expressionEvaluator) advString(w *strings.Builder, r *strings.Reader) error {
 	for {
 		c, _, err := r.ReadRune()
@@ -212,8 +307,9 @@ func (rc *RunContext) newVM() *otto.Otto {
 		vmEndsWith,
 		vmFormat,
 		vmJoin,
-		vmToJSON,
-		vmFromJSON,
+		vmObjectFilter,
+		rc.vmToJSON(),
+		rc.vmFromJSON(),
 		vmAlways,
 		rc.vmCancelled(),
 		rc.vmSuccess(),
@@ -222,13 +318,16 @@ func (rc *RunContext) newVM() *otto.Otto {
 
 		rc.vmGithub(),
 		rc.vmJob(),
+		rc.vmNeeds(),
 		rc.vmSteps(),
 		rc.vmRunner(),
 
 		rc.vmSecrets(),
+		rc.vmVars(),
 		rc.vmStrategy(),
 		rc.vmMatrix(),
 		rc.vmEnv(),
+		rc.vmInputs(),
 	}
 	vm := otto.New()
 	for _, configer := range configers {
@@ -238,81 +337,289 @@ func (rc *RunContext) newVM() *otto.Otto {
 }
 
 func vmContains(vm *otto.Otto) {
-	_ = vm.Set("contains", func(searchString interface{}, searchValue string) bool {
-		if searchStringString, ok := searchString.(string); ok {
-			return strings.Contains(strings.ToLower(searchStringString), strings.ToLower(searchValue))
-		} else if searchStringArray, ok := searchString.([]string); ok {
-			for _, s := range searchStringArray {
-				if strings.EqualFold(s, searchValue) {
+	_ = vm.Set("contains", func(search interface{}, item interface{}) bool {
+		if items, ok := expressionArray(search); ok {
+			for _, element := range items {
+				if expressionEquals(element, item) {
 					return true
 				}
 			}
+			return false
 		}
-		return false
+		searchString, ok := expressionString(search)
+		if !ok {
+			return false
+		}
+		itemString, ok := expressionString(item)
+		if !ok {
+			return false
+		}
+		return strings.Contains(strings.ToLower(searchString), strings.ToLower(itemString))
 	})
 }
 
 func vmStartsWith(vm *otto.Otto) {
-	_ = vm.Set("startsWith", func(searchString string, searchValue string) bool {
-		return strings.HasPrefix(strings.ToLower(searchString), strings.ToLower(searchValue))
+	_ = vm.Set("startsWith", func(searchString interface{}, searchValue interface{}) bool {
+		s, ok := expressionString(searchString)
+		v, vok := expressionString(searchValue)
+		return ok && vok && strings.HasPrefix(strings.ToLower(s), strings.ToLower(v))
 	})
 }
 
 func vmEndsWith(vm *otto.Otto) {
-	_ = vm.Set("endsWith", func(searchString string, searchValue string) bool {
-		return strings.HasSuffix(strings.ToLower(searchString), strings.ToLower(searchValue))
+	_ = vm.Set("endsWith", func(searchString interface{}, searchValue interface{}) bool {
+		s, ok := expressionString(searchString)
+		v, vok := expressionString(searchValue)
+		return ok && vok && strings.HasSuffix(strings.ToLower(s), strings.ToLower(v))
 	})
 }
 
+// vmFormat replaces `{N}` with the Nth value, `{{` and `}}` are escaped braces
 func vmFormat(vm *otto.Otto) {
-	_ = vm.Set("format", func(s string, vals ...string) string {
-		for i, v := range vals {
-			s = strings.ReplaceAll(s, fmt.Sprintf("{%d}", i), v)
+	_ = vm.Set("format", func(s string, vals ...interface{}) string {
+		var buf strings.Builder
+		runes := []rune(s)
+		for i := 0; i < len(runes); i++ {
+			c := runes[i]
+			switch {
+			case c == '{' && i+1 < len(runes) && runes[i+1] == '{':
+				buf.WriteRune('{')
+				i++
+			case c == '}' && i+1 < len(runes) && runes[i+1] == '}':
+				buf.WriteRune('}')
+				i++
+			case c == '{':
+				end := i + 1
+				for end < len(runes) && runes[end] != '}' {
+					end++
+				}
+				index, err := strconv.Atoi(string(runes[i+1 : end]))
+				if end == len(runes) || err != nil || index < 0 {
+					panic(vm.MakeCustomError("Error", fmt.Sprintf("The following format string is invalid: '%s'", s)))
+				}
+				if index >= len(vals) {
+					panic(vm.MakeCustomError("Error", fmt.Sprintf("The following format string references more arguments than were supplied: '%s'", s)))
+				}
+				value, ok := expressionString(vals[index])
+				if !ok {
+					panic(vm.MakeCustomError("Error", fmt.Sprintf("The argument %d of format('%s') is an array or object", index, s)))
+				}
+				buf.WriteString(value)
+				i = end
+			case c == '}':
+				panic(vm.MakeCustomError("Error", fmt.Sprintf("The following format string is invalid: '%s'", s)))
+			default:
+				buf.WriteRune(c)
+			}
 		}
-		return s
+		return buf.String()
 	})
 }
 
+// vmJoin joins the elements of an array with the separator, which defaults to a comma. A string is returned as is.
 func vmJoin(vm *otto.Otto) {
-	_ = vm.Set("join", func(element interface{}, optionalElem string) string {
-		slist := make([]string, 0)
-		if elementString, ok := element.(string); ok {
-			slist = append(slist, elementString)
-		} else if elementArray, ok := element.([]string); ok {
-			slist = append(slist, elementArray...)
+	_ = vm.Set("join", func(element interface{}, separator ...interface{}) string {
+		sep := ","
+		if len(separator) > 0 {
+			sep, _ = expressionString(separator[0])
 		}
-		if optionalElem != "" {
-			slist = append(slist, optionalElem)
+		items, ok := expressionArray(element)
+		if !ok {
+			s, _ := expressionString(element)
+			return s
 		}
-		return strings.Join(slist, " ")
+		slist := make([]string, 0, len(items))
+		for _, item := range items {
+			s, _ := expressionString(item)
+			slist = append(slist, s)
+		}
+		return strings.Join(slist, sep)
 	})
 }
 
-func vmToJSON(vm *otto.Otto) {
-	toJSON := func(o interface{}) string {
-		rtn, err := json.MarshalIndent(o, "", "  ")
-		if err != nil {
-			log.Errorf("Unable to marshal: %v", err)
-			return ""
+// filteredArray is the result of an object filter like `github.event.commits.*.message`
+type filteredArray []interface{}
+
+// vmObjectFilter sets the functions that Rewrite uses for object filters: `__splat(x)` is `x.*`
+// and `__property(x, 'name')` is `.name` applied to every element of a filtered array
+func vmObjectFilter(vm *otto.Otto) {
+	_ = vm.Set("__splat", func(value interface{}) filteredArray {
+		result := filteredArray{}
+		if filtered, ok := value.(filteredArray); ok {
+			for _, item := range filtered {
+				result = append(result, expressionValues(item)...)
+			}
+			return result
+		}
+		return append(result, expressionValues(value)...)
+	})
+	_ = vm.Set("__property", func(value interface{}, name string) filteredArray {
+		result := filteredArray{}
+		items, _ := value.(filteredArray)
+		for _, item := range items {
+			object, ok := expressionNormalize(item).(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if v, ok := object[name]; ok && v != nil {
+				result = append(result, v)
+				continue
+			}
+			for k, v := range object {
+				if strings.EqualFold(k, name) && v != nil {
+					result = append(result, v)
+					break
+				}
+			}
 		}
-		return string(rtn)
+		return result
+	})
+}
+
+// expressionNormalize converts a value from a context (e.g. a struct or a map of strings) to the
+// values JSON is decoded to, so the functions only have to handle these
+func expressionNormalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, bool, string, float64, []interface{}, map[string]interface{}:
+		return value
+	case filteredArray:
+		return []interface{}(v)
+	}
+	buf, err := json.Marshal(value)
+	if err != nil {
+		return value
 	}
-	_ = vm.Set("toJSON", toJSON)
-	_ = vm.Set("toJson", toJSON)
+	var result interface{}
+	if err := json.Unmarshal(buf, &result); err != nil {
+		return value
+	}
+	return result
+}
+
+// expressionArray returns the elements of value if it is an array
+func expressionArray(value interface{}) ([]interface{}, bool) {
+	items, ok := expressionNormalize(value).([]interface{})
+	return items, ok
 }
 
-func vmFromJSON(vm *otto.Otto) {
-	fromJSON := func(str string) map[string]interface{} {
-		var dat map[string]interface{}
-		err := json.Unmarshal([]byte(str), &dat)
+// expressionValues returns the elements of an array or the values of an object, for anything else nothing
+func expressionValues(value interface{}) []interface{} {
+	switch v := expressionNormalize(value).(type) {
+	case []interface{}:
+		return v
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		values := make([]interface{}, 0, len(v))
+		for _, k := range keys {
+			values = append(values, v[k])
+		}
+		return values
+	}
+	return nil
+}
+
+// expressionString coerces a scalar to a string like GitHub does, null is an empty string.
+// Arrays and objects are not converted.
+func expressionString(value interface{}) (string, bool) {
+	switch v := expressionNormalize(value).(type) {
+	case nil:
+		return "", true
+	case bool:
+		return strconv.FormatBool(v), true
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	}
+	return "", false
+}
+
+// expressionNumber coerces a scalar to a number like GitHub does, strings that aren't numbers are NaN
+func expressionNumber(value interface{}) float64 {
+	switch v := expressionNormalize(value).(type) {
+	case nil:
+		return 0
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	case string:
+		if strings.TrimSpace(v) == "" {
+			return 0
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
 		if err != nil {
-			log.Errorf("Unable to unmarshal: %v", err)
+			return math.NaN()
+		}
+		return f
+	case float64:
+		return v
+	}
+	return math.NaN()
+}
+
+// expressionEquals compares like the == operator of GitHub, strings ignore case and values of
+// different types are compared as numbers. Arrays and objects are never equal.
+func expressionEquals(left interface{}, right interface{}) bool {
+	left, right = expressionNormalize(left), expressionNormalize(right)
+	switch left.(type) {
+	case []interface{}, map[string]interface{}:
+		return false
+	}
+	switch right.(type) {
+	case []interface{}, map[string]interface{}:
+		return false
+	}
+	if l, ok := left.(string); ok {
+		if r, ok := right.(string); ok {
+			return strings.EqualFold(l, r)
+		}
+	}
+	if l, ok := left.(bool); ok {
+		if r, ok := right.(bool); ok {
+			return l == r
+		}
+	}
+	if left == nil && right == nil {
+		return true
+	}
+	return expressionNumber(left) == expressionNumber(right)
+}
+
+func (rc *RunContext) vmToJSON() func(*otto.Otto) {
+	return func(vm *otto.Otto) {
+		toJSON := func(o interface{}) string {
+			rtn, err := json.MarshalIndent(o, "", "  ")
+			if err != nil {
+				rc.Config.logger().Errorf("Unable to marshal: %v", err)
+				return ""
+			}
+			return string(rtn)
+		}
+		_ = vm.Set("toJSON", toJSON)
+		_ = vm.Set("toJson", toJSON)
+	}
+}
+
+func (rc *RunContext) vmFromJSON() func(*otto.Otto) {
+	return func(vm *otto.Otto) {
+		fromJSON := func(str string) interface{} {
+			var dat interface{}
+			err := json.Unmarshal([]byte(str), &dat)
+			if err != nil {
+				rc.Config.logger().Errorf("Unable to unmarshal: %v", err)
+				return dat
+			}
 			return dat
 		}
-		return dat
+		_ = vm.Set("fromJSON", fromJSON)
+		_ = vm.Set("fromJson", fromJSON)
 	}
-	_ = vm.Set("fromJSON", fromJSON)
-	_ = vm.Set("fromJson", fromJSON)
 }
 
 func (rc *RunContext) vmHashFiles() func(*otto.Otto) {
@@ -322,7 +629,7 @@ func (rc *RunContext) vmHashFiles() func(*otto.Otto) {
 			for i := range paths {
 				newFiles, err := filepath.Glob(filepath.Join(rc.Config.Workdir, paths[i]))
 				if err != nil {
-					log.Errorf("Unable to glob.Glob: %v", err)
+					rc.Config.logger().Errorf("Unable to glob.Glob: %v", err)
 					return ""
 				}
 				files = append(files, newFiles...)
@@ -331,13 +638,13 @@ func (rc *RunContext) vmHashFiles() func(*otto.Otto) {
 			for _, file := range files {
 				f, err := os.Open(file)
 				if err != nil {
-					log.Errorf("Unable to os.Open: %v", err)
+					rc.Config.logger().Errorf("Unable to os.Open: %v", err)
 				}
 				if _, err := io.Copy(hasher, f); err != nil {
-					log.Errorf("Unable to io.Copy: %v", err)
+					rc.Config.logger().Errorf("Unable to io.Copy: %v", err)
 				}
 				if err := f.Close(); err != nil {
-					log.Errorf("Unable to Close file: %v", err)
+					rc.Config.logger().Errorf("Unable to Close file: %v", err)
 				}
 			}
 			return hex.EncodeToString(hasher.Sum(nil))
@@ -384,20 +691,31 @@ func (rc *RunContext) vmGithub() func(*otto.Otto) {
 func (rc *RunContext) vmEnv() func(*otto.Otto) {
 	return func(vm *otto.Otto) {
 		env := rc.GetEnv()
-		log.Debugf("context env => %v", env)
+		rc.Config.logger().Debugf("context env => %v", env)
 		_ = vm.Set("env", env)
 	}
 }
 
 func (sc *StepContext) vmEnv() func(*otto.Otto) {
 	return func(vm *otto.Otto) {
-		log.Debugf("context env => %v", sc.Env)
+		sc.RunContext.Config.logger().Debugf("context env => %v", sc.Env)
 		_ = vm.Set("env", sc.Env)
 	}
 }
 
 func (sc *StepContext) vmInputs() func(*otto.Otto) {
-	inputs := make(map[string]string)
+	// a run step sees the inputs of the workflow, a step using an action the inputs of the action
+	if sc.Step.Uses == "" {
+		return sc.RunContext.vmInputs()
+	}
+
+	inputs := sc.Inputs
+	if inputs != nil {
+		return func(vm *otto.Otto) {
+			_ = vm.Set("inputs", inputs)
+		}
+	}
+	inputs = make(map[string]string)
 
 	// Set Defaults
 	if sc.Action != nil {
@@ -415,6 +733,17 @@ func (sc *StepContext) vmInputs() func(*otto.Otto) {
 	}
 }
 
+func (rc *RunContext) vmInputs() func(*otto.Otto) {
+	inputs := rc.Inputs
+	if inputs == nil {
+		inputs = make(map[string]interface{})
+	}
+
+	return func(vm *otto.Otto) {
+		_ = vm.Set("inputs", inputs)
+	}
+}
+
 func (rc *RunContext) vmJob() func(*otto.Otto) {
 	job := rc.getJobContext()
 
@@ -423,6 +752,14 @@ func (rc *RunContext) vmJob() func(*otto.Otto) {
 	}
 }
 
+func (rc *RunContext) vmNeeds() func(*otto.Otto) {
+	needs := rc.getNeedsContext()
+
+	return func(vm *otto.Otto) {
+		_ = vm.Set("needs", needs)
+	}
+}
+
 func (rc *RunContext) vmSteps() func(*otto.Otto) {
 	steps := rc.getStepsContext()
 
@@ -435,7 +772,11 @@ func (rc *RunContext) vmRunner() func(*otto.Otto) {
 	runner := map[string]interface{}{
 		"os":         "Linux",
 		"temp":       "/tmp",
-		"tool_cache": "/opt/hostedtoolcache",
+		"tool_cache": containerToolCacheDir,
+	}
+	// the platform of the job can only be resolved once there is an evaluator
+	if rc.ExprEval != nil {
+		runner["tool_cache"] = rc.toolCacheDir()
 	}
 
 	return func(vm *otto.Otto) {
@@ -445,7 +786,18 @@ func (rc *RunContext) vmRunner() func(*otto.Otto) {
 
 func (rc *RunContext) vmSecrets() func(*otto.Otto) {
 	return func(vm *otto.Otto) {
-		_ = vm.Set("secrets", rc.Config.Secrets)
+		_ = vm.Set("secrets", rc.secrets())
+	}
+}
+
+func (rc *RunContext) vmVars() func(*otto.Otto) {
+	vars := rc.vars()
+	if vars == nil {
+		vars = make(map[string]string)
+	}
+
+	return func(vm *otto.Otto) {
+		_ = vm.Set("vars", vars)
 	}
 }
 
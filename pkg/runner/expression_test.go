@@ -9,9 +9,18 @@ import (
 
 	"github.com/nektos/act/pkg/model"
 	a "github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
 )
 
 func TestEvaluate(t *testing.T) {
+	var strategy model.Strategy
+	err := yaml.Unmarshal([]byte(`
+matrix:
+  os: [Linux, Windows]
+  foo: [bar, baz]
+`), &strategy)
+	a.Nil(t, err)
+
 	rc := &RunContext{
 		Config: &Config{
 			Workdir: ".",
@@ -28,12 +37,7 @@ func TestEvaluate(t *testing.T) {
 				Name: "test-workflow",
 				Jobs: map[string]*model.Job{
 					"job1": {
-						Strategy: &model.Strategy{
-							Matrix: map[string][]interface{}{
-								"os":  {"Linux", "Windows"},
-								"foo": {"bar", "baz"},
-							},
-						},
+						Strategy: &strategy,
 					},
 				},
 			},
@@ -81,13 +85,18 @@ func TestEvaluate(t *testing.T) {
 		{"startsWith('hello world', 'He')", "true", ""},
 		{"endsWith('hello world', 'ld')", "true", ""},
 		{"format('0:{0} 2:{2} 1:{1}', 'zero', 'one', 'two')", "0:zero 2:two 1:one", ""},
-		{"join(['hello'],'octocat')", "hello octocat", ""},
-		{"join(['hello','mona','the'],'octocat')", "hello mona the octocat", ""},
-		{"join('hello','mona')", "hello mona", ""},
+		{"join(['hello'],'octocat')", "hello", ""},
+		{"join(['hello','mona','the'],'octocat')", "hellooctocatmonaoctocatthe", ""},
+		{"join('hello','mona')", "hello", ""},
 		{"toJSON({'foo':'bar'})", "{\n  \"foo\": \"bar\"\n}", ""},
 		{"toJson({'foo':'bar'})", "{\n  \"foo\": \"bar\"\n}", ""},
 		{"(fromJSON('{\"foo\":\"bar\"}')).foo", "bar", ""},
 		{"(fromJson('{\"foo\":\"bar\"}')).foo", "bar", ""},
+		{"fromJSON('[\"linux\",\"windows\"]')[1]", "windows", ""},
+		{"fromJSON('42')", "42", ""},
+		{"fromJSON('true')", "true", ""},
+		{"toJSON(fromJSON('{\"os\":[\"linux\"]}'))", "{\n  \"os\": [\n    \"linux\"\n  ]\n}", ""},
+		{"toJSON(matrix)", "{\n  \"foo\": \"bar\",\n  \"os\": \"Linux\"\n}", ""},
 		{"hashFiles('**/non-extant-files')", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", ""},
 		{"hashFiles('**/non-extant-files', '**/more-non-extant-files')", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", ""},
 		{"hashFiles('**/non.extant.files')", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", ""},
@@ -272,6 +281,10 @@ func TestRewrite(t *testing.T) {
 		{"ecole['centrale-paris']", "ecole['centrale-paris']"},
 		{"ecole.centrale_paris", "ecole['centrale_paris']"},
 		{"ecole['centrale_paris']", "ecole['centrale_paris']"},
+		{"ecole.*.paris", "__property(__splat(ecole), 'paris')"},
+		{"ecole.centrale.*.paris.*", "__splat(__property(__splat(ecole['centrale']), 'paris'))"},
+		{"contains(ecole.*.paris, 'x')", "contains(__property(__splat(ecole), 'paris'), 'x')"},
+		{"fromJSON(ecole).*.paris", "__property(__splat(fromJSON(ecole)), 'paris')"},
 	}
 
 	for _, table := range tables {
@@ -283,3 +296,126 @@ func TestRewrite(t *testing.T) {
 		})
 	}
 }
+
+func TestEvaluateFunctions(t *testing.T) {
+	rc := newTestRunContext(&Config{Workdir: ".", EventName: "push"}, nil, "job1", nil)
+	rc.EventJSON = `{
+		"commits": [
+			{"message": "Fix the build [skip ci]", "author": {"name": "mona"}},
+			{"message": "Add a test", "author": {"name": "octocat"}},
+			{"message": null}
+		],
+		"labels": {"bug": {"name": "bug"}, "docs": {"name": "documentation"}}
+	}`
+	rc.StepResults = map[string]*stepResult{
+		"build": {Outcome: "success", Conclusion: "success"},
+		"test":  {Outcome: "failure", Conclusion: "success"},
+	}
+	ee := rc.NewExpressionEvaluator()
+
+	tables := []struct {
+		in      string
+		out     string
+		errMesg string
+	}{
+		// https://docs.github.com/en/actions/learn-github-actions/expressions#functions
+		{"contains('Hello world', 'llo')", "true", ""},
+		{"contains('Hello world', 'LLO')", "true", ""},
+		{"contains('Hello world', 'bye')", "false", ""},
+		{"contains(fromJSON('[\"push\", \"pull_request\"]'), github.event_name)", "true", ""},
+		{"contains(fromJSON('[1, 2, 3]'), '2')", "true", ""},
+		{"contains(fromJSON('[true]'), true)", "true", ""},
+		{"contains(fromJSON('[{\"a\": 1}]'), 'a')", "false", ""},
+		{"contains(null, '')", "true", ""},
+		{"contains(123, 2)", "true", ""},
+		{"contains(github.event.commits.*.message, 'Add a test')", "true", ""},
+		{"contains(join(github.event.commits.*.message), '[skip ci]')", "true", ""},
+		{"contains(github.event.commits.*.author.name, 'MONA')", "true", ""},
+		{"contains(github.event.commits.*.author.name, 'hubot')", "false", ""},
+		{"contains(github.event.labels.*.name, 'documentation')", "true", ""},
+		{"contains(steps.*.outcome, 'failure')", "true", ""},
+		{"contains(steps.*.conclusion, 'failure')", "false", ""},
+		{"startsWith('Hello world', 'He')", "true", ""},
+		{"startsWith('Hello world', 'he')", "true", ""},
+		{"startsWith('Hello world', 'world')", "false", ""},
+		{"startsWith(123, 12)", "true", ""},
+		{"endsWith('Hello world', 'ld')", "true", ""},
+		{"endsWith('Hello world', 'LD')", "true", ""},
+		{"endsWith('Hello world', 'He')", "false", ""},
+		{"endsWith(true, 'ue')", "true", ""},
+		{"format('Hello {0} {1} {2}', 'Mona', 'the', 'Octocat')", "Hello Mona the Octocat", ""},
+		{"format('{{Hello {0} {1} {2}!}}', 'Mona', 'the', 'Octocat')", "{Hello Mona the Octocat!}", ""},
+		{"format('{0}-{1}', 'a', 1)", "a-1", ""},
+		{"format('{0}{0}', true)", "truetrue", ""},
+		{"format('{0}', null)", "", ""},
+		{"format('{{0}}', 'a')", "{0}", ""},
+		{"format('{0', 'a')", "", "Error: The following format string is invalid: '{0'"},
+		{"format('{0}}', 'a')", "", "Error: The following format string is invalid: '{0}}'"},
+		{"format('{1}', 'a')", "", "Error: The following format string references more arguments than were supplied: '{1}'"},
+		{"join(github.event.commits.*.author.name, ', ')", "mona, octocat", ""},
+		{"join(fromJSON('[\"a\", \"b\"]'))", "a,b", ""},
+		{"join(fromJSON('[1, true, null]'), '-')", "1-true-", ""},
+		{"join('hello')", "hello", ""},
+		{"toJSON(github.event.commits.*.message)", "[\n  \"Fix the build [skip ci]\",\n  \"Add a test\"\n]", ""},
+	}
+
+	for _, table := range tables {
+		table := table
+		t.Run(table.in, func(t *testing.T) {
+			assert := a.New(t)
+			out, _, err := ee.Evaluate(table.in)
+			if table.errMesg == "" {
+				assert.NoError(err, table.in)
+				assert.Equal(table.out, out, table.in)
+			} else {
+				assert.Error(err, table.in)
+				assert.Equal(table.errMesg, err.Error(), table.in)
+			}
+		})
+	}
+}
+
+func TestEvaluateObjectFilters(t *testing.T) {
+	rc := newTestRunContext(&Config{Workdir: ".", EventName: "push"}, nil, "job1", nil)
+	rc.EventJSON = `{
+		"commits": [
+			{"id": "1", "message": "Fix the build", "author": {"name": "mona", "user-name": "mona-lisa"}},
+			{"id": "2", "message": "Update the docs [skip ci]", "author": {"name": "octocat"}}
+		],
+		"labels": {"bug": {"name": "bug"}, "docs": {"name": "documentation"}}
+	}`
+	ee := rc.NewExpressionEvaluator()
+
+	for in, out := range map[string]string{
+		"join(github.event.commits.*.author.name)":                        "mona,octocat",
+		"join(github.event.commits.*.author.name, ' and ')":               "mona and octocat",
+		"join(github.event.commits.*.author.user-name)":                   "mona-lisa",
+		"join(github.event.commits.*.ID)":                                 "1,2",
+		"join(github.event['commits'].*.id)":                              "1,2",
+		"join(github.event.labels.*.name)":                                "bug,documentation",
+		"join(github.event.commits.*.author.*)":                           "mona,mona-lisa,octocat",
+		"join(github.event.*.*.name)":                                     "bug,documentation",
+		"github.event.commits.*.author.name[1]":                           "octocat",
+		"contains(github.event.commits.*.author.name, 'octocat')":         "true",
+		"contains(github.event.commits.*.message, 'skip ci')":             "false",
+		"contains(join(github.event.commits.*.message), 'skip ci')":       "true",
+		"toJSON(github.event.missing.*.name)":                             "[]",
+		"toJSON(fromJSON('[[1, 2], [3]]').*.*)":                           "[\n  1,\n  2,\n  3\n]",
+		"toJSON(fromJSON('[{\"a\": 1}, {\"b\": 2}, {\"a\": null}]').*.a)": "[\n  1\n]",
+	} {
+		value, _, err := ee.Evaluate(in)
+		a.NoError(t, err, in)
+		a.Equal(t, out, value, in)
+	}
+
+	rc.ExprEval = ee
+	for in, out := range map[string]bool{
+		"contains(github.event.commits.*.author.name, 'mona')":                true,
+		"${{ contains(github.event.commits.*.author.name, 'hubot') }}":        false,
+		"${{ !contains(join(github.event.commits.*.message), '[skip ci]') }}": false,
+	} {
+		b, err := rc.EvalBool(in)
+		a.NoError(t, err, in)
+		a.Equal(t, out, b, in)
+	}
+}
@@ -0,0 +1,103 @@
+package runner
+
+import (
+	"context"
+	"sync"
+
+	"github.com/nektos/act/pkg/common"
+)
+
+// planAbort aborts a plan as soon as one of its jobs fails, for Config.FailFastPlan. The jobs that
+// are running are canceled and the ones that haven't started yet are skipped.
+type planAbort struct {
+	mu      sync.Mutex
+	failed  string // the job that failed first, empty while none has failed
+	err     error
+	cancels map[*RunContext]context.CancelFunc // cancel the jobs that are running
+}
+
+// newPlanAbort returns nil if Config.FailFastPlan isn't set, the plan then runs the jobs it can to completion
+func (runner *runnerImpl) newPlanAbort() *planAbort {
+	if !runner.config.FailFastPlan {
+		return nil
+	}
+	return &planAbort{cancels: make(map[*RunContext]context.CancelFunc)}
+}
+
+// plan runs planExecutor and returns the error of the job that failed first, not those of the jobs
+// that were canceled because of it
+func (pa *planAbort) plan(planExecutor common.Executor) common.Executor {
+	if pa == nil {
+		return planExecutor
+	}
+	return func(ctx context.Context) error {
+		err := planExecutor(ctx)
+		if _, abortErr := pa.failure(); abortErr != nil {
+			return abortErr
+		}
+		return err
+	}
+}
+
+// stage runs the jobs of a stage, after a failure the later stages still run to log that their jobs are skipped
+func (pa *planAbort) stage(stageExecutor common.Executor) common.Executor {
+	if pa == nil {
+		return stageExecutor
+	}
+	return func(ctx context.Context) error {
+		err := stageExecutor(ctx)
+		if job, _ := pa.failure(); job != "" {
+			return nil
+		}
+		return err
+	}
+}
+
+// job runs the executor of rc unless another job failed already, then rc is skipped
+func (pa *planAbort) job(rc *RunContext, jobExecutor common.Executor) common.Executor {
+	if pa == nil {
+		return jobExecutor
+	}
+	return func(ctx context.Context) error {
+		if job, _ := pa.failure(); job != "" {
+			common.Logger(ctx).Infof("⏭  Skipping %s, the plan was aborted due to a failure in %s", rc.String(), job)
+			rc.addJobResult("skipped")
+			return nil
+		}
+
+		jobCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		pa.mu.Lock()
+		pa.cancels[rc] = cancel
+		pa.mu.Unlock()
+
+		err := jobExecutor(jobCtx)
+
+		pa.mu.Lock()
+		delete(pa.cancels, rc)
+		pa.mu.Unlock()
+		if err != nil && jobCtx.Err() == nil {
+			pa.fail(ctx, rc.String(), err)
+		}
+		return err
+	}
+}
+
+func (pa *planAbort) failure() (string, error) {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+	return pa.failed, pa.err
+}
+
+func (pa *planAbort) fail(ctx context.Context, job string, err error) {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+	if pa.failed != "" {
+		return
+	}
+	common.Logger(ctx).Errorf("❌  Aborting the plan due to a failure in %s", job)
+	pa.failed, pa.err = job, err
+	for _, cancel := range pa.cancels {
+		cancel()
+	}
+}
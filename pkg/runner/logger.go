@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"regexp"
+	"sort"
 	"strings"
 	"sync"
 
@@ -38,27 +40,105 @@ func init() {
 }
 
 // WithJobLogger attaches a new logger to context that is aware of steps
-func WithJobLogger(ctx context.Context, jobName string, secrets map[string]string, insecureSecrets bool) context.Context {
+func WithJobLogger(ctx context.Context, jobName string, secrets map[string]string, secretPatterns []*regexp.Regexp, insecureSecrets bool) context.Context {
+	return withJobLogger(ctx, nil, jobName, secrets, secretPatterns, nil, insecureSecrets)
+}
+
+// addedMasks are the values the steps of a job masked with ::add-mask::, they are masked like secrets
+// in the output that is logged after they were added
+type addedMasks struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func (m *addedMasks) add(value string) {
+	if m == nil || value == "" {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.values == nil {
+		m.values = make(map[string]string)
+	}
+	m.values[value] = value
+}
+
+// withSecrets returns secrets with the added masks
+func (m *addedMasks) withSecrets(secrets map[string]string) map[string]string {
+	if m == nil {
+		return secrets
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.values) == 0 {
+		return secrets
+	}
+	return mergeMaps(secrets, m.values)
+}
+
+// withJobLogger attaches a logger for the job to ctx. Without a base logger it logs to stdout in the
+// format of act, otherwise it logs to the output and with the formatter, level and hooks of base.
+func withJobLogger(ctx context.Context, base *logrus.Logger, jobName string, secrets map[string]string, secretPatterns []*regexp.Regexp, masks *addedMasks, insecureSecrets bool) context.Context {
 	mux.Lock()
 	defer mux.Unlock()
-	formatter := new(stepLogFormatter)
-	formatter.color = colors[nextColor%len(colors)]
-	formatter.secrets = secrets
-	formatter.insecureSecrets = insecureSecrets
-	nextColor++
 
 	logger := logrus.New()
-	logger.SetFormatter(formatter)
-	logger.SetOutput(os.Stdout)
-	logger.SetLevel(logrus.GetLevel())
+	if base == nil {
+		formatter := new(stepLogFormatter)
+		formatter.color = colors[nextColor%len(colors)]
+		formatter.secrets = secrets
+		formatter.secretPatterns = secretPatterns
+		formatter.masks = masks
+		formatter.insecureSecrets = insecureSecrets
+		nextColor++
+
+		logger.SetFormatter(formatter)
+		logger.SetOutput(os.Stdout)
+		logger.SetLevel(logrus.GetLevel())
+	} else {
+		// the secrets are masked before the hooks of base see the entries
+		hooks := make(logrus.LevelHooks)
+		hooks.Add(&maskingHook{secrets: secrets, secretPatterns: secretPatterns, masks: masks, insecureSecrets: insecureSecrets})
+		for level, levelHooks := range base.Hooks {
+			hooks[level] = append(hooks[level], levelHooks...)
+		}
+
+		logger.SetFormatter(base.Formatter)
+		logger.SetOutput(base.Out)
+		logger.SetLevel(base.GetLevel())
+		logger.ReplaceHooks(hooks)
+		logger.ExitFunc = base.ExitFunc
+	}
 	rtn := logger.WithFields(logrus.Fields{"job": jobName, "dryrun": common.Dryrun(ctx)})
 
 	return common.WithLogger(ctx, rtn)
 }
 
+// maskingHook masks the secrets in the entries of a job logged to a Config.Logger, like stepLogFormatter does
+type maskingHook struct {
+	secrets         map[string]string
+	secretPatterns  []*regexp.Regexp
+	masks           *addedMasks
+	insecureSecrets bool
+}
+
+func (h *maskingHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *maskingHook) Fire(entry *logrus.Entry) error {
+	entry.Message = strings.TrimSuffix(entry.Message, "\n")
+	if !h.insecureSecrets {
+		entry.Message = maskSecrets(entry.Message, h.masks.withSecrets(h.secrets), h.secretPatterns)
+	}
+	return nil
+}
+
 type stepLogFormatter struct {
 	color           int
 	secrets         map[string]string
+	secretPatterns  []*regexp.Regexp
+	masks           *addedMasks
 	insecureSecrets bool
 }
 
@@ -67,9 +147,7 @@ func (f *stepLogFormatter) Format(entry *logrus.Entry) ([]byte, error) {
 
 	// Replace any secrets in the entry if insecure-secrets flag is not used
 	if !f.insecureSecrets {
-		for _, v := range f.secrets {
-			entry.Message = strings.ReplaceAll(entry.Message, v, "***")
-		}
+		entry.Message = maskSecrets(entry.Message, f.masks.withSecrets(f.secrets), f.secretPatterns)
 	}
 
 	if f.isColored(entry) {
@@ -130,3 +208,37 @@ func checkIfTerminal(w io.Writer) bool {
 		return false
 	}
 }
+
+// maskSecrets replaces the secrets in s with ***. Output is logged line by line, so every line of a
+// multi-line secret is masked on its own. A secret with a single quote is also masked in the quoted
+// form the `set -x` trace of bash and sh prints it in. The matches of patterns are masked too, for
+// the secrets that aren't known up front.
+func maskSecrets(s string, secrets map[string]string, patterns []*regexp.Regexp) string {
+	values := make([]string, 0, len(secrets))
+	for _, v := range secrets {
+		for _, line := range strings.Split(v, "\n") {
+			line = strings.TrimSuffix(line, "\r")
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			values = append(values, line)
+			if strings.Contains(line, "'") {
+				values = append(values,
+					strings.ReplaceAll(line, "'", `'\''`),
+					strings.ReplaceAll(line, "'", `'"'"'`),
+				)
+			}
+		}
+	}
+	// the longest first, so a secret containing another one is masked as a whole
+	sort.Slice(values, func(i, j int) bool {
+		return len(values[i]) > len(values[j])
+	})
+	for _, v := range values {
+		s = strings.ReplaceAll(s, v, "***")
+	}
+	for _, pattern := range patterns {
+		s = pattern.ReplaceAllString(s, "***")
+	}
+	return s
+}
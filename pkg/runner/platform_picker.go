@@ -0,0 +1,42 @@
+package runner
+
+import "fmt"
+
+// PlatformPickerJob describes the job a PlatformPicker picks the image for
+type PlatformPickerJob struct {
+	Workflow string                 // name of the workflow
+	JobID    string                 // id of the job
+	Job      string                 // name of the job, with the number of the matrix combination
+	Labels   []string               // interpolated `runs-on` labels of the job in lower case, with `group:<name>` for a runner group
+	Matrix   map[string]interface{} // matrix combination of the job, empty if it has no matrix
+	Env      map[string]string      // env of the job, merged from Config.Env and the env of the workflow and the job
+}
+
+// PlatformPicker returns the image to run a job in, e.g. container.HostImage to run it on the host. An empty
+// image falls back to Config.Platforms and Config.DefaultImage, an error fails the job.
+type PlatformPicker func(job PlatformPickerJob) (string, error)
+
+// pickPlatformImage returns the image Config.PlatformPicker picks for the job, it is only called once per job
+// so the image doesn't change between the container being named, started and the job being checked
+func (rc *RunContext) pickPlatformImage() (string, error) {
+	if rc.Config.PlatformPicker == nil {
+		return "", nil
+	}
+	if rc.pickedImage != nil {
+		return *rc.pickedImage, nil
+	}
+
+	image, err := rc.Config.PlatformPicker(PlatformPickerJob{
+		Workflow: rc.Run.Workflow.Name,
+		JobID:    rc.Run.JobID,
+		Job:      rc.Name,
+		Labels:   rc.runsOnLabels(),
+		Matrix:   rc.Matrix,
+		Env:      mergeMaps(rc.GetEnv()),
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to pick the platform of %s: %w", rc.String(), err)
+	}
+	rc.pickedImage = &image
+	return image, nil
+}
@@ -0,0 +1,78 @@
+package runner
+
+import (
+	"context"
+	"sort"
+
+	"github.com/nektos/act/pkg/common"
+)
+
+// PostRunEvent describes the result of the plan a PostRunHook is called after
+type PostRunEvent struct {
+	Result string       // success, failure or cancelled
+	Err    error        // error the plan failed with, nil if it succeeded
+	Jobs   []PostRunJob // results of the jobs of the plan, by workflow name and job id
+}
+
+// PostRunJob is the result of a job of the plan, the runs of a matrix job are combined
+type PostRunJob struct {
+	Workflow string // name of the workflow
+	JobID    string // id of the job
+	Result   string // success, failure, cancelled or skipped
+}
+
+// PostRunHook is called by act once the whole plan is done, whether it succeeded, failed or was cancelled
+type PostRunHook func(ctx context.Context, event PostRunEvent) error
+
+// withPostRun calls Config.PostRun after planExecutor. The hook runs with a context that is not
+// canceled, so it runs when the plan was interrupted too. The error of the hook is returned if the
+// plan succeeded, otherwise it is only logged.
+func (runner *runnerImpl) withPostRun(planExecutor common.Executor) common.Executor {
+	hook := runner.config.PostRun
+	if hook == nil {
+		return planExecutor
+	}
+	return func(ctx context.Context) error {
+		err := planExecutor(ctx)
+
+		event := PostRunEvent{Result: planResult(ctx, err), Err: err, Jobs: runner.jobResults.list()}
+
+		if hookErr := hook(common.WithoutCancel(ctx), event); hookErr != nil {
+			if err == nil {
+				return hookErr
+			}
+			common.Logger(ctx).Warnf("⚠  Post run hook failed: %v", hookErr)
+		}
+		return err
+	}
+}
+
+// planResult returns the result of a plan whose executor returned err: success, failure or cancelled if ctx was canceled
+func planResult(ctx context.Context, err error) string {
+	if ctx.Err() != nil {
+		return "cancelled"
+	} else if err != nil {
+		return "failure"
+	}
+	return "success"
+}
+
+// list returns the results of all the jobs collected so far, sorted by workflow name and job id
+func (jr *jobResults) list() []PostRunJob {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+
+	jobs := make([]PostRunJob, 0)
+	for workflow, results := range jr.results {
+		for jobID, result := range results {
+			jobs = append(jobs, PostRunJob{Workflow: workflow.Name, JobID: jobID, Result: result.Result})
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		if jobs[i].Workflow != jobs[j].Workflow {
+			return jobs[i].Workflow < jobs[j].Workflow
+		}
+		return jobs[i].JobID < jobs[j].JobID
+	})
+	return jobs
+}
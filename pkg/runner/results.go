@@ -0,0 +1,89 @@
+package runner
+
+import (
+	"context"
+	"time"
+
+	"github.com/nektos/act/pkg/common"
+	"github.com/nektos/act/pkg/model"
+)
+
+// PlanResult is the result of a plan, for callers that need more than the error of its executor
+type PlanResult struct {
+	Jobs     []JobRunResult // results of the runs of the jobs in the order they finished
+	Duration time.Duration  // time the whole plan took
+}
+
+// JobRunResult is the result of one run of a job, each combination of a matrix job has its own
+type JobRunResult struct {
+	Workflow   string                 // name of the workflow
+	JobID      string                 // id of the job
+	Job        string                 // name of the job, with the number of the matrix combination
+	Matrix     map[string]interface{} // matrix combination of the run, empty if the job has no matrix
+	Conclusion string                 // success, failure, cancelled or skipped
+	Outputs    map[string]string      // outputs of the job
+	Steps      []StepRunResult        // results of the steps in the order of the job, steps that didn't start are left out
+	Duration   time.Duration          // time the run took, 0 if it was skipped
+}
+
+// StepRunResult is the result of a step of a job run
+type StepRunResult struct {
+	StepID     string            // id of the step
+	Step       string            // name of the step
+	Outcome    string            // result of the step before continue-on-error is applied
+	Conclusion string            // result of the step after continue-on-error is applied
+	Outputs    map[string]string // outputs the step set
+	Duration   time.Duration     // time the step took, 0 if it was skipped
+}
+
+// NewPlanExecutorWithResults returns the executor of NewPlanExecutor and the result of the plan,
+// which is filled in once the executor is done, also when it failed
+func (runner *runnerImpl) NewPlanExecutorWithResults(plan *model.Plan) (common.Executor, *PlanResult) {
+	result := &PlanResult{Jobs: make([]JobRunResult, 0)}
+	return func(ctx context.Context) error {
+		execution := runner.newExecution()
+		start := time.Now()
+		err := execution.newPlanExecutor(plan)(ctx)
+		result.Jobs = execution.jobResults.runResults()
+		result.Duration = time.Since(start)
+		return err
+	}, result
+}
+
+// newJobRunResult returns the result of the run of rc that ended with conclusion
+func (rc *RunContext) newJobRunResult(conclusion string, outputs map[string]string) JobRunResult {
+	result := JobRunResult{
+		Workflow:   rc.Run.Workflow.Name,
+		JobID:      rc.Run.JobID,
+		Job:        rc.Name,
+		Matrix:     rc.Matrix,
+		Conclusion: conclusion,
+		Outputs:    outputs,
+		Steps:      make([]StepRunResult, 0),
+	}
+	if !rc.started.IsZero() {
+		result.Duration = time.Since(rc.started)
+	}
+	for _, step := range rc.Run.Job().Steps {
+		stepResult, ok := rc.StepResults[step.ID]
+		if !ok {
+			continue
+		}
+		result.Steps = append(result.Steps, StepRunResult{
+			StepID:     step.ID,
+			Step:       step.String(),
+			Outcome:    stepResult.Outcome,
+			Conclusion: stepResult.Conclusion,
+			Outputs:    mergeMaps(stepResult.Outputs),
+			Duration:   stepResult.duration,
+		})
+	}
+	return result
+}
+
+// runResults returns the results of the job runs in the order they finished
+func (jr *jobResults) runResults() []JobRunResult {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+	return append(make([]JobRunResult, 0, len(jr.runs)), jr.runs...)
+}
@@ -2,16 +2,26 @@ package runner
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"sort"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/mitchellh/go-homedir"
+	"github.com/robertkrimen/otto/ast"
+	"github.com/robertkrimen/otto/parser"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/nektos/act/pkg/common"
@@ -21,23 +31,37 @@ import (
 
 // RunContext contains info about current job
 type RunContext struct {
-	Name           string
-	Config         *Config
-	Matrix         map[string]interface{}
-	Run            *model.Run
-	EventJSON      string
-	Env            map[string]string
-	ExtraPath      []string
-	CurrentStep    string
-	StepResults    map[string]*stepResult
-	ExprEval       ExpressionEvaluator
-	JobContainer   container.Container
-	OutputMappings map[MappableOutput]MappableOutput
-}
-
-type MappableOutput struct {
-	StepID     string
-	OutputName string
+	Name         string
+	Config       *Config
+	Matrix       map[string]interface{}
+	Run          *model.Run
+	EventJSON    string
+	Env          map[string]string
+	ExtraPath    []string
+	CurrentStep  string
+	StepResults  map[string]*stepResult
+	ExprEval     ExpressionEvaluator
+	JobContainer container.Container
+	Inputs       map[string]interface{}
+	PostSteps    []common.Executor
+	jobResults   *jobResults
+	events       *eventQueue
+	masks        *addedMasks // the values the steps masked with ::add-mask::
+	defaultShell string
+	started      time.Time
+	githubEnv    map[string]string // the variables the steps so far wrote to GITHUB_ENV
+	pickedImage  *string           // the image Config.PlatformPicker picked, once it was called
+
+	secretPatterns []*regexp.Regexp
+	onHost         bool                      // the job runs on the host, known once it starts and before its contexts are evaluated
+	workflowCall   common.Executor           // runs the reusable workflow the job calls instead of its steps, nil if the job has steps
+	callOutputs    map[string]string         // the outputs of the reusable workflow the job called
+	cachedActions  map[string]bool           // the directories of the action cache the job acquired, guarded by actionCacheLock
+	majorVersions  *common.MajorVersionCache // the shas of the major versions of the remote actions of the run of the plan
+
+	resolvedEnvironment *model.Environment // the job's environment interpolated before its evaluator is created
+	environmentSecrets  map[string]string  // the secrets of the files of the job's environment, read when the job starts
+	environmentVars     map[string]string  // the vars of the files of the job's environment, read when the job starts
 }
 
 func (rc *RunContext) String() string {
@@ -45,8 +69,82 @@ func (rc *RunContext) String() string {
 }
 
 type stepResult struct {
-	Success bool              `json:"success"`
-	Outputs map[string]string `json:"outputs"`
+	Success         bool              `json:"success"`
+	Outcome         string            `json:"outcome,omitempty"`    // result of the step before continue-on-error is applied
+	Conclusion      string            `json:"conclusion,omitempty"` // result of the step after continue-on-error is applied
+	Outputs         map[string]string `json:"outputs"`
+	Output          string            `json:"output,omitempty"`
+	OutputTruncated bool              `json:"output_truncated,omitempty"`
+	State           map[string]string `json:"-"`
+	duration        time.Duration
+	deprecated      map[string]bool // the deprecated commands the step used, each is only warned about once
+}
+
+// captureStepOutput adds a line of output to the result of the current step, up to Config.StepOutputLimit bytes.
+// A line that doesn't fit is cut on a rune boundary, so the output stays valid UTF-8.
+func (rc *RunContext) captureStepOutput(line string) {
+	result, ok := rc.StepResults[rc.CurrentStep]
+	if rc.Config.StepOutputLimit <= 0 || !ok || result.OutputTruncated {
+		return
+	}
+
+	if !rc.Config.InsecureSecrets {
+		line = maskSecrets(line, rc.masks.withSecrets(rc.maskedSecrets()), rc.secretPatterns)
+	}
+
+	if remaining := rc.Config.StepOutputLimit - len(result.Output); len(line) > remaining {
+		for remaining > 0 && !utf8.RuneStart(line[remaining]) {
+			remaining--
+		}
+		line = line[:remaining]
+		result.OutputTruncated = true
+	}
+	result.Output += line
+}
+
+// newLogWriters returns the writers for the stdout and stderr of a container. Each has its own line
+// buffer, so interleaved output like the `set -x` trace on stderr doesn't break up the lines of the
+// other stream, which would keep the secrets in them from being masked. The streams can be written
+// at the same time, e.g. by os/exec on the host, so their lines are handled one at a time.
+func (rc *RunContext) newLogWriters(ctx context.Context) (io.Writer, io.Writer) {
+	rawLogger := common.Logger(ctx).WithField("raw_output", true)
+	commandHandler := rc.commandHandler(ctx)
+	var mu sync.Mutex
+	lineHandler := func(s string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if !commandHandler(s) {
+			return false
+		}
+		rc.captureStepOutput(s)
+		if rc.Config.LogOutput {
+			rawLogger.Infof("%s", s)
+		} else {
+			rawLogger.Debugf("%s", s)
+		}
+		return true
+	}
+	return common.NewLineWriter(lineHandler), common.NewLineWriter(lineHandler)
+}
+
+// interpolateConfigEnv evaluates the expressions in Config.Env, then the env of the workflow and the job
+// is merged over it again
+func (rc *RunContext) interpolateConfigEnv() {
+	env := make(map[string]string, len(rc.Config.Env))
+	for k, v := range rc.Config.Env {
+		env[k] = rc.ExprEval.Interpolate(v)
+	}
+	rc.Env = mergeMaps(env, rc.Run.Workflow.Env, rc.Run.Job().Env)
+	rc.ExprEval = rc.NewExpressionEvaluator()
+}
+
+// isLiteralConfigEnv returns true if the value of key is the one from Config.Env and has to be used as is
+func (rc *RunContext) isLiteralConfigEnv(key string, value string) bool {
+	if rc.Config.EnvExpressions {
+		return false
+	}
+	configValue, ok := rc.Config.Env[key]
+	return ok && configValue == value
 }
 
 // GetEnv returns the env for the context
@@ -58,16 +156,55 @@ func (rc *RunContext) GetEnv() map[string]string {
 	return rc.Env
 }
 
+// jobContainerName ends in a hash of everything the job container is created from, so when
+// containers are reused a later run of the same job finds its container while a change of
+// e.g. the image or the container options results in a new one
 func (rc *RunContext) jobContainerName() string {
-	return createContainerName("act", rc.String())
+	var image, options string
+	var ports, volumes []string
+	if job := rc.Run.Job(); job != nil {
+		image = rc.platformImage()
+		if c := job.Container(); c != nil {
+			options, ports, volumes = c.Options, c.Ports, c.Volumes
+		}
+	}
+	return fmt.Sprintf("%s-%s", createContainerName("act", rc.String()), containerNameHash(
+		rc.Run.Workflow.File,
+		rc.Run.JobID,
+		rc.Matrix,
+		image,
+		options,
+		ports,
+		volumes,
+		rc.Config.ContainerOptions,
+		rc.Config.ContainerMemory,
+		rc.Config.ContainerCPUs,
+		rc.Config.Privileged,
+		rc.Config.UsernsMode,
+		rc.Config.ContainerArchitecture,
+		rc.Config.BindWorkdir,
+		rc.Config.BindHostPath,
+		rc.Config.Workdir,
+		rc.Config.ContainerWorkspace,
+	))
+}
+
+// containerNameHash returns a short hash of values, maps are hashed in key order
+func containerNameHash(values ...interface{}) string {
+	h := sha256.New()
+	for _, value := range values {
+		fmt.Fprintf(h, "%v\x00", value)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12]
 }
 
 // Returns the binds and mounts for the container, resolving paths as appopriate
 func (rc *RunContext) GetBindsAndMounts() ([]string, map[string]string) {
 	name := rc.jobContainerName()
 
-	binds := []string{
-		fmt.Sprintf("%s:%s", "/var/run/docker.sock", "/var/run/docker.sock"),
+	binds := make([]string, 0)
+	if socket := rc.bindDaemonSocket(); socket != "" {
+		binds = append(binds, fmt.Sprintf("%s:%s", socket, container.DefaultDockerSocket))
 	}
 
 	mounts := map[string]string{
@@ -75,80 +212,266 @@ func (rc *RunContext) GetBindsAndMounts() ([]string, map[string]string) {
 		"act-actions":   "/actions",
 	}
 
-	if rc.Config.BindWorkdir {
+	// the tools preinstalled in /opt/hostedtoolcache of the image are only hidden by an explicit ToolCacheDir
+	if dir := rc.Config.ToolCacheDir; dir != "" {
+		binds = append(binds, fmt.Sprintf("%s:%s", dir, containerToolCacheDir))
+	}
+
+	if rc.Config.BindWorkdir || rc.runsOnHost() {
 		bindModifiers := ""
 		if runtime.GOOS == "darwin" {
 			bindModifiers = ":delegated"
 		}
-		binds = append(binds, fmt.Sprintf("%s:%s%s", rc.Config.Workdir, rc.Config.ContainerWorkdir(), bindModifiers))
+		binds = append(binds, fmt.Sprintf("%s:%s%s", rc.Config.Workdir, rc.containerWorkdir(), bindModifiers))
 	} else {
-		mounts[name] = rc.Config.ContainerWorkdir()
+		mounts[name] = rc.containerWorkdir()
 	}
 
 	return binds, mounts
 }
 
-func (rc *RunContext) startJobContainer() common.Executor {
-	image := rc.platformImage()
+// bindDaemonSocket returns the path of the socket of the daemon to bind to /var/run/docker.sock in the
+// containers for Config.BindDaemonSocket, empty if it isn't set or the daemon doesn't listen on a unix socket
+func (rc *RunContext) bindDaemonSocket() string {
+	if !rc.Config.BindDaemonSocket {
+		return ""
+	}
+	socket := rc.Config.daemonSocket()
+	if socket == "" {
+		socket = container.DetectDaemonSocket()
+	}
+	if socket == "" {
+		return container.DefaultDockerSocket
+	}
+	if strings.HasPrefix(socket, "unix://") {
+		return strings.TrimPrefix(socket, "unix://")
+	}
+	return ""
+}
 
-	return func(ctx context.Context) error {
-		rawLogger := common.Logger(ctx).WithField("raw_output", true)
-		logWriter := common.NewLineWriter(rc.commandHandler(ctx), func(s string) bool {
-			if rc.Config.LogOutput {
-				rawLogger.Infof("%s", s)
-			} else {
-				rawLogger.Debugf("%s", s)
-			}
+// daemonSocketEnv returns the DOCKER_HOST of the containers for Config.BindDaemonSocket, the bound socket
+// or the socket of the daemon if it can't be bound, e.g. tcp://host:2376
+func (rc *RunContext) daemonSocketEnv() []string {
+	if !rc.Config.BindDaemonSocket {
+		return nil
+	}
+	if rc.bindDaemonSocket() != "" {
+		return []string{"DOCKER_HOST=unix://" + container.DefaultDockerSocket}
+	}
+	return []string{"DOCKER_HOST=" + rc.Config.daemonSocket()}
+}
+
+// containerOptions merges the global container options with the options of a container from the workflow.
+// The global options are applied first, so single valued options from the workflow take precedence while
+// options which can be repeated (e.g. --add-host, --dns) are combined.
+func (rc *RunContext) containerOptions(options string) string {
+	return strings.TrimSpace(fmt.Sprintf("%s %s", rc.Config.ContainerOptions, rc.ExprEval.Interpolate(options)))
+}
+
+// registryCredentials returns the username and password to pull image with from Config.RegistryCredentials
+func (rc *RunContext) registryCredentials(image string) (string, string) {
+	credential, ok := rc.Config.RegistryCredentials[container.ImageRegistry(image)]
+	if !ok {
+		return "", ""
+	}
+	return rc.ExprEval.Interpolate(credential.Username), rc.ExprEval.Interpolate(credential.Password)
+}
+
+// containerCredentials returns the username and password to pull the image of the container spec with, the
+// `credentials` of spec if it has them or else those of the registry of image from Config.RegistryCredentials
+func (rc *RunContext) containerCredentials(spec *model.ContainerSpec, image string) (string, string) {
+	if spec == nil || len(spec.Credentials) == 0 {
+		return rc.registryCredentials(image)
+	}
+	return rc.ExprEval.Interpolate(spec.Credentials["username"]), rc.ExprEval.Interpolate(spec.Credentials["password"])
+}
+
+// maskedSecrets returns the secrets masked in the output of the job, the secrets for the job and the password
+// of the `credentials` of its container, which doesn't have to come from a secret
+func (rc *RunContext) maskedSecrets() map[string]string {
+	c := rc.Run.Job().Container()
+	if c == nil || c.Credentials["password"] == "" {
+		return rc.secrets()
+	}
+	_, password := rc.containerCredentials(c, "")
+	return mergeMaps(rc.secrets(), map[string]string{"container.credentials.password": password})
+}
+
+// forcePull returns true if image has to be pulled even if it is already present
+func (rc *RunContext) forcePull(image string) bool {
+	if rc.Config.ForcePull {
+		return true
+	}
+	for _, pattern := range rc.Config.ForcePullImages {
+		if matched, err := path.Match(pattern, image); err != nil {
+			rc.Config.logger().Warnf("Invalid force pull image pattern '%s': %v", pattern, err)
+		} else if matched {
 			return true
-		})
+		}
+	}
+	return false
+}
+
+var namedVolumePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// jobContainerVolumes converts the `volumes` of the job container into docker binds.
+// Relative host paths are resolved against the workspace.
+func (rc *RunContext) jobContainerVolumes(volumes []string) ([]string, error) {
+	binds := make([]string, 0, len(volumes))
+	for _, volume := range volumes {
+		spec := rc.ExprEval.Interpolate(volume)
+		parts := strings.Split(spec, ":")
+
+		var source, target, mode string
+		switch len(parts) {
+		case 1:
+			target = parts[0]
+		case 2:
+			source, target = parts[0], parts[1]
+		case 3:
+			source, target, mode = parts[0], parts[1], parts[2]
+		default:
+			return nil, fmt.Errorf("invalid volume '%s', expected [source:]target[:mode]", spec)
+		}
+
+		if !strings.HasPrefix(target, "/") {
+			return nil, fmt.Errorf("invalid volume '%s', container path '%s' must be absolute", spec, target)
+		}
+		if len(parts) == 3 && mode == "" {
+			return nil, fmt.Errorf("invalid volume '%s', mode must not be empty", spec)
+		}
+
+		switch {
+		case len(parts) == 1:
+		case source == "":
+			return nil, fmt.Errorf("invalid volume '%s', source must not be empty", spec)
+		case strings.HasPrefix(source, "."):
+			source = rc.Config.containerPath(filepath.Join(rc.Config.Workdir, source))
+		case filepath.IsAbs(source):
+			source = rc.Config.containerPath(source)
+		case !namedVolumePattern.MatchString(source):
+			return nil, fmt.Errorf("invalid volume '%s', '%s' is neither a path nor a valid volume name", spec, source)
+		}
+
+		bind := target
+		if source != "" {
+			bind = fmt.Sprintf("%s:%s", source, target)
+		}
+		if mode != "" {
+			bind = fmt.Sprintf("%s:%s", bind, mode)
+		}
+		binds = append(binds, bind)
+	}
+	return binds, nil
+}
+
+// jobContainerInput returns the input of the job container of rc that runs in image, with the
+// credentials of its `container:` or of Config.RegistryCredentials to pull the image
+func (rc *RunContext) jobContainerInput(image string, stdout, stderr io.Writer) (*container.NewContainerInput, error) {
+	name := rc.jobContainerName()
+
+	envList := make([]string, 0)
+
+	envList = append(envList, fmt.Sprintf("%s=%s", "RUNNER_TOOL_CACHE", containerToolCacheDir))
+	envList = append(envList, fmt.Sprintf("%s=%s", "RUNNER_OS", "Linux"))
+	envList = append(envList, fmt.Sprintf("%s=%s", "RUNNER_TEMP", "/tmp"))
+	envList = append(envList, rc.daemonSocketEnv()...)
+
+	binds, mounts := rc.GetBindsAndMounts()
+
+	var options string
+	var ports []string
+	c := rc.Run.Job().Container()
+	username, password := rc.containerCredentials(c, image)
+	if c != nil {
+		options = c.Options
+		for _, port := range c.Ports {
+			ports = append(ports, rc.ExprEval.Interpolate(port))
+		}
+		volumeBinds, err := rc.jobContainerVolumes(c.Volumes)
+		if err != nil {
+			return nil, err
+		}
+		binds = append(binds, volumeBinds...)
+	}
+
+	return &container.NewContainerInput{
+		Cmd:         nil,
+		Entrypoint:  rc.keepAliveEntrypoint(),
+		OpenStdin:   rc.Config.ContainerDefaultShell != "",
+		WorkingDir:  rc.containerWorkdir(),
+		Image:       image,
+		Name:        name,
+		Env:         envList,
+		Mounts:      mounts,
+		NetworkMode: "host",
+		Binds:       binds,
+		Stdout:      stdout,
+		Stderr:      stderr,
+		Privileged:  rc.Config.Privileged,
+		UsernsMode:  rc.Config.UsernsMode,
+		Platform:    rc.Config.ContainerArchitecture,
+		Options:     rc.containerOptions(options),
+		Ports:       ports,
+		Memory:      rc.Config.ContainerMemory,
+		CPUs:        rc.Config.ContainerCPUs,
+		Init:        rc.Config.ContainerInit,
+		PullRetries: rc.Config.PullRetries,
+		PullBackoff: rc.Config.PullRetryBackoff,
+		StopTimeout: rc.containerStopTimeout(),
+		Username:    username,
+		Password:    password,
+	}, nil
+}
+
+func (rc *RunContext) startJobContainer() common.Executor {
+	return func(ctx context.Context) error {
+		image, err := rc.resolvePlatformImage()
+		if err != nil {
+			return err
+		}
+		if rc.usesDefaultImage() {
+			common.Logger(ctx).Warnf("\u26a0  The runs-on labels [%s] match no platform, running in the default image %s", strings.Join(rc.runsOnLabels(), ", "), image)
+		}
+
+		stdout, stderr := rc.newLogWriters(ctx)
+		rc.onHost = image == container.HostImage
+
+		if image == container.HostImage {
+			return rc.startHostEnvironment(stdout, stderr)(ctx)
+		}
 
 		common.Logger(ctx).Infof("\U0001f680  Start image=%s", image)
-		name := rc.jobContainerName()
-
-		envList := make([]string, 0)
-
-		envList = append(envList, fmt.Sprintf("%s=%s", "RUNNER_TOOL_CACHE", "/opt/hostedtoolcache"))
-		envList = append(envList, fmt.Sprintf("%s=%s", "RUNNER_OS", "Linux"))
-		envList = append(envList, fmt.Sprintf("%s=%s", "RUNNER_TEMP", "/tmp"))
-
-		binds, mounts := rc.GetBindsAndMounts()
-
-		rc.JobContainer = container.NewContainer(&container.NewContainerInput{
-			Cmd:         nil,
-			Entrypoint:  []string{"/usr/bin/tail", "-f", "/dev/null"},
-			WorkingDir:  rc.Config.ContainerWorkdir(),
-			Image:       image,
-			Name:        name,
-			Env:         envList,
-			Mounts:      mounts,
-			NetworkMode: "host",
-			Binds:       binds,
-			Stdout:      logWriter,
-			Stderr:      logWriter,
-			Privileged:  rc.Config.Privileged,
-			UsernsMode:  rc.Config.UsernsMode,
-			Platform:    rc.Config.ContainerArchitecture,
-		})
+		input, err := rc.jobContainerInput(image, stdout, stderr)
+		if err != nil {
+			return err
+		}
+		rc.JobContainer = container.NewContainer(input)
 
 		var copyWorkspace bool
 		var copyToPath string
 		if !rc.Config.BindWorkdir {
 			copyToPath, copyWorkspace = rc.localCheckoutPath()
-			copyToPath = filepath.Join(rc.Config.ContainerWorkdir(), copyToPath)
+			copyToPath = filepath.Join(rc.containerWorkdir(), copyToPath)
 		}
 
 		return common.NewPipelineExecutor(
-			rc.JobContainer.Pull(rc.Config.ForcePull),
+			rc.JobContainer.Pull(rc.forcePull(image)),
 			rc.stopJobContainer(),
+			rc.createToolCacheDir().IfNot(common.Dryrun),
 			rc.JobContainer.Create(),
 			rc.JobContainer.Start(false),
 			rc.JobContainer.CopyDir(copyToPath, rc.Config.Workdir+string(filepath.Separator)+".", rc.Config.UseGitIgnore).IfBool(copyWorkspace),
-			rc.JobContainer.Copy(rc.Config.ContainerWorkdir(), &container.FileEntry{
-				Name: "workflow/event.json",
+			rc.JobContainer.Copy(rc.containerWorkdir(), &container.FileEntry{
+				Name: rc.workflowFile("event.json"),
 				Mode: 0644,
 				Body: rc.EventJSON,
 			}, &container.FileEntry{
-				Name: "workflow/envs.txt",
+				Name: rc.workflowFile("envs.txt"),
+				Mode: 0644,
+				Body: "",
+			}, &container.FileEntry{
+				Name: rc.workflowFile("paths.txt"),
 				Mode: 0644,
 				Body: "",
 			}, &container.FileEntry{
@@ -156,21 +479,146 @@ func (rc *RunContext) startJobContainer() common.Executor {
 				Mode: 0644,
 				Body: "",
 			}),
+			rc.resetStepFiles(true),
+			rc.detectDefaultShell(),
 		)(ctx)
 	}
 }
+
+// startHostEnvironment prepares running the job directly on the host, the working directory is used like with BindWorkdir
+func (rc *RunContext) startHostEnvironment(stdout io.Writer, stderr io.Writer) common.Executor {
+	return func(ctx context.Context) error {
+		if runtime.GOOS == "windows" {
+			return fmt.Errorf("running %s on the host is not supported on windows", rc.String())
+		}
+
+		runnerOS := "Linux"
+		if runtime.GOOS == "darwin" {
+			runnerOS = "macOS"
+		}
+
+		common.Logger(ctx).Infof("\U0001f680  Start on the host in %s", rc.containerWorkdir())
+		rc.JobContainer = container.NewHostEnvironment(&container.NewContainerInput{
+			WorkingDir: rc.containerWorkdir(),
+			Env: []string{
+				fmt.Sprintf("%s=%s", "RUNNER_OS", runnerOS),
+				fmt.Sprintf("%s=%s", "RUNNER_TEMP", os.TempDir()),
+				fmt.Sprintf("%s=%s", "RUNNER_TOOL_CACHE", rc.toolCacheDir()),
+			},
+			Stdout: stdout,
+			Stderr: stderr,
+		})
+
+		return common.NewPipelineExecutor(
+			rc.JobContainer.Create(),
+			rc.createToolCacheDir().IfNot(common.Dryrun),
+			rc.JobContainer.Copy(rc.containerWorkdir(), &container.FileEntry{
+				Name: rc.workflowFile("event.json"),
+				Mode: 0644,
+				Body: rc.EventJSON,
+			}, &container.FileEntry{
+				Name: rc.workflowFile("envs.txt"),
+				Mode: 0644,
+				Body: "",
+			}, &container.FileEntry{
+				Name: rc.workflowFile("paths.txt"),
+				Mode: 0644,
+				Body: "",
+			}),
+			rc.resetStepFiles(true),
+			rc.detectDefaultShell(),
+		)(ctx)
+	}
+}
+
+// runsOnHost returns true if the job runs directly on the host instead of in a container
+func (rc *RunContext) runsOnHost() bool {
+	if rc.Run == nil || rc.Run.Job() == nil {
+		return false
+	}
+	return rc.platformImage() == container.HostImage
+}
+
+// containerWorkdir returns the path of the workspace in the job container, Config.ContainerWorkspace if
+// it is set. The workdir of a job on the host, and a workdir bound with Config.BindHostPath, is at its own
+// path, so the absolute paths the steps emit are valid on the host too.
+func (rc *RunContext) containerWorkdir() string {
+	if rc.Config.ContainerWorkspace == "" || rc.onHost || (rc.Config.BindWorkdir && rc.Config.BindHostPath) {
+		return rc.Config.ContainerWorkdir()
+	}
+	return rc.Config.ContainerWorkspace
+}
+
+// keepAliveEntrypoint is the entrypoint that keeps the job container running while the steps are executed in it.
+// With Config.ContainerDefaultShell it is the shell alone, its `read` waits on the stdin the container keeps open,
+// so the image needs nothing but the shell.
+func (rc *RunContext) keepAliveEntrypoint() []string {
+	if shell := rc.Config.ContainerDefaultShell; shell != "" {
+		return []string{shell, "-c", "read _"}
+	}
+	return []string{"/usr/bin/tail", "-f", "/dev/null"}
+}
+
+// detectDefaultShell picks the shell of run steps without a shell once the job container is started,
+// Config.ContainerDefaultShell if set, otherwise bash like GitHub does or sh if the image has no bash
+func (rc *RunContext) detectDefaultShell() common.Executor {
+	return func(ctx context.Context) error {
+		rc.defaultShell = rc.Config.ContainerDefaultShell
+		if rc.defaultShell != "" {
+			return nil
+		}
+		rc.defaultShell = "bash"
+		if err := rc.JobContainer.Exec([]string{"bash", "-c", ":"}, nil)(ctx); err != nil {
+			common.Logger(ctx).Debugf("Using sh as the default shell, bash is not available: %v", err)
+			rc.defaultShell = "sh"
+		}
+		return nil
+	}
+}
+
+// defaultShellCommand returns the command of run steps without a shell
+func (rc *RunContext) defaultShellCommand() string {
+	shell := rc.defaultShell
+	if shell == "" {
+		shell = rc.Config.ContainerDefaultShell
+	}
+	if shell == "" {
+		shell = "bash"
+	}
+	return shell + " -e {0}"
+}
+
 func (rc *RunContext) execJobContainer(cmd []string, env map[string]string) common.Executor {
 	return func(ctx context.Context) error {
+		logDryRunCommand(ctx, "in the job container", cmd, env)
 		return rc.JobContainer.Exec(cmd, env)(ctx)
 	}
 }
 
+// DefaultContainerStopTimeout is the time the processes of a container have to exit when it is removed,
+// if Config.ContainerStopTimeout isn't set
+const DefaultContainerStopTimeout = 3 * time.Second
+
+// containerStopTimeout is the StopTimeout of the job container and of the containers of docker actions
+func (rc *RunContext) containerStopTimeout() time.Duration {
+	if rc.Config.ContainerStopTimeout == 0 {
+		return DefaultContainerStopTimeout
+	}
+	if rc.Config.ContainerStopTimeout < 0 {
+		return 0
+	}
+	return rc.Config.ContainerStopTimeout
+}
+
 // stopJobContainer removes the job container (if it exists) and its volume (if it exists) if !rc.Config.ReuseContainers
 func (rc *RunContext) stopJobContainer() common.Executor {
 	return func(ctx context.Context) error {
 		if rc.JobContainer != nil && !rc.Config.ReuseContainers {
+			if rc.runsOnHost() {
+				return rc.JobContainer.Remove()(ctx)
+			}
 			return rc.JobContainer.Remove().
-				Then(container.NewDockerVolumeRemoveExecutor(rc.jobContainerName(), false))(ctx)
+				Then(container.NewDockerVolumeRemoveExecutor(rc.jobContainerName(), false).IfNot(common.Dryrun))(ctx)
 		}
 		return nil
 	}
@@ -180,6 +628,47 @@ func (rc *RunContext) stopJobContainer() common.Executor {
 
 // ActionCacheDir is for rc
 func (rc *RunContext) ActionCacheDir() string {
+	if rc.Config.ActionCacheDir != "" {
+		return rc.Config.ActionCacheDir
+	}
+
+	return filepath.Join(cacheHome(), "act")
+}
+
+// containerToolCacheDir is where the tool cache is mounted in containers, like on the GitHub hosted runners
+const containerToolCacheDir = "/opt/hostedtoolcache"
+
+// hostToolCacheDir is the directory on the host that is mounted as the tool cache, empty if the
+// tool cache of the image is used. Jobs that run on the host always use a directory.
+func (rc *RunContext) hostToolCacheDir() string {
+	if rc.Config.ToolCacheDir != "" {
+		return rc.Config.ToolCacheDir
+	}
+	if rc.runsOnHost() {
+		return filepath.Join(cacheHome(), "act-toolcache")
+	}
+	return ""
+}
+
+// toolCacheDir is the tool cache as the steps of the job see it in RUNNER_TOOL_CACHE
+func (rc *RunContext) toolCacheDir() string {
+	if rc.runsOnHost() {
+		return rc.hostToolCacheDir()
+	}
+	return containerToolCacheDir
+}
+
+// createToolCacheDir creates the directory of the tool cache on the host, so docker doesn't create it owned by root
+func (rc *RunContext) createToolCacheDir() common.Executor {
+	return func(ctx context.Context) error {
+		if dir := rc.hostToolCacheDir(); dir != "" {
+			return os.MkdirAll(dir, 0755)
+		}
+		return nil
+	}
+}
+
+func cacheHome() string {
 	var xdgCache string
 	var ok bool
 	if xdgCache, ok = os.LookupEnv("XDG_CACHE_HOME"); !ok || xdgCache == "" {
@@ -189,7 +678,7 @@ func (rc *RunContext) ActionCacheDir() string {
 			log.Fatal(err)
 		}
 	}
-	return filepath.Join(xdgCache, "act")
+	return xdgCache
 }
 
 // Executor returns a pipeline executor for all the steps in the job
@@ -205,15 +694,110 @@ func (rc *RunContext) Executor() common.Executor {
 
 	steps = append(steps, rc.startJobContainer())
 
-	for i, step := range rc.Run.Job().Steps {
-		if step.ID == "" {
-			step.ID = fmt.Sprintf("%d", i)
-		}
+	for _, step := range rc.Run.Job().Steps {
 		steps = append(steps, rc.newStepExecutor(step))
 	}
-	steps = append(steps, rc.stopJobContainer())
 
-	return common.NewPipelineExecutor(steps...).If(rc.isEnabled)
+	// the job container is stopped when the run is interrupted too, so it isn't left behind
+	jobExecutor := common.NewPipelineExecutor(
+		common.NewPipelineExecutor(steps...).Finally(rc.runPostSteps()),
+		rc.stopJobContainer(),
+	).OnCancel(rc.stopJobContainer()).Finally(rc.releaseCachedActions())
+	if rc.workflowCall != nil {
+		jobExecutor = rc.workflowCall
+	}
+
+	return func(ctx context.Context) error {
+		// the jobs this job needs are done now, so their results can be evaluated
+		rc.resolveEnvironment()
+		if err := rc.readEnvironmentFiles(); err != nil {
+			rc.addJobResult("failure")
+			return err
+		}
+		rc.ExprEval = rc.NewExpressionEvaluator()
+		// the contexts show the workspace, which is elsewhere on the host. Where the job runs needs an evaluator for runs-on.
+		if rc.onHost = rc.runsOnHost(); rc.onHost {
+			rc.ExprEval = rc.NewExpressionEvaluator()
+		}
+		if !rc.isEnabled(ctx) {
+			rc.addJobResult("skipped")
+			return nil
+		}
+
+		rc.started = time.Now()
+		rc.sendJobEvent(JobStarted, "", 0)
+		var groups []string
+		if group := rc.concurrencyGroup(ctx, rc.Run.Job().Concurrency()); group != "" {
+			groups = append(groups, group)
+		}
+		err := withConcurrency(groups, jobExecutor)(ctx)
+		if err != nil && ctx.Err() != nil {
+			rc.addJobResult("cancelled")
+		} else if err != nil {
+			rc.addJobResult("failure")
+		} else {
+			rc.logActionOutputs(ctx)
+			rc.addJobResult("success")
+		}
+		return err
+	}
+}
+
+// logActionOutputs logs the outputs of the action a job created with model.NewActionWorkflow ran,
+// since no later step can use them
+func (rc *RunContext) logActionOutputs(ctx context.Context) {
+	if rc.Run.Workflow.Action == nil {
+		return
+	}
+	names := make([]string, 0, len(rc.Run.Job().Outputs))
+	for name := range rc.Run.Job().Outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	exprEval := rc.NewExpressionEvaluator()
+	for _, name := range names {
+		common.Logger(ctx).Infof("  \U00002699  Output %s=%s", name, exprEval.Interpolate(rc.Run.Job().Outputs[name]))
+	}
+}
+
+// addJobResult records the result and resolved outputs of the job for the jobs that need it
+func (rc *RunContext) addJobResult(result string) {
+	var duration time.Duration
+	if !rc.started.IsZero() {
+		duration = time.Since(rc.started)
+	}
+	rc.sendJobEvent(JobCompleted, result, duration)
+	if rc.jobResults == nil {
+		return
+	}
+
+	outputs := make(map[string]string)
+	if result != "skipped" && rc.workflowCall != nil {
+		outputs = mergeMaps(rc.callOutputs)
+	} else if result != "skipped" {
+		exprEval := rc.NewExpressionEvaluator()
+		for name, value := range rc.Run.Job().Outputs {
+			outputs[name] = exprEval.Interpolate(value)
+		}
+	}
+	rc.jobResults.add(rc.Run.Workflow, rc.Run.JobID, result, outputs, rc.newJobRunResult(result, outputs))
+}
+
+// runPostSteps runs the post steps of the actions used by the job in reverse order,
+// even if a step of the job failed or the job was canceled. Like the steps they write to the step files.
+func (rc *RunContext) runPostSteps() common.Executor {
+	return func(ctx context.Context) error {
+		// like on GitHub the post steps also run once the job is canceled
+		ctx = common.WithoutCancel(ctx)
+		var err error
+		for i := len(rc.PostSteps) - 1; i >= 0; i-- {
+			if postErr := rc.withStepFiles(rc.PostSteps[i])(ctx); postErr != nil && err == nil {
+				err = postErr
+			}
+		}
+		return err
+	}
 }
 
 func (rc *RunContext) newStepExecutor(step *model.Step) common.Executor {
@@ -223,10 +807,11 @@ func (rc *RunContext) newStepExecutor(step *model.Step) common.Executor {
 	}
 	return func(ctx context.Context) error {
 		rc.CurrentStep = sc.Step.ID
-		rc.StepResults[rc.CurrentStep] = &stepResult{
+		result := &stepResult{
 			Success: true,
 			Outputs: make(map[string]string),
 		}
+		rc.StepResults[rc.CurrentStep] = result
 		runStep, err := rc.EvalBool(sc.Step.If.Value)
 
 		if err != nil {
@@ -237,11 +822,17 @@ func (rc *RunContext) newStepExecutor(step *model.Step) common.Executor {
 			}
 			rc.ExprEval = exprEval
 			rc.StepResults[rc.CurrentStep].Success = false
+			rc.StepResults[rc.CurrentStep].Outcome = "failure"
+			rc.StepResults[rc.CurrentStep].Conclusion = "failure"
+			rc.sendStepEvent(StepCompleted, sc.Step)
 			return err
 		}
 
 		if !runStep {
-			log.Debugf("Skipping step '%s' due to '%s'", sc.Step.String(), sc.Step.If.Value)
+			logSkipped(ctx, "Skipping step '%s' due to '%s'", sc.Step.String(), sc.Step.If.Value)
+			rc.StepResults[rc.CurrentStep].Outcome = "skipped"
+			rc.StepResults[rc.CurrentStep].Conclusion = "skipped"
+			rc.sendStepEvent(StepCompleted, sc.Step)
 			return nil
 		}
 
@@ -252,66 +843,211 @@ func (rc *RunContext) newStepExecutor(step *model.Step) common.Executor {
 		rc.ExprEval = exprEval
 
 		common.Logger(ctx).Infof("\u2B50  Run %s", sc.Step)
-		err = sc.Executor()(ctx)
-		if err == nil {
-			common.Logger(ctx).Infof("  \u2705  Success - %s", sc.Step)
-		} else {
-			common.Logger(ctx).Errorf("  \u274C  Failure - %s", sc.Step)
-
-			if sc.Step.ContinueOnError {
-				common.Logger(ctx).Infof("Failed but continue next step")
-				err = nil
-				rc.StepResults[rc.CurrentStep].Success = true
-			} else {
-				rc.StepResults[rc.CurrentStep].Success = false
-			}
+		start := time.Now()
+		rc.sendStepEvent(StepStarted, sc.Step)
+		defer func() {
+			result.duration = time.Since(start)
+			rc.sendStepEvent(StepCompleted, sc.Step)
+		}()
+		if err := rc.runStepHook(ctx, rc.Config.BeforeStep, sc.Step); err != nil {
+			return rc.finishStep(ctx, sc.Step, err)
+		}
+		err = rc.finishStep(ctx, sc.Step, rc.withStepFiles(sc.Executor())(ctx))
+		if hookErr := rc.runStepHook(ctx, rc.Config.AfterStep, sc.Step); hookErr != nil && err == nil {
+			rc.StepResults[rc.CurrentStep].Success = false
+			rc.StepResults[rc.CurrentStep].Outcome, rc.StepResults[rc.CurrentStep].Conclusion = "failure", "failure"
+			return hookErr
 		}
 		return err
 	}
 }
 
+// finishStep records the result of the current step. A step that fails with continue-on-error
+// has the outcome failure but the conclusion success, so it doesn't fail the job and its needs.
+// A step that exits with Config.NeutralExitCode is skipped and the job continues.
+func (rc *RunContext) finishStep(ctx context.Context, step *model.Step, err error) error {
+	result := rc.StepResults[rc.CurrentStep]
+	if err == nil {
+		common.Logger(ctx).Infof("  \u2705  Success - %s", step)
+		result.Outcome, result.Conclusion = "success", "success"
+		return nil
+	}
+
+	var exitErr container.ExitCodeError
+	if rc.Config.NeutralExitCode != 0 && errors.As(err, &exitErr) && exitErr.ExitCode == rc.Config.NeutralExitCode {
+		common.Logger(ctx).Infof("  \u2796  Neutral - %s", step)
+		result.Outcome, result.Conclusion = "skipped", "skipped"
+		return nil
+	}
+
+	common.Logger(ctx).Errorf("  \u274C  Failure - %s", step)
+	result.Outcome = "failure"
+	if rc.ExprEval.Interpolate(step.ContinueOnError) == "true" {
+		common.Logger(ctx).Infof("Failed but continue next step")
+		result.Success, result.Conclusion = true, "success"
+		return nil
+	}
+	result.Success, result.Conclusion = false, "failure"
+	return err
+}
+
 func (rc *RunContext) platformImage() string {
+	image, _ := rc.resolvePlatformImage()
+	return image
+}
+
+// resolvePlatformImage returns the image of the job's container or else the image Config.PlatformPicker picks
+// or else the image of the platform that matches the job's `runs-on` labels. A key of Config.Platforms is a comma separated set of labels (e.g. `self-hosted,linux`)
+// and matches if all of its labels are in `runs-on`, the key with the most labels wins. If no key matches
+// Config.DefaultImage is used, unless the job runs on windows or macOS. An empty image means the platform
+// isn't supported and the job is skipped.
+func (rc *RunContext) resolvePlatformImage() (string, error) {
 	job := rc.Run.Job()
 
 	c := job.Container()
 	if c != nil {
-		return rc.ExprEval.Interpolate(c.Image)
+		return rc.ExprEval.Interpolate(c.Image), nil
 	}
 
+	if job.RunsOn() == nil && job.Uses != "" {
+		return "", nil
+	}
 	if job.RunsOn() == nil {
-		log.Errorf("'runs-on' key not defined in %s", rc.String())
+		rc.Config.logger().Errorf("'runs-on' key not defined in %s", rc.String())
+		return "", nil
+	}
+
+	if image, err := rc.pickPlatformImage(); err != nil || image != "" {
+		return image, err
+	}
+
+	labels := rc.runsOnLabels()
+	image, ok := matchPlatform(rc.Config.Platforms, labels)
+	if ok {
+		return image, nil
+	}
+	// the default image would run the job on linux without a word
+	if label, runnerOS := dockerUnsupportedLabel(labels); label != "" {
+		return "", fmt.Errorf("%s runs on %s, a %s runner that docker can't run. Map the label to an image in the platforms to run the job in a linux container anyway (e.g. -P %s=node:16-buster-slim), or to an empty image to skip the job (-P %s=)",
+			rc.String(), label, runnerOS, label, label)
+	}
+	if rc.Config.DefaultImage != "" {
+		return rc.Config.DefaultImage, nil
 	}
+	return "", fmt.Errorf("the runs-on labels [%s] of %s match no platform, map them to an image in the platforms or set a default image", strings.Join(labels, ", "), rc.String())
+}
 
+// runsOnLabels returns the interpolated `runs-on` labels of the job in lower case
+func (rc *RunContext) runsOnLabels() []string {
+	job := rc.Run.Job()
+	// the first evaluator of the job names the job container for the paths of its github context
+	// (BindWorkdir) before there is an evaluator to interpolate the labels with
+	interpolate := func(value string) string {
+		if rc.ExprEval == nil {
+			return value
+		}
+		return rc.ExprEval.Interpolate(value)
+	}
+
+	// a runner group is matched by the platforms of `group:<name>`
+	labels := make([]string, 0, len(job.RunsOn())+1)
+	if group := interpolate(job.RunsOnGroup()); group != "" {
+		labels = append(labels, "group:"+strings.ToLower(group))
+	}
 	for _, runnerLabel := range job.RunsOn() {
-		platformName := rc.ExprEval.Interpolate(runnerLabel)
-		image := rc.Config.Platforms[strings.ToLower(platformName)]
-		if image != "" {
-			return image
+		labels = append(labels, strings.ToLower(interpolate(runnerLabel)))
+	}
+	return labels
+}
+
+// usesDefaultImage returns true if the job runs in Config.DefaultImage because its labels match no platform
+func (rc *RunContext) usesDefaultImage() bool {
+	if rc.Config.DefaultImage == "" || rc.Run.Job().Container() != nil || rc.Run.Job().RunsOn() == nil {
+		return false
+	}
+	if image, err := rc.pickPlatformImage(); err != nil || image != "" {
+		return false
+	}
+	_, ok := matchPlatform(rc.Config.Platforms, rc.runsOnLabels())
+	return !ok
+}
+
+// dockerUnsupportedLabel returns the first of labels that is a windows or macOS runner and its OS, or empty strings
+func dockerUnsupportedLabel(labels []string) (string, string) {
+	for _, label := range labels {
+		switch {
+		case label == "windows" || strings.HasPrefix(label, "windows-"):
+			return label, "Windows"
+		case label == "macos" || strings.HasPrefix(label, "macos-"):
+			return label, "macOS"
 		}
 	}
+	return "", ""
+}
 
-	return ""
+// matchPlatform returns the image of the platform whose labels are all in labels, preferring the platforms
+// with the most labels and then the platforms of the labels that come first
+func matchPlatform(platforms map[string]string, labels []string) (string, bool) {
+	position := make(map[string]int, len(labels))
+	for i, label := range labels {
+		if _, ok := position[label]; !ok {
+			position[label] = i
+		}
+	}
+
+	var image, bestKey string
+	bestSize, bestPosition := 0, 0
+	for key, platformImage := range platforms {
+		keyLabels := strings.Split(strings.ToLower(key), ",")
+		first := len(labels)
+		matches := true
+		for _, label := range keyLabels {
+			i, ok := position[strings.TrimSpace(label)]
+			if !ok {
+				matches = false
+				break
+			}
+			if i < first {
+				first = i
+			}
+		}
+		if !matches {
+			continue
+		}
+		better := len(keyLabels) > bestSize ||
+			(len(keyLabels) == bestSize && (first < bestPosition || (first == bestPosition && key < bestKey)))
+		if better {
+			image, bestKey, bestSize, bestPosition = platformImage, key, len(keyLabels), first
+		}
+	}
+	return image, bestSize > 0
 }
 
 func (rc *RunContext) isEnabled(ctx context.Context) bool {
 	job := rc.Run.Job()
 	l := common.Logger(ctx)
+	if status, skipped := rc.skippedByNeeds(); skipped {
+		logSkipped(ctx, "Skipping job '%s', a job it needs has the result %s", job.Name, status)
+		return false
+	}
 	runJob, err := rc.EvalBool(job.If.Value)
 	if err != nil {
 		common.Logger(ctx).Errorf("  \u274C  Error in if: expression - %s", job.Name)
 		return false
 	}
 	if !runJob {
-		l.Debugf("Skipping job '%s' due to '%s'", job.Name, job.If.Value)
+		logSkipped(ctx, "Skipping job '%s' due to '%s'", job.Name, job.If.Value)
 		return false
 	}
 
-	img := rc.platformImage()
-	if img == "" {
-		if job.RunsOn() == nil {
-			log.Errorf("'runs-on' key not defined in %s", rc.String())
-		}
+	// the jobs of a called workflow have the platforms
+	if job.Uses != "" {
+		return true
+	}
 
+	// jobs whose labels match no platform fail when their container is started
+	img, err := rc.resolvePlatformImage()
+	if err == nil && img == "" {
 		for _, runnerLabel := range job.RunsOn() {
 			platformName := rc.ExprEval.Interpolate(runnerLabel)
 			l.Infof("\U0001F6A7  Skipping unsupported platform '%+v'", platformName)
@@ -321,6 +1057,44 @@ func (rc *RunContext) isEnabled(ctx context.Context) bool {
 	return true
 }
 
+// skippedByNeeds returns the status of the jobs the job needs and true if the job is skipped because of it. Like
+// on GitHub, a job only runs after a job it needs didn't succeed if its if calls a status function.
+func (rc *RunContext) skippedByNeeds() (string, bool) {
+	status := rc.needsStatus()
+	return status, status != "success" && !rc.callsStatusFunction(rc.Run.Job().If.Value)
+}
+
+// statusFunctions are the functions that make a job run after a job it needs didn't succeed
+var statusFunctions = map[string]bool{"success": true, "failure": true, "always": true, "cancelled": true}
+
+// callsStatusFunction returns true if the expression expr calls a status function, also inside ${{ }}. It's
+// parsed like when it's evaluated, so the names in strings, e.g. contains(msg, 'failure('), don't count.
+func (rc *RunContext) callsStatusFunction(expr string) bool {
+	program, err := parser.ParseFile(nil, "", rc.ExprEval.Rewrite(expressionPattern.ReplaceAllString(expr, "($1)")), 0)
+	if err != nil {
+		return false
+	}
+	visitor := &statusCallVisitor{}
+	ast.Walk(visitor, program)
+	return visitor.found
+}
+
+// statusCallVisitor finds the calls of the status functions in an expression
+type statusCallVisitor struct {
+	found bool
+}
+
+func (v *statusCallVisitor) Enter(n ast.Node) ast.Visitor {
+	if call, ok := n.(*ast.CallExpression); ok {
+		if callee, ok := call.Callee.(*ast.Identifier); ok && statusFunctions[callee.Name] {
+			v.found = true
+		}
+	}
+	return v
+}
+
+func (v *statusCallVisitor) Exit(n ast.Node) {}
+
 var splitPattern *regexp.Regexp
 
 // EvalBool evaluates an expression against current run context
@@ -362,7 +1136,7 @@ func (rc *RunContext) EvalBool(expr string) (bool, error) {
 		if err != nil {
 			return false, err
 		}
-		log.Debugf("expression '%s' evaluated to '%s'", expr, v)
+		rc.Config.logger().Debugf("expression '%s' evaluated to '%s'", expr, v)
 		return v == "true", nil
 	}
 	return true, nil
@@ -379,6 +1153,80 @@ func previousOrNextPartIsAnOperator(i int, parts []string) bool {
 	return operator
 }
 
+// environment returns the deployment environment of the job with its name and url interpolated
+func (rc *RunContext) environment() *model.Environment {
+	env := rc.resolvedEnvironment
+	if env == nil || rc.ExprEval == nil {
+		return env
+	}
+	// the url can use the outputs of the steps, so it's interpolated again with the evaluator of the job
+	return &model.Environment{Name: env.Name, URL: rc.ExprEval.Interpolate(rc.Run.Job().Environment().URL)}
+}
+
+// resolveEnvironment interpolates the job's environment. The secrets and vars of the job depend on
+// its name, so it is resolved before the evaluator of the job is created.
+func (rc *RunContext) resolveEnvironment() {
+	rc.resolvedEnvironment = nil
+	if env := rc.Run.Job().Environment(); env != nil {
+		exprEval := rc.newEnvironmentEvaluator()
+		rc.resolvedEnvironment = &model.Environment{
+			Name: exprEval.Interpolate(env.Name),
+			URL:  exprEval.Interpolate(env.URL),
+		}
+	}
+}
+
+// secrets returns the secrets for the job, the secrets of its environment take precedence
+func (rc *RunContext) secrets() map[string]string {
+	if env := rc.environment(); env != nil {
+		if secrets, ok := rc.Config.EnvironmentSecrets[env.Name]; ok || len(rc.environmentSecrets) > 0 {
+			return mergeMaps(rc.Config.Secrets, rc.environmentSecrets, secrets)
+		}
+	}
+	return rc.Config.Secrets
+}
+
+// vars returns the vars for the job, the vars of its environment take precedence
+func (rc *RunContext) vars() map[string]string {
+	if env := rc.environment(); env != nil {
+		if vars, ok := rc.Config.EnvironmentVars[env.Name]; ok || len(rc.environmentVars) > 0 {
+			return mergeMaps(rc.Config.Vars, rc.environmentVars, vars)
+		}
+	}
+	return rc.Config.Vars
+}
+
+// readEnvironmentFiles reads the secrets and vars of the job's environment from the secret and var files
+// with the environment's name appended (e.g. .secrets.production), once its name can be evaluated when
+// the job starts. The files are optional and the secrets of them are masked.
+func (rc *RunContext) readEnvironmentFiles() error {
+	env := rc.environment()
+	if env == nil || env.Name == "" {
+		return nil
+	}
+	environmentFiles := func(files []EnvFile) []EnvFile {
+		named := make([]EnvFile, 0, len(files))
+		for _, file := range files {
+			named = append(named, EnvFile{Path: fmt.Sprintf("%s.%s", file.Path, env.Name), Optional: true})
+		}
+		return named
+	}
+
+	secrets, err := rc.Config.readEnvFiles(environmentFiles(rc.Config.SecretFiles), nil)
+	if err != nil {
+		return err
+	}
+	vars, err := rc.Config.readEnvFiles(environmentFiles(rc.Config.VarFiles), nil)
+	if err != nil {
+		return err
+	}
+	rc.environmentSecrets, rc.environmentVars = secrets, vars
+	for _, value := range secrets {
+		rc.masks.add(value)
+	}
+	return nil
+}
+
 func mergeMaps(maps ...map[string]string) map[string]string {
 	rtnMap := make(map[string]string)
 	for _, m := range maps {
@@ -431,19 +1279,61 @@ type jobContext struct {
 	Services map[string]struct {
 		ID string `json:"id"`
 	} `json:"services"`
+	Environment map[string]string `json:"environment,omitempty"`
 }
 
 func (rc *RunContext) getJobContext() *jobContext {
 	jobStatus := "success"
+	if rc.started.IsZero() {
+		// the if of a job is evaluated before it starts, its status functions see the results of the jobs it needs
+		jobStatus = rc.needsStatus()
+	}
 	for _, stepStatus := range rc.StepResults {
 		if !stepStatus.Success {
 			jobStatus = "failure"
 			break
 		}
 	}
-	return &jobContext{
+	job := &jobContext{
 		Status: jobStatus,
 	}
+	if env := rc.environment(); env != nil {
+		job.Environment = map[string]string{
+			"name": env.Name,
+			"url":  env.URL,
+		}
+	}
+	return job
+}
+
+// needsStatus returns success if all the jobs the job needs succeeded, else failure if one of them failed,
+// cancelled if one was cancelled or skipped if one was skipped
+func (rc *RunContext) needsStatus() string {
+	status := "success"
+	for _, need := range rc.getNeedsContext() {
+		switch {
+		case need.Result == "failure":
+			return "failure"
+		case need.Result == "cancelled":
+			status = need.Result
+		case need.Result == "skipped" && status == "success":
+			status = need.Result
+		}
+	}
+	return status
+}
+
+func (rc *RunContext) getNeedsContext() map[string]*jobResult {
+	needs := make(map[string]*jobResult)
+	if rc.jobResults == nil {
+		return needs
+	}
+	for _, jobID := range rc.Run.Job().Needs() {
+		if result := rc.jobResults.get(rc.Run.Workflow, jobID); result != nil {
+			needs[jobID] = result
+		}
+	}
+	return needs
 }
 
 func (rc *RunContext) getStepsContext() map[string]*stepResult {
@@ -451,27 +1341,37 @@ func (rc *RunContext) getStepsContext() map[string]*stepResult {
 }
 
 type githubContext struct {
-	Event      map[string]interface{} `json:"event"`
-	EventPath  string                 `json:"event_path"`
-	Workflow   string                 `json:"workflow"`
-	RunID      string                 `json:"run_id"`
-	RunNumber  string                 `json:"run_number"`
-	Actor      string                 `json:"actor"`
-	Repository string                 `json:"repository"`
-	EventName  string                 `json:"event_name"`
-	Sha        string                 `json:"sha"`
-	Ref        string                 `json:"ref"`
-	HeadRef    string                 `json:"head_ref"`
-	BaseRef    string                 `json:"base_ref"`
-	Token      string                 `json:"token"`
-	Workspace  string                 `json:"workspace"`
-	Action     string                 `json:"action"`
+	Event       map[string]interface{} `json:"event"`
+	EventPath   string                 `json:"event_path"`
+	Workflow    string                 `json:"workflow"`
+	RunID       string                 `json:"run_id"`
+	RunNumber   string                 `json:"run_number"`
+	Actor       string                 `json:"actor"`
+	Repository  string                 `json:"repository"`
+	EventName   string                 `json:"event_name"`
+	Sha         string                 `json:"sha"`
+	Ref         string                 `json:"ref"`
+	RefName     string                 `json:"ref_name"`
+	RefType     string                 `json:"ref_type"`
+	HeadRef     string                 `json:"head_ref"`
+	BaseRef     string                 `json:"base_ref"`
+	Token       string                 `json:"token"`
+	Workspace   string                 `json:"workspace"`
+	Action      string                 `json:"action"`
+	ServerURL   string                 `json:"server_url"`
+	APIURL      string                 `json:"api_url"`
+	GraphQLURL  string                 `json:"graphql_url"`
+	Permissions map[string]string      `json:"permissions,omitempty"` // permissions of the GITHUB_TOKEN the workflow or job declares, not enforced
 }
 
 func (rc *RunContext) getGithubContext() *githubContext {
-	token, ok := rc.Config.Secrets["GITHUB_TOKEN"]
-	if !ok {
-		token = os.Getenv("GITHUB_TOKEN")
+	token := rc.Config.Token
+	if token == "" {
+		var ok bool
+		token, ok = rc.secrets()["GITHUB_TOKEN"]
+		if !ok {
+			token = os.Getenv("GITHUB_TOKEN")
+		}
 	}
 	runID := rc.Config.Env["GITHUB_RUN_ID"]
 	if runID == "" {
@@ -483,16 +1383,20 @@ func (rc *RunContext) getGithubContext() *githubContext {
 	}
 	ghc := &githubContext{
 		Event:     make(map[string]interface{}),
-		EventPath: fmt.Sprintf("%s/%s", rc.Config.ContainerWorkdir(), "workflow/event.json"),
+		EventPath: fmt.Sprintf("%s/%s", rc.containerWorkdir(), rc.workflowFile("event.json")),
 		Workflow:  rc.Run.Workflow.Name,
 		RunID:     runID,
 		RunNumber: runNumber,
 		Actor:     rc.Config.Actor,
 		EventName: rc.Config.EventName,
 		Token:     token,
-		Workspace: rc.Config.ContainerWorkdir(),
+		Workspace: rc.containerWorkdir(),
 		Action:    rc.CurrentStep,
 	}
+	ghc.ServerURL, ghc.APIURL, ghc.GraphQLURL = rc.Config.githubURLs()
+	if rc.Run.Job() != nil {
+		ghc.Permissions = rc.Run.Permissions()
+	}
 
 	// Backwards compatibility for configs that require
 	// a default rather than being run as a cmd
@@ -501,46 +1405,62 @@ func (rc *RunContext) getGithubContext() *githubContext {
 	}
 
 	repoPath := rc.Config.Workdir
-	repo, err := common.FindGithubRepo(repoPath)
-	if err != nil {
-		log.Warningf("unable to get git repo: %v", err)
-	} else {
-		ghc.Repository = repo
-	}
+	if !rc.Config.NoGitContext {
+		repo, err := common.FindGithubRepo(repoPath, rc.Config.githubInstance())
+		if err != nil {
+			rc.Config.logger().Warningf("unable to get git repo: %v", err)
+		} else {
+			ghc.Repository = repo
+		}
 
-	_, sha, err := common.FindGitRevision(repoPath)
-	if err != nil {
-		log.Warningf("unable to get git revision: %v", err)
-	} else {
-		ghc.Sha = sha
+		_, sha, err := common.FindGitRevision(repoPath)
+		if err != nil {
+			rc.Config.logger().Warningf("unable to get git revision: %v", err)
+		} else {
+			ghc.Sha = sha
+		}
 	}
 
 	if rc.EventJSON != "" {
-		err = json.Unmarshal([]byte(rc.EventJSON), &ghc.Event)
+		err := json.Unmarshal([]byte(rc.EventJSON), &ghc.Event)
 		if err != nil {
-			log.Errorf("Unable to Unmarshal event '%s': %v", rc.EventJSON, err)
+			rc.Config.logger().Errorf("Unable to Unmarshal event '%s': %v", rc.EventJSON, err)
 		}
 	}
 
-	maybeRef := nestedMapLookup(ghc.Event, ghc.EventName, "ref")
-	if maybeRef != nil {
-		log.Debugf("using github ref from event: %s", maybeRef)
-		ghc.Ref = maybeRef.(string)
-	} else {
+	if ref := eventRef(ghc.Event, ghc.EventName); ref != "" {
+		rc.Config.logger().Debugf("using github ref from event: %s", ref)
+		ghc.Ref = ref
+	} else if !rc.Config.NoGitContext {
 		ref, err := common.FindGitRef(repoPath)
 		if err != nil {
-			log.Warningf("unable to get git ref: %v", err)
+			rc.Config.logger().Warningf("unable to get git ref: %v", err)
 		} else {
-			log.Debugf("using github ref: %s", ref)
+			rc.Config.logger().Debugf("using github ref: %s", ref)
 			ghc.Ref = ref
 		}
+	}
 
-		// set the branch in the event data
-		if rc.Config.DefaultBranch != "" {
-			ghc.Event = withDefaultBranch(rc.Config.DefaultBranch, ghc.Event)
-		} else {
-			ghc.Event = withDefaultBranch("master", ghc.Event)
+	// set the branch in the event data, unless the event has it already
+	if rc.Config.DefaultBranch != "" {
+		ghc.Event = rc.withDefaultBranch(rc.Config.DefaultBranch, ghc.Event)
+	} else {
+		ghc.Event = rc.withDefaultBranch("master", ghc.Event)
+	}
+
+	// a scheduled run has the cron expression that triggered it, which is the first one here
+	if _, ok := ghc.Event["schedule"]; !ok && ghc.EventName == "schedule" && rc.Run != nil {
+		if crons := rc.Run.Workflow.Schedules(); len(crons) > 0 {
+			ghc.Event["schedule"] = crons[0]
+		}
+	}
+
+	if ghc.EventName == "workflow_dispatch" && len(rc.Inputs) > 0 {
+		eventInputs := make(map[string]interface{})
+		for k, v := range rc.Inputs {
+			eventInputs[k] = fmt.Sprintf("%v", v)
 		}
+		ghc.Event["inputs"] = eventInputs
 	}
 
 	if ghc.EventName == "pull_request" {
@@ -548,6 +1468,15 @@ func (rc *RunContext) getGithubContext() *githubContext {
 		ghc.HeadRef = asString(nestedMapLookup(ghc.Event, "pull_request", "head", "ref"))
 	}
 
+	// the short name of the branch or tag, like refs/heads/main is main
+	if strings.HasPrefix(ghc.Ref, "refs/tags/") {
+		ghc.RefName, ghc.RefType = strings.TrimPrefix(ghc.Ref, "refs/tags/"), "tag"
+	} else if strings.HasPrefix(ghc.Ref, "refs/heads/") {
+		ghc.RefName, ghc.RefType = strings.TrimPrefix(ghc.Ref, "refs/heads/"), "branch"
+	} else {
+		ghc.RefName = ghc.Ref
+	}
+
 	return ghc
 }
 
@@ -599,7 +1528,18 @@ func nestedMapLookup(m map[string]interface{}, ks ...string) (rval interface{})
 	}
 }
 
-func withDefaultBranch(b string, event map[string]interface{}) map[string]interface{} {
+// eventRef returns the fully qualified ref of the event payload, like the one of a push event
+func eventRef(event map[string]interface{}, eventName string) string {
+	if ref, ok := nestedMapLookup(event, "ref").(string); ok && strings.HasPrefix(ref, "refs/") {
+		return ref
+	}
+	if ref, ok := nestedMapLookup(event, eventName, "ref").(string); ok {
+		return ref
+	}
+	return ""
+}
+
+func (rc *RunContext) withDefaultBranch(b string, event map[string]interface{}) map[string]interface{} {
 	repoI, ok := event["repository"]
 	if !ok {
 		repoI = make(map[string]interface{})
@@ -607,7 +1547,7 @@ func withDefaultBranch(b string, event map[string]interface{}) map[string]interf
 
 	repo, ok := repoI.(map[string]interface{})
 	if !ok {
-		log.Warnf("unable to set default branch to %v", b)
+		rc.Config.logger().Warnf("unable to set default branch to %v", b)
 		return event
 	}
 
@@ -625,7 +1565,10 @@ func withDefaultBranch(b string, event map[string]interface{}) map[string]interf
 func (rc *RunContext) withGithubEnv(env map[string]string) map[string]string {
 	github := rc.getGithubContext()
 	env["CI"] = "true"
-	env["GITHUB_ENV"] = fmt.Sprintf("%s/%s", rc.Config.ContainerWorkdir(), "workflow/envs.txt")
+	for _, file := range stepFiles {
+		env[file.envName] = rc.stepFilePath(file.envName)
+	}
+	env["GITHUB_PATH"] = fmt.Sprintf("%s/%s", rc.containerWorkdir(), rc.workflowFile("paths.txt"))
 	env["GITHUB_WORKFLOW"] = github.Workflow
 	env["GITHUB_RUN_ID"] = github.RunID
 	env["GITHUB_RUN_NUMBER"] = github.RunNumber
@@ -638,10 +1581,12 @@ func (rc *RunContext) withGithubEnv(env map[string]string) map[string]string {
 	env["GITHUB_WORKSPACE"] = github.Workspace
 	env["GITHUB_SHA"] = github.Sha
 	env["GITHUB_REF"] = github.Ref
+	env["GITHUB_REF_NAME"] = github.RefName
+	env["GITHUB_REF_TYPE"] = github.RefType
 	env["GITHUB_TOKEN"] = github.Token
-	env["GITHUB_SERVER_URL"] = "https://github.com"
-	env["GITHUB_API_URL"] = "https://api.github.com"
-	env["GITHUB_GRAPHQL_URL"] = "https://api.github.com/graphql"
+	env["GITHUB_SERVER_URL"] = github.ServerURL
+	env["GITHUB_API_URL"] = github.APIURL
+	env["GITHUB_GRAPHQL_URL"] = github.GraphQLURL
 
 	job := rc.Run.Job()
 	if job.RunsOn() != nil {
@@ -2,42 +2,164 @@ package runner
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/joho/godotenv"
 	"github.com/nektos/act/pkg/common"
+	"github.com/nektos/act/pkg/container"
 	"github.com/nektos/act/pkg/model"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/semaphore"
 )
 
 // Runner provides capabilities to run GitHub actions
 type Runner interface {
 	NewPlanExecutor(plan *model.Plan) common.Executor
+	NewPlanExecutorWithResults(plan *model.Plan) (common.Executor, *PlanResult)
 }
 
 // Config contains the config for a new runner
 type Config struct {
-	Actor                 string            // the user that triggered the event
-	Workdir               string            // path to working directory
-	BindWorkdir           bool              // bind the workdir to the job container
-	EventName             string            // name of event to run
-	EventPath             string            // path to JSON file to use for event.json in containers
-	DefaultBranch         string            // name of the main branch for this repository
-	ReuseContainers       bool              // reuse containers to maintain state
-	ForcePull             bool              // force pulling of the image, even if already present
-	LogOutput             bool              // log the output from docker run
-	Env                   map[string]string // env for containers
-	Secrets               map[string]string // list of secrets
-	InsecureSecrets       bool              // switch hiding output when printing to terminal
-	Platforms             map[string]string // list of platforms
-	Privileged            bool              // use privileged mode
-	UsernsMode            string            // user namespace to use
-	ContainerArchitecture string            // Desired OS/architecture platform for running containers
-	UseGitIgnore          bool              // controls if paths in .gitignore should not be copied into container, default true
+	Actor                 string                              // the user that triggered the event
+	Workdir               string                              // path to working directory
+	BindWorkdir           bool                                // bind the workdir to the job container
+	BindHostPath          bool                                // with BindWorkdir, bind the workdir at its own path (the WSL path of a windows path) instead of ContainerWorkspace
+	ContainerWorkspace    string                              // path of the workspace in the job containers the workdir is copied or bound to, the path of the workdir if empty
+	EventName             string                              // name of event to run
+	EventPath             string                              // path to JSON file to use for event.json in containers
+	DefaultBranch         string                              // name of the main branch for this repository
+	ReuseContainers       bool                                // reuse containers to maintain state
+	ForcePull             bool                                // force pulling of the image, even if already present
+	ForcePullImages       []string                            // force pulling of the images matching these glob patterns, even if already present
+	LogOutput             bool                                // log the output from docker run
+	Env                   map[string]string                   // env for containers
+	StepEnvOverride       map[string]string                   // env of the steps that use an action, not of run steps, with the lowest precedence so the env of the workflow, the job and the step wins (e.g. FORCE_COLOR)
+	Secrets               map[string]string                   // list of secrets
+	InsecureSecrets       bool                                // INSECURE: don't mask the secrets and the values of ::add-mask:: in the output, e.g. to debug a secret
+	SecretPatterns        []string                            // regular expressions of values to mask in the output like secrets, e.g. of tokens that aren't in Secrets
+	Token                 string                              // token for github.token, GITHUB_TOKEN and cloning private remote actions, secrets.GITHUB_TOKEN defaults to it
+	GitHubInstance        string                              // host of the GitHub instance (e.g. github.mycompany.com for a GitHub Enterprise Server) for the github context and remote actions, github.com if empty
+	InsecureSkipTLS       bool                                // INSECURE: don't verify the TLS certificates of the servers remote actions are cloned from, e.g. of a GitHub Enterprise with a private CA
+	CABundle              string                              // path to a PEM file with the certificates of private CAs to verify the servers remote actions are cloned from with, besides those of the system
+	Platforms             map[string]string                   // list of platforms
+	PlatformPicker        PlatformPicker                      // picks the image of a job at runtime, e.g. from its labels and matrix, before Platforms is used
+	Privileged            bool                                // use privileged mode
+	UsernsMode            string                              // user namespace to use
+	ContainerArchitecture string                              // Desired OS/architecture platform for running containers
+	ContainerDaemonSocket string                              // socket of the daemon to create the containers with (e.g. unix:///run/user/1000/podman/podman.sock or tcp://host:2376), DOCKER_HOST or the docker socket, else the one of Podman, if empty
+	BindDaemonSocket      bool                                // INSECURE: bind the socket of the daemon to /var/run/docker.sock in the containers and set DOCKER_HOST to it, e.g. for docker build steps, the steps can control the daemon
+	UseGitIgnore          bool                                // controls if paths in .gitignore should not be copied into container, default true
+	StepDebug             map[string]bool                     // enable step debug output only for these steps, keyed by `job.step`
+	Inputs                map[string]string                   // inputs for the workflow_dispatch event
+	MaxJobParallelism     int                                 // maximum number of jobs to run at once, defaults to the number of CPUs
+	Concurrency           int                                 // maximum number of jobs running at once across all the plans of the runner, e.g. to limit the containers of parallel jobs and matrix legs, 0 is unlimited
+	ContainerOptions      string                              // extra docker create options for every container, applied before the workflow's `container.options`
+	EnvFiles              []EnvFile                           // files to read env from in order, later files override earlier ones and Env overrides them all
+	SecretFiles           []EnvFile                           // files to read secrets from in order, later files override earlier ones and Secrets overrides them all
+	Vars                  map[string]string                   // variables for the `vars` context, these are not masked in the output
+	VarFiles              []EnvFile                           // files to read vars from in order, later files override earlier ones and Vars overrides them all
+	StepOutputLimit       int                                 // capture up to this many bytes of the output of each step in its result, 0 disables capturing
+	StepOutputEnv         bool                                // expose the outputs of the previous steps to the later steps of the job as STEPS_<ID>_<OUTPUT> env vars, e.g. for scripts that can't use expressions
+	ActionCacheDir        string                              // directory to clone remote actions to, defaults to $XDG_CACHE_HOME/act
+	ActionCacheMaxSize    int64                               // evict the least recently used actions when the cache grows beyond this many bytes, 0 is unlimited
+	ToolCacheDir          string                              // directory on the host mounted as RUNNER_TOOL_CACHE, so the tools setup actions download are kept across runs, the tool cache of the image if empty
+	ActionRefConstraints  bool                                // resolve a semver constraint in the ref of a remote action, like org/action@^1.2.0, to the highest tag satisfying it
+	ActionRewrites        map[string]string                   // replaces the owner or owner/repo of remote actions before they are cloned, e.g. {"actions": "my-mirror"} clones actions/checkout@v4 from my-mirror/checkout@v4
+	EnvironmentSecrets    map[string]map[string]string        // secrets by environment name, merged over Secrets and the SecretFiles with the name appended (e.g. .secrets.production) for jobs that target the environment
+	EnvironmentVars       map[string]map[string]string        // vars by environment name, merged over Vars and the VarFiles with the name appended (e.g. .vars.production) for jobs that target the environment
+	OnWorkflowCommand     WorkflowCommandHandler              // called for every workflow command emitted by a step, before act handles it
+	ContainerMemory       string                              // default memory limit of every container (e.g. 512m), `--memory` in the container options overrides it
+	ContainerCPUs         string                              // default number of CPUs of every container (e.g. 2), `--cpus` in the container options overrides it
+	ContainerInit         bool                                // run an init process in every container that reaps zombie processes and forwards signals, `--init` in the container options overrides it
+	ContainerStopTimeout  time.Duration                       // time the processes of the containers have to exit after SIGTERM when they are removed, 3s if 0, killed at once if negative
+	PullRetries           int                                 // times to retry pulling an image that failed with a transient error like a timeout, not if it doesn't exist or the credentials are wrong
+	PullRetryBackoff      time.Duration                       // time to wait before the first retry of a pull, doubled for every further one, 2s if 0
+	RegistryCredentials   map[string]Credentials              // credentials to pull the images of docker actions with by registry host (e.g. ghcr.io), defaults to the docker config.json
+	DefaultImage          string                              // image for jobs whose runs-on labels match no platform, if empty these jobs fail
+	ListenAddr            string                              // address for servers the containers have to reach, detected from docker if empty
+	NoGitContext          bool                                // don't read the ref, sha and repository from the git repository in Workdir, e.g. if it isn't one
+	EnvExpressions        bool                                // evaluate the expressions in Env (e.g. ${{ github.ref_name }}) when a job starts, otherwise Env is used as is
+	ContainerDefaultShell string                              // shell that keeps the job container alive and runs steps without a shell (e.g. /bin/bash), bash or else sh is detected if empty
+	NeutralExitCode       int                                 // exit code (e.g. 78) that skips the step instead of failing it, like the neutral result of legacy actions, 0 disables it
+	AutoDetectEvent       bool                                // detect the event from the payload in EventPath if EventName is empty
+	MatrixOverride        map[string]map[string][]interface{} // matrixes (including include and exclude) by job id, each replaces the strategy.matrix of its job
+	BeforeStep            StepHook                            // called before every step that runs, e.g. to take measurements on the host
+	AfterStep             StepHook                            // called after every step that ran with its result
+	StrictStepHooks       bool                                // fail the step if BeforeStep or AfterStep return an error, otherwise the error is only logged
+	PostRun               PostRunHook                         // called once after the whole plan with its result, also when it failed or was cancelled
+	Events                chan<- RunEvent                     // receives an event when a job or step starts and completes and when the plan completed, the events queue up instead of blocking the jobs while it isn't read
+	DryRun                bool                                // log the commands and env of the steps that would run without creating containers or executing anything
+	JobID                 string                              // run only this job of the plan and the jobs it needs
+	NoDeps                bool                                // run JobID without the jobs it needs, it must not use their outputs
+	FailFastPlan          bool                                // abort the whole plan once a job fails, the running jobs are canceled and the ones that haven't started are skipped
+	Logger                *log.Logger                         // logger of the runner and the jobs, whose output, formatter, level and hooks are used instead of the global logger of logrus
+}
+
+// Credentials are a username and password, both can reference secrets (e.g. ${{ secrets.REGISTRY_TOKEN }})
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// EnvFile is a file in .env format to read variables from
+type EnvFile struct {
+	Path     string // path to the file
+	Optional bool   // skip the file if it doesn't exist instead of failing
+}
+
+// logger returns Logger or the global logger of logrus if it isn't set
+func (config *Config) logger() *log.Logger {
+	if config == nil || config.Logger == nil {
+		return log.StandardLogger()
+	}
+	return config.Logger
+}
+
+// daemonSocket returns ContainerDaemonSocket or DOCKER_HOST, empty if the daemon is detected
+func (config *Config) daemonSocket() string {
+	if config.ContainerDaemonSocket != "" {
+		return config.ContainerDaemonSocket
+	}
+	return os.Getenv("DOCKER_HOST")
+}
+
+// githubInstance returns GitHubInstance or github.com if it isn't set
+func (config *Config) githubInstance() string {
+	if config.GitHubInstance == "" {
+		return "github.com"
+	}
+	return config.GitHubInstance
+}
+
+// githubURLs returns the URLs of the server, the REST API and the GraphQL API of the GitHub instance.
+// A GitHub Enterprise Server serves its APIs under /api of the server instead of on api.github.com.
+func (config *Config) githubURLs() (string, string, string) {
+	instance := config.githubInstance()
+	if instance == "github.com" {
+		return "https://github.com", "https://api.github.com", "https://api.github.com/graphql"
+	}
+	server := "https://" + instance
+	return server, server + "/api/v3", server + "/api/graphql"
+}
+
+// absWorkdir returns Workdir as an absolute path, so the paths in it don't depend on the directory act runs in
+func (config *Config) absWorkdir() string {
+	workdir, err := filepath.Abs(config.Workdir)
+	if err != nil {
+		return config.Workdir
+	}
+	return workdir
 }
 
 // Resolves the equivalent host path inside the container
@@ -45,13 +167,13 @@ type Config struct {
 // For use in docker volumes and binds
 func (config *Config) containerPath(path string) string {
 	if runtime.GOOS == "windows" && strings.Contains(path, "/") {
-		log.Error("You cannot specify linux style local paths (/mnt/etc) on Windows as it does not understand them.")
+		config.logger().Error("You cannot specify linux style local paths (/mnt/etc) on Windows as it does not understand them.")
 		return ""
 	}
 
 	abspath, err := filepath.Abs(path)
 	if err != nil {
-		log.Error(err)
+		config.logger().Error(err)
 		return ""
 	}
 
@@ -74,6 +196,15 @@ func (config *Config) containerPath(path string) string {
 	return result
 }
 
+// ServerAddress returns where servers for the containers (e.g. for artifacts or caches) listen and the host the
+// containers reach them at. ListenAddr is used for both if it is set, otherwise they are detected from docker.
+func (config *Config) ServerAddress(ctx context.Context) (container.ServerAddress, error) {
+	if config.ListenAddr != "" {
+		return container.ServerAddress{ListenAddr: config.ListenAddr, Host: config.ListenAddr}, nil
+	}
+	return container.DetectServerAddress(ctx)
+}
+
 // Resolves the equivalent host path inside the container
 // This is required for windows and WSL 2 to translate things like C:\Users\Myproject to /mnt/users/Myproject
 func (config *Config) ContainerWorkdir() string {
@@ -81,67 +212,623 @@ func (config *Config) ContainerWorkdir() string {
 }
 
 type runnerImpl struct {
-	config    *Config
-	eventJSON string
+	config         *Config
+	eventJSON      string
+	jobResults     *jobResults // the results of the run of the plan, nil outside of one, see newExecution
+	events         *eventQueue
+	secretPatterns []*regexp.Regexp
+	majorVersions  *common.MajorVersionCache // the shas of the major versions of the remote actions of the run of the plan, see newExecution
+	jobSlots       *semaphore.Weighted       // the jobs running of all the plans, nil if Config.Concurrency is unlimited
+	callInputs     map[string]interface{}    // the inputs of the call if this runs a reusable workflow, see workflowCallExecutor
+}
+
+// jobResult is the result of a job as seen by the jobs that need it
+type jobResult struct {
+	Result  string            `json:"result"`
+	Outputs map[string]string `json:"outputs"`
+}
+
+// jobResults collects the results of the jobs of a run of a plan, keyed by workflow and job id
+type jobResults struct {
+	mu      sync.Mutex
+	results map[*model.Workflow]map[string]*jobResult
+	runs    []JobRunResult
+}
+
+// resultRank orders the results of the runs of a matrix job, the combined result is the one with the highest rank
+var resultRank = map[string]int{"skipped": 0, "success": 1, "cancelled": 2, "failure": 3}
+
+// add records the result of one run of a job. The runs of a matrix job are combined: the job
+// fails if any run fails, else it is cancelled if any run was cancelled, and the outputs of later
+// runs override the ones of earlier runs.
+func (jr *jobResults) add(workflow *model.Workflow, jobID string, result string, outputs map[string]string, run JobRunResult) {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+
+	jr.runs = append(jr.runs, run)
+
+	if jr.results == nil {
+		jr.results = make(map[*model.Workflow]map[string]*jobResult)
+	}
+	if jr.results[workflow] == nil {
+		jr.results[workflow] = make(map[string]*jobResult)
+	}
+	existing, ok := jr.results[workflow][jobID]
+	if !ok {
+		existing = &jobResult{Result: result, Outputs: make(map[string]string)}
+		jr.results[workflow][jobID] = existing
+	}
+	if resultRank[result] > resultRank[existing.Result] {
+		existing.Result = result
+	}
+	for k, v := range outputs {
+		if v != "" {
+			existing.Outputs[k] = v
+		}
+	}
+}
+
+func (jr *jobResults) get(workflow *model.Workflow, jobID string) *jobResult {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+
+	if result, ok := jr.results[workflow][jobID]; ok {
+		return &jobResult{Result: result.Result, Outputs: mergeMaps(result.Outputs)}
+	}
+	return nil
 }
 
 // New Creates a new Runner
 func New(runnerConfig *Config) (Runner, error) {
+	if runnerConfig.EventName != "" {
+		if err := model.ValidateEventName(runnerConfig.EventName); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := container.ValidateResourceLimits(runnerConfig.ContainerMemory, runnerConfig.ContainerCPUs); err != nil {
+		return nil, err
+	}
+
+	if err := container.ValidateDaemonSocket(runnerConfig.daemonSocket()); err != nil {
+		return nil, err
+	}
+
+	// the path is in the linux job containers, also when act runs on windows
+	if runnerConfig.ContainerWorkspace != "" && !path.IsAbs(runnerConfig.ContainerWorkspace) {
+		return nil, fmt.Errorf("the container workspace '%s' isn't an absolute path", runnerConfig.ContainerWorkspace)
+	}
+
+	env, err := runnerConfig.readEnvFiles(runnerConfig.EnvFiles, runnerConfig.Env)
+	if err != nil {
+		return nil, err
+	}
+	runnerConfig.Env = env
+
+	secrets, err := runnerConfig.readEnvFiles(runnerConfig.SecretFiles, runnerConfig.Secrets)
+	if err != nil {
+		return nil, err
+	}
+	runnerConfig.Secrets = secrets
+	if _, ok := runnerConfig.Secrets["GITHUB_TOKEN"]; !ok && runnerConfig.Token != "" {
+		runnerConfig.Secrets = map[string]string{"GITHUB_TOKEN": runnerConfig.Token}
+		for k, v := range secrets {
+			runnerConfig.Secrets[k] = v
+		}
+	}
+
+	vars, err := runnerConfig.readEnvFiles(runnerConfig.VarFiles, runnerConfig.Vars)
+	if err != nil {
+		return nil, err
+	}
+	runnerConfig.Vars = vars
+
 	runner := &runnerImpl{
 		config: runnerConfig,
+		events: newEventQueue(runnerConfig.Events),
+	}
+	for _, pattern := range runnerConfig.SecretPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid secret pattern '%s': %w", pattern, err)
+		}
+		if re.MatchString("") {
+			// it would put *** between every character of the output
+			return nil, fmt.Errorf("invalid secret pattern '%s': it matches the empty string", pattern)
+		}
+		runner.secretPatterns = append(runner.secretPatterns, re)
+	}
+	if runnerConfig.Token != "" {
+		// masked even if secrets.GITHUB_TOKEN is another token
+		runner.secretPatterns = append(runner.secretPatterns, regexp.MustCompile(regexp.QuoteMeta(runnerConfig.Token)))
+	}
+
+	if runnerConfig.Concurrency > 0 {
+		runner.jobSlots = semaphore.NewWeighted(int64(runnerConfig.Concurrency))
+	}
+
+	if runnerConfig.daemonSocket() == "" {
+		if socket := container.DetectDaemonSocket(); socket != "" {
+			runnerConfig.logger().Infof("Using Podman at %s, there is no docker daemon at %s", socket, container.DefaultDockerSocket)
+		}
+	}
+
+	if runnerConfig.BindDaemonSocket {
+		runnerConfig.logger().Warn("\u26a0  The socket of the container daemon is bound into the containers, the steps can start containers as root on the host of the daemon, only use it with workflows you trust")
+	}
+
+	if runnerConfig.InsecureSecrets {
+		runnerConfig.logger().Warn("\u26a0  The secrets and the values of ::add-mask:: are not masked in the output, don't share the logs or run this in CI")
+	}
+
+	if runnerConfig.InsecureSkipTLS {
+		runnerConfig.logger().Warn("\u26a0  The TLS certificates of the servers remote actions are cloned from aren't verified")
 	}
 
 	runner.eventJSON = "{}"
-	if runnerConfig.EventPath != "" {
-		log.Debugf("Reading event.json from %s", runner.config.EventPath)
+	if runnerConfig.EventPath == "" && !runnerConfig.NoGitContext {
+		runner.eventJSON = gitEventPayload(runnerConfig)
+	} else if runnerConfig.EventPath != "" {
+		runnerConfig.logger().Debugf("Reading event.json from %s", runner.config.EventPath)
 		eventJSONBytes, err := ioutil.ReadFile(runner.config.EventPath)
 		if err != nil {
 			return nil, err
 		}
 		runner.eventJSON = string(eventJSONBytes)
+		if runnerConfig.AutoDetectEvent {
+			if err := runner.detectEventName(); err != nil {
+				return nil, err
+			}
+		}
 	}
 	return runner, nil
 }
 
+// detectEventName sets an empty Config.EventName to the event detected from the payload
+func (runner *runnerImpl) detectEventName() error {
+	eventName, err := resolveEventName([]byte(runner.eventJSON), runner.config.EventPath, runner.config.EventName, runner.config.logger())
+	if err != nil {
+		return err
+	}
+	runner.config.EventName = eventName
+	return nil
+}
+
+// ResolveEventName returns the event of the payload in eventPath, like Config.AutoDetectEvent does: eventName
+// if it is set, else the event detected from the payload. If the payload matches no event or several, it
+// returns eventName or an error if it is empty.
+func ResolveEventName(eventPath string, eventName string, logger log.FieldLogger) (string, error) {
+	content, err := ioutil.ReadFile(eventPath)
+	if err != nil {
+		return "", err
+	}
+	return resolveEventName(content, eventPath, eventName, logger)
+}
+
+func resolveEventName(content []byte, eventPath string, eventName string, logger log.FieldLogger) (string, error) {
+	detected, reason, err := model.DetectEventName(content)
+	switch {
+	case err != nil && eventName != "":
+		logger.Infof("Using event %s, %v", eventName, err)
+	case err != nil:
+		return "", fmt.Errorf("unable to detect the event of %s: %w", eventPath, err)
+	case eventName == "":
+		logger.Infof("Using event %s detected from %s, %s", detected, eventPath, reason)
+		return detected, nil
+	case !strings.HasPrefix(eventName, detected):
+		// a pull_request_target has the same payload as a pull_request
+		logger.Warnf("Using event %s, but %s looks like a %s event, %s", eventName, eventPath, detected, reason)
+	}
+	return eventName, nil
+}
+
+// readEnvFiles reads the files in order and merges them with values, which take precedence over the files
+func (config *Config) readEnvFiles(files []EnvFile, values map[string]string) (map[string]string, error) {
+	if len(files) == 0 {
+		return values, nil
+	}
+
+	merged := make(map[string]string)
+	for _, file := range files {
+		if _, err := os.Stat(file.Path); os.IsNotExist(err) && file.Optional {
+			config.logger().Debugf("Skipping optional file %s, it does not exist", file.Path)
+			continue
+		}
+		config.logger().Debugf("Loading variables from %s", file.Path)
+		vars, err := godotenv.Read(file.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file.Path, err)
+		}
+		for k, v := range vars {
+			merged[k] = v
+		}
+	}
+	for k, v := range values {
+		merged[k] = v
+	}
+	return merged, nil
+}
+
 func (runner *runnerImpl) NewPlanExecutor(plan *model.Plan) common.Executor {
+	return func(ctx context.Context) error {
+		return runner.newExecution().newPlanExecutor(plan)(ctx)
+	}
+}
+
+// newExecution returns a copy of the runner for one run of a plan executor. Each run, e.g. the ones of --watch
+// or of plans running at the same time, collects the results of its jobs in its own jobResults. The major
+// versions of the remote actions are resolved again in each run, to the tags they were moved to since.
+func (runner *runnerImpl) newExecution() *runnerImpl {
+	execution := *runner
+	execution.jobResults = &jobResults{}
+	execution.majorVersions = &common.MajorVersionCache{}
+	return &execution
+}
+
+func (runner *runnerImpl) newPlanExecutor(plan *model.Plan) common.Executor {
+	if runner.config.JobID != "" {
+		filtered, err := plan.FilterJob(runner.config.JobID, runner.config.NoDeps)
+		if err != nil {
+			return runner.wrapPlanExecutor(common.NewErrorExecutor(err))
+		}
+		plan = filtered
+	}
+	// each run of the executor, e.g. the ones of --watch, aborts for its own failures only
+	return runner.wrapPlanExecutor(runner.withDaemonCheck(plan, func(ctx context.Context) error {
+		return runner.newStagesExecutor(plan, runner.newPlanAbort())(ctx)
+	}))
+}
+
+// newStagesExecutor returns the executor that runs the jobs of the stages of plan, the jobs of the
+// reusable workflows they call run in it too. abort is nil unless Config.FailFastPlan is set.
+func (runner *runnerImpl) newStagesExecutor(plan *model.Plan, abort *planAbort) common.Executor {
 	maxJobNameLen := 0
 
+	maxParallel := runner.config.MaxJobParallelism
+	if maxParallel <= 0 {
+		maxParallel = runtime.NumCPU()
+	}
+
+	checkedWorkflows := make(map[*model.Workflow]bool)
+	concurrencyGroups := make([]string, 0)
 	pipeline := make([]common.Executor, 0)
 	for _, stage := range plan.Stages {
-		stageExecutor := make([]common.Executor, 0)
 		for _, run := range stage.Runs {
-			job := run.Job()
-			matrixes := job.GetMatrixes()
+			if !checkedWorkflows[run.Workflow] {
+				checkedWorkflows[run.Workflow] = true
+				if err := model.CheckWorkflowCalls(runner.config.Workdir, run.Workflow); err != nil {
+					return common.NewErrorExecutor(err)
+				}
+				group, err := runner.workflowConcurrencyGroup(run)
+				if err != nil {
+					return common.NewErrorExecutor(err)
+				}
+				if group != "" {
+					concurrencyGroups = append(concurrencyGroups, group)
+				}
+			}
 
-			for i, matrix := range matrixes {
-				rc := runner.newRunContext(run, matrix)
-				if len(matrixes) > 1 {
-					rc.Name = fmt.Sprintf("%s-%d", rc.Name, i+1)
+			// the names of the runs of a matrix with expressions are only known once the stage runs
+			if rcs, err := runner.newRunContexts(run, nil); err == nil {
+				for _, rc := range rcs {
+					if len(rc.String()) > maxJobNameLen {
+						maxJobNameLen = len(rc.String())
+					}
 				}
-				if len(rc.String()) > maxJobNameLen {
-					maxJobNameLen = len(rc.String())
+			}
+		}
+
+		stage := stage
+		pipeline = append(pipeline, abort.stage(func(ctx context.Context) error {
+			// the matrixes are evaluated now that the jobs of the earlier stages, whose outputs they can use, are done
+			stageExecutor := make([]common.Executor, 0)
+			for _, run := range stage.Runs {
+				rcs, err := runner.newRunContexts(run, runner.matrixEvaluator(run))
+				if err != nil {
+					return err
+				}
+				for _, rc := range rcs {
+					rc := rc
+					stageExecutor = append(stageExecutor, func(ctx context.Context) error {
+						jobName := fmt.Sprintf("%-*s", maxJobNameLen, rc.String())
+						jobExecutor := rc.Executor()
+						// the jobs of the called workflow take the slots
+						if rc.workflowCall == nil {
+							jobExecutor = runner.withJobSlot(jobExecutor)
+						}
+						return abort.job(rc, jobExecutor)(withJobLogger(ctx, rc.Config.Logger, jobName, rc.maskedSecrets(), rc.secretPatterns, rc.masks, rc.Config.InsecureSecrets))
+					})
 				}
-				stageExecutor = append(stageExecutor, func(ctx context.Context) error {
-					jobName := fmt.Sprintf("%-*s", maxJobNameLen, rc.String())
-					return rc.Executor()(WithJobLogger(ctx, jobName, rc.Config.Secrets, rc.Config.InsecureSecrets))
-				})
+			}
+			return common.NewLimitedParallelExecutor(maxParallel, stageExecutor...)(ctx)
+		}))
+	}
+
+	return withConcurrency(concurrencyGroups, abort.plan(runStages(pipeline...)))
+}
+
+// runStages runs the stages of a plan one after the other and returns the first error. The stages after a
+// failure still run, their jobs are skipped unless their if runs them after a job they need didn't succeed.
+func runStages(stages ...common.Executor) common.Executor {
+	return func(ctx context.Context) error {
+		var err error
+		for _, stage := range stages {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if stageErr := stage(ctx); stageErr != nil && err == nil {
+				err = stageErr
+			}
+		}
+		return err
+	}
+}
+
+// workflowConcurrencyGroup evaluates the concurrency group of the workflow of run, on GitHub it sees
+// the github, inputs and vars contexts
+func (runner *runnerImpl) workflowConcurrencyGroup(run *model.Run) (string, error) {
+	concurrency := run.Workflow.Concurrency()
+	if concurrency == nil {
+		return "", nil
+	}
+	inputs, err := runner.workflowDispatchInputs(run.Workflow)
+	if err != nil {
+		return "", err
+	}
+	rc := runner.newRunContext(run, make(map[string]interface{}), inputs)
+	return rc.concurrencyGroup(common.WithLogger(context.Background(), runner.config.logger()), concurrency), nil
+}
+
+// withJobSlot runs jobExecutor once fewer than Config.Concurrency jobs of the plans of the runner are running.
+// This can't deadlock: a job only needs the jobs of earlier stages, which are done before its stage starts,
+// so a job never waits for a slot that is held by a job waiting for it.
+func (runner *runnerImpl) withJobSlot(jobExecutor common.Executor) common.Executor {
+	if runner.jobSlots == nil {
+		return jobExecutor
+	}
+	return func(ctx context.Context) error {
+		if !runner.jobSlots.TryAcquire(1) {
+			common.Logger(ctx).Debugf("Waiting for one of the %d jobs running to finish", runner.config.Concurrency)
+			if err := runner.jobSlots.Acquire(ctx, 1); err != nil {
+				return err
 			}
 		}
-		pipeline = append(pipeline, common.NewParallelExecutor(stageExecutor...))
+		defer runner.jobSlots.Release(1)
+		return jobExecutor(ctx)
 	}
+}
+
+// wrapPlanExecutor runs the executor of a plan as a dry run if Config.DryRun is set, followed by Config.PostRun and the PlanCompleted event.
+// What isn't logged by a job is logged to Config.Logger if it is set. The containers are created with the
+// daemon at Config.ContainerDaemonSocket.
+func (runner *runnerImpl) wrapPlanExecutor(planExecutor common.Executor) common.Executor {
+	executor := runner.withDryRun(runner.withPlanEvent(runner.withPostRun(planExecutor)))
+	return func(ctx context.Context) error {
+		if runner.config.Logger != nil {
+			ctx = common.WithLogger(ctx, runner.config.Logger)
+		}
+		if runner.config.ContainerDaemonSocket != "" {
+			ctx = container.WithDaemonSocket(ctx, runner.config.ContainerDaemonSocket)
+		}
+		return executor(ctx)
+	}
+}
+
+// withDaemonCheck fails the plan before its first job if the daemon at Config.ContainerDaemonSocket or
+// DOCKER_HOST doesn't answer and a job of plan needs a container. A daemon that is detected isn't checked.
+func (runner *runnerImpl) withDaemonCheck(plan *model.Plan, planExecutor common.Executor) common.Executor {
+	if runner.config.daemonSocket() == "" || !runner.needsContainers(plan) {
+		return planExecutor
+	}
+	return func(ctx context.Context) error {
+		if !common.Dryrun(ctx) {
+			if err := container.CheckDaemon(ctx); err != nil {
+				return err
+			}
+		}
+		return planExecutor(ctx)
+	}
+}
 
-	return common.NewPipelineExecutor(pipeline...)
+// needsContainers returns true unless every job of plan runs on the host without `docker://` steps.
+// A job whose platform isn't known before it runs, e.g. one that calls a reusable workflow, needs them.
+// The docker actions of the steps are only known once they run, they fail then without a daemon.
+func (runner *runnerImpl) needsContainers(plan *model.Plan) bool {
+	for _, stage := range plan.Stages {
+		for _, run := range stage.Runs {
+			rcs, err := runner.newRunContexts(run, nil)
+			if err != nil {
+				return true
+			}
+			for _, rc := range rcs {
+				if !rc.runsOnHost() {
+					return true
+				}
+			}
+			for _, step := range run.Job().Steps {
+				if step.Type() == model.StepTypeUsesDockerURL {
+					return true
+				}
+			}
+		}
+	}
+	return false
 }
 
-func (runner *runnerImpl) newRunContext(run *model.Run, matrix map[string]interface{}) *RunContext {
+// newRunContexts returns a RunContext for each combination of the matrix of the job of run
+func (runner *runnerImpl) newRunContexts(run *model.Run, evaluate model.MatrixEvaluator) ([]*RunContext, error) {
+	inputs, err := runner.workflowDispatchInputs(run.Workflow)
+	if err != nil {
+		return nil, err
+	}
+
+	// the legs of a matrix share the steps of the job and run at the same time, so the steps without an id get theirs before
+	for i, step := range run.Job().Steps {
+		if step.ID == "" {
+			step.ID = fmt.Sprintf("%d", i)
+		}
+	}
+
+	// a job that is skipped because of the jobs it needs isn't expanded, its matrix can use the outputs they didn't set
+	if evaluate != nil {
+		rc := runner.newRunContext(run, make(map[string]interface{}), inputs)
+		if _, skipped := rc.skippedByNeeds(); skipped {
+			return []*RunContext{rc}, nil
+		}
+	}
+
+	var matrixes []map[string]interface{}
+	if job, override := run.Job(), runner.config.MatrixOverride[run.JobID]; override != nil && job.Strategy != nil && job.Strategy.RawMatrix.Kind != 0 {
+		runner.config.logger().Debugf("Using the matrix override instead of the matrix of %s", run.String())
+		matrixes, err = model.ExpandMatrix(override)
+	} else {
+		matrixes, err = job.GetMatrixes(evaluate)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to evaluate the matrix of %s: %w", run.String(), err)
+	}
+
+	rcs := make([]*RunContext, 0, len(matrixes))
+	for i, matrix := range matrixes {
+		rc := runner.newRunContext(run, matrix, inputs)
+		if len(matrixes) > 1 {
+			rc.Name = fmt.Sprintf("%s-%d", rc.Name, i+1)
+		}
+		if run.Job().Uses != "" {
+			rc.workflowCall = runner.workflowCallExecutor(rc)
+		}
+		rcs = append(rcs, rc)
+	}
+	return rcs, nil
+}
+
+// matrixEvaluator evaluates the expressions in the matrix of the job of run, which see the same
+// contexts as the job except for `matrix`. The value of an expression is converted with toJSON, so
+// objects and arrays like the ones fromJSON returns keep their structure.
+func (runner *runnerImpl) matrixEvaluator(run *model.Run) model.MatrixEvaluator {
+	return func(expression string) (interface{}, error) {
+		inputs, err := runner.workflowDispatchInputs(run.Workflow)
+		if err != nil {
+			return nil, err
+		}
+		rc := runner.newRunContext(run, make(map[string]interface{}), inputs)
+		expression = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(expression), "${{"), "}}")
+		value, _, err := rc.ExprEval.Evaluate(fmt.Sprintf("toJSON(%s)", expression))
+		if err != nil {
+			return nil, err
+		}
+
+		var result interface{}
+		if value == "" {
+			return result, nil
+		}
+		if err := json.Unmarshal([]byte(value), &result); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+}
+
+func (runner *runnerImpl) newRunContext(run *model.Run, matrix map[string]interface{}, inputs map[string]interface{}) *RunContext {
 	rc := &RunContext{
 		Config:      runner.config,
 		Run:         run,
 		EventJSON:   runner.eventJSON,
 		StepResults: make(map[string]*stepResult),
 		Matrix:      matrix,
+		Inputs:      inputs,
+		jobResults:  runner.jobResults,
+		events:      runner.events,
+		masks:       &addedMasks{},
+
+		secretPatterns: runner.secretPatterns,
+		majorVersions:  runner.majorVersions,
 	}
+	rc.resolveEnvironment()
 	rc.ExprEval = rc.NewExpressionEvaluator()
+	if rc.Config.EnvExpressions && len(rc.Config.Env) > 0 {
+		rc.interpolateConfigEnv()
+	}
 	rc.Name = rc.ExprEval.Interpolate(run.String())
 	return rc
 }
+
+// workflowDispatchInputs resolves the inputs of a workflow_dispatch event from the config, the event payload
+// and the defaults declared in the workflow, in that order. Values are converted according to the input type.
+func (runner *runnerImpl) workflowDispatchInputs(w *model.Workflow) (map[string]interface{}, error) {
+	// the jobs of a reusable workflow see the inputs of its call instead
+	if runner.callInputs != nil {
+		return runner.callInputs, nil
+	}
+	inputs := make(map[string]interface{})
+	if runner.config.EventName != "workflow_dispatch" {
+		return inputs, nil
+	}
+	dispatch := w.WorkflowDispatchConfig()
+	if dispatch == nil {
+		return inputs, nil
+	}
+
+	var event map[string]interface{}
+	if err := json.Unmarshal([]byte(runner.eventJSON), &event); err != nil {
+		return nil, err
+	}
+	eventInputs, _ := event["inputs"].(map[string]interface{})
+
+	for name, input := range dispatch.Inputs {
+		value, ok := runner.config.Inputs[name]
+		if !ok {
+			if eventValue, found := eventInputs[name]; found {
+				value, ok = fmt.Sprintf("%v", eventValue), true
+			}
+		}
+		if !ok || value == "" {
+			if input.Required && input.Default == "" {
+				return nil, fmt.Errorf("Input '%s' is required for workflow '%s'", name, w.Name)
+			}
+			value = input.Default
+		}
+
+		typed, err := typedInput(name, input.Type, value, input.Options)
+		if err != nil {
+			return nil, err
+		}
+		inputs[name] = typed
+	}
+	return inputs, nil
+}
+
+// typedInput converts the value of input name to its type, a boolean, number or one of the options of a choice
+func typedInput(name string, inputType string, value string, options []string) (interface{}, error) {
+	switch inputType {
+	case "boolean":
+		b, err := strconv.ParseBool(value)
+		if value == "" {
+			b, err = false, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Input '%s' must be a boolean, got '%s'", name, value)
+		}
+		return b, nil
+	case "number":
+		n, err := strconv.ParseFloat(value, 64)
+		if value == "" {
+			n, err = 0, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Input '%s' must be a number, got '%s'", name, value)
+		}
+		return n, nil
+	case "choice":
+		valid := value == ""
+		for _, option := range options {
+			if option == value {
+				valid = true
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("Input '%s' must be one of %v, got '%s'", name, options, value)
+		}
+	}
+	return value, nil
+}
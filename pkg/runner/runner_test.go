@@ -1,21 +1,79 @@
 package runner
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io/ioutil"
+	"net"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/joho/godotenv"
 	log "github.com/sirupsen/logrus"
 	"gotest.tools/v3/assert"
 
+	"github.com/nektos/act/pkg/container"
 	"github.com/nektos/act/pkg/model"
 )
 
+// hostWorkdir returns a temporary working directory for jobs on the host, it is removed after the test
+func hostWorkdir(t *testing.T) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the jobs run on the host")
+	}
+	workdir, err := ioutil.TempDir("", "act-host")
+	assert.NilError(t, err)
+	t.Cleanup(func() { os.RemoveAll(workdir) })
+	return workdir
+}
+
+// runHostWorkflow runs the workflow at path with its jobs on the host and returns the result of the plan.
+// The event is push and the workdir a hostWorkdir unless config sets them.
+func runHostWorkflow(t *testing.T, config *Config, path string) (*PlanResult, error) {
+	t.Helper()
+	if config.Workdir == "" {
+		config.Workdir = hostWorkdir(t)
+	}
+	if config.EventName == "" {
+		config.EventName = "push"
+	}
+	config.Platforms = map[string]string{"ubuntu-latest": container.HostImage}
+
+	runner, err := New(config)
+	assert.NilError(t, err)
+	planner, err := model.NewWorkflowPlanner(path, true)
+	assert.NilError(t, err)
+
+	planExecutor, result := runner.NewPlanExecutorWithResults(planner.PlanEvent(config.EventName))
+	return result, planExecutor(context.Background())
+}
+
+// copyTestAction copies the action testdata/actions/name to the workdir, where `uses: ./actions/name` finds it
+func copyTestAction(t *testing.T, workdir string, name string) {
+	t.Helper()
+	actionDir := filepath.Join(workdir, "actions", name)
+	assert.NilError(t, os.MkdirAll(actionDir, 0755))
+	files, err := ioutil.ReadDir(filepath.Join("testdata", "actions", name))
+	assert.NilError(t, err)
+	for _, file := range files {
+		body, err := ioutil.ReadFile(filepath.Join("testdata", "actions", name, file.Name()))
+		assert.NilError(t, err)
+		assert.NilError(t, ioutil.WriteFile(filepath.Join(actionDir, file.Name()), body, 0644))
+	}
+}
+
 func TestGraphEvent(t *testing.T) {
 	planner, err := model.NewWorkflowPlanner("testdata/basic", true)
 	assert.NilError(t, err)
@@ -82,6 +140,8 @@ func TestRunEvent(t *testing.T) {
 
 	platforms := map[string]string{
 		"ubuntu-latest": "node:12.20.1-buster-slim",
+		"ubuntu-18.04":  "node:12.20.1-buster-slim",
+		"macos-latest":  "",
 	}
 
 	tables := []TestJobFileInfo{
@@ -90,6 +150,7 @@ func TestRunEvent(t *testing.T) {
 		{"testdata", "runs-on", "push", "", platforms, ""},
 		// Pwsh is not available in default worker (yet) so we use a separate image for testing
 		{"testdata", "powershell", "push", "", map[string]string{"ubuntu-latest": "ghcr.io/justingrote/act-pwsh:latest"}, ""},
+		{"testdata", "shells", "push", "", map[string]string{"ubuntu-latest": "python:3-slim"}, ""},
 		{"testdata", "job-container", "push", "", platforms, ""},
 		{"testdata", "job-container-non-root", "push", "", platforms, ""},
 		{"testdata", "uses-docker-url", "push", "", platforms, ""},
@@ -97,13 +158,18 @@ func TestRunEvent(t *testing.T) {
 		{"testdata", "remote-action-js", "push", "", platforms, ""},
 		{"testdata", "local-action-docker-url", "push", "", platforms, ""},
 		{"testdata", "local-action-dockerfile", "push", "", platforms, ""},
+		{"testdata", "local-action-docker-args", "push", "", platforms, ""},
+		{"testdata", "local-action-docker-inputs", "push", "", platforms, ""},
 		{"testdata", "local-action-js", "push", "", platforms, ""},
+		{"testdata", "uses-action-with-pre-and-post", "push", "", platforms, ""},
 		{"testdata", "matrix", "push", "", platforms, ""},
 		{"testdata", "matrix-include-exclude", "push", "", platforms, ""},
 		{"testdata", "commands", "push", "", platforms, ""},
 		{"testdata", "workdir", "push", "", platforms, ""},
 		{"testdata", "defaults-run", "push", "", platforms, ""},
+		{"testdata", "needs-outputs", "push", "", platforms, ""},
 		{"testdata", "uses-composite", "push", "", platforms, ""},
+		{"testdata", "uses-composite-with-error", "push", "Required property is missing: 'shell'", platforms, ""},
 		{"testdata", "issue-597", "push", "", platforms, ""},
 		{"testdata", "issue-598", "push", "", platforms, ""},
 		// {"testdata", "issue-228", "push", "", platforms, ""}, // TODO [igni]: Remove this once everything passes
@@ -122,6 +188,64 @@ func TestRunEvent(t *testing.T) {
 	}
 }
 
+// TestRunEventPodman runs trivial workflows with the Docker compatible API of Podman, if it is listening
+func TestRunEventPodman(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	socket := container.PodmanSocket()
+	if socket == "" {
+		t.Skip("podman isn't listening")
+	}
+
+	platforms := map[string]string{
+		"ubuntu-latest": "node:12.20.1-buster-slim",
+	}
+	tables := []TestJobFileInfo{
+		{"testdata", "basic", "push", "", platforms, ""},
+		{"testdata", "job-container", "push", "", platforms, ""},
+		{"testdata", "local-action-dockerfile", "push", "", platforms, ""},
+	}
+
+	ctx := container.WithDaemonSocket(context.Background(), socket)
+	for _, table := range tables {
+		runTestJobFile(ctx, t, table, map[string]string{})
+	}
+}
+
+// TestRunContainerShell runs a job in an image that has bash but no sh, tail or any other program with
+// --container-shell, the shell alone keeps the job container alive
+func TestRunContainerShell(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	ctx := context.Background()
+	if err := container.CheckDaemon(ctx); err != nil {
+		t.Skip(err)
+	}
+
+	image := "act-test-bash-only:latest"
+	err := container.NewDockerBuildExecutor(container.NewDockerBuildExecutorInput{
+		ContextDir: "testdata/container-shell",
+		ImageTag:   image,
+	})(ctx)
+	assert.NilError(t, err)
+
+	runner, err := New(&Config{
+		Workdir:               "testdata",
+		EventName:             "push",
+		Platforms:             map[string]string{"ubuntu-latest": image},
+		ContainerDefaultShell: "/usr/local/bin/bash",
+	})
+	assert.NilError(t, err)
+
+	planner, err := model.NewWorkflowPlanner("testdata/container-shell/push.yml", true)
+	assert.NilError(t, err)
+
+	err = runner.NewPlanExecutor(planner.PlanEvent("push"))(ctx)
+	assert.NilError(t, err)
+}
+
 func TestRunEventSecrets(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping integration test")
@@ -163,6 +287,83 @@ func TestRunEventSecrets(t *testing.T) {
 	assert.NilError(t, err, workflowPath)
 }
 
+func TestRunEventVars(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	log.SetLevel(log.DebugLevel)
+	ctx := context.Background()
+
+	platforms := map[string]string{
+		"ubuntu-latest": "node:12.20.1-buster-slim",
+	}
+
+	workflowPath := "vars"
+	eventName := "push"
+
+	workdir, err := filepath.Abs("testdata")
+	assert.NilError(t, err, workflowPath)
+
+	runnerConfig := &Config{
+		Workdir:         workdir,
+		EventName:       eventName,
+		Platforms:       platforms,
+		ReuseContainers: false,
+		VarFiles:        []EnvFile{{Path: filepath.Join(workdir, workflowPath, ".vars")}},
+	}
+	runner, err := New(runnerConfig)
+	assert.NilError(t, err, workflowPath)
+
+	planner, err := model.NewWorkflowPlanner(fmt.Sprintf("testdata/%s", workflowPath), true)
+	assert.NilError(t, err, workflowPath)
+
+	plan := planner.PlanEvent(eventName)
+
+	err = runner.NewPlanExecutor(plan)(ctx)
+	assert.NilError(t, err, workflowPath)
+}
+
+func TestRunEventDefaultBranch(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	log.SetLevel(log.DebugLevel)
+	ctx := context.Background()
+
+	platforms := map[string]string{
+		"ubuntu-latest": "node:12.20.1-buster-slim",
+	}
+
+	workflowPath := "if-default-branch"
+	eventName := "push"
+
+	workdir, err := filepath.Abs("testdata")
+	assert.NilError(t, err, workflowPath)
+
+	// each job checks that it only runs for the branch its `if` selects
+	for _, event := range []string{"event-default.json", "event-feature.json"} {
+		runnerConfig := &Config{
+			Workdir:         workdir,
+			EventName:       eventName,
+			EventPath:       filepath.Join(workdir, workflowPath, event),
+			Platforms:       platforms,
+			ReuseContainers: false,
+		}
+		runner, err := New(runnerConfig)
+		assert.NilError(t, err, event)
+
+		planner, err := model.NewWorkflowPlanner(fmt.Sprintf("testdata/%s", workflowPath), true)
+		assert.NilError(t, err, event)
+
+		plan := planner.PlanEvent(eventName)
+
+		err = runner.NewPlanExecutor(plan)(ctx)
+		assert.NilError(t, err, event)
+	}
+}
+
 func TestRunEventPullRequest(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping integration test")
@@ -254,5 +455,1208 @@ func TestContainerPath(t *testing.T) {
 
 			assert.Equal(t, v.destinationPath, runnerConfig.containerPath(runnerConfig.Workdir))
 		}
+
+		// a copied or bound workdir can be moved, unless it's bound at its host path or the job runs on the host
+		for _, v := range []struct {
+			bind      bool
+			hostPath  bool
+			onHost    bool
+			workspace string
+			want      string
+		}{
+			{false, false, false, "", "/home/act"},
+			{false, false, false, "/github/workspace", "/github/workspace"},
+			{false, true, false, "/github/workspace", "/github/workspace"},
+			{true, false, false, "", "/home/act"},
+			{true, false, false, "/github/workspace", "/github/workspace"},
+			{true, true, false, "/github/workspace", "/home/act"},
+			{false, false, true, "/github/workspace", "/home/act"},
+		} {
+			rc := &RunContext{
+				Config: &Config{Workdir: "/home/act", BindWorkdir: v.bind, BindHostPath: v.hostPath, ContainerWorkspace: v.workspace},
+				Run:    &model.Run{Workflow: &model.Workflow{Name: "TestWorkflowName"}},
+				onHost: v.onHost,
+			}
+			assert.Equal(t, v.want, rc.containerWorkdir(), "%+v", v)
+			if v.bind {
+				binds, _ := rc.GetBindsAndMounts()
+				assert.Assert(t, strings.HasPrefix(binds[len(binds)-1], "/home/act:"+v.want+":") || binds[len(binds)-1] == "/home/act:"+v.want, "%+v", v)
+			}
+		}
+	}
+
+	_, err := New(&Config{Workdir: "testdata", ContainerWorkspace: "github/workspace"})
+	assert.ErrorContains(t, err, "the container workspace 'github/workspace' isn't an absolute path")
+}
+
+func TestWorkflowDispatchInputs(t *testing.T) {
+	workflow, err := model.ReadWorkflow(strings.NewReader(`
+name: dispatch
+on:
+  workflow_dispatch:
+    inputs:
+      name:
+        required: true
+      greeting:
+        default: hello
+      dry:
+        type: boolean
+        default: 'false'
+      count:
+        type: number
+        default: '1'
+      level:
+        type: choice
+        options: [info, debug]
+        default: info
+jobs:
+  test:
+    runs-on: ubuntu-latest
+    steps:
+    - run: echo
+`))
+	assert.NilError(t, err)
+
+	newRunner := func(inputs map[string]string) *runnerImpl {
+		r, err := New(&Config{
+			Workdir:   "testdata",
+			EventName: "workflow_dispatch",
+			Inputs:    inputs,
+		})
+		assert.NilError(t, err)
+		return r.(*runnerImpl)
+	}
+
+	_, err = newRunner(map[string]string{}).workflowDispatchInputs(workflow)
+	assert.ErrorContains(t, err, "Input 'name' is required")
+
+	_, err = newRunner(map[string]string{"name": "act", "dry": "maybe"}).workflowDispatchInputs(workflow)
+	assert.ErrorContains(t, err, "Input 'dry' must be a boolean")
+
+	_, err = newRunner(map[string]string{"name": "act", "level": "trace"}).workflowDispatchInputs(workflow)
+	assert.ErrorContains(t, err, "Input 'level' must be one of")
+
+	r := newRunner(map[string]string{"name": "act", "dry": "true", "count": "3"})
+	inputs, err := r.workflowDispatchInputs(workflow)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, inputs, map[string]interface{}{
+		"name":     "act",
+		"greeting": "hello",
+		"dry":      true,
+		"count":    float64(3),
+		"level":    "info",
+	})
+
+	rc := r.newRunContext(&model.Run{Workflow: workflow, JobID: "test"}, map[string]interface{}{}, inputs)
+	for expr, want := range map[string]string{
+		"inputs.name":              "act",
+		"inputs.dry":               "true",
+		"inputs.count + 1":         "4",
+		"github.event.inputs.name": "act",
+		"github.event.inputs.dry":  "true",
+	} {
+		out, _, err := rc.ExprEval.Evaluate(expr)
+		assert.NilError(t, err, expr)
+		assert.Equal(t, out, want, expr)
+	}
+}
+
+func TestEnvAndSecretFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "act-env-files")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	writeFile := func(name string, content string) string {
+		path := filepath.Join(dir, name)
+		assert.NilError(t, ioutil.WriteFile(path, []byte(content), 0600))
+		return path
+	}
+	base := writeFile("base.env", "SHARED=base\nBASE_ONLY=base\nEXPLICIT=base\n")
+	override := writeFile("override.env", "SHARED=override\nOVERRIDE_ONLY=override\n")
+	secrets := writeFile("override.secrets", "TOKEN=from-file\nOTHER=from-file\n")
+
+	r, err := New(&Config{
+		Workdir: "testdata",
+		Env:     map[string]string{"EXPLICIT": "explicit"},
+		EnvFiles: []EnvFile{
+			{Path: base},
+			{Path: override},
+			{Path: filepath.Join(dir, "missing.env"), Optional: true},
+		},
+		Secrets:     map[string]string{"TOKEN": "explicit"},
+		SecretFiles: []EnvFile{{Path: secrets}},
+	})
+	assert.NilError(t, err)
+
+	config := r.(*runnerImpl).config
+	assert.DeepEqual(t, config.Env, map[string]string{
+		"SHARED":        "override",
+		"BASE_ONLY":     "base",
+		"OVERRIDE_ONLY": "override",
+		"EXPLICIT":      "explicit",
+	})
+	assert.DeepEqual(t, config.Secrets, map[string]string{
+		"TOKEN": "explicit",
+		"OTHER": "from-file",
+	})
+
+	_, err = New(&Config{
+		Workdir:  "testdata",
+		EnvFiles: []EnvFile{{Path: filepath.Join(dir, "missing.env")}},
+	})
+	assert.ErrorContains(t, err, "missing.env")
+}
+
+func TestRunActionFile(t *testing.T) {
+	// the action of the planner tests
+	result, err := runHostWorkflow(t, &Config{
+		EventName: "workflow_dispatch",
+		Inputs:    map[string]string{"who": "world"},
+	}, "../model/testdata/composite-action/action.yml")
+	assert.NilError(t, err)
+
+	assert.Equal(t, 1, len(result.Jobs))
+	assert.Equal(t, model.ActionJobID, result.Jobs[0].JobID)
+	assert.Equal(t, "success", result.Jobs[0].Conclusion)
+	assert.Equal(t, "Hello world", result.Jobs[0].Outputs["message"])
+}
+
+func TestRunMatrixFromJSON(t *testing.T) {
+	for _, table := range []struct {
+		failSetup bool
+		builds    []string
+		results   []string
+	}{
+		{false, []string{"linux-", "macos-14", "windows-"}, []string{"build success", "setup success"}},
+		// the matrix of build isn't evaluated without the output of setup, build is skipped
+		{true, []string{}, []string{"build skipped", "setup failure"}},
+	} {
+		var mu sync.Mutex
+		builds := make([]string, 0)
+		var jobs []PostRunJob
+		runnerConfig := &Config{
+			OnWorkflowCommand: func(ctx context.Context, command WorkflowCommand) {
+				if command.Command == "set-output" && command.Parameters["name"] == "build" {
+					mu.Lock()
+					defer mu.Unlock()
+					builds = append(builds, command.Value)
+				}
+			},
+			PostRun: func(ctx context.Context, event PostRunEvent) error {
+				jobs = event.Jobs
+				return nil
+			},
+		}
+		if table.failSetup {
+			runnerConfig.Env = map[string]string{"FAIL_SETUP": "true"}
+		}
+
+		_, err := runHostWorkflow(t, runnerConfig, "testdata/matrix-from-json/push.yml")
+		if table.failSetup {
+			assert.ErrorContains(t, err, "exit with `FAILURE`: 1")
+		} else {
+			assert.NilError(t, err)
+		}
+
+		sort.Strings(builds)
+		assert.DeepEqual(t, table.builds, builds)
+
+		results := make([]string, 0)
+		for _, job := range jobs {
+			results = append(results, fmt.Sprintf("%s %s", job.JobID, job.Result))
+		}
+		assert.DeepEqual(t, table.results, results)
+	}
+}
+
+func TestRunWorkflowCall(t *testing.T) {
+	workdir := hostWorkdir(t)
+	called, err := ioutil.ReadFile("testdata/workflow-call/called.yml")
+	assert.NilError(t, err)
+	assert.NilError(t, ioutil.WriteFile(filepath.Join(workdir, "called.yml"), called, 0644))
+	// the working-directory of the defaults of each workflow
+	for _, dir := range []string{"caller", "called"} {
+		assert.NilError(t, os.MkdirAll(filepath.Join(workdir, dir), 0755))
 	}
+
+	result, err := runHostWorkflow(t, &Config{
+		Workdir:      workdir,
+		Secrets:      map[string]string{"TOKEN": "s3cr3t", "OTHER": "not passed"},
+		NoGitContext: true,
+	}, "testdata/workflow-call/push.yml")
+	assert.NilError(t, err)
+
+	// the output of the called workflow maps the output of its job to the job that calls it
+	conclusions := make(map[string]string)
+	for _, job := range result.Jobs {
+		conclusions[job.JobID] = job.Conclusion
+		if job.JobID == "call" {
+			assert.DeepEqual(t, map[string]string{"greeting": "hello act", "count": "2"}, job.Outputs)
+		}
+	}
+	assert.DeepEqual(t, map[string]string{"greet": "success", "call": "success", "check": "success"}, conclusions)
+}
+
+func TestRunWorkspaceHost(t *testing.T) {
+	// the job on the host uses the workdir, also in the contexts the job evaluates first
+	result, err := runHostWorkflow(t, &Config{
+		ContainerWorkspace: "/github/workspace",
+		NoGitContext:       true,
+	}, "testdata/workspace-host/push.yml")
+	assert.NilError(t, err)
+	assert.Equal(t, 1, len(result.Jobs))
+	assert.Equal(t, "host/success", result.Jobs[0].JobID+"/"+result.Jobs[0].Conclusion)
+}
+
+func TestRunMatrixEnv(t *testing.T) {
+	workdir := hostWorkdir(t)
+
+	assert.NilError(t, os.MkdirAll(filepath.Join(workdir, "target"), 0755))
+	assert.NilError(t, ioutil.WriteFile(filepath.Join(workdir, "target", "action.yml"), []byte(`name: target
+inputs:
+  target:
+    required: true
+outputs:
+  target:
+    value: ${{ steps.target.outputs.target }}
+runs:
+  using: composite
+  steps:
+    - id: target
+      run: echo "target=${{ inputs.target }}" >> "$GITHUB_OUTPUT"
+      shell: bash
+`), 0644))
+
+	// the legs run at the same time, so they can't see each other's values
+	result, err := runHostWorkflow(t, &Config{
+		Workdir:           workdir,
+		NoGitContext:      true,
+		MaxJobParallelism: 4,
+	}, "testdata/matrix-env/push.yml")
+	assert.NilError(t, err)
+
+	// the env and the inputs of the steps are evaluated with the matrix of each leg
+	assert.Equal(t, 4, len(result.Jobs))
+	for _, job := range result.Jobs {
+		want := fmt.Sprintf("%s-%s", job.Matrix["os"], job.Matrix["arch"])
+		for _, step := range job.Steps {
+			assert.Equal(t, want, step.Outputs["target"], "%s %s", job.Job, step.StepID)
+		}
+	}
+}
+
+func TestRunConcurrency(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the jobs run on the host")
+	}
+
+	workdir, err := ioutil.TempDir("", "act-concurrency")
+	assert.NilError(t, err)
+	defer os.RemoveAll(workdir)
+
+	xdg, ok := os.LookupEnv("XDG_CACHE_HOME")
+	defer func() {
+		if ok {
+			os.Setenv("XDG_CACHE_HOME", xdg)
+		} else {
+			os.Unsetenv("XDG_CACHE_HOME")
+		}
+	}()
+	os.Setenv("XDG_CACHE_HOME", workdir)
+
+	// two runs of the workflow, like two act processes, whose legs all queue in the groups
+	logFile := filepath.Join(workdir, "log.txt")
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		runner, err := New(&Config{
+			Workdir:           workdir,
+			EventName:         "push",
+			Platforms:         map[string]string{"ubuntu-latest": container.HostImage},
+			Env:               map[string]string{"LOG": logFile},
+			MaxJobParallelism: 2,
+		})
+		assert.NilError(t, err)
+		planner, err := model.NewWorkflowPlanner("testdata/concurrency/push.yml", true)
+		assert.NilError(t, err)
+		executor := runner.NewPlanExecutor(planner.PlanEvent("push"))
+		go func() {
+			errs <- executor(context.Background())
+		}()
+	}
+	assert.NilError(t, <-errs)
+	assert.NilError(t, <-errs)
+
+	log, err := ioutil.ReadFile(logFile)
+	assert.NilError(t, err)
+	assert.Equal(t, strings.Repeat("start\nend\n", 4), string(log))
+}
+
+func TestRunConcurrencyDeadlock(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the jobs run on the host")
+	}
+
+	workdir, err := ioutil.TempDir("", "act-concurrency-deadlock")
+	assert.NilError(t, err)
+	defer os.RemoveAll(workdir)
+
+	xdg, ok := os.LookupEnv("XDG_CACHE_HOME")
+	defer func() {
+		if ok {
+			os.Setenv("XDG_CACHE_HOME", xdg)
+		} else {
+			os.Unsetenv("XDG_CACHE_HOME")
+		}
+	}()
+	os.Setenv("XDG_CACHE_HOME", workdir)
+
+	runner, err := New(&Config{
+		Workdir:   workdir,
+		EventName: "push",
+		Platforms: map[string]string{"ubuntu-latest": container.HostImage},
+	})
+	assert.NilError(t, err)
+	planner, err := model.NewWorkflowPlanner("testdata/concurrency-deadlock/push.yml", true)
+	assert.NilError(t, err)
+	plan := planner.PlanEvent("push")
+
+	// the job fails instead of waiting for its workflow
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	planExecutor, result := runner.NewPlanExecutorWithResults(plan)
+	err = planExecutor(ctx)
+	assert.ErrorContains(t, err, "deadlock for the concurrency group deploy")
+	assert.NilError(t, ctx.Err())
+	assert.Equal(t, 1, len(result.Jobs))
+	assert.Equal(t, "deploy/failure", result.Jobs[0].JobID+"/"+result.Jobs[0].Conclusion)
+
+	_, err = os.Stat(filepath.Join(workdir, "act-concurrency"))
+	assert.NilError(t, err)
+}
+
+func TestRunConcurrencyLimit(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the jobs run on the host")
+	}
+
+	workdir, err := ioutil.TempDir("", "act-concurrency-limit")
+	assert.NilError(t, err)
+	defer os.RemoveAll(workdir)
+
+	logFile := filepath.Join(workdir, "log.txt")
+	runner, err := New(&Config{
+		Workdir:           workdir,
+		EventName:         "push",
+		Platforms:         map[string]string{"ubuntu-latest": container.HostImage},
+		Env:               map[string]string{"LOG": logFile},
+		MaxJobParallelism: 2,
+		Concurrency:       1,
+	})
+	assert.NilError(t, err)
+
+	// two plans of the runner, the jobs of both share the slots but each plan has its own results
+	results := make([]*PlanResult, 0, 2)
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		planner, err := model.NewWorkflowPlanner("testdata/concurrency-limit/push.yml", true)
+		assert.NilError(t, err)
+		executor, result := runner.NewPlanExecutorWithResults(planner.PlanEvent("push"))
+		results = append(results, result)
+		go func() {
+			errs <- executor(context.Background())
+		}()
+	}
+	assert.NilError(t, <-errs)
+	assert.NilError(t, <-errs)
+
+	log, err := ioutil.ReadFile(logFile)
+	assert.NilError(t, err)
+	assert.Equal(t, strings.Repeat("start\nend\n", 6), string(log))
+	for _, result := range results {
+		assert.Equal(t, 3, len(result.Jobs))
+		assert.Equal(t, "c", result.Jobs[2].JobID)
+		assert.Equal(t, "ab", result.Jobs[2].Outputs["names"])
+	}
+}
+
+func TestRunWithContexts(t *testing.T) {
+	workdir := hostWorkdir(t)
+	actionDir := filepath.Join(workdir, "actions", "node-inputs")
+	assert.NilError(t, os.MkdirAll(actionDir, 0755))
+	for _, name := range []string{"action.yml", "index.js"} {
+		content, err := ioutil.ReadFile(filepath.Join("testdata", "actions", "node-inputs", name))
+		assert.NilError(t, err)
+		assert.NilError(t, ioutil.WriteFile(filepath.Join(actionDir, name), content, 0644))
+	}
+
+	_, err := runHostWorkflow(t, &Config{Workdir: workdir}, "testdata/with-contexts/push.yml")
+	assert.NilError(t, err)
+}
+
+func TestRunContainerDaemonSocket(t *testing.T) {
+	_, err := New(&Config{Workdir: "testdata", ContainerDaemonSocket: "docker.example.com"})
+	assert.ErrorContains(t, err, "invalid container daemon socket 'docker.example.com'")
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	socket := "tcp://" + listener.Addr().String()
+	listener.Close()
+
+	workdir, err := ioutil.TempDir("", "act-container-daemon-socket")
+	assert.NilError(t, err)
+	defer os.RemoveAll(workdir)
+
+	runner, err := New(&Config{
+		Workdir:               workdir,
+		EventName:             "push",
+		Platforms:             map[string]string{"ubuntu-latest": container.HostImage},
+		ContainerDaemonSocket: socket,
+	})
+	assert.NilError(t, err)
+
+	// the docker:// steps of the jobs on the host need the daemon, the plan fails before its first job
+	planner, err := model.NewWorkflowPlanner("testdata/basic/push.yml", true)
+	assert.NilError(t, err)
+	planExecutor, result := runner.NewPlanExecutorWithResults(planner.PlanEvent("push"))
+	err = planExecutor(context.Background())
+	assert.ErrorContains(t, err, "unable to reach the container daemon at "+socket)
+	assert.Equal(t, 0, len(result.Jobs))
+
+	// a plan that needs no container runs without it
+	if runtime.GOOS == "windows" {
+		t.Skip("the jobs run on the host")
+	}
+	planner, err = model.NewWorkflowPlanner("testdata/step-output-env/push.yml", true)
+	assert.NilError(t, err)
+	err = runner.NewPlanExecutor(planner.PlanEvent("push"))(context.Background())
+	assert.NilError(t, err)
+}
+
+func TestRunNeutralExitCode(t *testing.T) {
+	for _, table := range []struct {
+		neutralExitCode int
+		outcomes        []string
+		errorMessage    string
+	}{
+		{78, []string{"skipped-skipped"}, ""},
+		{0, []string{}, "exit with `FAILURE`: 78"},
+	} {
+		outcomes := make([]string, 0)
+		runnerConfig := &Config{
+			NeutralExitCode: table.neutralExitCode,
+			OnWorkflowCommand: func(ctx context.Context, command WorkflowCommand) {
+				if command.Command == "set-output" {
+					outcomes = append(outcomes, command.Value)
+				}
+			},
+		}
+		_, err := runHostWorkflow(t, runnerConfig, "testdata/neutral-exit-code/push.yml")
+		if table.errorMessage == "" {
+			assert.NilError(t, err)
+		} else {
+			assert.Error(t, err, table.errorMessage)
+		}
+		assert.DeepEqual(t, table.outcomes, outcomes)
+	}
+}
+
+func TestRunnerAutoDetectEvent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "act-detect-event")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, table := range []struct {
+		payload   string
+		eventName string
+		expected  string
+		errMsg    string
+	}{
+		{`{"action": "opened", "pull_request": {"base": {"ref": "main"}}}`, "", "pull_request", ""},
+		{`{"action": "opened", "pull_request": {"base": {"ref": "main"}}}`, "pull_request_target", "pull_request_target", ""},
+		{`{"ref": "refs/heads/main", "commits": [], "pusher": {}}`, "workflow_dispatch", "workflow_dispatch", ""},
+		{`{"ref": "v1.0.0", "ref_type": "tag"}`, "create", "create", ""},
+		{`{"ref": "v1.0.0", "ref_type": "tag"}`, "", "", "could be any of create, delete"},
+	} {
+		eventPath := filepath.Join(dir, "event.json")
+		assert.NilError(t, ioutil.WriteFile(eventPath, []byte(table.payload), 0600))
+
+		// the CLI resolves the event before planning like New does
+		eventName, err := ResolveEventName(eventPath, table.eventName, log.StandardLogger())
+		if table.errMsg != "" {
+			assert.ErrorContains(t, err, table.errMsg)
+		} else {
+			assert.NilError(t, err)
+			assert.Equal(t, table.expected, eventName)
+		}
+
+		r, err := New(&Config{
+			Workdir:         dir,
+			EventName:       table.eventName,
+			EventPath:       eventPath,
+			AutoDetectEvent: true,
+		})
+		if table.errMsg != "" {
+			assert.ErrorContains(t, err, table.errMsg)
+			continue
+		}
+		assert.NilError(t, err)
+		assert.Equal(t, table.expected, r.(*runnerImpl).config.EventName)
+	}
+}
+
+func TestRunMatrixOverride(t *testing.T) {
+	var mu sync.Mutex
+	legs := make([]string, 0)
+	runnerConfig := &Config{
+		MatrixOverride: map[string]map[string][]interface{}{
+			"build": {
+				"os":      {"linux", "windows"},
+				"version": {1, 2},
+				"exclude": {map[string]interface{}{"os": "windows", "version": 1}},
+				"include": {map[string]interface{}{"os": "freebsd", "version": 3}},
+			},
+			"lint": {"os": {"linux"}},
+		},
+		OnWorkflowCommand: func(ctx context.Context, command WorkflowCommand) {
+			if command.Command == "set-output" {
+				mu.Lock()
+				defer mu.Unlock()
+				legs = append(legs, command.Value)
+			}
+		},
+	}
+	_, err := runHostWorkflow(t, runnerConfig, "testdata/matrix-override/push.yml")
+	assert.NilError(t, err)
+
+	sort.Strings(legs)
+	assert.DeepEqual(t, []string{"freebsd-3", "lint", "linux-1", "linux-2", "test-macos", "windows-2"}, legs)
+}
+
+func TestRunStepHooks(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		events := make([]string, 0)
+		runnerConfig := &Config{
+			BeforeStep: func(ctx context.Context, event StepHookEvent) error {
+				events = append(events, fmt.Sprintf("before %s/%s/%s", event.Workflow, event.JobID, event.StepID))
+				return nil
+			},
+			AfterStep: func(ctx context.Context, event StepHookEvent) error {
+				events = append(events, fmt.Sprintf("after %s %s-%s", event.StepID, event.Outcome, event.Conclusion))
+				if event.StepID == "last" {
+					return fmt.Errorf("unable to take a snapshot")
+				}
+				return nil
+			},
+			StrictStepHooks: strict,
+		}
+		_, err := runHostWorkflow(t, runnerConfig, "testdata/step-hooks/push.yml")
+		if strict {
+			assert.Error(t, err, "unable to take a snapshot")
+		} else {
+			assert.NilError(t, err)
+		}
+		assert.DeepEqual(t, []string{
+			"before step-hooks/test/first",
+			"after first success-success",
+			"before step-hooks/test/failing",
+			"after failing failure-success",
+			"before step-hooks/test/last",
+			"after last success-success",
+		}, events)
+	}
+}
+
+func TestRunEnvPrecedence(t *testing.T) {
+	values := make([]string, 0)
+	runnerConfig := &Config{
+		Secrets: map[string]string{"TOKEN": "s3cr3t"},
+		OnWorkflowCommand: func(ctx context.Context, command WorkflowCommand) {
+			if command.Command == "set-output" {
+				values = append(values, command.Value)
+			}
+		},
+	}
+	_, err := runHostWorkflow(t, runnerConfig, "testdata/env-precedence/push.yml")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{
+		"job workflow workflow-job",
+		"step",
+		"github-env ${{ github.job }}",
+		"github-env-step s3cr3t",
+		"github-env",
+	}, values)
+}
+
+func TestRunToolCache(t *testing.T) {
+	workdir := hostWorkdir(t)
+	toolCacheDir := filepath.Join(workdir, "toolcache")
+
+	output := make([]string, 0)
+	_, err := runHostWorkflow(t, &Config{
+		Workdir:      workdir,
+		ToolCacheDir: toolCacheDir,
+		AfterStep: func(ctx context.Context, event StepHookEvent) error {
+			output = append(output, fmt.Sprintf("%s %s", event.StepID, event.Conclusion))
+			return nil
+		},
+	}, "testdata/tool-cache/push.yml")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{"0 success", "1 success"}, output)
+
+	_, err = os.Stat(filepath.Join(toolCacheDir, "tool", "1.0.0", "x64", "bin", "tool"))
+	assert.NilError(t, err)
+}
+
+func TestRunStepOutputEnv(t *testing.T) {
+	for _, table := range []struct {
+		enabled bool
+		values  []string
+	}{
+		{false, []string{"v1.2.3", "[]", "[step]"}},
+		{true, []string{"v1.2.3", "[v1.2.3]", "[step]"}},
+	} {
+		values := make([]string, 0)
+		_, err := runHostWorkflow(t, &Config{
+			StepOutputEnv: table.enabled,
+			OnWorkflowCommand: func(ctx context.Context, command WorkflowCommand) {
+				if command.Command == "set-output" {
+					values = append(values, command.Value)
+				}
+			},
+		}, "testdata/step-output-env/push.yml")
+		assert.NilError(t, err)
+		assert.DeepEqual(t, table.values, values)
+	}
+}
+
+func TestRunToken(t *testing.T) {
+	for _, table := range []struct {
+		secrets map[string]string
+		values  []string
+	}{
+		{nil, []string{"ghp_token", "ghp_token", "ghp_token"}},
+		{map[string]string{"GITHUB_TOKEN": "ghp_secret"}, []string{"ghp_token", "ghp_token", "ghp_secret"}},
+	} {
+		values := make([]string, 0)
+		_, err := runHostWorkflow(t, &Config{
+			Secrets: table.secrets,
+			Token:   "ghp_token",
+			OnWorkflowCommand: func(ctx context.Context, command WorkflowCommand) {
+				if command.Command == "set-output" {
+					values = append(values, command.Value)
+				}
+			},
+		}, "testdata/token/push.yml")
+		assert.NilError(t, err)
+		assert.DeepEqual(t, table.values, values)
+	}
+
+	r, err := New(&Config{Workdir: "testdata", Token: "ghp_token"})
+	assert.NilError(t, err)
+	assert.Equal(t, "***", maskSecrets("ghp_token", nil, r.(*runnerImpl).secretPatterns))
+}
+
+func TestRunLogger(t *testing.T) {
+	output := &bytes.Buffer{}
+	logger := log.New()
+	logger.SetOutput(output)
+	logger.SetFormatter(&log.JSONFormatter{})
+	logger.SetLevel(log.InfoLevel)
+	hook := &loggerHook{}
+	logger.AddHook(hook)
+
+	_, err := runHostWorkflow(t, &Config{
+		Secrets:   map[string]string{"SECRET": "s3cr3t"},
+		LogOutput: true,
+		Logger:    logger,
+	}, "testdata/logger/push.yml")
+	assert.NilError(t, err)
+
+	assert.Assert(t, strings.Contains(output.String(), `"msg":"hello from logger with ***"`), output.String())
+	assert.Assert(t, !strings.Contains(output.String(), "s3cr3t"), output.String())
+	assert.Assert(t, strings.Contains(output.String(), `"job":"logger/test"`), output.String())
+	outputs := make([]string, 0)
+	for _, entry := range hook.entries {
+		if entry.Data["raw_output"] == true {
+			assert.Equal(t, "logger/test", entry.Data["job"])
+			outputs = append(outputs, entry.Message)
+		}
+	}
+	assert.DeepEqual(t, []string{"hello from logger with ***"}, outputs)
+}
+
+func TestRunInsecureSecrets(t *testing.T) {
+	for _, insecure := range []bool{false, true} {
+		output := &bytes.Buffer{}
+		logger := log.New()
+		logger.SetOutput(output)
+		logger.SetLevel(log.InfoLevel)
+
+		_, err := runHostWorkflow(t, &Config{
+			Secrets:         map[string]string{"SECRET": "s3cr3t"},
+			InsecureSecrets: insecure,
+			LogOutput:       true,
+			NoGitContext:    true,
+			Logger:          logger,
+		}, "testdata/insecure-secrets/push.yml")
+		assert.NilError(t, err)
+
+		// the values of ::add-mask:: are masked in the output of the steps after it like the secrets, unless insecure
+		for _, value := range []string{`msg="the secret is s3cr3t"`, `msg="the generated value is gen3r4ted"`} {
+			assert.Equal(t, insecure, strings.Contains(output.String(), value), value)
+		}
+		for _, value := range []string{`msg="the secret is ***"`, `msg="the generated value is ***"`} {
+			assert.Equal(t, !insecure, strings.Contains(output.String(), value), value)
+		}
+		assert.Equal(t, insecure, strings.Contains(output.String(), "are not masked in the output"))
+	}
+}
+
+type loggerHook struct {
+	mu      sync.Mutex
+	entries []*log.Entry
+}
+
+func (h *loggerHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (h *loggerHook) Fire(entry *log.Entry) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries = append(h.entries, entry)
+	return nil
+}
+
+func TestRunPostRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the jobs run on the host")
+	}
+
+	for _, table := range []struct {
+		workflow string
+		cancel   bool
+		result   string
+		jobs     []PostRunJob
+	}{
+		{"testdata/step-hooks/push.yml", false, "success", []PostRunJob{{Workflow: "step-hooks", JobID: "test", Result: "success"}}},
+		{"testdata/neutral-exit-code/push.yml", false, "failure", []PostRunJob{{Workflow: "neutral-exit-code", JobID: "test", Result: "failure"}}},
+		{"testdata/step-hooks/push.yml", true, "cancelled", []PostRunJob{{Workflow: "step-hooks", JobID: "test", Result: "cancelled"}}},
+	} {
+		workdir, err := ioutil.TempDir("", "act-post-run")
+		assert.NilError(t, err)
+		defer os.RemoveAll(workdir)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		events := make([]PostRunEvent, 0)
+		runnerConfig := &Config{
+			Workdir:   workdir,
+			EventName: "push",
+			Platforms: map[string]string{"ubuntu-latest": container.HostImage},
+			BeforeStep: func(ctx context.Context, event StepHookEvent) error {
+				if table.cancel {
+					cancel()
+				}
+				return nil
+			},
+			PostRun: func(ctx context.Context, event PostRunEvent) error {
+				assert.NilError(t, ctx.Err())
+				events = append(events, event)
+				return nil
+			},
+		}
+		runner, err := New(runnerConfig)
+		assert.NilError(t, err)
+
+		planner, err := model.NewWorkflowPlanner(table.workflow, true)
+		assert.NilError(t, err)
+
+		err = runner.NewPlanExecutor(planner.PlanEvent("push"))(ctx)
+		assert.Equal(t, table.result == "success", err == nil, table.workflow)
+		assert.Equal(t, 1, len(events), table.workflow)
+		assert.Equal(t, table.result, events[0].Result, table.workflow)
+		assert.Equal(t, err, events[0].Err, table.workflow)
+		assert.DeepEqual(t, table.jobs, events[0].Jobs)
+	}
+}
+
+func TestRunCancelPostSteps(t *testing.T) {
+	for _, table := range []struct {
+		name     string
+		platform string
+	}{
+		{"host", container.HostImage},
+		{"container", "node:12.20.1-buster-slim"},
+	} {
+		t.Run(table.name, func(t *testing.T) {
+			if table.platform != container.HostImage {
+				if testing.Short() {
+					t.Skip("skipping integration test")
+				}
+				if err := container.CheckDaemon(context.Background()); err != nil {
+					t.Skip(err)
+				}
+			}
+			workdir := hostWorkdir(t)
+			copyTestAction(t, workdir, "post-step-files")
+
+			// the job is canceled while it runs, after the step of the action with the post
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			runner, err := New(&Config{
+				Workdir:   workdir,
+				EventName: "push",
+				Platforms: map[string]string{"ubuntu-latest": table.platform},
+				BeforeStep: func(ctx context.Context, event StepHookEvent) error {
+					if event.StepID == "wait" {
+						cancel()
+					}
+					return nil
+				},
+			})
+			assert.NilError(t, err)
+			planner, err := model.NewWorkflowPlanner("testdata/cancel-post/push.yml", true)
+			assert.NilError(t, err)
+
+			planExecutor, result := runner.NewPlanExecutorWithResults(planner.PlanEvent("push"))
+			err = planExecutor(ctx)
+			assert.Assert(t, err != nil)
+			assert.Equal(t, 1, len(result.Jobs))
+			assert.Equal(t, "cancelled", result.Jobs[0].Conclusion)
+
+			// the post step of the action writes an output of its step
+			assert.Equal(t, "post", result.Jobs[0].Steps[0].StepID)
+			assert.DeepEqual(t, map[string]string{"post": "ran"}, result.Jobs[0].Steps[0].Outputs)
+
+			if table.platform != container.HostImage {
+				cli, err := container.GetDockerClient(context.Background())
+				assert.NilError(t, err)
+				containers, err := cli.ContainerList(context.Background(), types.ContainerListOptions{
+					All:     true,
+					Filters: filters.NewArgs(filters.Arg("name", "act-cancel-post-test")),
+				})
+				assert.NilError(t, err)
+				assert.Equal(t, 0, len(containers), "the job container is removed after the job is canceled")
+			}
+		})
+	}
+}
+
+func TestRunEvents(t *testing.T) {
+	// nothing reads the channel while the plan runs, the events wait in the queue
+	events := make(chan RunEvent)
+	_, err := runHostWorkflow(t, &Config{Events: events}, "testdata/step-hooks/push.yml")
+	assert.NilError(t, err)
+
+	want := []string{
+		"job-started test ",
+		"step-started first ",
+		"step-completed first success",
+		"step-completed skipped skipped",
+		"step-started failing ",
+		"step-completed failing success",
+		"step-started last ",
+		"step-completed last success",
+		"job-completed test success",
+		"plan-completed  success",
+	}
+	// the events are read until the last one of the run
+	got := make([]string, 0)
+	for len(got) == 0 || !strings.HasPrefix(got[len(got)-1], string(PlanCompleted)) {
+		select {
+		case event := <-events:
+			assert.Equal(t, event.Type != PlanCompleted, event.Workflow == "step-hooks", event.Type)
+			assert.Equal(t, event.Type != StepStarted && event.Type != JobStarted, event.Duration > 0 || event.Result == "skipped", event.Type)
+			id := event.StepID
+			if id == "" {
+				id = event.JobID
+			}
+			got = append(got, fmt.Sprintf("%s %s %s", event.Type, id, event.Result))
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only got the events %v", got)
+		}
+	}
+	assert.DeepEqual(t, want, got)
+}
+
+func TestEventQueueDropsOldest(t *testing.T) {
+	events := make(chan RunEvent)
+	queue := newEventQueue(events)
+
+	// nothing reads the events, only the last ones wait besides the one the forwarding goroutine may hold
+	last := maxPendingEvents + 10
+	for i := 0; i <= last; i++ {
+		queue.send(RunEvent{StepID: fmt.Sprint(i)})
+	}
+	got := make([]string, 0)
+	for len(got) == 0 || got[len(got)-1] != fmt.Sprint(last) {
+		got = append(got, (<-events).StepID)
+	}
+	assert.Assert(t, len(got) == maxPendingEvents || len(got) == maxPendingEvents+1, len(got))
+	for i, id := range got[len(got)-maxPendingEvents:] {
+		assert.Equal(t, fmt.Sprint(last-maxPendingEvents+1+i), id)
+	}
+}
+
+func TestRunFailFastPlan(t *testing.T) {
+	for _, table := range []struct {
+		failFast bool
+		results  []string
+	}{
+		{false, []string{"a-fail failure", "b-slow success", "c-pending success", "d-later success"}},
+		{true, []string{"a-fail failure", "b-slow cancelled", "c-pending skipped", "d-later skipped"}},
+	} {
+		workdir := hostWorkdir(t)
+
+		// without fail-fast the slow job is released at once, with it only the abort of the plan ends it
+		release := filepath.Join(workdir, "release")
+		if !table.failFast {
+			assert.NilError(t, ioutil.WriteFile(release, nil, 0644))
+		}
+
+		var jobs []PostRunJob
+		_, err := runHostWorkflow(t, &Config{
+			Workdir:           workdir,
+			Env:               map[string]string{"STARTED": filepath.Join(workdir, "started"), "RELEASE": release},
+			MaxJobParallelism: 2,
+			FailFastPlan:      table.failFast,
+			PostRun: func(ctx context.Context, event PostRunEvent) error {
+				jobs = event.Jobs
+				return nil
+			},
+		}, "testdata/fail-fast-plan/push.yml")
+		assert.ErrorContains(t, err, "exit with `FAILURE`: 1")
+
+		results := make([]string, 0)
+		for _, job := range jobs {
+			results = append(results, fmt.Sprintf("%s %s", job.JobID, job.Result))
+		}
+		assert.DeepEqual(t, table.results, results)
+	}
+}
+
+func TestRunFailFastPlanRerun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the jobs run on the host")
+	}
+
+	workdir, err := ioutil.TempDir("", "act-fail-fast-rerun")
+	assert.NilError(t, err)
+	defer os.RemoveAll(workdir)
+
+	runner, err := New(&Config{
+		Workdir:      workdir,
+		EventName:    "push",
+		Platforms:    map[string]string{"ubuntu-latest": container.HostImage},
+		Env:          map[string]string{"MARKER": filepath.Join(workdir, "marker")},
+		FailFastPlan: true,
+	})
+	assert.NilError(t, err)
+
+	planner, err := model.NewWorkflowPlanner("testdata/fail-fast-rerun/push.yml", true)
+	assert.NilError(t, err)
+
+	// like --watch the executor runs again, the failure of the first run doesn't abort the second one
+	executor := runner.NewPlanExecutor(planner.PlanEvent("push"))
+	assert.ErrorContains(t, executor(context.Background()), "exit with `FAILURE`: 1")
+	assert.NilError(t, executor(context.Background()))
+}
+
+func TestRunResults(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the jobs run on the host")
+	}
+
+	workdir, err := ioutil.TempDir("", "act-results")
+	assert.NilError(t, err)
+	defer os.RemoveAll(workdir)
+
+	runner, err := New(&Config{
+		Workdir:   workdir,
+		EventName: "push",
+		Platforms: map[string]string{"ubuntu-latest": container.HostImage},
+	})
+	assert.NilError(t, err)
+
+	planner, err := model.NewWorkflowPlanner("testdata/step-hooks/push.yml", true)
+	assert.NilError(t, err)
+
+	for i := 0; i < 2; i++ {
+		planExecutor, result := runner.NewPlanExecutorWithResults(planner.PlanEvent("push"))
+		assert.NilError(t, planExecutor(context.Background()))
+		assert.Assert(t, result.Duration > 0)
+		assert.Equal(t, 1, len(result.Jobs))
+
+		job := result.Jobs[0]
+		assert.Equal(t, "step-hooks/test/success", fmt.Sprintf("%s/%s/%s", job.Workflow, job.JobID, job.Conclusion))
+		assert.Assert(t, job.Duration > 0)
+
+		steps := make([]string, 0)
+		for _, step := range job.Steps {
+			steps = append(steps, fmt.Sprintf("%s %s-%s", step.StepID, step.Outcome, step.Conclusion))
+			assert.Equal(t, step.Outcome == "skipped", step.Duration == 0, step.StepID)
+		}
+		assert.DeepEqual(t, []string{
+			"first success-success",
+			"skipped skipped-skipped",
+			"failing failure-success",
+			"last success-success",
+		}, steps)
+	}
+}
+
+func TestRunNeedsResult(t *testing.T) {
+	result, err := runHostWorkflow(t, &Config{}, "testdata/needs-result/push.yml")
+	assert.ErrorContains(t, err, "exit with `FAILURE`: 1")
+
+	// the failure of build skips deploy, notify still runs and sees both results
+	conclusions := make([]string, 0)
+	for _, job := range result.Jobs {
+		conclusions = append(conclusions, fmt.Sprintf("%s %s", job.JobID, job.Conclusion))
+	}
+	assert.DeepEqual(t, []string{"build failure", "deploy skipped", "notify success"}, conclusions)
+	assert.Equal(t, "success", result.Jobs[2].Steps[0].Conclusion)
+}
+
+func TestRunRemoteActionPath(t *testing.T) {
+	workdir := hostWorkdir(t)
+
+	// a monorepo with actions in nested paths, its clone is already in the action cache once the commit is known
+	repoDir := filepath.Join(workdir, "cache", "monorepo")
+	files := map[string]string{
+		"README.md": "monorepo",
+		"actions/build/action.yml": `name: build
+outputs:
+  path:
+    value: ${{ steps.path.outputs.path }}
+runs:
+  using: composite
+  steps:
+    - id: path
+      run: echo "path=actions/build" >> "$GITHUB_OUTPUT"
+      shell: bash
+`,
+		"actions/lint/action.yaml": `name: lint
+outputs:
+  path:
+    value: ${{ steps.path.outputs.path }}
+runs:
+  using: composite
+  steps:
+    - id: path
+      run: echo "path=actions/lint" >> "$GITHUB_OUTPUT"
+      shell: bash
+`,
+	}
+	repo, err := git.PlainInit(repoDir, false)
+	assert.NilError(t, err)
+	worktree, err := repo.Worktree()
+	assert.NilError(t, err)
+	for name, content := range files {
+		assert.NilError(t, os.MkdirAll(filepath.Join(repoDir, filepath.Dir(name)), 0755))
+		assert.NilError(t, ioutil.WriteFile(filepath.Join(repoDir, name), []byte(content), 0644))
+		_, err = worktree.Add(name)
+		assert.NilError(t, err)
+	}
+	hash, err := worktree.Commit("actions", &git.CommitOptions{
+		Author: &object.Signature{Name: "act", Email: "act@example.com", When: time.Now()},
+	})
+	assert.NilError(t, err)
+	cloneDir := filepath.Join(workdir, "cache", "octo-org-monorepo@"+hash.String())
+	assert.NilError(t, os.Rename(repoDir, cloneDir))
+
+	workflow := fmt.Sprintf(`name: remote-action-path
+on: push
+jobs:
+  test:
+    runs-on: ubuntu-latest
+    steps:
+      - id: build
+        uses: octo-org/monorepo/actions/build@%[1]s
+      - id: lint
+        uses: octo-org/monorepo/actions/lint@%[1]s
+      - id: missing
+        uses: octo-org/monorepo/actions/missing@%[1]s
+`, hash)
+	assert.NilError(t, ioutil.WriteFile(filepath.Join(workdir, "push.yml"), []byte(workflow), 0644))
+
+	result, err := runHostWorkflow(t, &Config{
+		Workdir:        workdir,
+		ActionCacheDir: filepath.Join(workdir, "cache"),
+		NoGitContext:   true,
+	}, filepath.Join(workdir, "push.yml"))
+	assert.ErrorContains(t, err, fmt.Sprintf("there is no action.yml, action.yaml or Dockerfile in '%s' for octo-org/monorepo/actions/missing@%s",
+		filepath.Join(cloneDir, "actions/missing"), hash))
+
+	// the action of each step is loaded from its path in the repository
+	assert.Equal(t, 1, len(result.Jobs))
+	outputs := make(map[string]string)
+	for _, step := range result.Jobs[0].Steps {
+		outputs[step.StepID] = step.Outputs["path"]
+	}
+	assert.DeepEqual(t, map[string]string{"build": "actions/build", "lint": "actions/lint", "missing": ""}, outputs)
+}
+
+func TestRunStepFiles(t *testing.T) {
+	workdir := hostWorkdir(t)
+	copyTestAction(t, workdir, "post-step-files")
+
+	result, err := runHostWorkflow(t, &Config{Workdir: workdir}, "testdata/step-files/push.yml")
+	assert.NilError(t, err)
+	assert.Equal(t, 1, len(result.Jobs))
+
+	outputs := make(map[string]map[string]string)
+	for _, step := range result.Jobs[0].Steps {
+		outputs[step.StepID] = step.Outputs
+	}
+	assert.DeepEqual(t, map[string]map[string]string{
+		"first":      {"first": "one"},
+		"second":     {"second": "two"},
+		"read-post":  {},
+		"write-post": {"post": "ran"},
+		"last":       {"env": "one"},
+	}, outputs)
+}
+
+func TestRunDryRun(t *testing.T) {
+	steps := make([]string, 0)
+	runnerConfig := &Config{
+		Workdir:   "testdata",
+		EventName: "push",
+		Platforms: map[string]string{"ubuntu-latest": "node:12.20.1-buster-slim"},
+		DryRun:    true,
+		AfterStep: func(ctx context.Context, event StepHookEvent) error {
+			steps = append(steps, fmt.Sprintf("%s/%s %s", event.JobID, event.StepID, event.Conclusion))
+			return nil
+		},
+	}
+	runner, err := New(runnerConfig)
+	assert.NilError(t, err)
+
+	planner, err := model.NewWorkflowPlanner("testdata/dry-run/push.yml", true)
+	assert.NilError(t, err)
+
+	// there is no docker needed, nothing is created or executed
+	err = runner.NewPlanExecutor(planner.PlanEvent("push"))(context.Background())
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{"test/greet success", "test/container success"}, steps)
+}
+
+func TestRunJobID(t *testing.T) {
+	runner, err := New(&Config{
+		Workdir:   "testdata",
+		EventName: "push",
+		Platforms: map[string]string{"ubuntu-latest": "node:12.20.1-buster-slim"},
+		DryRun:    true,
+		JobID:     "deploy",
+	})
+	assert.NilError(t, err)
+
+	planner, err := model.NewWorkflowPlanner("testdata/dry-run/push.yml", true)
+	assert.NilError(t, err)
+
+	err = runner.NewPlanExecutor(planner.PlanEvent("push"))(context.Background())
+	assert.Error(t, err, "job 'deploy' is not in the plan, the jobs are: skipped, test")
 }
@@ -11,10 +11,10 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"sort"
 	"strings"
 
 	"github.com/kballard/go-shellquote"
-	log "github.com/sirupsen/logrus"
 
 	"github.com/nektos/act/pkg/common"
 	"github.com/nektos/act/pkg/container"
@@ -28,10 +28,14 @@ type StepContext struct {
 	Env        map[string]string
 	Cmd        []string
 	Action     *model.Action
+	Inputs     map[string]string // inputs of the action by id once they are resolved, see resolveInputs
 }
 
 func (sc *StepContext) execJobContainer() common.Executor {
 	return func(ctx context.Context) error {
+		if sc.RunContext.isStepDebugTarget() {
+			common.Logger(ctx).Infof("  \U0001F4AC  Exec command %+q", sc.Cmd)
+		}
 		return sc.RunContext.execJobContainer(sc.Cmd, sc.Env)(ctx)
 	}
 }
@@ -60,7 +64,7 @@ func (sc *StepContext) Executor() common.Executor {
 		)
 
 	case model.StepTypeUsesActionLocal:
-		actionDir := filepath.Join(rc.Config.Workdir, step.Uses)
+		actionDir := rc.localActionDir(step.Uses)
 		return common.NewPipelineExecutor(
 			sc.setupAction(actionDir, ""),
 			sc.runAction(actionDir, ""),
@@ -77,13 +81,33 @@ func (sc *StepContext) Executor() common.Executor {
 			}
 		}
 
-		actionDir := fmt.Sprintf("%s/%s", rc.ActionCacheDir(), strings.ReplaceAll(step.Uses, "/", "-"))
+		if rewritten, ok := rc.Config.rewriteAction(step.Uses); ok {
+			rc.Config.logger().Infof("  \U0001F500  Using %s instead of %s", rewritten, step.Uses)
+			if remoteAction = newRemoteAction(rewritten); remoteAction == nil {
+				return common.NewErrorExecutor(formatError(rewritten))
+			}
+		}
+
+		// the actions in the paths of a repository share its clone
+		actionName := strings.ReplaceAll(fmt.Sprintf("%s/%s@%s", remoteAction.Org, remoteAction.Repo, remoteAction.Ref), "/", "-")
+		if instance := rc.Config.githubInstance(); instance != "github.com" {
+			// the same action of another instance is another repository
+			actionName = fmt.Sprintf("%s-%s", instance, actionName)
+		}
+		actionDir := fmt.Sprintf("%s/%s", rc.ActionCacheDir(), actionName)
 		return common.NewPipelineExecutor(
+			rc.acquireCachedAction(actionDir),
 			common.NewGitCloneExecutor(common.NewGitCloneExecutorInput{
-				URL: remoteAction.CloneURL(),
-				Ref: remoteAction.Ref,
-				Dir: actionDir,
+				URL:               remoteAction.CloneURL(rc.Config.githubInstance()),
+				Ref:               remoteAction.Ref,
+				Dir:               actionDir,
+				VersionConstraint: rc.Config.ActionRefConstraints,
+				Token:             rc.Config.Token,
+				InsecureSkipTLS:   rc.Config.InsecureSkipTLS,
+				CABundle:          rc.Config.CABundle,
+				MajorVersions:     rc.majorVersions,
 			}),
+			rc.useCachedAction(actionDir),
 			sc.setupAction(actionDir, remoteAction.Path),
 			sc.runAction(actionDir, remoteAction.Path),
 		)
@@ -94,117 +118,234 @@ func (sc *StepContext) Executor() common.Executor {
 	return common.NewErrorExecutor(fmt.Errorf("Unable to determine how to run job:%s step:%+v", rc.Run, step))
 }
 
+// mergeEnv returns the env of the workflow and the job with the variables act sets for every step.
+// The env of the job container and the step are merged over it in setupEnv.
 func (sc *StepContext) mergeEnv() map[string]string {
 	rc := sc.RunContext
-	job := rc.Run.Job()
-	step := sc.Step
-
-	var env map[string]string
-	c := job.Container()
-	if c != nil {
-		env = mergeMaps(rc.GetEnv(), c.Env, step.GetEnv())
-	} else {
-		env = mergeMaps(rc.GetEnv(), step.GetEnv())
-	}
 
-	if (rc.ExtraPath != nil) && (len(rc.ExtraPath) > 0) {
-		s := append(rc.ExtraPath, `/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin`)
+	env := mergeMaps(rc.GetEnv())
+	if len(rc.ExtraPath) > 0 {
+		// the directories of ::add-path:: come before the PATH of the host or the one of the containers
+		path := container.DefaultPathEnv
+		if rc.runsOnHost() {
+			path = os.Getenv("PATH")
+		}
+		s := append(append(make([]string, 0, len(rc.ExtraPath)+1), rc.ExtraPath...), path)
 		env["PATH"] = strings.Join(s, `:`)
 	}
+	return rc.withGithubEnv(env)
+}
 
-	sc.Env = rc.withGithubEnv(env)
+var stepOutputEnvPattern = regexp.MustCompile("[^A-Z0-9]+")
+
+// stepOutputEnv returns the outputs of the steps that ran before the current step as STEPS_<ID>_<OUTPUT>,
+// with the characters that can't be in the name of a variable replaced by _, for Config.StepOutputEnv.
+// If the names of two outputs are the same once replaced, like the ones of the steps a-b and a_b, the
+// output of the later step wins, or the one whose name sorts last.
+func (rc *RunContext) stepOutputEnv() map[string]string {
+	env := make(map[string]string)
+	for _, step := range rc.Run.Job().Steps {
+		result, ok := rc.StepResults[step.ID]
+		if !ok || step.ID == rc.CurrentStep {
+			continue
+		}
+		names := make([]string, 0, len(result.Outputs))
+		for name := range result.Outputs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			key := stepOutputEnvPattern.ReplaceAllString(strings.ToUpper(fmt.Sprintf("STEPS_%s_%s", step.ID, name)), "_")
+			env[key] = result.Outputs[name]
+		}
+	}
 	return env
 }
 
 func (sc *StepContext) interpolateEnv(exprEval ExpressionEvaluator) {
 	for k, v := range sc.Env {
+		if sc.RunContext.isLiteralConfigEnv(k, v) {
+			continue
+		}
 		sc.Env[k] = exprEval.Interpolate(v)
 	}
 }
 
+// mergeInterpolatedEnv merges env over sc.Env. All the values are evaluated before any of them is
+// merged, so the `env` context of the expressions is the env below this level.
+func (sc *StepContext) mergeInterpolatedEnv(exprEval ExpressionEvaluator, env map[string]string) {
+	interpolated := make(map[string]string, len(env))
+	for k, v := range env {
+		interpolated[k] = exprEval.Interpolate(v)
+	}
+	for k, v := range interpolated {
+		sc.Env[k] = v
+	}
+}
+
+// setupEnv sets up the env of the step. From the lowest to the highest precedence it is made of
+// Config.StepEnvOverride if the step uses an action, the env of the workflow, the job and the job container, the variables the previous steps added
+// to GITHUB_ENV, the env of the step and the INPUT_ env of its `with`. With Config.StepOutputEnv
+// the outputs of the previous steps come right below GITHUB_ENV. The directories the previous steps
+// added to GITHUB_PATH are prepended to PATH.
 func (sc *StepContext) setupEnv(ctx context.Context) (ExpressionEvaluator, error) {
 	rc := sc.RunContext
 	sc.Env = sc.mergeEnv()
-	if sc.Env != nil {
-		err := rc.JobContainer.UpdateFromGithubEnv(&sc.Env)(ctx)
-		if err != nil {
-			return nil, err
-		}
-	}
 	evaluator := sc.NewExpressionEvaluator()
 	sc.interpolateEnv(evaluator)
 
+	// like Config.Env the values are used as is
+	if sc.Step.Uses != "" {
+		for k, v := range rc.Config.StepEnvOverride {
+			if _, ok := sc.Env[k]; !ok {
+				sc.Env[k] = v
+			}
+		}
+	}
+
+	if c := rc.Run.Job().Container(); c != nil {
+		sc.mergeInterpolatedEnv(evaluator, c.Env)
+	}
+
+	// the outputs of the previous steps aren't expressions either
+	if rc.Config.StepOutputEnv {
+		for k, v := range rc.stepOutputEnv() {
+			sc.Env[k] = v
+		}
+	}
+
+	// the values written to GITHUB_ENV are used as is, they aren't expressions
+	for k, v := range rc.githubEnv {
+		sc.Env[k] = v
+	}
+
+	// the directories written to GITHUB_PATH come before the PATH of the job, like the ones of ::add-path::
+	if err := rc.JobContainer.UpdateFromPath(&sc.Env)(ctx); err != nil {
+		return nil, err
+	}
+
+	sc.mergeInterpolatedEnv(evaluator, sc.Step.Env)
+	// a value of the env of the step that matches a secret pattern is masked as a whole, like with ::add-mask::
+	for k := range sc.Step.Env {
+		for _, pattern := range rc.secretPatterns {
+			if pattern.MatchString(sc.Env[k]) {
+				rc.masks.add(sc.Env[k])
+				break
+			}
+		}
+	}
+
+	// the inputs in `with` come last, so their expressions see the env of the step
+	with := make(map[string]string, len(sc.Step.With))
+	for k, v := range sc.Step.With {
+		with[inputEnvKey(k)] = v
+	}
+	sc.mergeInterpolatedEnv(evaluator, with)
+
+	if rc.isStepDebugTarget() {
+		sc.Env["ACTIONS_STEP_DEBUG"] = "true"
+	}
+	// only at debug level, the values of the vars and the env files aren't masked
 	common.Logger(ctx).Debugf("setupEnv => %v", sc.Env)
 	return evaluator, nil
 }
 
 func (sc *StepContext) setupShellCommand() common.Executor {
 	rc := sc.RunContext
-	step := sc.Step
 	return func(ctx context.Context) error {
 		var script strings.Builder
 		var err error
 
+		// the step's own shell and working-directory win over the defaults of the job, which win over the defaults of the workflow.
+		// They're set on a copy, the legs of a matrix share the step.
+		defaulted := *sc.Step
+		step := &defaulted
+		if step.Shell == "" {
+			step.Shell = rc.Run.Job().Defaults.Run.Shell
+		}
+		if step.Shell == "" {
+			step.Shell = rc.Run.Workflow.Defaults.Run.Shell
+		}
 		if step.WorkingDirectory == "" {
 			step.WorkingDirectory = rc.Run.Job().Defaults.Run.WorkingDirectory
 		}
 		if step.WorkingDirectory == "" {
 			step.WorkingDirectory = rc.Run.Workflow.Defaults.Run.WorkingDirectory
 		}
-		if step.WorkingDirectory != "" {
-			_, err = script.WriteString(fmt.Sprintf("cd %s\n", step.WorkingDirectory))
-			if err != nil {
-				return err
-			}
-		}
-
-		run := rc.ExprEval.Interpolate(step.Run)
 
-		if _, err = script.WriteString(run); err != nil {
-			return err
+		scCmd := step.ShellCommand()
+		if step.Shell == "" {
+			scCmd = rc.defaultShellCommand()
+		}
+		if !strings.Contains(scCmd, "{0}") {
+			return fmt.Errorf("invalid shell option '%s' in step '%s', shell must be a built-in (bash, sh, cmd, powershell, pwsh, python) or a format string containing '{0}'", step.Shell, step)
 		}
-		scriptName := fmt.Sprintf("workflow/%s", step.ID)
+		shellName := step.Shell
+		if shellName == "" {
+			shellName = scCmd
+		}
+		shellName = filepath.Base(strings.Fields(shellName)[0])
 
 		// Reference: https://github.com/actions/runner/blob/8109c962f09d9acc473d92c595ff43afceddb347/src/Runner.Worker/Handlers/ScriptHandlerHelpers.cs#L47-L64
 		// Reference: https://github.com/actions/runner/blob/8109c962f09d9acc473d92c595ff43afceddb347/src/Runner.Worker/Handlers/ScriptHandlerHelpers.cs#L19-L27
 		runPrepend := ""
 		runAppend := ""
 		scriptExt := ""
-		switch step.Shell {
+		switch shellName {
 		case "bash", "sh":
 			scriptExt = ".sh"
 		case "pwsh", "powershell":
 			scriptExt = ".ps1"
-			runPrepend = "$ErrorActionPreference = 'stop'"
-			runAppend = "if ((Test-Path -LiteralPath variable:/LASTEXITCODE)) { exit $LASTEXITCODE }"
+			runPrepend = "$ErrorActionPreference = 'stop'\n"
+			runAppend = "\nif ((Test-Path -LiteralPath variable:/LASTEXITCODE)) { exit $LASTEXITCODE }"
 		case "cmd":
 			scriptExt = ".cmd"
-			runPrepend = "@echo off"
+			runPrepend = "@echo off\n"
 		case "python":
 			scriptExt = ".py"
 		}
 
-		scriptName += scriptExt
-		run = runPrepend + "\n" + run + "\n" + runAppend
-
-		log.Debugf("Wrote command '%s' to '%s'", run, scriptName)
-		containerPath := fmt.Sprintf("%s/%s", rc.Config.ContainerWorkdir(), scriptName)
-
-		if step.Shell == "" {
-			step.Shell = rc.Run.Job().Defaults.Run.Shell
+		if _, err = script.WriteString(runPrepend); err != nil {
+			return err
 		}
-		if step.Shell == "" {
-			step.Shell = rc.Run.Workflow.Defaults.Run.Shell
+		if workingDirectory := rc.ExprEval.Interpolate(step.WorkingDirectory); workingDirectory != "" {
+			if cd := changeDirectoryCommand(shellName, workingDirectory); cd != "" {
+				if _, err = script.WriteString(cd); err != nil {
+					return err
+				}
+			} else {
+				common.Logger(ctx).Warnf("Ignoring working-directory '%s' of step '%s', it is not supported for shell '%s'", workingDirectory, step, step.Shell)
+			}
 		}
-		scCmd := step.ShellCommand()
-		scResolvedCmd := strings.Replace(scCmd, "{0}", containerPath, 1)
-		if step.Shell == "pwsh" || step.Shell == "powershell" {
-			sc.Cmd = strings.SplitN(scResolvedCmd, " ", 3)
+		if _, err = script.WriteString(rc.ExprEval.Interpolate(step.Run) + runAppend); err != nil {
+			return err
+		}
+		scriptName := rc.workflowFile(step.ID + scriptExt)
+
+		if common.Dryrun(ctx) {
+			common.Logger(ctx).Infof("  \U0001F50D  Would write %s:\n%s", scriptName, script.String())
 		} else {
-			sc.Cmd = strings.Fields(scResolvedCmd)
+			rc.Config.logger().Debugf("Wrote command '%s' to '%s'", script.String(), scriptName)
 		}
+		containerPath := fmt.Sprintf("%s/%s", rc.containerWorkdir(), scriptName)
 
-		return rc.JobContainer.Copy(rc.Config.ContainerWorkdir(), &container.FileEntry{
+		switch step.Shell {
+		case "pwsh", "powershell":
+			sc.Cmd = strings.SplitN(strings.Replace(scCmd, "{0}", containerPath, 1), " ", 3)
+		case "cmd":
+			sc.Cmd = strings.Fields(strings.Replace(scCmd, "{0}", containerPath, 1))
+		default:
+			args, err := shellquote.Split(scCmd)
+			if err != nil {
+				return fmt.Errorf("invalid shell option '%s' in step '%s': %w", step.Shell, step, err)
+			}
+			for i, arg := range args {
+				args[i] = strings.Replace(arg, "{0}", containerPath, 1)
+			}
+			sc.Cmd = args
+		}
+
+		return rc.JobContainer.Copy(rc.containerWorkdir(), &container.FileEntry{
 			Name: scriptName,
 			Mode: 0755,
 			Body: script.String(),
@@ -212,51 +353,73 @@ func (sc *StepContext) setupShellCommand() common.Executor {
 	}
 }
 
+// changeDirectoryCommand returns the line a script starts with to change to dir, creating it if it doesn't exist.
+// The version of the shell is ignored, python3.9 has the syntax of python. It returns an empty string for shells
+// it doesn't know the syntax of.
+func changeDirectoryCommand(shell string, dir string) string {
+	switch strings.TrimRight(strings.TrimSuffix(shell, ".exe"), "0123456789.") {
+	case "pwsh", "powershell":
+		quoted := "'" + strings.ReplaceAll(dir, "'", "''") + "'"
+		return fmt.Sprintf("New-Item -ItemType Directory -Force -Path %s | Out-Null; Set-Location %s\n", quoted, quoted)
+	case "python":
+		return fmt.Sprintf("import os; os.makedirs(%[1]q, exist_ok=True); os.chdir(%[1]q)\n", dir)
+	case "cmd":
+		return fmt.Sprintf("if not exist \"%[1]s\" mkdir \"%[1]s\"\ncd /d \"%[1]s\"\n", dir)
+	case "bash", "sh":
+		quoted := shellquote.Join(dir)
+		return fmt.Sprintf("mkdir -p %s && cd %s || exit 1\n", quoted, quoted)
+	}
+	return ""
+}
+
+// newStepContainer returns the container of the step running cmd with entrypoint in image, cmd and entrypoint
+// are used as they are since the callers already interpolated them
 func (sc *StepContext) newStepContainer(ctx context.Context, image string, cmd []string, entrypoint []string) container.Container {
 	rc := sc.RunContext
 	step := sc.Step
-	rawLogger := common.Logger(ctx).WithField("raw_output", true)
-	logWriter := common.NewLineWriter(rc.commandHandler(ctx), func(s string) bool {
-		if rc.Config.LogOutput {
-			rawLogger.Infof("%s", s)
-		} else {
-			rawLogger.Debugf("%s", s)
-		}
-		return true
-	})
+	stdout, stderr := rc.newLogWriters(ctx)
 	envList := make([]string, 0)
 	for k, v := range sc.Env {
 		envList = append(envList, fmt.Sprintf("%s=%s", k, v))
 	}
-	stepEE := sc.NewExpressionEvaluator()
-	for i, v := range cmd {
-		cmd[i] = stepEE.Interpolate(v)
-	}
-	for i, v := range entrypoint {
-		entrypoint[i] = stepEE.Interpolate(v)
-	}
+	logDryRunCommand(ctx, "in a container of "+image, append(append([]string{}, entrypoint...), cmd...), sc.Env)
 
-	envList = append(envList, fmt.Sprintf("%s=%s", "RUNNER_TOOL_CACHE", "/opt/hostedtoolcache"))
+	envList = append(envList, fmt.Sprintf("%s=%s", "RUNNER_TOOL_CACHE", containerToolCacheDir))
 	envList = append(envList, fmt.Sprintf("%s=%s", "RUNNER_OS", "Linux"))
 	envList = append(envList, fmt.Sprintf("%s=%s", "RUNNER_TEMP", "/tmp"))
+	envList = append(envList, rc.daemonSocketEnv()...)
 
 	binds, mounts := rc.GetBindsAndMounts()
+	username, password := rc.registryCredentials(image)
+	networkMode := fmt.Sprintf("container:%s", rc.jobContainerName())
+	if rc.runsOnHost() {
+		networkMode = "host"
+	}
 
 	stepContainer := container.NewContainer(&container.NewContainerInput{
 		Cmd:         cmd,
 		Entrypoint:  entrypoint,
-		WorkingDir:  rc.Config.ContainerWorkdir(),
+		WorkingDir:  rc.containerWorkdir(),
 		Image:       image,
-		Name:        createContainerName(rc.jobContainerName(), step.ID),
+		Name:        fmt.Sprintf("%s-%s", createContainerName("act", rc.String(), step.ID), containerNameHash(rc.jobContainerName(), image, cmd, entrypoint)),
 		Env:         envList,
 		Mounts:      mounts,
-		NetworkMode: fmt.Sprintf("container:%s", rc.jobContainerName()),
+		NetworkMode: networkMode,
 		Binds:       binds,
-		Stdout:      logWriter,
-		Stderr:      logWriter,
+		Stdout:      stdout,
+		Stderr:      stderr,
 		Privileged:  rc.Config.Privileged,
 		UsernsMode:  rc.Config.UsernsMode,
 		Platform:    rc.Config.ContainerArchitecture,
+		Options:     rc.containerOptions(""),
+		Memory:      rc.Config.ContainerMemory,
+		CPUs:        rc.Config.ContainerCPUs,
+		Init:        rc.Config.ContainerInit,
+		PullRetries: rc.Config.PullRetries,
+		PullBackoff: rc.Config.PullRetryBackoff,
+		StopTimeout: rc.containerStopTimeout(),
+		Username:    username,
+		Password:    password,
 	})
 	return stepContainer
 }
@@ -265,15 +428,16 @@ func (sc *StepContext) runUsesContainer() common.Executor {
 	step := sc.Step
 	return func(ctx context.Context) error {
 		image := strings.TrimPrefix(step.Uses, "docker://")
-		cmd, err := shellquote.Split(sc.RunContext.NewExpressionEvaluator().Interpolate(step.With["args"]))
+		exprEval := sc.NewExpressionEvaluator()
+		cmd, err := shellquote.Split(exprEval.Interpolate(step.With["args"]))
 		if err != nil {
 			return err
 		}
-		entrypoint := strings.Fields(step.With["entrypoint"])
+		entrypoint := strings.Fields(exprEval.Interpolate(step.With["entrypoint"]))
 		stepContainer := sc.newStepContainer(ctx, image, cmd, entrypoint)
 
 		return common.NewPipelineExecutor(
-			stepContainer.Pull(rc.Config.ForcePull),
+			stepContainer.Pull(rc.forcePull(image)),
 			stepContainer.Remove().IfBool(!rc.Config.ReuseContainers),
 			stepContainer.Create(),
 			stepContainer.Start(true),
@@ -283,6 +447,12 @@ func (sc *StepContext) runUsesContainer() common.Executor {
 	}
 }
 
+// localActionDir returns the directory of the local action uses, like on GitHub ./ is the root of the
+// repository and not the directory act runs in or the working-directory of the step
+func (rc *RunContext) localActionDir(uses string) string {
+	return filepath.Join(rc.Config.absWorkdir(), uses)
+}
+
 //go:embed res/trampoline.js
 var trampoline []byte
 
@@ -300,7 +470,7 @@ func (sc *StepContext) setupAction(actionDir string, actionPath string) common.E
 							Image: "Dockerfile",
 						},
 					}
-					log.Debugf("Using synthetic action %v for Dockerfile", sc.Action)
+					sc.RunContext.Config.logger().Debugf("Using synthetic action %v for Dockerfile", sc.Action)
 					return nil
 				}
 				if sc.Step.With != nil {
@@ -328,18 +498,19 @@ func (sc *StepContext) setupAction(actionDir string, actionPath string) common.E
 								Main:  "trampoline.js",
 							},
 						}
-						log.Debugf("Using synthetic action %v", sc.Action)
+						sc.RunContext.Config.logger().Debugf("Using synthetic action %v", sc.Action)
 						return nil
 					}
 				}
-				return err
+				return fmt.Errorf("there is no action.yml, action.yaml or Dockerfile in '%s' for %s", filepath.Join(actionDir, actionPath), sc.Step.Uses)
 			}
 		} else if err != nil {
 			return err
 		}
+		defer f.Close()
 
 		sc.Action, err = model.ReadAction(f)
-		log.Debugf("Read action %v from '%s'", sc.Action, f.Name())
+		sc.RunContext.Config.logger().Debugf("Read action %v from '%s'", sc.Action, f.Name())
 		return err
 	}
 }
@@ -358,14 +529,14 @@ func (sc *StepContext) getContainerActionPaths(step *model.Step, actionDir strin
 	actionName := ""
 	containerActionDir := "."
 	if !rc.Config.BindWorkdir && step.Type() != model.StepTypeUsesActionRemote {
-		actionName = getOsSafeRelativePath(actionDir, rc.Config.Workdir)
-		containerActionDir = rc.Config.ContainerWorkdir() + "/_actions/" + actionName
+		actionName = getOsSafeRelativePath(actionDir, rc.Config.absWorkdir())
+		containerActionDir = rc.containerWorkdir() + "/_actions/" + actionName
 	} else if step.Type() == model.StepTypeUsesActionRemote {
 		actionName = getOsSafeRelativePath(actionDir, rc.ActionCacheDir())
-		containerActionDir = rc.Config.ContainerWorkdir() + "/_actions/" + actionName
+		containerActionDir = rc.containerWorkdir() + "/_actions/" + actionName
 	} else if step.Type() == model.StepTypeUsesActionLocal {
-		actionName = getOsSafeRelativePath(actionDir, rc.Config.Workdir)
-		containerActionDir = rc.Config.ContainerWorkdir() + "/_actions/" + actionName
+		actionName = getOsSafeRelativePath(actionDir, rc.Config.absWorkdir())
+		containerActionDir = rc.containerWorkdir() + "/_actions/" + actionName
 	}
 
 	if actionName == "" {
@@ -377,19 +548,65 @@ func (sc *StepContext) getContainerActionPaths(step *model.Step, actionDir strin
 	return actionName, containerActionDir
 }
 
+// inputEnvKey returns the name of the env var an action reads the input id from, which like on GitHub
+// is the id in upper case with its spaces replaced by _, e.g. INPUT_NODE-VERSION
+func inputEnvKey(id string) string {
+	return "INPUT_" + strings.ToUpper(strings.ReplaceAll(id, " ", "_"))
+}
+
+// resolveInputs resolves the inputs of the action once, so the INPUT_ env and the `inputs` context, which
+// e.g. the `runs.args` of a docker action use, have the same values. An input the step sets in `with`
+// has the value setupEnv interpolated into its INPUT_ env, the others get the interpolated default
+// of the action. Inputs the action doesn't declare are passed on too, like on GitHub. The `with` of the
+// step is interpolated after its `env`, so it sees the env, steps, needs, matrix, github and inputs
+// contexts of the step. It returns an error if a required input without a default isn't supplied.
+func (sc *StepContext) resolveInputs() error {
+	rc := sc.RunContext
+	inputs := make(map[string]string)
+	for id, value := range sc.Step.With {
+		if env, ok := sc.Env[inputEnvKey(id)]; ok {
+			inputs[id] = env
+		} else {
+			inputs[id] = sc.NewExpressionEvaluator().Interpolate(value)
+		}
+	}
+	for id, input := range sc.Action.Inputs {
+		if _, ok := inputs[id]; ok {
+			continue
+		}
+		if env, ok := sc.Env[inputEnvKey(id)]; ok {
+			inputs[id] = env
+		} else if input.Required && input.Default == "" {
+			return fmt.Errorf("Input '%s' is required for action '%s'", id, sc.Step.Uses)
+		} else {
+			inputs[id] = rc.ExprEval.Interpolate(input.Default)
+		}
+	}
+
+	// the keys with a - are also set with _, for scripts that can't read them, unless another input has that key
+	for id, value := range inputs {
+		sc.Env[strings.ReplaceAll(inputEnvKey(id), "-", "_")] = value
+	}
+	for id, value := range inputs {
+		sc.Env[inputEnvKey(id)] = value
+	}
+	sc.Inputs = inputs
+	return nil
+}
+
 // nolint: gocyclo
 func (sc *StepContext) runAction(actionDir string, actionPath string) common.Executor {
 	rc := sc.RunContext
 	step := sc.Step
 	return func(ctx context.Context) error {
 		action := sc.Action
-		log.Debugf("About to run action %v", action)
-		for inputID, input := range action.Inputs {
-			envKey := regexp.MustCompile("[^A-Z0-9-]").ReplaceAllString(strings.ToUpper(inputID), "_")
-			envKey = fmt.Sprintf("INPUT_%s", envKey)
-			if _, ok := sc.Env[envKey]; !ok {
-				sc.Env[envKey] = rc.ExprEval.Interpolate(input.Default)
-			}
+		rc.Config.logger().Debugf("About to run action %v", action)
+		// the inputs and the env of the action are added to the env of the step
+		if sc.Env == nil {
+			sc.Env = make(map[string]string)
+		}
+		if err := sc.resolveInputs(); err != nil {
+			return err
 		}
 
 		actionLocation := ""
@@ -400,9 +617,12 @@ func (sc *StepContext) runAction(actionDir string, actionPath string) common.Exe
 		}
 		actionName, containerActionDir := sc.getContainerActionPaths(step, actionLocation, rc)
 
-		sc.Env = mergeMaps(sc.Env, action.Runs.Env)
+		exprEval := sc.NewExpressionEvaluator()
+		for k, v := range action.Runs.Env {
+			sc.Env[k] = exprEval.Interpolate(v)
+		}
 
-		log.Debugf("type=%v actionDir=%s actionPath=%s Workdir=%s ActionCacheDir=%s actionName=%s containerActionDir=%s", step.Type(), actionDir, actionPath, rc.Config.Workdir, rc.ActionCacheDir(), actionName, containerActionDir)
+		rc.Config.logger().Debugf("type=%v actionDir=%s actionPath=%s Workdir=%s ActionCacheDir=%s actionName=%s containerActionDir=%s", step.Type(), actionDir, actionPath, rc.Config.Workdir, rc.ActionCacheDir(), actionName, containerActionDir)
 
 		maybeCopyToActionDir := func() error {
 			if step.Type() != model.StepTypeUsesActionRemote {
@@ -411,7 +631,7 @@ func (sc *StepContext) runAction(actionDir string, actionPath string) common.Exe
 					return nil
 				}
 			}
-			err := removeGitIgnore(actionDir)
+			err := rc.removeGitIgnore(actionDir)
 			if err != nil {
 				return err
 			}
@@ -424,9 +644,19 @@ func (sc *StepContext) runAction(actionDir string, actionPath string) common.Exe
 			if err != nil {
 				return err
 			}
+			if action.Runs.Pre != "" {
+				err = sc.runPreStep(ctx, containerActionDir)
+				if err != nil {
+					return err
+				}
+			}
+			if action.Runs.Post != "" {
+				// the post step runs once the job is done, even if this step fails
+				rc.PostSteps = append(rc.PostSteps, sc.newPostStepExecutor(containerActionDir))
+			}
 			containerArgs := []string{"node", path.Join(containerActionDir, action.Runs.Main)}
-			log.Debugf("executing remote job container: %s", containerArgs)
-			return rc.execJobContainer(containerArgs, sc.Env)(ctx)
+			rc.Config.logger().Debugf("executing remote job container: %s", containerArgs)
+			return sc.execWithState(containerArgs, sc.Env)(ctx)
 		case model.ActionRunsUsingDocker:
 			var prepImage common.Executor
 			var image string
@@ -438,14 +668,16 @@ func (sc *StepContext) runAction(actionDir string, actionPath string) common.Exe
 				image = strings.ToLower(image)
 				contextDir := filepath.Join(actionDir, actionPath, action.Runs.Main)
 
-				anyArchExists, err := container.ImageExistsLocally(ctx, image, "any")
-				if err != nil {
-					return err
-				}
-
-				correctArchExists, err := container.ImageExistsLocally(ctx, image, rc.Config.ContainerArchitecture)
-				if err != nil {
-					return err
+				// there is no docker to look for the image in during a dry run, it is built
+				anyArchExists, correctArchExists := false, false
+				if !common.Dryrun(ctx) {
+					var err error
+					if anyArchExists, err = container.ImageExistsLocally(ctx, image, "any"); err != nil {
+						return err
+					}
+					if correctArchExists, err = container.ImageExistsLocally(ctx, image, rc.Config.ContainerArchitecture); err != nil {
+						return err
+					}
 				}
 
 				if anyArchExists && !correctArchExists {
@@ -459,32 +691,35 @@ func (sc *StepContext) runAction(actionDir string, actionPath string) common.Exe
 				}
 
 				if !correctArchExists {
-					log.Debugf("image '%s' for architecture '%s' will be built from context '%s", image, rc.Config.ContainerArchitecture, contextDir)
+					rc.Config.logger().Debugf("image '%s' for architecture '%s' will be built from context '%s", image, rc.Config.ContainerArchitecture, contextDir)
 					prepImage = container.NewDockerBuildExecutor(container.NewDockerBuildExecutorInput{
 						ContextDir: contextDir,
 						ImageTag:   image,
 						Platform:   rc.Config.ContainerArchitecture,
 					})
 				} else {
-					log.Debugf("image '%s' for architecture '%s' already exists", image, rc.Config.ContainerArchitecture)
+					rc.Config.logger().Debugf("image '%s' for architecture '%s' already exists", image, rc.Config.ContainerArchitecture)
 				}
 			}
 
-			cmd, err := shellquote.Split(step.With["args"])
+			// `with.args` and `with.entrypoint` of the step override the ones of the action
+			cmd, err := shellquote.Split(exprEval.Interpolate(step.With["args"]))
 			if err != nil {
 				return err
 			}
 			if len(cmd) == 0 {
-				cmd = action.Runs.Args
+				for _, arg := range action.Runs.Args {
+					cmd = append(cmd, exprEval.Interpolate(arg))
+				}
 			}
-			entrypoint := strings.Fields(step.With["entrypoint"])
-			if len(entrypoint) == 0 {
-				entrypoint = action.Runs.Entrypoint
+			entrypoint := strings.Fields(exprEval.Interpolate(step.With["entrypoint"]))
+			if len(entrypoint) == 0 && action.Runs.Entrypoint != "" {
+				entrypoint = []string{exprEval.Interpolate(action.Runs.Entrypoint)}
 			}
 			stepContainer := sc.newStepContainer(ctx, image, cmd, entrypoint)
 			return common.NewPipelineExecutor(
 				prepImage,
-				stepContainer.Pull(rc.Config.ForcePull),
+				stepContainer.Pull(rc.forcePull(image)),
 				stepContainer.Remove().IfBool(!rc.Config.ReuseContainers),
 				stepContainer.Create(),
 				stepContainer.Start(true),
@@ -496,72 +731,194 @@ func (sc *StepContext) runAction(actionDir string, actionPath string) common.Exe
 			if err != nil {
 				return err
 			}
-			for outputName, output := range action.Outputs {
-				re := regexp.MustCompile(`\${{ steps\.([a-zA-Z_][a-zA-Z0-9_-]+)\.outputs\.([a-zA-Z_][a-zA-Z0-9_-]+) }}`)
-				matches := re.FindStringSubmatch(output.Value)
-				if len(matches) > 2 {
-					if sc.RunContext.OutputMappings == nil {
-						sc.RunContext.OutputMappings = make(map[MappableOutput]MappableOutput)
-					}
+			return sc.runCompositeSteps(action, containerActionDir, actionName)(ctx)
+		default:
+			return fmt.Errorf(fmt.Sprintf("The runs.using key must be one of: %v, got %s", []string{
+				model.ActionRunsUsingDocker,
+				model.ActionRunsUsingNode12,
+				model.ActionRunsUsingComposite,
+			}, action.Runs.Using))
+		}
+	}
+}
 
-					k := MappableOutput{StepID: matches[1], OutputName: matches[2]}
-					v := MappableOutput{StepID: step.ID, OutputName: outputName}
-					sc.RunContext.OutputMappings[k] = v
-				}
+func (sc *StepContext) runPreStep(ctx context.Context, containerActionDir string) error {
+	rc := sc.RunContext
+	action := sc.Action
+
+	rc.ExprEval = sc.NewExpressionEvaluator()
+	runPre, err := rc.EvalBool(lifecycleIf(action.Runs.PreIf))
+	if err != nil {
+		common.Logger(ctx).Errorf("  \u274C  Error in pre-if: expression - %s", sc.Step)
+		return err
+	}
+	if !runPre {
+		rc.Config.logger().Debugf("Skipping pre of step '%s' due to '%s'", sc.Step.String(), action.Runs.PreIf)
+		return nil
+	}
+
+	common.Logger(ctx).Infof("\u2B50  Run Pre %s", sc.Step)
+	containerArgs := []string{"node", path.Join(containerActionDir, action.Runs.Pre)}
+	rc.Config.logger().Debugf("executing remote job container: %s", containerArgs)
+	return sc.execWithState(containerArgs, sc.Env)(ctx)
+}
+
+// execWithState runs an entrypoint of the action with an empty GITHUB_STATE file and saves the
+// state written to it in the step result, where the post entrypoint picks it up
+func (sc *StepContext) execWithState(containerArgs []string, env map[string]string) common.Executor {
+	rc := sc.RunContext
+	result := rc.StepResults[rc.CurrentStep]
+	stateFile := rc.stepFilePath("GITHUB_STATE")
+	env = mergeMaps(env, map[string]string{"GITHUB_STATE": stateFile})
+
+	state := make(map[string]string)
+	saveState := func(ctx context.Context) error {
+		if result == nil || len(state) == 0 {
+			return nil
+		}
+		if result.State == nil {
+			result.State = make(map[string]string)
+		}
+		for k, v := range state {
+			result.State[k] = v
+		}
+		return nil
+	}
+
+	return common.NewPipelineExecutor(
+		rc.JobContainer.Copy(rc.containerWorkdir(), &container.FileEntry{
+			Name: rc.workflowFile("statecmd.txt"),
+			Mode: 0644,
+			Body: "",
+		}),
+		rc.execJobContainer(containerArgs, env).Finally(
+			rc.JobContainer.UpdateFromEnvFile(stateFile, &state).Then(saveState),
+		),
+	)
+}
+
+// newPostStepExecutor creates the executor for the post entrypoint of the action used by the step,
+// which sees the state saved by the step as STATE_ env vars
+func (sc *StepContext) newPostStepExecutor(containerActionDir string) common.Executor {
+	rc := sc.RunContext
+	step := sc.Step
+	action := sc.Action
+	result := rc.StepResults[rc.CurrentStep]
+
+	return func(ctx context.Context) error {
+		rc.CurrentStep = step.ID
+		rc.ExprEval = sc.NewExpressionEvaluator()
+
+		runPost, err := rc.EvalBool(lifecycleIf(action.Runs.PostIf))
+		if err != nil {
+			common.Logger(ctx).Errorf("  \u274C  Error in post-if: expression - %s", step)
+			return err
+		}
+		if !runPost {
+			rc.Config.logger().Debugf("Skipping post of step '%s' due to '%s'", step.String(), action.Runs.PostIf)
+			return nil
+		}
+
+		env := mergeMaps(sc.Env)
+		// what the steps wrote to GITHUB_ENV after the main step, unless the env of the step sets it
+		for k, v := range rc.githubEnv {
+			if _, ok := step.Env[k]; !ok {
+				env[k] = v
 			}
+		}
+		if result != nil {
+			for k, v := range result.State {
+				env[fmt.Sprintf("STATE_%s", k)] = v
+			}
+		}
 
-			var executors []common.Executor
-			stepID := 0
-			for _, compositeStep := range action.Runs.Steps {
-				stepClone := compositeStep
-				// Take a copy of the run context structure (rc is a pointer)
-				// Then take the address of the new structure
-				rcCloneStr := *rc
-				rcClone := &rcCloneStr
-				if stepClone.ID == "" {
-					stepClone.ID = fmt.Sprintf("composite-%d", stepID)
-					stepID++
-				}
-				rcClone.CurrentStep = stepClone.ID
+		common.Logger(ctx).Infof("\u2B50  Run Post %s", step)
+		containerArgs := []string{"node", path.Join(containerActionDir, action.Runs.Post)}
+		rc.Config.logger().Debugf("executing remote job container: %s", containerArgs)
+		err = rc.execJobContainer(containerArgs, env)(ctx)
+		if err == nil {
+			common.Logger(ctx).Infof("  \u2705  Success - Post %s", step)
+		} else {
+			common.Logger(ctx).Errorf("  \u274C  Failure - Post %s", step)
+		}
+		return err
+	}
+}
 
-				if err := compositeStep.Validate(); err != nil {
-					return err
-				}
+// lifecycleIf returns the condition of a pre or post entrypoint, which runs by default
+func lifecycleIf(expr string) string {
+	if expr == "" {
+		return "always()"
+	}
+	return expr
+}
 
-				// Setup the outputs for the composite steps
-				if _, ok := rcClone.StepResults[stepClone.ID]; !ok {
-					rcClone.StepResults[stepClone.ID] = &stepResult{
-						Success: true,
-						Outputs: make(map[string]string),
-					}
-				}
+// runCompositeSteps runs the steps of a composite action with their own steps context
+// and resolves the outputs of the action into the outputs of the step that uses it
+func (sc *StepContext) runCompositeSteps(action *model.Action, containerActionDir string, actionName string) common.Executor {
+	rc := sc.RunContext
+	step := sc.Step
+
+	return func(ctx context.Context) error {
+		parentResults, parentStep, parentExprEval := rc.StepResults, rc.CurrentStep, rc.ExprEval
+		compositeResults := make(map[string]*stepResult)
+		rc.StepResults = compositeResults
+		defer func() {
+			rc.StepResults, rc.CurrentStep, rc.ExprEval = parentResults, parentStep, parentExprEval
+		}()
+
+		var executors []common.Executor
+		stepID := 0
+		for _, compositeStep := range action.Runs.Steps {
+			stepClone := compositeStep
+			if stepClone.ID == "" {
+				stepClone.ID = fmt.Sprintf("composite-%d", stepID)
+				stepID++
+			}
 
-				stepClone.Run = strings.ReplaceAll(stepClone.Run, "${{ github.action_path }}", filepath.Join(containerActionDir, actionName))
+			stepClone.Run = strings.ReplaceAll(stepClone.Run, "${{ github.action_path }}", filepath.Join(containerActionDir, actionName))
 
-				stepContext := StepContext{
-					RunContext: rcClone,
-					Step:       &stepClone,
-					Env:        mergeMaps(sc.Env, stepClone.Env),
+			stepContext := &StepContext{
+				RunContext: rc,
+				Step:       &stepClone,
+				Env:        mergeMaps(sc.Env, stepClone.Env),
+			}
+
+			// Interpolate the outer inputs into the composite step with items
+			exprEval := sc.NewExpressionEvaluator()
+			for k, v := range stepContext.Step.With {
+				if strings.Contains(v, "inputs") {
+					stepContext.Step.With[k] = exprEval.Interpolate(v)
 				}
+			}
 
-				// Interpolate the outer inputs into the composite step with items
-				exprEval := sc.NewExpressionEvaluator()
-				for k, v := range stepContext.Step.With {
-					if strings.Contains(v, "inputs") {
-						stepContext.Step.With[k] = exprEval.Interpolate(v)
-					}
+			executors = append(executors, func(ctx context.Context) error {
+				rc.CurrentStep = stepContext.Step.ID
+				compositeResults[stepContext.Step.ID] = &stepResult{
+					Success: true,
+					Outputs: make(map[string]string),
 				}
+				// the expressions of the step see the outputs of the steps before it
+				rc.ExprEval = sc.newCompositeExpressionEvaluator(stepContext.Env)
+				return rc.finishStep(ctx, stepContext.Step, rc.withStepFiles(stepContext.Executor())(ctx))
+			})
+		}
 
-				executors = append(executors, stepContext.Executor())
-			}
-			return common.NewPipelineExecutor(executors...)(ctx)
-		default:
-			return fmt.Errorf(fmt.Sprintf("The runs.using key must be one of: %v, got %s", []string{
-				model.ActionRunsUsingDocker,
-				model.ActionRunsUsingNode12,
-				model.ActionRunsUsingComposite,
-			}, action.Runs.Using))
+		if err := common.NewPipelineExecutor(executors...)(ctx); err != nil {
+			return err
+		}
+
+		result, ok := parentResults[step.ID]
+		if !ok {
+			return nil
+		}
+		exprEval := sc.newCompositeExpressionEvaluator(sc.Env)
+		for outputName, output := range action.Outputs {
+			value := exprEval.Interpolate(output.Value)
+			common.Logger(ctx).Debugf("composite output %s=%s", outputName, value)
+			result.Outputs[outputName] = value
 		}
+		return nil
 	}
 }
 
@@ -572,8 +929,9 @@ type remoteAction struct {
 	Ref  string
 }
 
-func (ra *remoteAction) CloneURL() string {
-	return fmt.Sprintf("https://github.com/%s/%s", ra.Org, ra.Repo)
+// CloneURL returns the URL of the repository of the action on the GitHub instance, e.g. github.com
+func (ra *remoteAction) CloneURL(githubInstance string) string {
+	return fmt.Sprintf("https://%s/%s/%s", githubInstance, ra.Org, ra.Repo)
 }
 
 func (ra *remoteAction) IsCheckout() bool {
@@ -583,6 +941,22 @@ func (ra *remoteAction) IsCheckout() bool {
 	return false
 }
 
+// rewriteAction returns uses with the longest prefix of Config.ActionRewrites that matches it replaced, and
+// true if one matches. A prefix is an owner or owner/repo and matches whole path segments, so actions
+// matches actions/checkout@v4 but not actions-mirror/checkout@v4.
+func (config *Config) rewriteAction(uses string) (string, bool) {
+	longest := ""
+	for from := range config.ActionRewrites {
+		if len(from) > len(longest) && (strings.HasPrefix(uses, from+"/") || strings.HasPrefix(uses, from+"@")) {
+			longest = from
+		}
+	}
+	if longest == "" {
+		return uses, false
+	}
+	return config.ActionRewrites[longest] + strings.TrimPrefix(uses, longest), true
+}
+
 func newRemoteAction(action string) *remoteAction {
 	// GitHub's document[^] describes:
 	// > We strongly recommend that you include the version of
@@ -606,11 +980,11 @@ func newRemoteAction(action string) *remoteAction {
 // files in .gitignore are not copied in a Docker container
 // this causes issues with actions that ignore other important resources
 // such as `node_modules` for example
-func removeGitIgnore(directory string) error {
+func (rc *RunContext) removeGitIgnore(directory string) error {
 	gitIgnorePath := path.Join(directory, ".gitignore")
 	if _, err := os.Stat(gitIgnorePath); err == nil {
 		// .gitignore exists
-		log.Debugf("Removing %s before docker cp", gitIgnorePath)
+		rc.Config.logger().Debugf("Removing %s before docker cp", gitIgnorePath)
 		err := os.Remove(gitIgnorePath)
 		if err != nil {
 			return err
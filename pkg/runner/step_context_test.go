@@ -2,13 +2,37 @@ package runner
 
 import (
 	"context"
+	"io/ioutil"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/joho/godotenv"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+
 	"github.com/nektos/act/pkg/common"
+	"github.com/nektos/act/pkg/container"
+	"github.com/nektos/act/pkg/model"
 )
 
+// newTestRunContext returns the RunContext of the job jobID of workflow, a workflow with an empty job if nil,
+// with config and jobContainer and an evaluator
+func newTestRunContext(config *Config, workflow *model.Workflow, jobID string, jobContainer container.Container) *RunContext {
+	if workflow == nil {
+		workflow = &model.Workflow{Jobs: map[string]*model.Job{jobID: {}}}
+	}
+	rc := &RunContext{
+		Config:       config,
+		Run:          &model.Run{JobID: jobID, Workflow: workflow},
+		StepResults:  map[string]*stepResult{},
+		JobContainer: jobContainer,
+	}
+	rc.ExprEval = rc.NewExpressionEvaluator()
+	return rc
+}
+
 func TestStepContextExecutor(t *testing.T) {
 	platforms := map[string]string{
 		"ubuntu-latest": "node:12.20.1-buster-slim",
@@ -27,3 +51,618 @@ func TestStepContextExecutor(t *testing.T) {
 		runTestJobFile(ctx, t, table, secrets)
 	}
 }
+
+func TestStepContextCompositeOutputs(t *testing.T) {
+	workdir, err := filepath.Abs("testdata")
+	assert.NoError(t, err)
+
+	rc := newTestRunContext(&Config{Workdir: workdir}, nil, "test", container.NewContainer(&container.NewContainerInput{}))
+	rc.StepResults["composite"] = &stepResult{Success: true, Outputs: make(map[string]string)}
+	rc.CurrentStep = "composite"
+
+	sc := &StepContext{
+		RunContext: rc,
+		Step: &model.Step{
+			ID:   "composite",
+			Uses: "./uses-composite/composite_action",
+			With: map[string]string{
+				"test_input_required": "test_input_required_value",
+			},
+		},
+		Env: map[string]string{},
+	}
+
+	ctx := common.WithDryrun(context.Background(), true)
+	assert.NoError(t, sc.Executor()(ctx))
+
+	// outputs of the nested composite action are resolved in its own steps context and passed up
+	outputs := rc.StepResults["composite"].Outputs
+	assert.Equal(t, "test_input_required_value", outputs["nested_name"])
+	assert.Contains(t, outputs, "nested_greeting")
+	assert.Contains(t, outputs, "test_output")
+
+	// the steps of the composite action don't leak into the steps context of the job
+	assert.Len(t, rc.StepResults, 1)
+	assert.Equal(t, "composite", rc.CurrentStep)
+}
+
+func TestStepContextPrePostSteps(t *testing.T) {
+	workdir, err := filepath.Abs("testdata")
+	assert.NoError(t, err)
+
+	steps := []*model.Step{
+		{ID: "first", Name: "first", Uses: "./actions/pre-post"},
+		{ID: "second", Name: "second", Uses: "./actions/pre-post", With: map[string]string{"run-pre": "false"}},
+		{ID: "failing", Name: "failing", Uses: "./actions/missing"},
+	}
+	workflow := &model.Workflow{Jobs: map[string]*model.Job{"test": {Steps: steps}}}
+	rc := newTestRunContext(&Config{Workdir: workdir}, workflow, "test", container.NewContainer(&container.NewContainerInput{}))
+
+	logger, hook := test.NewNullLogger()
+	ctx := common.WithLogger(common.WithDryrun(context.Background(), true), logger)
+
+	var executors []common.Executor
+	for _, step := range steps {
+		executors = append(executors, rc.newStepExecutor(step))
+	}
+	err = common.NewPipelineExecutor(executors...).Finally(rc.runPostSteps())(ctx)
+	assert.Error(t, err)
+
+	var lifecycle []string
+	for _, entry := range hook.AllEntries() {
+		if strings.Contains(entry.Message, "Run Pre") || strings.Contains(entry.Message, "Run Post") {
+			lifecycle = append(lifecycle, entry.Message)
+		}
+	}
+	// pre respects pre-if, the post steps run in reverse order even though a step failed
+	assert.Equal(t, []string{
+		"⭐  Run Pre first",
+		"⭐  Run Post second",
+		"⭐  Run Post first",
+	}, lifecycle)
+}
+
+func TestStepContextRunActionEnv(t *testing.T) {
+	workdir, err := filepath.Abs("testdata")
+	assert.NoError(t, err)
+
+	// a step context without env gets the env of the action. The workdir is bound, so the action isn't
+	// copied and its .gitignore in testdata isn't removed
+	rc := newTestRunContext(&Config{Workdir: workdir, BindWorkdir: true}, nil, "test", container.NewContainer(&container.NewContainerInput{}))
+	sc := &StepContext{
+		RunContext: rc,
+		Step:       &model.Step{ID: "action", Uses: "./actions/node12", With: map[string]string{"who": "act"}},
+		Action: &model.Action{
+			Inputs: map[string]model.Input{"who": {}},
+			Runs:   model.ActionRuns{Using: model.ActionRunsUsingNode12, Main: "index.js", Env: map[string]string{"GREETING": "hello ${{ inputs.who }}"}},
+		},
+	}
+	err = sc.runAction(filepath.Join(workdir, "actions", "node12"), "")(common.WithDryrun(context.Background(), true))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello act", sc.Env["GREETING"])
+}
+
+func TestStepContextDockerArgsInterpolatedOnce(t *testing.T) {
+	workdir, err := filepath.Abs("testdata")
+	assert.NoError(t, err)
+
+	// the values the expressions evaluate to are passed to the container as they are
+	env := map[string]string{"WHO": "${{ github.actor }}"}
+	rc := newTestRunContext(&Config{Workdir: workdir, Actor: "nektos/act"}, nil, "test", container.NewContainer(&container.NewContainerInput{}))
+	logger, hook := test.NewNullLogger()
+	ctx := common.WithLogger(common.WithDryrun(context.Background(), true), logger)
+
+	sc := &StepContext{
+		RunContext: rc,
+		Env:        mergeMaps(env),
+		Step:       &model.Step{ID: "action", Uses: "./actions/docker-url", With: map[string]string{"who": "${{ env.WHO }}"}},
+		Action: &model.Action{
+			Inputs: map[string]model.Input{"who": {}},
+			Runs:   model.ActionRuns{Using: model.ActionRunsUsingDocker, Image: "docker://node:12-alpine", Args: []string{"--who=${{ inputs.who }}"}},
+		},
+	}
+	assert.NoError(t, sc.runAction(filepath.Join(workdir, "actions", "docker-url"), "")(ctx))
+
+	sc = &StepContext{
+		RunContext: rc,
+		Env:        mergeMaps(env),
+		Step:       &model.Step{ID: "docker", Uses: "docker://node:12-alpine", With: map[string]string{"args": `"--who=${{ env.WHO }}"`}},
+	}
+	assert.NoError(t, sc.runUsesContainer()(ctx))
+
+	var commands []string
+	for _, entry := range hook.AllEntries() {
+		if strings.Contains(entry.Message, "Would run") {
+			commands = append(commands, entry.Message)
+		}
+	}
+	assert.Len(t, commands, 2)
+	assert.Contains(t, commands[0], `["--who=${{ github.actor }}"]`)
+	assert.Contains(t, commands[1], `["--who=${{ github.actor }}"]`)
+	for _, command := range commands {
+		assert.NotContains(t, command, "nektos/act")
+	}
+}
+
+type scriptRecorder struct {
+	container.Container
+	files []*container.FileEntry
+}
+
+func (sr *scriptRecorder) Copy(destPath string, files ...*container.FileEntry) common.Executor {
+	return func(ctx context.Context) error {
+		sr.files = append(sr.files, files...)
+		return nil
+	}
+}
+
+func TestStepContextSetupShellCommandBlockScalars(t *testing.T) {
+	workflow, err := model.ReadWorkflow(strings.NewReader(`
+name: block-scalars
+on: push
+
+jobs:
+  test:
+    runs-on: ubuntu-latest
+    steps:
+    - id: literal
+      run: |
+        echo "one"
+          indented
+
+        echo "two"
+    - id: literal-strip
+      run: |-
+        echo "one"
+        echo "two"
+    - id: literal-keep
+      run: |+
+        echo "one"
+
+
+    - id: folded
+      run: >
+        echo one
+        two
+
+        echo three
+          indented
+    - id: folded-strip
+      run: >-
+        echo one
+        two
+`))
+	assert.NoError(t, err)
+
+	for id, expected := range map[string]string{
+		"literal":       "echo \"one\"\n  indented\n\necho \"two\"\n",
+		"literal-strip": "echo \"one\"\necho \"two\"",
+		"literal-keep":  "echo \"one\"\n\n\n",
+		"folded":        "echo one two\necho three\n  indented\n",
+		"folded-strip":  "echo one two",
+	} {
+		var step *model.Step
+		for _, s := range workflow.Jobs["test"].Steps {
+			if s.ID == id {
+				step = s
+			}
+		}
+		if !assert.NotNil(t, step, id) {
+			continue
+		}
+
+		recorder := &scriptRecorder{}
+		rc := newTestRunContext(&Config{}, workflow, "test", recorder)
+		sc := &StepContext{RunContext: rc, Step: step}
+
+		assert.NoError(t, sc.setupShellCommand()(context.Background()), id)
+		if assert.Len(t, recorder.files, 1, id) {
+			assert.Equal(t, expected, recorder.files[0].Body, id)
+		}
+	}
+}
+
+func TestStepContextSetupShellCommandDefaults(t *testing.T) {
+	workflow, err := model.ReadWorkflow(strings.NewReader(`
+name: defaults
+on: push
+
+defaults:
+  run:
+    shell: sh
+    working-directory: workflow-dir
+
+jobs:
+  workflow-defaults:
+    runs-on: ubuntu-latest
+    steps:
+    - id: inherit
+      run: echo
+  job-defaults:
+    runs-on: ubuntu-latest
+    defaults:
+      run:
+        shell: python
+        working-directory: job dir
+    steps:
+    - id: inherit
+      run: print()
+    - id: override
+      run: echo
+      shell: bash
+      working-directory: ${{ matrix.dir }}
+`))
+	assert.NoError(t, err)
+
+	tables := []struct {
+		jobID  string
+		stepID string
+		name   string
+		cmd    []string
+		body   string
+	}{
+		{"workflow-defaults", "inherit", "workflow/inherit.sh", []string{"sh", "-e", "/tmp/workflow/inherit.sh"}, "mkdir -p workflow-dir && cd workflow-dir || exit 1\necho"},
+		{"job-defaults", "inherit", "workflow/inherit.py", []string{"python", "/tmp/workflow/inherit.py"}, "import os; os.makedirs(\"job dir\", exist_ok=True); os.chdir(\"job dir\")\nprint()"},
+		{"job-defaults", "override", "workflow/override.sh", []string{"bash", "--noprofile", "--norc", "-eo", "pipefail", "/tmp/workflow/override.sh"}, "mkdir -p 'step dir' && cd 'step dir' || exit 1\necho"},
+	}
+
+	for _, table := range tables {
+		var step *model.Step
+		for _, s := range workflow.Jobs[table.jobID].Steps {
+			if s.ID == table.stepID {
+				step = s
+			}
+		}
+
+		recorder := &scriptRecorder{}
+		rc := newTestRunContext(&Config{Workdir: "/tmp"}, workflow, table.jobID, recorder)
+		rc.Matrix = map[string]interface{}{"dir": "step dir"}
+		rc.ExprEval = rc.NewExpressionEvaluator()
+		sc := &StepContext{RunContext: rc, Step: step}
+
+		name := table.jobID + "/" + table.stepID
+		assert.NoError(t, sc.setupShellCommand()(context.Background()), name)
+		assert.Equal(t, table.cmd, sc.Cmd, name)
+		if assert.Len(t, recorder.files, 1, name) {
+			assert.Equal(t, table.name, recorder.files[0].Name, name)
+			assert.Equal(t, table.body, recorder.files[0].Body, name)
+		}
+	}
+}
+
+func TestStepContextSetupShellCommandShells(t *testing.T) {
+	tables := []struct {
+		shell string
+		name  string
+		cmd   []string
+		body  string
+	}{
+		{"", "workflow/test.sh", []string{"bash", "-e", "/tmp/workflow/test.sh"}, "echo\nfoo"},
+		{"bash", "workflow/test.sh", []string{"bash", "--noprofile", "--norc", "-eo", "pipefail", "/tmp/workflow/test.sh"}, "echo\nfoo"},
+		{"sh", "workflow/test.sh", []string{"sh", "-e", "/tmp/workflow/test.sh"}, "echo\nfoo"},
+		{"python", "workflow/test.py", []string{"python", "/tmp/workflow/test.py"}, "echo\nfoo"},
+		{"pwsh", "workflow/test.ps1", []string{"pwsh", "-command", ". '/tmp/workflow/test.ps1'"}, "$ErrorActionPreference = 'stop'\necho\nfoo\nif ((Test-Path -LiteralPath variable:/LASTEXITCODE)) { exit $LASTEXITCODE }"},
+		{"bash -eo pipefail {0}", "workflow/test.sh", []string{"bash", "-eo", "pipefail", "/tmp/workflow/test.sh"}, "echo\nfoo"},
+		{"/usr/bin/python3 -u {0}", "workflow/test", []string{"/usr/bin/python3", "-u", "/tmp/workflow/test"}, "echo\nfoo"},
+		{`perl -e "do '{0}'"`, "workflow/test", []string{"perl", "-e", "do '/tmp/workflow/test'"}, "echo\nfoo"},
+	}
+
+	for _, table := range tables {
+		recorder := &scriptRecorder{}
+		rc := newTestRunContext(&Config{Workdir: "/tmp"}, nil, "job1", recorder)
+		sc := &StepContext{RunContext: rc, Step: &model.Step{ID: "test", Shell: table.shell, Run: "echo\nfoo"}}
+
+		assert.NoError(t, sc.setupShellCommand()(context.Background()), table.shell)
+		assert.Equal(t, table.cmd, sc.Cmd, table.shell)
+		if assert.Len(t, recorder.files, 1, table.shell) {
+			assert.Equal(t, table.name, recorder.files[0].Name, table.shell)
+			assert.Equal(t, table.body, recorder.files[0].Body, table.shell)
+		}
+	}
+
+	rc := newTestRunContext(&Config{}, nil, "job1", &scriptRecorder{})
+	sc := &StepContext{RunContext: rc, Step: &model.Step{ID: "test", Shell: "perl", Run: "print 1"}}
+	err := sc.setupShellCommand()(context.Background())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid shell option 'perl'")
+}
+
+func TestStepContextSetupShellCommandCustomShellWorkingDirectory(t *testing.T) {
+	tables := []struct {
+		shell string
+		body  string
+	}{
+		{"bash -eo pipefail {0}", "mkdir -p 'step dir' && cd 'step dir' || exit 1\necho foo"},
+		{"/usr/bin/python3 -u {0}", "import os; os.makedirs(\"step dir\", exist_ok=True); os.chdir(\"step dir\")\necho foo"},
+		{"python3.9 {0}", "import os; os.makedirs(\"step dir\", exist_ok=True); os.chdir(\"step dir\")\necho foo"},
+		{`perl -e "do '{0}'"`, "echo foo"},
+	}
+
+	for _, table := range tables {
+		recorder := &scriptRecorder{}
+		rc := newTestRunContext(&Config{Workdir: "/tmp"}, nil, "job1", recorder)
+		sc := &StepContext{RunContext: rc, Step: &model.Step{ID: "test", Shell: table.shell, Run: "echo foo", WorkingDirectory: "step dir"}}
+
+		assert.NoError(t, sc.setupShellCommand()(context.Background()), table.shell)
+		if assert.Len(t, recorder.files, 1, table.shell) {
+			assert.Equal(t, table.body, recorder.files[0].Body, table.shell)
+		}
+	}
+}
+
+func TestStepContextResolveInputs(t *testing.T) {
+	rc := newTestRunContext(&Config{Workdir: ".", EventName: "push", NoGitContext: true}, nil, "test", &execRecorder{})
+	rc.CurrentStep = "docker"
+
+	sc := &StepContext{
+		RunContext: rc,
+		Step: &model.Step{
+			ID:   "docker",
+			Uses: "./actions/docker-inputs",
+			Env:  map[string]string{"WHO": "Mona the Octocat"},
+			With: map[string]string{"who-to-greet": "${{ env.WHO }}", "undeclared": "value"},
+		},
+		Action: &model.Action{
+			Inputs: map[string]model.Input{
+				"greeting":     {Default: "Hello ${{ github.event_name }}"},
+				"who-to-greet": {Required: true},
+			},
+			Runs: model.ActionRuns{Args: []string{"${{ inputs.greeting }}", "--who=${{ inputs.who-to-greet }}"}},
+		},
+	}
+	exprEval, err := sc.setupEnv(context.Background())
+	assert.NoError(t, err)
+	rc.ExprEval = exprEval
+
+	assert.NoError(t, sc.resolveInputs())
+	assert.Equal(t, map[string]string{
+		"greeting":     "Hello push",
+		"who-to-greet": "Mona the Octocat",
+		"undeclared":   "value",
+	}, sc.Inputs)
+	assert.Equal(t, "Hello push", sc.Env["INPUT_GREETING"])
+	assert.Equal(t, "Mona the Octocat", sc.Env["INPUT_WHO-TO-GREET"])
+	assert.Equal(t, "Mona the Octocat", sc.Env["INPUT_WHO_TO_GREET"])
+	assert.Equal(t, "value", sc.Env["INPUT_UNDECLARED"])
+
+	// the args of the action see the same values as the env
+	exprEval = sc.NewExpressionEvaluator()
+	args := make([]string, 0)
+	for _, arg := range sc.Action.Runs.Args {
+		args = append(args, exprEval.Interpolate(arg))
+	}
+	assert.Equal(t, []string{"Hello push", "--who=Mona the Octocat"}, args)
+}
+
+func TestStepContextResolveInputsDefaults(t *testing.T) {
+	action, err := model.ReadAction(strings.NewReader(`
+name: defaults
+inputs:
+  cache:
+    default: false
+  retries:
+    default: 3
+  event:
+    default: ${{ github.event_name }}
+  node version:
+    required: true
+    default: "16"
+  token:
+    required: true
+runs:
+  using: node12
+  main: index.js
+`))
+	assert.NoError(t, err)
+
+	workflow, err := model.ReadWorkflow(strings.NewReader(`
+jobs:
+  test:
+    runs-on: ubuntu-latest
+    steps:
+    - uses: ./actions/defaults
+      with:
+        cache: true
+        token: ${{ github.event_name }}-token
+    - uses: ./actions/defaults
+`))
+	assert.NoError(t, err)
+
+	newStepContext := func(step *model.Step) *StepContext {
+		rc := newTestRunContext(&Config{Workdir: ".", EventName: "push", NoGitContext: true}, workflow, "test", &execRecorder{})
+		return &StepContext{RunContext: rc, Step: step, Action: action}
+	}
+
+	sc := newStepContext(workflow.Jobs["test"].Steps[0])
+	_, err = sc.setupEnv(context.Background())
+	assert.NoError(t, err)
+	assert.NoError(t, sc.resolveInputs())
+	assert.Equal(t, map[string]string{
+		"cache":        "true",
+		"retries":      "3",
+		"event":        "push",
+		"node version": "16",
+		"token":        "push-token",
+	}, sc.Inputs)
+	assert.Equal(t, "true", sc.Env["INPUT_CACHE"])
+	assert.Equal(t, "3", sc.Env["INPUT_RETRIES"])
+	assert.Equal(t, "push", sc.Env["INPUT_EVENT"])
+	assert.Equal(t, "16", sc.Env["INPUT_NODE_VERSION"])
+	assert.Equal(t, "push-token", sc.Env["INPUT_TOKEN"])
+
+	sc = newStepContext(workflow.Jobs["test"].Steps[1])
+	_, err = sc.setupEnv(context.Background())
+	assert.NoError(t, err)
+	assert.EqualError(t, sc.resolveInputs(), "Input 'token' is required for action './actions/defaults'")
+}
+
+func TestStepContextSetupEnvStepEnvOverride(t *testing.T) {
+	rc := newTestRunContext(&Config{
+		Workdir:         ".",
+		EventName:       "push",
+		NoGitContext:    true,
+		Env:             map[string]string{"npm_config_loglevel": "verbose"},
+		StepEnvOverride: map[string]string{"FORCE_COLOR": "1", "NO_UPDATE_NOTIFIER": "1", "npm_config_loglevel": "silent"},
+	}, nil, "test", &execRecorder{})
+
+	// the env of the workflow and the step win over the override
+	action := &StepContext{
+		RunContext: rc,
+		Step:       &model.Step{ID: "action", Uses: "./actions/docker-inputs", Env: map[string]string{"FORCE_COLOR": "0"}},
+	}
+	_, err := action.setupEnv(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "0", action.Env["FORCE_COLOR"])
+	assert.Equal(t, "1", action.Env["NO_UPDATE_NOTIFIER"])
+	assert.Equal(t, "verbose", action.Env["npm_config_loglevel"])
+
+	script := &StepContext{
+		RunContext: rc,
+		Step:       &model.Step{ID: "script", Run: "npm test"},
+	}
+	_, err = script.setupEnv(context.Background())
+	assert.NoError(t, err)
+	assert.NotContains(t, script.Env, "FORCE_COLOR")
+	assert.NotContains(t, script.Env, "NO_UPDATE_NOTIFIER")
+}
+
+func TestStepContextStepOutputEnv(t *testing.T) {
+	workflow := &model.Workflow{Jobs: map[string]*model.Job{"test": {Steps: []*model.Step{
+		{ID: "a-b"},
+		{ID: "a_b"},
+		{ID: "current"},
+	}}}}
+	rc := newTestRunContext(&Config{}, workflow, "test", nil)
+	rc.StepResults = map[string]*stepResult{
+		"a-b":     {Outputs: map[string]string{"tag": "first", "out-name": "first", "out_name": "second"}},
+		"a_b":     {Outputs: map[string]string{"tag": "second"}},
+		"current": {Outputs: map[string]string{"tag": "current"}},
+	}
+	rc.CurrentStep = "current"
+
+	// the ids and the names that are the same once replaced resolve in the order of the steps and the names
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, map[string]string{
+			"STEPS_A_B_TAG":      "second",
+			"STEPS_A_B_OUT_NAME": "second",
+		}, rc.stepOutputEnv())
+	}
+}
+
+func TestStepContextMergeEnvExtraPath(t *testing.T) {
+	workflow, err := model.ReadWorkflow(strings.NewReader(`
+name: extra-path
+on: push
+jobs:
+  host:
+    runs-on: ubuntu-latest
+    steps:
+      - run: tool
+  container:
+    runs-on: ubuntu-20.04
+    steps:
+      - run: tool
+`))
+	assert.NoError(t, err)
+
+	for jobID, path := range map[string]string{
+		"host":      os.Getenv("PATH"),
+		"container": container.DefaultPathEnv,
+	} {
+		// spare capacity, like the slices append grows, must not be written to
+		extraPath := append(make([]string, 0, 4), "/zoo")
+		rc := newTestRunContext(&Config{
+			Workdir:   ".",
+			EventName: "push",
+			Platforms: map[string]string{"ubuntu-latest": container.HostImage, "ubuntu-20.04": "node:12-buster-slim"},
+		}, workflow, jobID, nil)
+		rc.ExtraPath = extraPath
+
+		sc := &StepContext{RunContext: rc, Step: workflow.Jobs[jobID].Steps[0]}
+		env := sc.mergeEnv()
+		assert.Equal(t, "/zoo:"+path, env["PATH"], jobID)
+		assert.Equal(t, []string{"/zoo"}, rc.ExtraPath, jobID)
+		assert.Equal(t, []string{"/zoo", ""}, extraPath[:2], jobID)
+	}
+}
+
+func TestStepContextSetupActionLocal(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "act-local-action")
+	assert.NoError(t, err)
+	defer os.RemoveAll(workdir)
+
+	files := map[string]string{
+		"actions/yml/action.yml":    "name: yml\nruns:\n  using: node12\n  main: index.js\n",
+		"actions/yaml/action.yaml":  "name: yaml\nruns:\n  using: composite\n  steps: []\n",
+		"actions/docker/Dockerfile": "FROM alpine\n",
+		"actions/none/README.md":    "no action here\n",
+	}
+	for name, content := range files {
+		assert.NoError(t, os.MkdirAll(filepath.Join(workdir, filepath.Dir(name)), 0755))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(workdir, name), []byte(content), 0644))
+	}
+
+	// the workdir is relative to the directory act runs in, ./ is still its root
+	cwd, err := os.Getwd()
+	assert.NoError(t, err)
+	relative, err := filepath.Rel(cwd, workdir)
+	assert.NoError(t, err)
+
+	for _, table := range []struct {
+		uses  string
+		name  string
+		using string
+		err   string
+	}{
+		{"./actions/yml", "yml", "node12", ""},
+		{"./actions/yaml", "yaml", "composite", ""},
+		{"./actions/docker", "(Synthetic)", "docker", ""},
+		{"./actions/none", "", "", "there is no action.yml, action.yaml or Dockerfile in '" + filepath.Join(workdir, "actions/none") + "' for ./actions/none"},
+	} {
+		step := &model.Step{ID: "local", Uses: table.uses, WorkingDirectory: "actions"}
+		rc := &RunContext{Config: &Config{Workdir: relative}}
+		sc := &StepContext{RunContext: rc, Step: step}
+
+		actionDir := rc.localActionDir(step.Uses)
+		assert.Equal(t, filepath.Join(workdir, table.uses), actionDir)
+
+		err := sc.setupAction(actionDir, "")(context.Background())
+		if table.err != "" {
+			assert.EqualError(t, err, table.err, table.uses)
+			continue
+		}
+		assert.NoError(t, err, table.uses)
+		assert.Equal(t, table.name, sc.Action.Name, table.uses)
+		assert.Equal(t, table.using, string(sc.Action.Runs.Using), table.uses)
+	}
+}
+
+func TestStepContextRewriteAction(t *testing.T) {
+	config := &Config{ActionRewrites: map[string]string{
+		"actions":       "my-mirror",
+		"actions/cache": "cache-mirror/cache",
+		"octo-org/repo": "octo-mirror/repo",
+	}}
+
+	for _, table := range []struct {
+		uses      string
+		rewritten string
+		ok        bool
+	}{
+		{"actions/checkout@v4", "my-mirror/checkout@v4", true},
+		{"actions/setup-node/sub/path@v2", "my-mirror/setup-node/sub/path@v2", true},
+		{"actions/cache@v3", "cache-mirror/cache@v3", true},
+		{"octo-org/repo@main", "octo-mirror/repo@main", true},
+		{"octo-org/repo-two@main", "octo-org/repo-two@main", false},
+		{"actions-mirror/checkout@v4", "actions-mirror/checkout@v4", false},
+		{"other/action@v1", "other/action@v1", false},
+	} {
+		rewritten, ok := config.rewriteAction(table.uses)
+		assert.Equal(t, table.rewritten, rewritten, table.uses)
+		assert.Equal(t, table.ok, ok, table.uses)
+	}
+
+	rewritten, ok := (&Config{}).rewriteAction("actions/checkout@v4")
+	assert.Equal(t, "actions/checkout@v4", rewritten)
+	assert.False(t, ok)
+}
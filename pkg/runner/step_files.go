@@ -0,0 +1,99 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nektos/act/pkg/common"
+	"github.com/nektos/act/pkg/container"
+)
+
+// stepFiles are the files in the workflow directory a step writes its outputs, env, state and
+// summary to, by the env var that has their path
+var stepFiles = []struct {
+	envName string
+	name    string
+	job     bool // the file is created once for the job and kept, every step appends to it
+}{
+	{"GITHUB_OUTPUT", "outputcmd.txt", false},
+	{"GITHUB_ENV", "envs.txt", false},
+	{"GITHUB_STATE", "statecmd.txt", false},
+	{"GITHUB_STEP_SUMMARY", "SUMMARY.md", true},
+}
+
+// workflowFile returns the path of the file name in the workflow directory of the job, relative to the
+// workspace. It's workflow/name unless the job container shares the workspace with other jobs, then every
+// run of a job has its own directory in workflow, so e.g. the legs of a matrix running at the same time
+// don't read each other's scripts and step files.
+func (rc *RunContext) workflowFile(name string) string {
+	if rc.onHost || rc.Config.BindWorkdir {
+		return fmt.Sprintf("workflow/%s/%s", rc.jobContainerName(), name)
+	}
+	return fmt.Sprintf("workflow/%s", name)
+}
+
+// stepFilePath returns the path in the job container of the step file in env var envName
+func (rc *RunContext) stepFilePath(envName string) string {
+	for _, file := range stepFiles {
+		if file.envName == envName {
+			return fmt.Sprintf("%s/%s", rc.containerWorkdir(), rc.workflowFile(file.name))
+		}
+	}
+	return ""
+}
+
+// resetStepFiles replaces the step files with empty ones, the files of the job are only replaced with job
+func (rc *RunContext) resetStepFiles(job bool) common.Executor {
+	files := make([]*container.FileEntry, 0, len(stepFiles))
+	for _, file := range stepFiles {
+		if file.job && !job {
+			continue
+		}
+		files = append(files, &container.FileEntry{Name: rc.workflowFile(file.name), Mode: 0644, Body: ""})
+	}
+	return rc.JobContainer.Copy(rc.containerWorkdir(), files...)
+}
+
+// withStepFiles runs the executor of the current step, or post step, with empty step files. Afterwards
+// what the step wrote to GITHUB_OUTPUT is added to its outputs and what it wrote to GITHUB_ENV to the env
+// of the later steps, then the files are emptied, so a step never reads what another one left in them.
+// The summary is the one of the job, what the steps append to it is kept.
+func (rc *RunContext) withStepFiles(executor common.Executor) common.Executor {
+	return func(ctx context.Context) error {
+		if err := rc.resetStepFiles(false)(ctx); err != nil {
+			return err
+		}
+
+		err := executor(ctx)
+		// a post step sets the current step once it runs
+		result := rc.StepResults[rc.CurrentStep]
+
+		outputs := make(map[string]string)
+		env := make(map[string]string)
+		collectErr := common.NewPipelineExecutor(
+			rc.JobContainer.UpdateFromEnvFile(rc.stepFilePath("GITHUB_OUTPUT"), &outputs),
+			rc.JobContainer.UpdateFromEnvFile(rc.stepFilePath("GITHUB_ENV"), &env),
+			rc.resetStepFiles(false),
+		)(common.WithoutCancel(ctx))
+
+		if result != nil {
+			if result.Outputs == nil {
+				result.Outputs = make(map[string]string)
+			}
+			for k, v := range outputs {
+				result.Outputs[k] = v
+			}
+		}
+		if rc.githubEnv == nil {
+			rc.githubEnv = make(map[string]string)
+		}
+		for k, v := range env {
+			rc.githubEnv[k] = v
+		}
+
+		if err != nil {
+			return err
+		}
+		return collectErr
+	}
+}
@@ -0,0 +1,47 @@
+package runner
+
+import (
+	"context"
+
+	"github.com/nektos/act/pkg/common"
+	"github.com/nektos/act/pkg/model"
+)
+
+// StepHookEvent describes the step a StepHook is called for
+type StepHookEvent struct {
+	Workflow   string // name of the workflow
+	JobID      string // id of the job
+	Job        string // name of the job, with the number of the matrix combination
+	StepID     string // id of the step
+	Step       string // name of the step
+	Outcome    string // result of the step before continue-on-error is applied, empty before the step
+	Conclusion string // result of the step after continue-on-error is applied, empty before the step
+}
+
+// StepHook is called by act before or after a step runs, steps that are skipped by their `if` are left out
+type StepHook func(ctx context.Context, event StepHookEvent) error
+
+// runStepHook calls hook for step. An error of the hook is only logged, unless Config.StrictStepHooks
+// is set and the error is returned.
+func (rc *RunContext) runStepHook(ctx context.Context, hook StepHook, step *model.Step) error {
+	if hook == nil {
+		return nil
+	}
+	event := StepHookEvent{
+		Workflow: rc.Run.Workflow.Name,
+		JobID:    rc.Run.JobID,
+		Job:      rc.Name,
+		StepID:   step.ID,
+		Step:     step.String(),
+	}
+	if result, ok := rc.StepResults[step.ID]; ok {
+		event.Outcome, event.Conclusion = result.Outcome, result.Conclusion
+	}
+
+	err := hook(ctx, event)
+	if err != nil && !rc.Config.StrictStepHooks {
+		common.Logger(ctx).Warnf("  ⚠  Hook of step %s failed: %v", step, err)
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,5 @@
+#!/bin/sh -l
+
+[ "$1" = "Howdy" ] || { echo "unexpected greeting '$1'"; exit 1; }
+[ "$2" = "Mona the Octocat" ] || { echo "unexpected name '$2'"; exit 1; }
+[ "$GREETING" = "Howdy" ] || { echo "unexpected GREETING '$GREETING'"; exit 1; }
@@ -0,0 +1,5 @@
+#!/bin/sh -l
+
+[ "$1" = "one" ] || { echo "unexpected first arg '$1'"; exit 1; }
+[ "$2" = "two three" ] || { echo "unexpected second arg '$2'"; exit 1; }
+[ "$GREETING" = "Hello" ] || { echo "unexpected GREETING '$GREETING'"; exit 1; }
@@ -0,0 +1,7 @@
+#!/bin/sh -l
+
+[ "$1" = "Hello push" ] || { echo "unexpected greeting arg '$1'"; exit 1; }
+[ "$INPUT_GREETING" = "$1" ] || { echo "unexpected INPUT_GREETING '$INPUT_GREETING'"; exit 1; }
+[ "$2" = "--who=Mona the Octocat" ] || { echo "unexpected who arg '$2'"; exit 1; }
+# the name has a dash, so the shell can't expand it
+[ "$(printenv INPUT_WHO-TO-GREET)" = "Mona the Octocat" ] || { echo "unexpected INPUT_WHO-TO-GREET '$(printenv INPUT_WHO-TO-GREET)'"; exit 1; }
@@ -0,0 +1,7 @@
+const version = process.env['INPUT_NODE-VERSION'];
+if (process.env['INPUT_NODE_VERSION'] !== version) {
+  console.log(`INPUT_NODE_VERSION is ${process.env['INPUT_NODE_VERSION']}, not ${version}`);
+  process.exit(1);
+}
+const who = process.env['INPUT_WHO_TO_GREET'];
+console.log(`::set-output name=inputs::${version} ${who}`);
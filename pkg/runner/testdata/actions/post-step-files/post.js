@@ -0,0 +1,10 @@
+const fs = require('fs');
+
+// the post steps run in reverse order, the one that reads runs after the one that writes
+if (process.env.INPUT_WRITE === 'true') {
+  fs.appendFileSync(process.env.GITHUB_ENV, 'FROM_POST=post\n');
+  fs.appendFileSync(process.env.GITHUB_OUTPUT, 'post=ran\n');
+} else if (process.env.FROM_POST !== 'post') {
+  console.log(`FROM_POST=${process.env.FROM_POST}`);
+  process.exit(1);
+}
@@ -0,0 +1,9 @@
+const fs = require('fs');
+
+if (process.env.STATE_pre) {
+  console.log('state is only available to post');
+  process.exit(1);
+}
+console.log('::save-state name=key::main-value');
+fs.appendFileSync(process.env.GITHUB_STATE, 'file_key=file-value\n');
+fs.appendFileSync(process.env.GITHUB_STATE, 'multiline<<EOF\nfirst\nsecond\nEOF\n');
@@ -0,0 +1,13 @@
+const expected = {
+  STATE_pre: 'ran',
+  STATE_key: 'main-value',
+  STATE_file_key: 'file-value',
+  STATE_multiline: 'first\nsecond',
+};
+
+for (const [name, value] of Object.entries(expected)) {
+  if (process.env[name] !== value) {
+    console.log(`${name}=${process.env[name]}`);
+    process.exit(1);
+  }
+}
@@ -0,0 +1 @@
+console.log('::save-state name=pre::ran');
@@ -0,0 +1,104 @@
+package runner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/andreaskoch/go-fswatch"
+	gitignore "github.com/sabhiram/go-gitignore"
+
+	"github.com/nektos/act/pkg/common"
+)
+
+const (
+	defaultWatchInterval = 2 * time.Second
+	defaultWatchDebounce = 500 * time.Millisecond
+)
+
+// WatchOptions are the options of NewWatchExecutor
+type WatchOptions struct {
+	Dir      string        // directory watched for changes, with its subdirectories
+	Ignore   []string      // .gitignore patterns of the paths in Dir whose changes are ignored, besides .git and those of the .gitignore of Dir
+	Interval time.Duration // how often Dir is checked for changes, in whole seconds, 2s if not set
+	Debounce time.Duration // how long to wait for more changes before running again, 500ms if not set
+}
+
+// NewWatchExecutor returns an executor that runs executor, e.g. of NewPlanExecutor, then runs it again each time
+// files change in options.Dir. A run still in progress when files change is cancelled, and waited for, before
+// the next one starts. The errors of the runs are logged, the executor keeps watching until ctx is cancelled.
+func NewWatchExecutor(options WatchOptions, executor common.Executor) common.Executor {
+	return func(ctx context.Context) error {
+		logger := common.Logger(ctx)
+		ignore, err := options.gitIgnore()
+		if err != nil {
+			return err
+		}
+		interval := options.Interval
+		if interval < time.Second {
+			interval = defaultWatchInterval
+		}
+		debounce := options.Debounce
+		if debounce <= 0 {
+			debounce = defaultWatchDebounce
+		}
+
+		// the folder is polled instead of watched with inotify and the like (fsnotify): it sees the changes in the
+		// bind mounts and network filesystems they miss and the new subdirectories too, the same on every OS
+		watcher := fswatch.NewFolderWatcher(options.Dir, true, func(path string) bool {
+			rel, err := filepath.Rel(options.Dir, path)
+			return err == nil && ignore.MatchesPath(rel)
+		}, int(interval/time.Second))
+		watcher.Start()
+		defer watcher.Stop()
+
+		var cancel context.CancelFunc
+		var done chan struct{}
+		run := func() {
+			runCtx, runCancel := context.WithCancel(ctx)
+			cancel, done = runCancel, make(chan struct{})
+			go func(done chan struct{}) {
+				defer close(done)
+				if err := executor(runCtx); err != nil && runCtx.Err() == nil {
+					logger.Error(err)
+				}
+				if runCtx.Err() == nil {
+					logger.Infof("👀  Watching %s for changes", options.Dir)
+				}
+			}(done)
+		}
+		stop := func() {
+			cancel()
+			<-done
+		}
+
+		run()
+		var changed <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				stop()
+				return nil
+			case changes := <-watcher.ChangeDetails():
+				logger.Debugf("%s", changes.String())
+				changed = time.After(debounce)
+			case <-changed:
+				changed = nil
+				logger.Infof("🔁  Files changed in %s, running again", options.Dir)
+				stop()
+				run()
+			}
+		}
+	}
+}
+
+// gitIgnore returns the patterns of the paths whose changes are ignored
+func (o WatchOptions) gitIgnore() (*gitignore.GitIgnore, error) {
+	lines := append([]string{".git/"}, o.Ignore...)
+	file := filepath.Join(o.Dir, ".gitignore")
+	if _, err := os.Stat(file); err != nil {
+		return gitignore.CompileIgnoreLines(lines...)
+	}
+	return gitignore.CompileIgnoreFileAndLines(file, lines...)
+}
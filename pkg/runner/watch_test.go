@@ -0,0 +1,70 @@
+package runner
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestWatchExecutor(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping watch test")
+	}
+
+	dir, err := ioutil.TempDir("", "act-watch")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NilError(t, os.MkdirAll(filepath.Join(dir, "dist"), 0755))
+
+	runs := make(chan context.Context, 10)
+	executor := func(ctx context.Context) error {
+		runs <- ctx
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	nextRun := func(timeout time.Duration) context.Context {
+		select {
+		case run := <-runs:
+			return run
+		case <-time.After(timeout):
+			return nil
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		done <- NewWatchExecutor(WatchOptions{
+			Dir:      dir,
+			Ignore:   []string{"dist/"},
+			Interval: time.Second,
+			Debounce: 100 * time.Millisecond,
+		}, executor)(ctx)
+	}()
+
+	first := nextRun(5 * time.Second)
+	assert.Assert(t, first != nil, "the executor didn't run")
+
+	assert.NilError(t, ioutil.WriteFile(filepath.Join(dir, "dist", "output.txt"), []byte("output"), 0600))
+	assert.Assert(t, nextRun(2500*time.Millisecond) == nil, "a change of an ignored path triggered a run")
+
+	assert.NilError(t, ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte("package main"), 0600))
+	second := nextRun(5 * time.Second)
+	assert.Assert(t, second != nil, "a change didn't trigger a run")
+	assert.Equal(t, context.Canceled, first.Err(), "the run in progress wasn't cancelled")
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NilError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the executor didn't stop watching")
+	}
+	assert.Equal(t, context.Canceled, second.Err())
+}
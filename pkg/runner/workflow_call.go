@@ -0,0 +1,143 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nektos/act/pkg/common"
+	"github.com/nektos/act/pkg/model"
+)
+
+// workflowCallExecutor runs the jobs of the reusable workflow of the repository the job of rc calls
+// (`uses: ./.github/workflows/build.yml`) instead of steps. The `with` and `secrets` of the job are the
+// inputs and secrets of the called workflow, the `on.workflow_call.outputs` of the called workflow are
+// evaluated with the `jobs` context of its jobs once they are done and become the outputs of the job.
+func (runner *runnerImpl) workflowCallExecutor(rc *RunContext) common.Executor {
+	return func(ctx context.Context) error {
+		uses := rc.Run.Job().Uses
+		if !strings.HasPrefix(uses, "./") {
+			return fmt.Errorf("calling the reusable workflow '%s' of another repository is not supported, only the ones of the repository (./.github/workflows/...)", uses)
+		}
+
+		planner, err := model.NewWorkflowPlanner(filepath.Join(runner.config.absWorkdir(), strings.SplitN(uses, "@", 2)[0]), true)
+		if err != nil {
+			return fmt.Errorf("unable to read the reusable workflow '%s': %w", uses, err)
+		}
+		plan := planner.PlanEvent("workflow_call")
+		if len(plan.Stages) == 0 {
+			return fmt.Errorf("'%s' isn't a reusable workflow, it has no on.workflow_call", uses)
+		}
+		workflow := plan.Stages[0].Runs[0].Workflow
+		call := workflow.WorkflowCallConfig()
+		if call == nil {
+			call = &model.WorkflowCall{}
+		}
+
+		inputs, err := rc.workflowCallInputs(call, uses)
+		if err != nil {
+			return err
+		}
+		secrets, err := rc.workflowCallSecrets()
+		if err != nil {
+			return err
+		}
+
+		config := *runner.config
+		config.Secrets = secrets
+		config.JobID = ""
+		called := &runnerImpl{
+			config:         &config,
+			eventJSON:      runner.eventJSON,
+			jobResults:     runner.jobResults,
+			events:         runner.events,
+			secretPatterns: runner.secretPatterns,
+			majorVersions:  runner.majorVersions,
+			jobSlots:       runner.jobSlots,
+			callInputs:     inputs,
+		}
+		common.Logger(ctx).Infof("\U0001F4DE  Call %s", uses)
+		err = called.newStagesExecutor(plan, called.newPlanAbort())(ctx)
+
+		// like on GitHub the outputs are evaluated if a job of the called workflow failed too
+		rc.callOutputs = called.workflowCallOutputs(workflow, call)
+		return err
+	}
+}
+
+// workflowCallInputs returns the inputs of the call to the reusable workflow uses of the job of rc, the
+// interpolated `with` of the job converted to the types the inputs are declared with, else their defaults
+func (rc *RunContext) workflowCallInputs(call *model.WorkflowCall, uses string) (map[string]interface{}, error) {
+	with := rc.Run.Job().With
+	for name := range with {
+		if _, ok := call.Inputs[name]; !ok {
+			return nil, fmt.Errorf("Input '%s' isn't declared by the reusable workflow '%s'", name, uses)
+		}
+	}
+
+	inputs := make(map[string]interface{}, len(call.Inputs))
+	for name, input := range call.Inputs {
+		value, ok := with[name]
+		if ok {
+			value = rc.ExprEval.Interpolate(value)
+		} else if input.Required && input.Default == "" {
+			return nil, fmt.Errorf("Input '%s' is required by the reusable workflow '%s'", name, uses)
+		} else {
+			value = input.Default
+		}
+		typed, err := typedInput(name, input.Type, value, nil)
+		if err != nil {
+			return nil, err
+		}
+		inputs[name] = typed
+	}
+	return inputs, nil
+}
+
+// workflowCallSecrets returns the secrets the job of rc passes to the reusable workflow it calls, all of its
+// secrets with `secrets: inherit`. The GITHUB_TOKEN is always passed.
+func (rc *RunContext) workflowCallSecrets() (map[string]string, error) {
+	passed, inherit, err := rc.Run.Job().Secrets()
+	if err != nil {
+		return nil, err
+	}
+	if inherit {
+		return mergeMaps(rc.secrets()), nil
+	}
+
+	secrets := make(map[string]string, len(passed)+1)
+	if token, ok := rc.secrets()["GITHUB_TOKEN"]; ok {
+		secrets["GITHUB_TOKEN"] = token
+	}
+	// like the secrets of the config the names are upper case, the expressions look them up in it
+	for name, value := range passed {
+		secrets[strings.ToUpper(name)] = rc.ExprEval.Interpolate(value)
+	}
+	return secrets, nil
+}
+
+// workflowCallOutputs evaluates the outputs of the reusable workflow, they see the results and the
+// outputs of its jobs in the `jobs` context
+func (runner *runnerImpl) workflowCallOutputs(workflow *model.Workflow, call *model.WorkflowCall) map[string]string {
+	jobIDs := workflow.GetJobIDs()
+	sort.Strings(jobIDs)
+	jobs := make(map[string]*jobResult, len(jobIDs))
+	for _, jobID := range jobIDs {
+		if result := runner.jobResults.get(workflow, jobID); result != nil {
+			jobs[jobID] = result
+		}
+	}
+
+	rc := runner.newRunContext(&model.Run{Workflow: workflow, JobID: jobIDs[0]}, make(map[string]interface{}), runner.callInputs)
+	vm := rc.newVM()
+	_ = vm.Set("jobs", jobs)
+	exprEval := &expressionEvaluator{vm, rc.Config.logger()}
+
+	outputs := make(map[string]string, len(call.Outputs))
+	for name, output := range call.Outputs {
+		outputs[name] = exprEval.Interpolate(output.Value)
+	}
+	return outputs
+}